@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/subosito/gotenv"
+
+	"github.com/daccred/sorobangraph.attest.so/config"
+	"github.com/daccred/sorobangraph.attest.so/db"
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+func main() {
+	_ = gotenv.Load()
+
+	env := flag.String("e", "development", "application environment (development|production|test)")
+	start := flag.Uint("start", 0, "first ledger to backfill (required)")
+	end := flag.Uint("end", 0, "last ledger to backfill, inclusive (required)")
+	chunkSize := flag.Uint("chunk-size", 10000, "ledgers per chunk")
+	workers := flag.Int("workers", 4, "chunks ingested in parallel, each with its own ledger backend")
+	flag.Parse()
+
+	if *start == 0 || *end < *start {
+		log.Fatal("Usage: go run cmd/backfill/main.go -start <ledger> -end <ledger> [-chunk-size N] [-workers N]")
+	}
+
+	config.Init(*env)
+	cfg := config.GetConfig()
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		databaseURL = os.ExpandEnv(cfg.GetString("database.url"))
+	}
+	if databaseURL == "" || strings.Contains(databaseURL, "${") {
+		log.Fatal("DATABASE_URL environment variable is required")
+	}
+
+	dbConn, err := db.Connect(databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer dbConn.Close()
+	// Each worker holds a database transaction per ledger
+	if *workers+2 > 25 {
+		dbConn.SetMaxOpenConns(*workers + 2)
+	}
+
+	ingCfg, err := config.IngesterConfig(cfg)
+	if err != nil {
+		log.Fatalf("Invalid ingestion configuration: %v", err)
+	}
+
+	logger := logrus.WithField("service", "backfill")
+	backfiller, err := handlers.NewBackfiller(ingCfg, handlers.BackfillConfig{
+		StartLedger: uint32(*start),
+		EndLedger:   uint32(*end),
+		ChunkSize:   uint32(*chunkSize),
+		Workers:     *workers,
+	}, dbConn, logger)
+	if err != nil {
+		log.Fatalf("Failed to create backfiller: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := backfiller.Run(ctx); err != nil {
+		log.Fatalf("Backfill failed: %v", err)
+	}
+	logger.Infof("Backfill of ledgers %d-%d complete (%d ledgers ingested)",
+		*start, *end, backfiller.Stats().LedgersProcessed)
+}
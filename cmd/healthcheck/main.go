@@ -49,7 +49,7 @@ func main() {
 	log.Println("✅ Ingester created successfully!")
 
 	log.Println("Testing controller creation...")
-	ctl := controllers.NewIngesterController(dbConn, ing.Stats())
+	ctl := controllers.NewIngesterController(dbConn, ing)
 	if ctl == nil {
 		log.Fatalf("failed to create controller")
 	}
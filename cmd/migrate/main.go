@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 
 	"github.com/daccred/sorobangraph.attest.so/db"
+	"github.com/daccred/sorobangraph.attest.so/handlers"
 )
 
 func main() {
@@ -65,5 +66,57 @@ func runMigrations(dbConn *sql.DB) error {
 		}
 	}
 
+	// Data changes SQL cannot express run after the schema is in place
+	fmt.Println("Running migration: hex contract IDs to strkeys")
+	if err := encodeHexContractIDs(dbConn); err != nil {
+		return fmt.Errorf("failed to re-encode contract IDs: %w", err)
+	}
+
+	return nil
+}
+
+// encodeHexContractIDs rewrites the contract IDs that versions before
+// strkey normalization stored as hex, in contract_events.contract_id and the
+// contract_id of operation details, to C... strkeys. Rows already in strkey
+// form are left alone, so it is safe to run again.
+func encodeHexContractIDs(dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`
+		SELECT DISTINCT contract_id FROM contract_events WHERE contract_id ~ '^[0-9a-f]{64}$'
+		UNION
+		SELECT DISTINCT details->>'contract_id' FROM operations WHERE details->>'contract_id' ~ '^[0-9a-f]{64}$'`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		strkey, err := handlers.NormalizeContractID(id)
+		if err != nil {
+			return fmt.Errorf("contract %s: %w", id, err)
+		}
+		if _, err := dbConn.Exec(`UPDATE contract_events SET contract_id = $2 WHERE contract_id = $1`, id, strkey); err != nil {
+			return fmt.Errorf("failed to update events of contract %s: %w", id, err)
+		}
+		if _, err := dbConn.Exec(`
+			UPDATE operations SET details = jsonb_set(details, '{contract_id}', to_jsonb($2::text))
+			WHERE details->>'contract_id' = $1`, id, strkey); err != nil {
+			return fmt.Errorf("failed to update operations of contract %s: %w", id, err)
+		}
+	}
+	if len(ids) > 0 {
+		fmt.Printf("Re-encoded %d hex contract IDs\n", len(ids))
+	}
 	return nil
 }
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+// Network defaults selected by NETWORK_MODE
+const (
+	testnetPassphrase = "Test SDF Network ; September 2015"
+	testnetArchiveURL = "https://history.stellar.org/prd/core-testnet/core_testnet_001"
+	mainnetPassphrase = "Public Global Stellar Network ; September 2015"
+	mainnetArchiveURL = "https://history.stellar.org/prd/core-live/core_live_001"
+)
+
+// IngesterConfig builds the ingestion settings shared by the server and
+// cmd/backfill from v. Environment variables take precedence over the
+// configuration files.
+func IngesterConfig(v *viper.Viper) (*handlers.Config, error) {
+	passphrase, archiveURL := testnetPassphrase, testnetArchiveURL
+	if getEnv("NETWORK_MODE", "testnet") == "mainnet" {
+		passphrase, archiveURL = mainnetPassphrase, mainnetArchiveURL
+	}
+
+	cfg := &handlers.Config{
+		NetworkPassphrase:     getEnv("NETWORK_PASSPHRASE", passphrase),
+		CaptiveCoreConfigPath: getEnv("CAPTIVE_CORE_CONFIG_PATH", v.GetString("captive_core.config_path")),
+		CaptiveCoreBinaryPath: getEnv("CAPTIVE_CORE_BINARY_PATH", v.GetString("captive_core.binary_path")),
+		HistoryArchiveURLs:    []string{getEnv("HISTORY_ARCHIVE_URLS", archiveURL)},
+		StartLedger:           uint32(getEnvInt("START_LEDGER", 0)),
+		EndLedger:             uint32(getEnvInt("END_LEDGER", 0)),
+		EnableWebSocket:       getEnv("ENABLE_WEBSOCKET", "true") == "true",
+		LogLevel:              getEnv("LOG_LEVEL", "info"),
+		FilterContracts:       v.GetStringSlice("stellar.filter_contracts"),
+		LedgerBackend:         getEnv("LEDGER_BACKEND", v.GetString("ingestion.backend")),
+		RPCServerURL:          getEnv("RPC_URL", v.GetString("rpc.url")),
+		RPCPageSize:           uint32(getEnvInt("RPC_PAGE_SIZE", v.GetInt("rpc.page_size"))),
+		RPCPollInterval:       v.GetDuration("rpc.poll_interval"),
+		RetryAttempts:         v.GetInt("ingestion.retry_attempts"),
+		RetryDelay:            v.GetDuration("ingestion.retry_delay"),
+		SkipAfterAttempts:     v.GetInt("ingestion.skip_after_attempts"),
+		Datastore: handlers.DatastoreConfig{
+			Type:              getEnv("DATASTORE_TYPE", v.GetString("datastore.type")),
+			Path:              getEnv("DATASTORE_PATH", v.GetString("datastore.path")),
+			Region:            getEnv("DATASTORE_REGION", v.GetString("datastore.region")),
+			EndpointURL:       getEnv("DATASTORE_ENDPOINT_URL", v.GetString("datastore.endpoint_url")),
+			LedgersPerFile:    v.GetUint32("datastore.ledgers_per_file"),
+			FilesPerPartition: v.GetUint32("datastore.files_per_partition"),
+			BufferSize:        v.GetUint32("datastore.buffer_size"),
+			NumWorkers:        v.GetUint32("datastore.num_workers"),
+		},
+		WebSocket: handlers.WebSocketConfig{
+			ReadBufferSize:  v.GetInt("websocket.read_buffer_size"),
+			WriteBufferSize: v.GetInt("websocket.write_buffer_size"),
+			WriteWait:       v.GetDuration("websocket.write_wait"),
+			PongWait:        v.GetDuration("websocket.pong_wait"),
+			PingPeriod:      v.GetDuration("websocket.ping_period"),
+		},
+	}
+
+	// Filter contracts from environment variable (comma-separated) or config
+	if filter := getEnv("FILTER_CONTRACTS", ""); filter != "" {
+		cfg.FilterContracts = strings.Split(filter, ",")
+		for i := range cfg.FilterContracts {
+			cfg.FilterContracts[i] = strings.TrimSpace(cfg.FilterContracts[i])
+		}
+	}
+
+	// Filter expression from environment variable (JSON) or config
+	if expr := getEnv("FILTER_EXPRESSION", ""); expr != "" {
+		if err := json.Unmarshal([]byte(expr), &cfg.Filter); err != nil {
+			return nil, fmt.Errorf("invalid FILTER_EXPRESSION: %w", err)
+		}
+	} else if err := v.UnmarshalKey("stellar.filter", &cfg.Filter); err != nil {
+		return nil, fmt.Errorf("invalid stellar.filter: %w", err)
+	}
+
+	// Decoders of all events of a contract, from environment variable
+	// (C...=decoder,...) or config
+	cfg.EventDecoders = map[string]string{}
+	if decoders := getEnv("EVENT_DECODERS", ""); decoders != "" {
+		for _, pair := range strings.Split(decoders, ",") {
+			contractID, decoder, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid EVENT_DECODERS entry %q, expected CONTRACT_ID=decoder", pair)
+			}
+			cfg.EventDecoders[contractID] = decoder
+		}
+	} else {
+		var decoders []struct {
+			ContractID string `mapstructure:"contract_id"`
+			Decoder    string `mapstructure:"decoder"`
+		}
+		if err := v.UnmarshalKey("stellar.event_decoders", &decoders); err != nil {
+			return nil, fmt.Errorf("invalid stellar.event_decoders: %w", err)
+		}
+		for _, d := range decoders {
+			cfg.EventDecoders[d.ContractID] = d.Decoder
+		}
+	}
+	return cfg, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intVal, err := strconv.Atoi(value); err == nil {
+			return intVal
+		}
+	}
+	return defaultValue
+}
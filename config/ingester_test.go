@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngesterConfig(t *testing.T) {
+	v := viper.New()
+	v.Set("stellar.filter_contracts", []string{"CCONFIG"})
+	v.Set("stellar.event_decoders", []map[string]interface{}{{"contract_id": "CATTEST", "decoder": "attestation"}})
+	v.Set("ingestion.retry_attempts", 2)
+
+	cfg, err := IngesterConfig(v)
+	require.NoError(t, err)
+	assert.Equal(t, testnetPassphrase, cfg.NetworkPassphrase)
+	assert.Equal(t, []string{"CCONFIG"}, cfg.FilterContracts)
+	assert.Equal(t, map[string]string{"CATTEST": "attestation"}, cfg.EventDecoders)
+	assert.Equal(t, 2, cfg.RetryAttempts)
+
+	// Environment variables take precedence
+	t.Setenv("NETWORK_MODE", "mainnet")
+	t.Setenv("FILTER_CONTRACTS", "CA, CB")
+	t.Setenv("EVENT_DECODERS", "CA=attestation")
+	cfg, err = IngesterConfig(v)
+	require.NoError(t, err)
+	assert.Equal(t, mainnetPassphrase, cfg.NetworkPassphrase)
+	assert.Equal(t, []string{"CA", "CB"}, cfg.FilterContracts)
+	assert.Equal(t, map[string]string{"CA": "attestation"}, cfg.EventDecoders)
+
+	t.Setenv("EVENT_DECODERS", "CA")
+	_, err = IngesterConfig(v)
+	assert.Error(t, err)
+	t.Setenv("EVENT_DECODERS", "")
+	t.Setenv("FILTER_EXPRESSION", "{not json")
+	_, err = IngesterConfig(v)
+	assert.Error(t, err)
+}
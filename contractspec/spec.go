@@ -0,0 +1,420 @@
+// Package contractspec reads the contract spec soroban-sdk embeds in the
+// contractspecv0 custom section of a contract's WASM: a sequence of XDR
+// ScSpecEntry values describing the contract's functions, user-defined types
+// and events.
+//
+// Describe gives a readable summary of the spec, with types written as
+//
+//	u32, i128, address, bytes, string, symbol, ...
+//	option<T>, result<T,E>, vec<T>, map<K,V>, tuple<A,B>, bytesn<32>
+//	Name                      a struct, union, enum or error enum of the contract
+//
+// and Args and Native use it to turn invocation arguments into named values,
+// with enums as their case names and structs as objects.
+package contractspec
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+// Spec is a parsed contract spec
+type Spec struct {
+	entries   []xdr.ScSpecEntry
+	functions map[string]xdr.ScSpecFunctionV0
+	types     map[string]xdr.ScSpecEntry
+}
+
+// Section returns the raw contractspecv0 section of a WASM module
+func Section(wasm []byte) ([]byte, error) {
+	return customSection(wasm, SectionName)
+}
+
+// FromWASM parses the spec embedded in a WASM module
+func FromWASM(wasm []byte) (*Spec, error) {
+	raw, err := Section(wasm)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(raw)
+}
+
+// Parse decodes the ScSpecEntry values of a contractspecv0 section
+func Parse(raw []byte) (*Spec, error) {
+	s := &Spec{functions: map[string]xdr.ScSpecFunctionV0{}, types: map[string]xdr.ScSpecEntry{}}
+	r := bytes.NewReader(raw)
+	for r.Len() > 0 {
+		var entry xdr.ScSpecEntry
+		if _, err := xdr.Unmarshal(r, &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode spec entry %d: %w", len(s.entries), err)
+		}
+		s.entries = append(s.entries, entry)
+		switch entry.Kind {
+		case xdr.ScSpecEntryKindScSpecEntryFunctionV0:
+			s.functions[string(entry.FunctionV0.Name)] = *entry.FunctionV0
+		case xdr.ScSpecEntryKindScSpecEntryUdtStructV0:
+			s.types[entry.UdtStructV0.Name] = entry
+		case xdr.ScSpecEntryKindScSpecEntryUdtUnionV0:
+			s.types[entry.UdtUnionV0.Name] = entry
+		case xdr.ScSpecEntryKindScSpecEntryUdtEnumV0:
+			s.types[entry.UdtEnumV0.Name] = entry
+		case xdr.ScSpecEntryKindScSpecEntryUdtErrorEnumV0:
+			s.types[entry.UdtErrorEnumV0.Name] = entry
+		}
+	}
+	return s, nil
+}
+
+// Entries returns the spec entries in the order of the section
+func (s *Spec) Entries() []xdr.ScSpecEntry { return s.entries }
+
+// Function returns the spec of a contract function
+func (s *Spec) Function(name string) (xdr.ScSpecFunctionV0, bool) {
+	fn, ok := s.functions[name]
+	return fn, ok
+}
+
+// Description is the readable form of a spec
+type Description struct {
+	Functions  []Function `json:"functions"`
+	Structs    []Struct   `json:"structs"`
+	Unions     []Union    `json:"unions"`
+	Enums      []Enum     `json:"enums"`
+	ErrorEnums []Enum     `json:"error_enums"`
+	Events     []Event    `json:"events"`
+}
+
+// Function describes a contract function
+type Function struct {
+	Name    string   `json:"name"`
+	Doc     string   `json:"doc,omitempty"`
+	Inputs  []Field  `json:"inputs"`
+	Outputs []string `json:"outputs"`
+}
+
+// Field is a named, typed function input or struct field
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+// Struct describes a struct type
+type Struct struct {
+	Name   string  `json:"name"`
+	Doc    string  `json:"doc,omitempty"`
+	Fields []Field `json:"fields"`
+}
+
+// Union describes a union type; void cases have no types
+type Union struct {
+	Name  string      `json:"name"`
+	Doc   string      `json:"doc,omitempty"`
+	Cases []UnionCase `json:"cases"`
+}
+
+// UnionCase is a case of a union
+type UnionCase struct {
+	Name  string   `json:"name"`
+	Types []string `json:"types,omitempty"`
+	Doc   string   `json:"doc,omitempty"`
+}
+
+// Enum describes an enum or error enum type
+type Enum struct {
+	Name  string     `json:"name"`
+	Doc   string     `json:"doc,omitempty"`
+	Cases []EnumCase `json:"cases"`
+}
+
+// EnumCase is a case of an enum
+type EnumCase struct {
+	Name  string `json:"name"`
+	Value uint32 `json:"value"`
+	Doc   string `json:"doc,omitempty"`
+}
+
+// Event describes an event the contract emits. Params are located in the
+// topics after PrefixTopics or in the data, laid out per DataFormat:
+// "single_value", "vec" or "map".
+type Event struct {
+	Name         string       `json:"name"`
+	Doc          string       `json:"doc,omitempty"`
+	PrefixTopics []string     `json:"prefix_topics"`
+	Params       []EventParam `json:"params"`
+	DataFormat   string       `json:"data_format"`
+}
+
+// EventParam is a param of an event, in the "topic" list or the "data"
+type EventParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Location string `json:"location"`
+	Doc      string `json:"doc,omitempty"`
+}
+
+// Describe returns the readable form of the spec
+func (s *Spec) Describe() Description {
+	d := Description{
+		Functions: []Function{}, Structs: []Struct{}, Unions: []Union{},
+		Enums: []Enum{}, ErrorEnums: []Enum{}, Events: []Event{},
+	}
+	for _, entry := range s.entries {
+		switch entry.Kind {
+		case xdr.ScSpecEntryKindScSpecEntryFunctionV0:
+			fn := entry.FunctionV0
+			f := Function{Name: string(fn.Name), Doc: fn.Doc, Inputs: []Field{}, Outputs: []string{}}
+			for _, input := range fn.Inputs {
+				f.Inputs = append(f.Inputs, Field{Name: input.Name, Type: TypeName(input.Type), Doc: input.Doc})
+			}
+			for _, output := range fn.Outputs {
+				f.Outputs = append(f.Outputs, TypeName(output))
+			}
+			d.Functions = append(d.Functions, f)
+		case xdr.ScSpecEntryKindScSpecEntryUdtStructV0:
+			st := entry.UdtStructV0
+			out := Struct{Name: st.Name, Doc: st.Doc, Fields: []Field{}}
+			for _, field := range st.Fields {
+				out.Fields = append(out.Fields, Field{Name: field.Name, Type: TypeName(field.Type), Doc: field.Doc})
+			}
+			d.Structs = append(d.Structs, out)
+		case xdr.ScSpecEntryKindScSpecEntryUdtUnionV0:
+			union := entry.UdtUnionV0
+			out := Union{Name: union.Name, Doc: union.Doc, Cases: []UnionCase{}}
+			for _, c := range union.Cases {
+				if c.Kind == xdr.ScSpecUdtUnionCaseV0KindScSpecUdtUnionCaseVoidV0 {
+					out.Cases = append(out.Cases, UnionCase{Name: c.VoidCase.Name, Doc: c.VoidCase.Doc})
+					continue
+				}
+				uc := UnionCase{Name: c.TupleCase.Name, Doc: c.TupleCase.Doc}
+				for _, t := range c.TupleCase.Type {
+					uc.Types = append(uc.Types, TypeName(t))
+				}
+				out.Cases = append(out.Cases, uc)
+			}
+			d.Unions = append(d.Unions, out)
+		case xdr.ScSpecEntryKindScSpecEntryUdtEnumV0:
+			enum := entry.UdtEnumV0
+			out := Enum{Name: enum.Name, Doc: enum.Doc, Cases: []EnumCase{}}
+			for _, c := range enum.Cases {
+				out.Cases = append(out.Cases, EnumCase{Name: c.Name, Value: uint32(c.Value), Doc: c.Doc})
+			}
+			d.Enums = append(d.Enums, out)
+		case xdr.ScSpecEntryKindScSpecEntryUdtErrorEnumV0:
+			enum := entry.UdtErrorEnumV0
+			out := Enum{Name: enum.Name, Doc: enum.Doc, Cases: []EnumCase{}}
+			for _, c := range enum.Cases {
+				out.Cases = append(out.Cases, EnumCase{Name: c.Name, Value: uint32(c.Value), Doc: c.Doc})
+			}
+			d.ErrorEnums = append(d.ErrorEnums, out)
+		case xdr.ScSpecEntryKindScSpecEntryEventV0:
+			event := entry.EventV0
+			out := Event{Name: string(event.Name), Doc: event.Doc, PrefixTopics: []string{}, Params: []EventParam{}}
+			for _, topic := range event.PrefixTopics {
+				out.PrefixTopics = append(out.PrefixTopics, string(topic))
+			}
+			for _, param := range event.Params {
+				location := "data"
+				if param.Location == xdr.ScSpecEventParamLocationV0ScSpecEventParamLocationTopicList {
+					location = "topic"
+				}
+				out.Params = append(out.Params, EventParam{Name: param.Name, Type: TypeName(param.Type), Location: location, Doc: param.Doc})
+			}
+			switch event.DataFormat {
+			case xdr.ScSpecEventDataFormatScSpecEventDataFormatVec:
+				out.DataFormat = "vec"
+			case xdr.ScSpecEventDataFormatScSpecEventDataFormatMap:
+				out.DataFormat = "map"
+			default:
+				out.DataFormat = "single_value"
+			}
+			d.Events = append(d.Events, out)
+		}
+	}
+	return d
+}
+
+var typeNames = map[xdr.ScSpecType]string{
+	xdr.ScSpecTypeScSpecTypeVal:          "val",
+	xdr.ScSpecTypeScSpecTypeBool:         "bool",
+	xdr.ScSpecTypeScSpecTypeVoid:         "void",
+	xdr.ScSpecTypeScSpecTypeError:        "error",
+	xdr.ScSpecTypeScSpecTypeU32:          "u32",
+	xdr.ScSpecTypeScSpecTypeI32:          "i32",
+	xdr.ScSpecTypeScSpecTypeU64:          "u64",
+	xdr.ScSpecTypeScSpecTypeI64:          "i64",
+	xdr.ScSpecTypeScSpecTypeTimepoint:    "timepoint",
+	xdr.ScSpecTypeScSpecTypeDuration:     "duration",
+	xdr.ScSpecTypeScSpecTypeU128:         "u128",
+	xdr.ScSpecTypeScSpecTypeI128:         "i128",
+	xdr.ScSpecTypeScSpecTypeU256:         "u256",
+	xdr.ScSpecTypeScSpecTypeI256:         "i256",
+	xdr.ScSpecTypeScSpecTypeBytes:        "bytes",
+	xdr.ScSpecTypeScSpecTypeString:       "string",
+	xdr.ScSpecTypeScSpecTypeSymbol:       "symbol",
+	xdr.ScSpecTypeScSpecTypeAddress:      "address",
+	xdr.ScSpecTypeScSpecTypeMuxedAddress: "muxed_address",
+}
+
+// TypeName writes a spec type in the notation of the package documentation
+func TypeName(t xdr.ScSpecTypeDef) string {
+	switch t.Type {
+	case xdr.ScSpecTypeScSpecTypeOption:
+		return "option<" + TypeName(t.MustOption().ValueType) + ">"
+	case xdr.ScSpecTypeScSpecTypeResult:
+		result := t.MustResult()
+		return "result<" + TypeName(result.OkType) + "," + TypeName(result.ErrorType) + ">"
+	case xdr.ScSpecTypeScSpecTypeVec:
+		return "vec<" + TypeName(t.MustVec().ElementType) + ">"
+	case xdr.ScSpecTypeScSpecTypeMap:
+		m := t.MustMap()
+		return "map<" + TypeName(m.KeyType) + "," + TypeName(m.ValueType) + ">"
+	case xdr.ScSpecTypeScSpecTypeTuple:
+		var names []string
+		for _, v := range t.MustTuple().ValueTypes {
+			names = append(names, TypeName(v))
+		}
+		return "tuple<" + strings.Join(names, ",") + ">"
+	case xdr.ScSpecTypeScSpecTypeBytesN:
+		return fmt.Sprintf("bytesn<%d>", t.MustBytesN().N)
+	case xdr.ScSpecTypeScSpecTypeUdt:
+		return t.MustUdt().Name
+	}
+	if name, ok := typeNames[t.Type]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", t.Type)
+}
+
+// Args names the arguments of a call to fn after its inputs and converts
+// them with Native. It returns false when fn is not in the spec or the
+// number of arguments does not match its inputs.
+func (s *Spec) Args(fn string, args []xdr.ScVal) (map[string]interface{}, bool) {
+	f, ok := s.functions[fn]
+	if !ok || len(f.Inputs) != len(args) {
+		return nil, false
+	}
+	named := make(map[string]interface{}, len(args))
+	for idx, input := range f.Inputs {
+		named[input.Name] = s.Native(args[idx], input.Type)
+	}
+	return named, true
+}
+
+// Native converts a value of spec type t like scval.ToNative, except that
+// enums become their case names, unions {"Case": value} or the case name of
+// void cases, and tuple structs objects keyed by field name. Values that do
+// not have the shape of t fall back to scval.ToNative.
+func (s *Spec) Native(val xdr.ScVal, t xdr.ScSpecTypeDef) interface{} {
+	switch t.Type {
+	case xdr.ScSpecTypeScSpecTypeOption:
+		if val.Type == xdr.ScValTypeScvVoid {
+			return nil
+		}
+		return s.Native(val, t.MustOption().ValueType)
+	case xdr.ScSpecTypeScSpecTypeVec:
+		if vec, ok := val.GetVec(); ok && vec != nil {
+			items := make([]interface{}, len(*vec))
+			for idx, item := range *vec {
+				items[idx] = s.Native(item, t.MustVec().ElementType)
+			}
+			return items
+		}
+	case xdr.ScSpecTypeScSpecTypeTuple:
+		types := t.MustTuple().ValueTypes
+		if vec, ok := val.GetVec(); ok && vec != nil && len(*vec) == len(types) {
+			items := make([]interface{}, len(*vec))
+			for idx, item := range *vec {
+				items[idx] = s.Native(item, types[idx])
+			}
+			return items
+		}
+	case xdr.ScSpecTypeScSpecTypeMap:
+		if m, ok := val.GetMap(); ok && m != nil {
+			obj := make(map[string]interface{}, len(*m))
+			for _, entry := range *m {
+				obj[scval.String(entry.Key)] = s.Native(entry.Val, t.MustMap().ValueType)
+			}
+			return obj
+		}
+	case xdr.ScSpecTypeScSpecTypeUdt:
+		if converted, ok := s.udt(val, t.MustUdt().Name); ok {
+			return converted
+		}
+	}
+	return scval.ToNative(val)
+}
+
+func (s *Spec) udt(val xdr.ScVal, name string) (interface{}, bool) {
+	entry, ok := s.types[name]
+	if !ok {
+		return nil, false
+	}
+	switch entry.Kind {
+	case xdr.ScSpecEntryKindScSpecEntryUdtStructV0:
+		fields := entry.UdtStructV0.Fields
+		obj := make(map[string]interface{}, len(fields))
+		if m, ok := val.GetMap(); ok && m != nil {
+			byName := make(map[string]xdr.ScVal, len(*m))
+			for _, e := range *m {
+				byName[scval.String(e.Key)] = e.Val
+			}
+			for _, field := range fields {
+				if v, ok := byName[field.Name]; ok {
+					obj[field.Name] = s.Native(v, field.Type)
+				}
+			}
+			return obj, true
+		}
+		// Tuple structs are vecs of their fields, named "0", "1", ...
+		if vec, ok := val.GetVec(); ok && vec != nil && len(*vec) == len(fields) {
+			for idx, field := range fields {
+				obj[field.Name] = s.Native((*vec)[idx], field.Type)
+			}
+			return obj, true
+		}
+	case xdr.ScSpecEntryKindScSpecEntryUdtEnumV0:
+		if v, ok := val.GetU32(); ok {
+			for _, c := range entry.UdtEnumV0.Cases {
+				if c.Value == v {
+					return c.Name, true
+				}
+			}
+		}
+	case xdr.ScSpecEntryKindScSpecEntryUdtUnionV0:
+		vec, ok := val.GetVec()
+		if !ok || vec == nil || len(*vec) == 0 {
+			return nil, false
+		}
+		caseName, ok := (*vec)[0].GetSym()
+		if !ok {
+			return nil, false
+		}
+		for _, c := range entry.UdtUnionV0.Cases {
+			if c.Kind == xdr.ScSpecUdtUnionCaseV0KindScSpecUdtUnionCaseVoidV0 {
+				if c.VoidCase.Name == string(caseName) && len(*vec) == 1 {
+					return c.VoidCase.Name, true
+				}
+				continue
+			}
+			types := c.TupleCase.Type
+			if c.TupleCase.Name != string(caseName) || len(*vec)-1 != len(types) {
+				continue
+			}
+			values := make([]interface{}, len(types))
+			for idx, t := range types {
+				values[idx] = s.Native((*vec)[idx+1], t)
+			}
+			if len(values) == 1 {
+				return map[string]interface{}{c.TupleCase.Name: values[0]}, true
+			}
+			return map[string]interface{}{c.TupleCase.Name: values}, true
+		}
+	}
+	return nil, false
+}
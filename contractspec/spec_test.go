@@ -0,0 +1,211 @@
+package contractspec
+
+import (
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func typeDef(t xdr.ScSpecType) xdr.ScSpecTypeDef { return xdr.ScSpecTypeDef{Type: t} }
+
+func udt(name string) xdr.ScSpecTypeDef {
+	return xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeUdt, Udt: &xdr.ScSpecTypeUdt{Name: name}}
+}
+
+func sym(s string) xdr.ScVal {
+	v := xdr.ScSymbol(s)
+	return xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &v}
+}
+
+func u32(v uint32) xdr.ScVal {
+	x := xdr.Uint32(v)
+	return xdr.ScVal{Type: xdr.ScValTypeScvU32, U32: &x}
+}
+
+func vec(values ...xdr.ScVal) xdr.ScVal {
+	v := xdr.ScVec(values)
+	ptr := &v
+	return xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &ptr}
+}
+
+func scMap(fields ...interface{}) xdr.ScVal {
+	var m xdr.ScMap
+	for idx := 0; idx < len(fields); idx += 2 {
+		m = append(m, xdr.ScMapEntry{Key: sym(fields[idx].(string)), Val: fields[idx+1].(xdr.ScVal)})
+	}
+	ptr := &m
+	return xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &ptr}
+}
+
+// wasmWithSection builds a WASM module of a type section and a custom section
+func wasmWithSection(t *testing.T, name string, entries ...xdr.ScSpecEntry) []byte {
+	var payload []byte
+	for _, entry := range entries {
+		b, err := entry.MarshalBinary()
+		require.NoError(t, err)
+		payload = append(payload, b...)
+	}
+	custom := append([]byte{byte(len(name))}, name...)
+	custom = append(custom, payload...)
+	wasm := append([]byte{}, wasmHeader...)
+	wasm = append(wasm, 1, 1, 0)
+	wasm = append(wasm, 0)
+	wasm = append(wasm, leb128(len(custom))...)
+	return append(wasm, custom...)
+}
+
+func leb128(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func attestSpec() []xdr.ScSpecEntry {
+	bytes32 := xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeBytesN, BytesN: &xdr.ScSpecTypeBytesN{N: 32}}
+	optionU64 := xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeOption, Option: &xdr.ScSpecTypeOption{ValueType: typeDef(xdr.ScSpecTypeScSpecTypeU64)}}
+	return []xdr.ScSpecEntry{
+		{Kind: xdr.ScSpecEntryKindScSpecEntryUdtStructV0, UdtStructV0: &xdr.ScSpecUdtStructV0{
+			Name: "Schema",
+			Fields: []xdr.ScSpecUdtStructFieldV0{
+				{Name: "definition", Type: typeDef(xdr.ScSpecTypeScSpecTypeString)},
+				{Name: "level", Type: udt("Level")},
+			},
+		}},
+		{Kind: xdr.ScSpecEntryKindScSpecEntryUdtEnumV0, UdtEnumV0: &xdr.ScSpecUdtEnumV0{
+			Name:  "Level",
+			Cases: []xdr.ScSpecUdtEnumCaseV0{{Name: "Low", Value: 0}, {Name: "High", Value: 1}},
+		}},
+		{Kind: xdr.ScSpecEntryKindScSpecEntryUdtUnionV0, UdtUnionV0: &xdr.ScSpecUdtUnionV0{
+			Name: "Expiry",
+			Cases: []xdr.ScSpecUdtUnionCaseV0{
+				{Kind: xdr.ScSpecUdtUnionCaseV0KindScSpecUdtUnionCaseVoidV0, VoidCase: &xdr.ScSpecUdtUnionCaseVoidV0{Name: "Never"}},
+				{Kind: xdr.ScSpecUdtUnionCaseV0KindScSpecUdtUnionCaseTupleV0, TupleCase: &xdr.ScSpecUdtUnionCaseTupleV0{
+					Name: "At", Type: []xdr.ScSpecTypeDef{typeDef(xdr.ScSpecTypeScSpecTypeU64)},
+				}},
+			},
+		}},
+		{Kind: xdr.ScSpecEntryKindScSpecEntryFunctionV0, FunctionV0: &xdr.ScSpecFunctionV0{
+			Name: "attest",
+			Doc:  "Attests to a subject",
+			Inputs: []xdr.ScSpecFunctionInputV0{
+				{Name: "schema", Type: udt("Schema")},
+				{Name: "expiry", Type: udt("Expiry")},
+				{Name: "nonce", Type: optionU64},
+			},
+			Outputs: []xdr.ScSpecTypeDef{bytes32},
+		}},
+		{Kind: xdr.ScSpecEntryKindScSpecEntryEventV0, EventV0: &xdr.ScSpecEventV0{
+			Name:         "attested",
+			PrefixTopics: []xdr.ScSymbol{"attest"},
+			Params: []xdr.ScSpecEventParamV0{
+				{Name: "uid", Type: bytes32, Location: xdr.ScSpecEventParamLocationV0ScSpecEventParamLocationTopicList},
+				{Name: "schema", Type: udt("Schema")},
+			},
+			DataFormat: xdr.ScSpecEventDataFormatScSpecEventDataFormatMap,
+		}},
+	}
+}
+
+func TestFromWASM(t *testing.T) {
+	spec, err := FromWASM(wasmWithSection(t, SectionName, attestSpec()...))
+	require.NoError(t, err)
+	assert.Len(t, spec.Entries(), 5)
+	fn, ok := spec.Function("attest")
+	require.True(t, ok)
+	assert.Len(t, fn.Inputs, 3)
+
+	_, err = FromWASM(wasmWithSection(t, "contractmetav0"))
+	assert.ErrorIs(t, err, ErrNoSpec)
+	_, err = FromWASM(make([]byte, 16))
+	assert.ErrorIs(t, err, ErrNotWASM)
+	truncated := wasmWithSection(t, SectionName, attestSpec()...)
+	_, err = FromWASM(truncated[:len(truncated)-3])
+	assert.ErrorIs(t, err, ErrNotWASM)
+}
+
+func TestDescribe(t *testing.T) {
+	spec, err := FromWASM(wasmWithSection(t, SectionName, attestSpec()...))
+	require.NoError(t, err)
+	d := spec.Describe()
+
+	require.Len(t, d.Functions, 1)
+	assert.Equal(t, Function{
+		Name: "attest",
+		Doc:  "Attests to a subject",
+		Inputs: []Field{
+			{Name: "schema", Type: "Schema"},
+			{Name: "expiry", Type: "Expiry"},
+			{Name: "nonce", Type: "option<u64>"},
+		},
+		Outputs: []string{"bytesn<32>"},
+	}, d.Functions[0])
+	assert.Equal(t, []Struct{{Name: "Schema", Fields: []Field{{Name: "definition", Type: "string"}, {Name: "level", Type: "Level"}}}}, d.Structs)
+	assert.Equal(t, []Union{{Name: "Expiry", Cases: []UnionCase{{Name: "Never"}, {Name: "At", Types: []string{"u64"}}}}}, d.Unions)
+	assert.Equal(t, []Enum{{Name: "Level", Cases: []EnumCase{{Name: "Low", Value: 0}, {Name: "High", Value: 1}}}}, d.Enums)
+	assert.Empty(t, d.ErrorEnums)
+	assert.Equal(t, []Event{{
+		Name:         "attested",
+		PrefixTopics: []string{"attest"},
+		Params:       []EventParam{{Name: "uid", Type: "bytesn<32>", Location: "topic"}, {Name: "schema", Type: "Schema", Location: "data"}},
+		DataFormat:   "map",
+	}}, d.Events)
+}
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		def  xdr.ScSpecTypeDef
+		want string
+	}{
+		{typeDef(xdr.ScSpecTypeScSpecTypeAddress), "address"},
+		{xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeVec, Vec: &xdr.ScSpecTypeVec{ElementType: udt("Schema")}}, "vec<Schema>"},
+		{xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeMap, Map: &xdr.ScSpecTypeMap{
+			KeyType: typeDef(xdr.ScSpecTypeScSpecTypeSymbol), ValueType: typeDef(xdr.ScSpecTypeScSpecTypeI128)}}, "map<symbol,i128>"},
+		{xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeTuple, Tuple: &xdr.ScSpecTypeTuple{
+			ValueTypes: []xdr.ScSpecTypeDef{typeDef(xdr.ScSpecTypeScSpecTypeU32), typeDef(xdr.ScSpecTypeScSpecTypeBool)}}}, "tuple<u32,bool>"},
+		{xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeResult, Result: &xdr.ScSpecTypeResult{
+			OkType: typeDef(xdr.ScSpecTypeScSpecTypeVoid), ErrorType: typeDef(xdr.ScSpecTypeScSpecTypeError)}}, "result<void,error>"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TypeName(tt.def))
+	}
+}
+
+func TestArgs(t *testing.T) {
+	spec, err := FromWASM(wasmWithSection(t, SectionName, attestSpec()...))
+	require.NoError(t, err)
+	definition := xdr.ScString("name:string")
+	schema := scMap("definition", xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &definition}, "level", u32(1))
+	never := xdr.ScVal{Type: xdr.ScValTypeScvVoid}
+	at := xdr.Uint64(1700000000)
+
+	args, ok := spec.Args("attest", []xdr.ScVal{schema, vec(sym("Never")), never})
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{
+		"schema": map[string]interface{}{"definition": "name:string", "level": "High"},
+		"expiry": "Never",
+		"nonce":  nil,
+	}, args)
+
+	args, ok = spec.Args("attest", []xdr.ScVal{schema, vec(sym("At"), xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &at}), never})
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"At": "1700000000"}, args["expiry"])
+
+	// Values that do not match their type keep their plain form
+	args, ok = spec.Args("attest", []xdr.ScVal{u32(7), vec(sym("Later")), never})
+	require.True(t, ok)
+	assert.Equal(t, uint32(7), args["schema"])
+	assert.Equal(t, []interface{}{"Later"}, args["expiry"])
+
+	_, ok = spec.Args("attest", []xdr.ScVal{schema})
+	assert.False(t, ok)
+	_, ok = spec.Args("revoke", nil)
+	assert.False(t, ok)
+}
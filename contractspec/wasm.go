@@ -0,0 +1,68 @@
+package contractspec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// SectionName is the WASM custom section soroban-sdk writes the spec to
+const SectionName = "contractspecv0"
+
+var (
+	// ErrNotWASM is returned for code that is not a WASM module
+	ErrNotWASM = errors.New("not a WASM module")
+	// ErrNoSpec is returned for WASM without a contractspecv0 section
+	ErrNoSpec = errors.New("no contract spec in WASM")
+)
+
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// customSection returns the payload of the named custom section of a WASM
+// module. Other sections are skipped without being parsed.
+func customSection(wasm []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(wasm, wasmHeader) {
+		return nil, ErrNotWASM
+	}
+	rest := wasm[len(wasmHeader):]
+	for len(rest) > 0 {
+		id := rest[0]
+		size, n, err := uleb128(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		start := 1 + n
+		if uint64(len(rest)-start) < size {
+			return nil, fmt.Errorf("%w: section %d overruns the module", ErrNotWASM, id)
+		}
+		payload := rest[start : start+int(size)]
+		rest = rest[start+int(size):]
+		if id != 0 {
+			continue
+		}
+		nameLen, n, err := uleb128(payload)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(payload)-n) < nameLen {
+			return nil, fmt.Errorf("%w: custom section name overruns the section", ErrNotWASM)
+		}
+		if string(payload[n:n+int(nameLen)]) == name {
+			return payload[n+int(nameLen):], nil
+		}
+	}
+	return nil, ErrNoSpec
+}
+
+// uleb128 decodes an unsigned LEB128 number of at most 32 bits, returning
+// it with the number of bytes read
+func uleb128(b []byte) (uint64, int, error) {
+	var result uint64
+	for idx := 0; idx < len(b) && idx < 5; idx++ {
+		result |= uint64(b[idx]&0x7f) << (7 * idx)
+		if b[idx]&0x80 == 0 {
+			return result, idx + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: invalid LEB128 length", ErrNotWASM)
+}
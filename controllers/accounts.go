@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAccount returns the latest state of an account: balance, liabilities,
+// signers, thresholds, flags and home domain
+func (ic *IngesterController) GetAccount(c *gin.Context) {
+	account, err := handlers.GetAccount(c.Request.Context(), ic.db, c.Param("id"))
+	if err != nil {
+		accountError(c, err, "Failed to fetch account")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": account})
+}
+
+// GetAccountHistory lists the states an account went through, newest first
+func (ic *IngesterController) GetAccountHistory(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	history, err := handlers.AccountHistory(c.Request.Context(), ic.db, c.Param("id"), limit, offset)
+	if err != nil {
+		accountError(c, err, "Failed to fetch account history")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": history})
+}
+
+func accountError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, handlers.ErrInvalidAccountID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid account ID"})
+	case errors.Is(err, handlers.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Account not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": message})
+	}
+}
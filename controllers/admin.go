@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/gin-gonic/gin"
+)
+
+// repairRequest selects the ranges to re-ingest: explicit ranges when given,
+// otherwise every gap found between from and to
+type repairRequest struct {
+	From   uint32             `json:"from"`
+	To     uint32             `json:"to"`
+	Ranges []models.LedgerGap `json:"ranges"`
+}
+
+// filterRequest adds a contract to the ingestion filter, optionally
+// re-ingesting history from BackfillFrom
+type filterRequest struct {
+	ContractID   string `json:"contract_id" binding:"required"`
+	Label        string `json:"label"`
+	BackfillFrom uint32 `json:"backfill_from"`
+}
+
+// GetGaps reports missing ledgers, broken hash links, ledgers the live
+// ingester failed on, and the state of scheduled repairs. Optional from and
+// to query parameters bound the scan.
+func (ic *IngesterController) GetGaps(c *gin.Context) {
+	from, to, ok := ledgerBounds(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	gaps, err := handlers.FindLedgerGaps(ctx, ic.db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to scan for gaps"})
+		return
+	}
+	failures, err := ic.ingester.LedgerFailures(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch ledger failures"})
+		return
+	}
+	repairs, err := ic.ingester.RepairChunks(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch repairs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"gaps":     gaps,
+		"failures": failures,
+		"repairs":  repairs,
+	}})
+}
+
+// RepairGaps schedules re-ingestion of the requested ranges, or of every gap
+// in from..to when no ranges are given
+func (ic *IngesterController) RepairGaps(c *gin.Context) {
+	var req repairRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+			return
+		}
+	}
+	ctx := c.Request.Context()
+
+	gaps := req.Ranges
+	if len(gaps) == 0 {
+		if req.To > 0 && req.To < req.From {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "from must not exceed to"})
+			return
+		}
+		found, err := handlers.FindLedgerGaps(ctx, ic.db, req.From, req.To)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to scan for gaps"})
+			return
+		}
+		gaps = found
+	}
+	for idx := range gaps {
+		if gaps[idx].Start == 0 || gaps[idx].End < gaps[idx].Start {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid ledger range"})
+			return
+		}
+		if gaps[idx].Reason == "" {
+			gaps[idx].Reason = handlers.GapMissing
+		}
+	}
+	if len(gaps) == 0 {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"scheduled": []models.LedgerGap{}}})
+		return
+	}
+
+	if err := ic.ingester.ScheduleRepair(ctx, gaps); err != nil {
+		if errors.Is(err, handlers.ErrNoLedgerBackend) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "No ledger backend configured"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to schedule repair"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": gin.H{"scheduled": gaps}})
+}
+
+// ledgerBounds parses the optional from and to query parameters, writing a
+// 400 response when they are invalid
+func ledgerBounds(c *gin.Context) (uint32, uint32, bool) {
+	var bounds [2]uint32
+	for idx, key := range []string{"from", "to"} {
+		raw := c.Query(key)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + key + " ledger"})
+			return 0, 0, false
+		}
+		bounds[idx] = uint32(v)
+	}
+	if bounds[1] > 0 && bounds[1] < bounds[0] {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "from must not exceed to"})
+		return 0, 0, false
+	}
+	return bounds[0], bounds[1], true
+}
+
+// GetFilters lists the contracts the ingester keeps data for
+func (ic *IngesterController) GetFilters(c *gin.Context) {
+	filters, err := ic.ingester.ContractFilters(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch contract filters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": filters})
+}
+
+// AddFilter adds a contract to the ingestion filter. The ingester applies it
+// from the next ledger; with backfill_from, earlier ledgers are re-ingested.
+func (ic *IngesterController) AddFilter(c *gin.Context) {
+	var req filterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+	filter, scheduled, err := ic.ingester.AddFilterContract(c.Request.Context(), req.ContractID, req.Label, req.BackfillFrom)
+	switch {
+	case errors.Is(err, handlers.ErrInvalidContractID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+		return
+	case errors.Is(err, handlers.ErrInvalidLedgerRange):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	case errors.Is(err, handlers.ErrNoLedgerBackend):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "No ledger backend configured for backfill"})
+		return
+	case errors.Is(err, handlers.ErrFilterNotActive):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "No filter is active and all data is ingested; configure a filter before adding contracts"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to add contract filter"})
+		return
+	}
+	if scheduled == nil {
+		scheduled = []models.LedgerGap{}
+	}
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"filter": filter, "backfill": scheduled}})
+}
+
+// RemoveFilter removes a contract added through AddFilter
+func (ic *IngesterController) RemoveFilter(c *gin.Context) {
+	err := ic.ingester.RemoveFilterContract(c.Request.Context(), c.Param("contract_id"))
+	switch {
+	case errors.Is(err, handlers.ErrInvalidContractID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+	case errors.Is(err, handlers.ErrFilterContractNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Contract is not in the filter"})
+	case errors.Is(err, handlers.ErrFilterContractFixed):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Contract is set in the configuration and cannot be removed at runtime"})
+	case errors.Is(err, handlers.ErrLastFilterContract):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Contract is the last one in the filter; removing it would ingest all data"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to remove contract filter"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// GetDecoders lists the registered event decoders with the topics and
+// contracts they decode
+func (ic *IngesterController) GetDecoders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": ic.ingester.Decoders().Decoders()})
+}
+
+// RedecodeEvents decodes stored contract events again with the current
+// decoders, optionally only with one decoder, for one contract or in a
+// ledger range
+func (ic *IngesterController) RedecodeEvents(c *gin.Context) {
+	var req handlers.RedecodeQuery
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+			return
+		}
+	}
+	result, err := ic.ingester.RedecodeEvents(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, handlers.ErrUnknownDecoder):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Unknown decoder"})
+	case errors.Is(err, handlers.ErrInvalidContractID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+	case errors.Is(err, handlers.ErrInvalidLedgerRange):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "from must not exceed to"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to decode events"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+	}
+}
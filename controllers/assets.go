@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAssets lists the assets seen in trustlines, payments, offers and asset
+// contract deployments, optionally filtered by code
+func (ic *IngesterController) GetAssets(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	assets, err := handlers.ListAssets(c.Request.Context(), ic.db, c.Query("code"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch assets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assets})
+}
+
+// GetAssetHolders lists the balances of an asset given as CODE:ISSUER or
+// native, largest first
+func (ic *IngesterController) GetAssetHolders(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	holders, err := handlers.AssetHolders(c.Request.Context(), ic.db, c.Param("asset"), limit, offset)
+	if errors.Is(err, handlers.ErrInvalidAsset) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid asset, expected CODE:ISSUER or native"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch asset holders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": holders})
+}
+
+// GetAccountBalances lists an account's native balance and trustlines
+func (ic *IngesterController) GetAccountBalances(c *gin.Context) {
+	balances, err := handlers.AccountBalances(c.Request.Context(), ic.db, c.Param("id"))
+	if err != nil {
+		accountError(c, err, "Failed to fetch account balances")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": balances})
+}
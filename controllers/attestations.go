@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAttestations lists attestations, optionally filtered by subject,
+// attester, schema_uid, contract_id and revoked
+func (ic *IngesterController) GetAttestations(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	q := handlers.AttestationQuery{
+		ContractID: c.Query("contract_id"),
+		SchemaUID:  c.Query("schema_uid"),
+		Attester:   c.Query("attester"),
+		Subject:    c.Query("subject"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	if value := c.Query("revoked"); value != "" {
+		revoked, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid revoked, expected true or false"})
+			return
+		}
+		q.Revoked = &revoked
+	}
+	attestations, err := handlers.ListAttestations(c.Request.Context(), ic.db, q)
+	if err != nil {
+		attestationError(c, err, "Failed to fetch attestations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": attestations})
+}
+
+// GetAttestation returns an attestation by UID, of the contract given by
+// contract_id when the UID is used by several
+func (ic *IngesterController) GetAttestation(c *gin.Context) {
+	attestation, err := handlers.GetAttestation(c.Request.Context(), ic.db, c.Param("uid"), c.Query("contract_id"))
+	if err != nil {
+		attestationError(c, err, "Failed to fetch attestation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": attestation})
+}
+
+// GetSchemas lists registered schemas, optionally filtered by contract_id and
+// authority
+func (ic *IngesterController) GetSchemas(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	schemas, err := handlers.ListSchemas(c.Request.Context(), ic.db, c.Query("contract_id"), c.Query("authority"), limit, offset)
+	if err != nil {
+		attestationError(c, err, "Failed to fetch schemas")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schemas})
+}
+
+// GetSchema returns a schema by UID, of the contract given by contract_id
+// when the UID is used by several
+func (ic *IngesterController) GetSchema(c *gin.Context) {
+	schema, err := handlers.GetSchema(c.Request.Context(), ic.db, c.Param("uid"), c.Query("contract_id"))
+	if err != nil {
+		attestationError(c, err, "Failed to fetch schema")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schema})
+}
+
+func attestationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, handlers.ErrInvalidUID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid UID, expected 32 hex-encoded bytes"})
+	case errors.Is(err, handlers.ErrInvalidAddress):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid address"})
+	case errors.Is(err, handlers.ErrInvalidContractID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+	case errors.Is(err, handlers.ErrAttestationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Attestation not found"})
+	case errors.Is(err, handlers.ErrSchemaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Schema not found"})
+	case errors.Is(err, handlers.ErrAmbiguousUID):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "UID is used by several contracts, select one with contract_id"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": message})
+	}
+}
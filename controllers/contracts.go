@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetContractStorage lists a contract's storage entries. With ledger set the
+// entries live as of that ledger are returned, otherwise the latest ones;
+// durability restricts them to persistent or temporary entries.
+func (ic *IngesterController) GetContractStorage(c *gin.Context) {
+	ledger, ok := ledgerParam(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	durability := c.Query("durability")
+	if durability != "" && durability != handlers.DurabilityPersistent && durability != handlers.DurabilityTemporary {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "durability must be persistent or temporary"})
+		return
+	}
+
+	entries, err := handlers.ContractStorage(c.Request.Context(), ic.db, c.Param("contract_id"), handlers.ContractStorageQuery{
+		Ledger:     ledger,
+		Durability: durability,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		contractStateError(c, err, "Failed to fetch contract storage")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
+
+// GetContractStorageEntry returns one storage entry by the hex SHA-256 of
+// its ledger key, optionally as of a ledger
+func (ic *IngesterController) GetContractStorageEntry(c *gin.Context) {
+	ledger, ok := ledgerParam(c)
+	if !ok {
+		return
+	}
+	keyHash, ok := hashParam(c, "key_hash")
+	if !ok {
+		return
+	}
+	entry, err := handlers.ContractStorageEntry(c.Request.Context(), ic.db, c.Param("contract_id"), keyHash, ledger)
+	if err != nil {
+		contractStateError(c, err, "Failed to fetch contract storage entry")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+// GetContract returns the executable a contract runs and, for WASM
+// contracts, the spec of its WASM
+func (ic *IngesterController) GetContract(c *gin.Context) {
+	contract, err := handlers.GetContract(c.Request.Context(), ic.db, c.Param("contract_id"))
+	if err != nil {
+		contractStateError(c, err, "Failed to fetch contract")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": contract})
+}
+
+// GetContractCode describes an uploaded WASM by its hash
+func (ic *IngesterController) GetContractCode(c *gin.Context) {
+	wasmHash, ok := hashParam(c, "wasm_hash")
+	if !ok {
+		return
+	}
+	code, err := handlers.GetContractCode(c.Request.Context(), ic.db, wasmHash)
+	if err != nil {
+		contractStateError(c, err, "Failed to fetch contract code")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": code})
+}
+
+// contractStateError maps errors of the contract state handlers to responses
+func contractStateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, handlers.ErrInvalidContractID):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+	case errors.Is(err, handlers.ErrLedgerNotIngested):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Ledger has not been ingested"})
+	case errors.Is(err, handlers.ErrContractDataNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Storage entry not found"})
+	case errors.Is(err, handlers.ErrContractNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Contract not found"})
+	case errors.Is(err, handlers.ErrContractCodeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Contract code not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": message})
+	}
+}
+
+// pageParams parses the limit and offset query parameters, writing a 400
+// response when they are invalid
+func pageParams(c *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageLimit)))
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "limit must be between 1 and 1000"})
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid offset"})
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+// ledgerParam parses the optional ledger query parameter, writing a 400
+// response when it is invalid
+func ledgerParam(c *gin.Context) (uint32, bool) {
+	raw := c.Query("ledger")
+	if raw == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil || v == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid ledger"})
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// hashParam reads a 32-byte hex hash path parameter in lower case, writing a
+// 400 response when it is malformed
+func hashParam(c *gin.Context, name string) (string, bool) {
+	value := strings.ToLower(c.Param(name))
+	if raw, err := hex.DecodeString(value); err != nil || len(raw) != 32 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + name})
+		return "", false
+	}
+	return value, true
+}
+
+// timeRange adds conditions on column for the optional start_time and
+// end_time query parameters, RFC 3339 times that bound the range inclusively,
+// writing a 400 response when either is invalid
+func timeRange(c *gin.Context, column string, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	for _, bound := range []struct{ param, op string }{{"start_time", ">="}, {"end_time", "<="}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid " + bound.param})
+			return nil, nil, false
+		}
+		args = append(args, t.UTC())
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", column, bound.op, len(args)))
+	}
+	return conditions, args, true
+}
+
+// whereClause joins conditions into a WHERE clause, empty without conditions
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
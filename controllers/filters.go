@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTopics is the number of topics a Soroban event can have
+const maxTopics = 4
+
+var memoTypes = map[string]bool{"none": true, "text": true, "id": true, "hash": true, "return": true}
+
+// ledgerRange adds conditions on column for the optional start_ledger and
+// end_ledger query parameters, which bound the range inclusively, writing a
+// 400 response when either is invalid
+func ledgerRange(c *gin.Context, column string, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	var bounds [2]uint64
+	for idx, bound := range []struct{ param, op string }{{"start_ledger", ">="}, {"end_ledger", "<="}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || v == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": bound.param + " must be a ledger sequence"})
+			return nil, nil, false
+		}
+		bounds[idx] = v
+		args = append(args, int64(v))
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", column, bound.op, len(args)))
+	}
+	if bounds[0] != 0 && bounds[1] != 0 && bounds[0] > bounds[1] {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "start_ledger must not be after end_ledger"})
+		return nil, nil, false
+	}
+	return conditions, args, true
+}
+
+// boolParam parses an optional boolean query parameter, writing a 400
+// response when it is invalid
+func boolParam(c *gin.Context, name string) (*bool, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, true
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": name + " must be true or false"})
+		return nil, false
+	}
+	return &v, true
+}
+
+// accountParam parses an optional G... or M... account query parameter into
+// its G... address, writing a 400 response when it is invalid
+func accountParam(c *gin.Context, name string) (string, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return "", true
+	}
+	account, err := handlers.NormalizeAccountID(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": name + " must be a G... or M... account"})
+		return "", false
+	}
+	return account, true
+}
+
+// memoFilter adds conditions for the optional memo_type and memo query
+// parameters of transactions, writing a 400 response when memo_type is invalid
+func memoFilter(c *gin.Context, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	if memoType := c.Query("memo_type"); memoType != "" {
+		if !memoTypes[memoType] {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "memo_type must be none, text, id, hash or return"})
+			return nil, nil, false
+		}
+		if memoType == "none" {
+			conditions = append(conditions, "COALESCE(memo_type, '') = ''")
+		} else {
+			args = append(args, memoType)
+			conditions = append(conditions, fmt.Sprintf("memo_type = $%d", len(args)))
+		}
+	}
+	if memo := c.Query("memo"); memo != "" {
+		args = append(args, memo)
+		conditions = append(conditions, fmt.Sprintf("memo_value = $%d", len(args)))
+	}
+	return conditions, args, true
+}
+
+// operationTypes parses the comma-separated type query parameter of
+// operations, writing a 400 response for unknown types
+func operationTypes(c *gin.Context) ([]string, bool) {
+	raw := c.Query("type")
+	if raw == "" {
+		return nil, true
+	}
+	types := strings.Split(raw, ",")
+	for idx, opType := range types {
+		types[idx] = strings.TrimSpace(opType)
+		if !handlers.KnownOperationType(types[idx]) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": fmt.Sprintf("unknown operation type %q", types[idx])})
+			return nil, false
+		}
+	}
+	return types, true
+}
+
+// topicFilter adds conditions for the topic0 to topic3 query parameters,
+// each matching the topic at its position in the JSONB topics column
+func topicFilter(c *gin.Context, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	for position := 0; position < maxTopics; position++ {
+		topic, ok := c.GetQuery(fmt.Sprintf("topic%d", position))
+		if !ok {
+			continue
+		}
+		if topic == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": fmt.Sprintf("topic%d must not be empty", position)})
+			return nil, nil, false
+		}
+		args = append(args, topic)
+		conditions = append(conditions, fmt.Sprintf("topics->>%d = $%d", position, len(args)))
+	}
+	if _, ok := c.GetQuery(fmt.Sprintf("topic%d", maxTopics)); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "events have at most 4 topics, topic0 to topic3"})
+		return nil, nil, false
+	}
+	return conditions, args, true
+}
@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/daccred/sorobangraph.attest.so/graph"
+)
+
+// GraphQL returns the handler of the GraphQL API. Its subscriptions are fed
+// by the WebSocket hub and fail while streaming is disabled.
+func (ic *IngesterController) GraphQL() http.Handler {
+	return graph.NewHandler(ic.db, ic.hub)
+}
@@ -2,23 +2,34 @@ package controllers
 
 import (
 	"database/sql"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/middlewares"
 	"github.com/daccred/sorobangraph.attest.so/models"
 	"github.com/gin-contrib/cache"
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 type IngesterController struct {
-	db    *sql.DB
-	stats *models.Stats
+	db       *sql.DB
+	ingester *handlers.Ingester
+	stats    *models.Stats
+	hub      *handlers.WebSocketHub
 }
 
-func NewIngesterController(db *sql.DB, stats *models.Stats) *IngesterController {
-	return &IngesterController{db: db, stats: stats}
+// NewIngesterController builds the API controller around a running ingester.
+// The hub is nil when WebSocket streaming is disabled.
+func NewIngesterController(db *sql.DB, ingester *handlers.Ingester) *IngesterController {
+	return &IngesterController{db: db, ingester: ingester, stats: ingester.Stats(), hub: ingester.WebSocketHub()}
 }
 
 func (ic *IngesterController) RegisterRoutes(r *gin.Engine) {
@@ -30,11 +41,42 @@ func (ic *IngesterController) RegisterRoutes(r *gin.Engine) {
 	{
 		v1.GET("/ledgers", ic.GetLedgers)
 		v1.GET("/ledgers/:sequence", ic.GetLedger)
+		v1.GET("/ledgers/:sequence/transactions", ic.GetLedgerTransactions)
 		v1.GET("/transactions", ic.GetTransactions)
 		v1.GET("/transactions/:hash", ic.GetTransaction)
+		v1.GET("/transactions/:hash/operations", ic.GetTransactionOperations)
+		v1.GET("/transactions/:hash/events", ic.GetTransactionEvents)
+		v1.GET("/transactions/:hash/xdr", ic.GetTransactionXDR)
 		v1.GET("/operations", ic.GetOperations)
+		v1.GET("/accounts/:id", ic.GetAccount)
+		v1.GET("/accounts/:id/history", ic.GetAccountHistory)
+		v1.GET("/accounts/:id/transactions", ic.GetAccountTransactions)
+		v1.GET("/accounts/:id/balances", ic.GetAccountBalances)
+		v1.GET("/assets", ic.GetAssets)
+		v1.GET("/assets/:asset/holders", ic.GetAssetHolders)
 		v1.GET("/contract-events", ic.GetContractEvents)
+		v1.GET("/contracts/:contract_id", ic.GetContract)
+		v1.GET("/contracts/:contract_id/events", ic.GetContractEventsOf)
+		v1.GET("/contracts/:contract_id/storage", ic.GetContractStorage)
+		v1.GET("/contracts/:contract_id/storage/:key_hash", ic.GetContractStorageEntry)
+		v1.GET("/contract-code/:wasm_hash", ic.GetContractCode)
+		v1.GET("/attestations", ic.GetAttestations)
+		v1.GET("/attestations/:uid", ic.GetAttestation)
+		v1.GET("/schemas", ic.GetSchemas)
+		v1.GET("/schemas/:uid", ic.GetSchema)
 		v1.GET("/stats", cache.CachePage(store, time.Minute, ic.GetStats))
+		v1.GET("/ws", ic.StreamWebSocket)
+	}
+
+	admin := v1.Group("/admin", middlewares.AuthMiddleware())
+	{
+		admin.GET("/gaps", ic.GetGaps)
+		admin.POST("/gaps/repair", ic.RepairGaps)
+		admin.GET("/filters", ic.GetFilters)
+		admin.POST("/filters", ic.AddFilter)
+		admin.DELETE("/filters/:contract_id", ic.RemoveFilter)
+		admin.GET("/decoders", ic.GetDecoders)
+		admin.POST("/decoders/redecode", ic.RedecodeEvents)
 	}
 }
 
@@ -47,15 +89,23 @@ func (ic *IngesterController) HealthCheck(c *gin.Context) {
 }
 
 func (ic *IngesterController) GetLedgers(c *gin.Context) {
-	limit := c.DefaultQuery("limit", "100")
-	offset := c.DefaultQuery("offset", "0")
-
+	page, ok := cursorPage(c, "sequence")
+	if !ok {
+		return
+	}
+	conditions, args, ok := ledgerRange(c, "sequence", nil, nil)
+	if !ok {
+		return
+	}
+	if conditions, args, ok = timeRange(c, "closed_at", conditions, args); !ok {
+		return
+	}
+	conditions, args = page.Condition(conditions, args)
+	orderBy, args := page.OrderBy(args)
 	rows, err := ic.db.Query(`
 		SELECT sequence, hash, previous_hash, transaction_count, operation_count,
 		       closed_at, protocol_version
-		FROM ledgers
-		ORDER BY sequence DESC
-		LIMIT $1 OFFSET $2`, limit, offset)
+		FROM ledgers`+whereClause(conditions)+orderBy, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch ledgers"})
 		return
@@ -63,29 +113,23 @@ func (ic *IngesterController) GetLedgers(c *gin.Context) {
 	defer rows.Close()
 
 	var ledgers []models.LedgerInfo
+	var keys [][]int64
 	for rows.Next() {
 		var ledger models.LedgerInfo
 		if err := rows.Scan(&ledger.Sequence, &ledger.Hash, &ledger.PreviousHash,
 			&ledger.TransactionCount, &ledger.OperationCount, &ledger.ClosedAt,
 			&ledger.ProtocolVersion); err == nil {
 			ledgers = append(ledgers, ledger)
+			keys = append(keys, []int64{int64(ledger.Sequence)})
 		}
 	}
-
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": ledgers})
+	ledgers, info := pageOf(page, ledgers, keys)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": ledgers, "pagination": info})
 }
 
 func (ic *IngesterController) GetLedger(c *gin.Context) {
 	sequence := c.Param("sequence")
-	var ledger models.LedgerInfo
-	err := ic.db.QueryRow(`
-		SELECT sequence, hash, previous_hash, transaction_count, operation_count,
-		       closed_at, total_coins, fee_pool, base_fee, base_reserve,
-		       max_tx_set_size, protocol_version
-		FROM ledgers WHERE sequence = $1`, sequence).Scan(
-		&ledger.Sequence, &ledger.Hash, &ledger.PreviousHash, &ledger.TransactionCount,
-		&ledger.OperationCount, &ledger.ClosedAt, &ledger.TotalCoins, &ledger.FeePool,
-		&ledger.BaseFee, &ledger.BaseReserve, &ledger.MaxTxSetSize, &ledger.ProtocolVersion)
+	ledger, err := handlers.ScanLedger(ic.db.QueryRow(`SELECT `+handlers.LedgerColumns+` FROM ledgers WHERE sequence = $1`, sequence))
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Ledger not found"})
 		return
@@ -98,15 +142,77 @@ func (ic *IngesterController) GetLedger(c *gin.Context) {
 }
 
 func (ic *IngesterController) GetTransactions(c *gin.Context) {
-	limit := c.DefaultQuery("limit", "100")
-	offset := c.DefaultQuery("offset", "0")
+	ic.listTransactions(c, nil, nil)
+}
 
-	rows, err := ic.db.Query(`
-		SELECT id, hash, ledger, index, source_account, fee_paid,
-		       operation_count, created_at, memo_type, memo_value, successful
-		FROM transactions
-		ORDER BY ledger DESC, index DESC
-		LIMIT $1 OFFSET $2`, limit, offset)
+// GetLedgerTransactions lists the transactions of a ledger
+func (ic *IngesterController) GetLedgerTransactions(c *gin.Context) {
+	sequence, err := strconv.ParseUint(c.Param("sequence"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid sequence"})
+		return
+	}
+	var exists bool
+	if err := ic.db.QueryRow("SELECT EXISTS (SELECT 1 FROM ledgers WHERE sequence = $1)", sequence).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch ledger"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Ledger not found"})
+		return
+	}
+	ic.listTransactions(c, []string{"ledger = $1"}, []interface{}{int64(sequence)})
+}
+
+// GetAccountTransactions lists the transactions an account is the source of
+// or has operations in
+func (ic *IngesterController) GetAccountTransactions(c *gin.Context) {
+	account, err := handlers.NormalizeAccountID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid account ID"})
+		return
+	}
+	ic.listTransactions(c, []string{
+		"(source_account = $1 OR id IN (SELECT transaction_id FROM operations WHERE source_account = $1))",
+	}, []interface{}{account})
+}
+
+// listTransactions writes a page of the transactions matching conditions
+// and the filters of the request
+func (ic *IngesterController) listTransactions(c *gin.Context, conditions []string, args []interface{}) {
+	page, ok := cursorPage(c, "ledger", "index")
+	if !ok {
+		return
+	}
+	conditions, args, ok = ledgerRange(c, "ledger", conditions, args)
+	if !ok {
+		return
+	}
+	if conditions, args, ok = timeRange(c, "closed_at", conditions, args); !ok {
+		return
+	}
+	sourceAccount, ok := accountParam(c, "source_account")
+	if !ok {
+		return
+	}
+	if sourceAccount != "" {
+		args = append(args, sourceAccount)
+		conditions = append(conditions, fmt.Sprintf("source_account = $%d", len(args)))
+	}
+	successful, ok := boolParam(c, "successful")
+	if !ok {
+		return
+	}
+	if successful != nil {
+		args = append(args, *successful)
+		conditions = append(conditions, fmt.Sprintf("successful = $%d", len(args)))
+	}
+	if conditions, args, ok = memoFilter(c, conditions, args); !ok {
+		return
+	}
+	conditions, args = page.Condition(conditions, args)
+	orderBy, args := page.OrderBy(args)
+	rows, err := ic.db.Query(`SELECT `+handlers.TransactionColumns+` FROM transactions`+whereClause(conditions)+orderBy, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch transactions"})
 		return
@@ -114,125 +220,280 @@ func (ic *IngesterController) GetTransactions(c *gin.Context) {
 	defer rows.Close()
 
 	var transactions []models.Transaction
+	var keys [][]int64
 	for rows.Next() {
-		var tx models.Transaction
-		var memoType, memoValue sql.NullString
-		if err := rows.Scan(&tx.ID, &tx.Hash, &tx.Ledger, &tx.Index,
-			&tx.SourceAccount, &tx.FeePaid, &tx.OperationCount,
-			&tx.CreatedAt, &memoType, &memoValue, &tx.Successful); err == nil {
-			if memoType.Valid {
-				tx.MemoType = memoType.String
-			}
-			if memoValue.Valid {
-				tx.MemoValue = memoValue.String
-			}
+		if tx, err := handlers.ScanTransaction(rows); err == nil {
 			transactions = append(transactions, tx)
+			keys = append(keys, []int64{int64(tx.Ledger), int64(tx.Index)})
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": transactions})
+	transactions, info := pageOf(page, transactions, keys)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": transactions, "pagination": info})
 }
 
+// GetTransaction returns a transaction by hash. include=operations,events
+// embeds its operations and events in chain order.
 func (ic *IngesterController) GetTransaction(c *gin.Context) {
-	hash := c.Param("hash")
-	var tx models.Transaction
-	var memoType, memoValue sql.NullString
-	err := ic.db.QueryRow(`
-		SELECT id, hash, ledger, index, source_account, fee_paid,
-		       operation_count, created_at, memo_type, memo_value, successful
-		FROM transactions WHERE hash = $1`, hash).Scan(
-		&tx.ID, &tx.Hash, &tx.Ledger, &tx.Index, &tx.SourceAccount, &tx.FeePaid,
-		&tx.OperationCount, &tx.CreatedAt, &memoType, &memoValue, &tx.Successful)
+	include := map[string]bool{}
+	if raw := c.Query("include"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if name != "operations" && name != "events" {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": fmt.Sprintf("include must list operations or events, not %q", name)})
+				return
+			}
+			include[name] = true
+		}
+	}
+	tx, ok := ic.transactionByHash(c)
+	if !ok {
+		return
+	}
+	if include["operations"] {
+		rows, err := ic.db.Query(`SELECT `+handlers.OperationColumns+` FROM operations WHERE transaction_id = $1 ORDER BY index`, tx.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch operations"})
+			return
+		}
+		tx.Operations, _ = handlers.ScanOperations(rows)
+		rows.Close()
+	}
+	if include["events"] {
+		rows, err := ic.db.Query(`SELECT `+handlers.ContractEventColumns+` FROM contract_events WHERE transaction_hash = $1 ORDER BY event_index`, tx.Hash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch contract events"})
+			return
+		}
+		tx.Events, _ = handlers.ScanContractEvents(rows)
+		rows.Close()
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": tx})
+}
+
+// transactionByHash loads the transaction of the hash path parameter,
+// writing a 404 response when it has not been ingested
+func (ic *IngesterController) transactionByHash(c *gin.Context) (models.Transaction, bool) {
+	tx, err := handlers.ScanTransaction(ic.db.QueryRow(`SELECT `+handlers.TransactionColumns+` FROM transactions WHERE hash = $1`, c.Param("hash")))
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Transaction not found"})
-		return
+		return tx, false
 	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch transaction"})
+		return tx, false
+	}
+	return tx, true
+}
+
+// GetTransactionOperations lists the operations of a transaction
+func (ic *IngesterController) GetTransactionOperations(c *gin.Context) {
+	tx, ok := ic.transactionByHash(c)
+	if !ok {
+		return
+	}
+	ic.listOperations(c, []string{"transaction_id = $1"}, []interface{}{tx.ID})
+}
+
+// GetTransactionEvents lists the events of a transaction
+func (ic *IngesterController) GetTransactionEvents(c *gin.Context) {
+	tx, ok := ic.transactionByHash(c)
+	if !ok {
+		return
+	}
+	ic.listContractEvents(c, []string{"transaction_hash = $1"}, []interface{}{tx.Hash})
+}
+
+// GetTransactionXDR returns the envelope, result and meta XDR of a
+// transaction in base64, or decoded to JSON with decoded=true
+func (ic *IngesterController) GetTransactionXDR(c *gin.Context) {
+	decoded, ok := boolParam(c, "decoded")
+	if !ok {
 		return
 	}
-	if memoType.Valid {
-		tx.MemoType = memoType.String
+	raw, err := handlers.GetTransactionXDR(c.Request.Context(), ic.db, c.Param("hash"))
+	if errors.Is(err, handlers.ErrTransactionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Transaction not found"})
+		return
 	}
-	if memoValue.Valid {
-		tx.MemoValue = memoValue.String
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch transaction XDR"})
+		return
+	}
+	if decoded == nil || !*decoded {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": raw})
+		return
+	}
+	tx, err := handlers.DecodeTransactionXDR(raw)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to decode transaction XDR"})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": tx})
 }
 
 func (ic *IngesterController) GetOperations(c *gin.Context) {
-	limit := c.DefaultQuery("limit", "100")
-	offset := c.DefaultQuery("offset", "0")
+	ic.listOperations(c, nil, nil)
+}
 
-	rows, err := ic.db.Query(`
-		SELECT id, transaction_id, index, type, source_account, details
-		FROM operations
-		ORDER BY id DESC
-		LIMIT $1 OFFSET $2`, limit, offset)
+// listOperations writes a page of the operations matching conditions and
+// the filters of the request
+func (ic *IngesterController) listOperations(c *gin.Context, conditions []string, args []interface{}) {
+	page, ok := cursorPage(c, "ledger", "transaction_index", "index")
+	if !ok {
+		return
+	}
+	var calls []string
+	// Calls are matched on the expressions of idx_operations_invocation_order
+	if contractID := c.Query("contract_id"); contractID != "" {
+		id, err := handlers.NormalizeContractID(contractID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+			return
+		}
+		args = append(args, id)
+		calls = append(calls, fmt.Sprintf("details->>'contract_id' = $%d", len(args)))
+	}
+	if fn := c.Query("fn"); fn != "" {
+		args = append(args, fn)
+		calls = append(calls, fmt.Sprintf("details->>'fn' = $%d", len(args)))
+	}
+	if len(calls) > 0 {
+		conditions = append(append(conditions, calls...), "type = 'invoke_host_function'")
+	}
+	types, ok := operationTypes(c)
+	if !ok {
+		return
+	}
+	if len(types) > 0 {
+		args = append(args, pq.Array(types))
+		conditions = append(conditions, fmt.Sprintf("type = ANY($%d)", len(args)))
+	}
+	// Operations without their own source account take the transaction's
+	sourceAccount, ok := accountParam(c, "source_account")
+	if !ok {
+		return
+	}
+	if sourceAccount != "" {
+		args = append(args, sourceAccount)
+		conditions = append(conditions, fmt.Sprintf(`(source_account = $%[1]d OR (COALESCE(source_account, '') = ''
+			AND transaction_id IN (SELECT id FROM transactions WHERE source_account = $%[1]d)))`, len(args)))
+	}
+	successful, ok := boolParam(c, "successful")
+	if !ok {
+		return
+	}
+	if successful != nil {
+		args = append(args, *successful)
+		conditions = append(conditions, fmt.Sprintf("transaction_id IN (SELECT id FROM transactions WHERE successful = $%d)", len(args)))
+	}
+	if conditions, args, ok = ledgerRange(c, "ledger", conditions, args); !ok {
+		return
+	}
+	if conditions, args, ok = timeRange(c, "closed_at", conditions, args); !ok {
+		return
+	}
+	conditions, args = page.Condition(conditions, args)
+	orderBy, args := page.OrderBy(args)
+	rows, err := ic.db.Query(`SELECT `+handlers.OperationColumns+` FROM operations`+whereClause(conditions)+orderBy, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch operations"})
 		return
 	}
 	defer rows.Close()
 
-	var operations []models.Operation
-	for rows.Next() {
-		var op models.Operation
-		var sourceAccount sql.NullString
-		if err := rows.Scan(&op.ID, &op.TransactionID, &op.Index,
-			&op.Type, &sourceAccount, &op.Details); err == nil {
-			if sourceAccount.Valid {
-				op.SourceAccount = sourceAccount.String
-			}
-			operations = append(operations, op)
+	operations, keys := handlers.ScanOperations(rows)
+	operations, info := pageOf(page, operations, keys)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": operations, "pagination": info})
+}
+
+func (ic *IngesterController) GetContractEvents(c *gin.Context) {
+	var conditions []string
+	args := []interface{}{}
+	if contractID := c.Query("contract_id"); contractID != "" {
+		var ok bool
+		if conditions, args, ok = contractEventsOf(c, contractID, conditions, args); !ok {
+			return
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": operations})
+	ic.listContractEvents(c, conditions, args)
 }
 
-func (ic *IngesterController) GetContractEvents(c *gin.Context) {
-	limit := c.DefaultQuery("limit", "100")
-	offset := c.DefaultQuery("offset", "0")
-	contractID := c.Query("contract_id")
+// GetContractEventsOf lists the events a contract emitted
+func (ic *IngesterController) GetContractEventsOf(c *gin.Context) {
+	conditions, args, ok := contractEventsOf(c, c.Param("contract_id"), nil, nil)
+	if !ok {
+		return
+	}
+	ic.listContractEvents(c, conditions, args)
+}
 
-	query := `
-		SELECT id, contract_id, ledger, transaction_hash, event_type,
-		       topics, data, in_successful_tx
-		FROM contract_events`
-	args := []interface{}{}
-	if contractID != "" {
-		query += " WHERE contract_id = $1"
-		args = append(args, contractID)
-	}
-	query += " ORDER BY ledger DESC"
-	if contractID != "" {
-		query += " LIMIT $2 OFFSET $3"
-		args = append(args, limit, offset)
-	} else {
-		query += " LIMIT $1 OFFSET $2"
-		args = append(args, limit, offset)
-	}
-	rows, err := ic.db.Query(query, args...)
+// contractEventsOf adds the condition selecting the events of a contract,
+// writing a 400 response when its ID is invalid
+func contractEventsOf(c *gin.Context, contractID string, conditions []string, args []interface{}) ([]string, []interface{}, bool) {
+	id, err := handlers.ParseContractID(contractID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid contract_id"})
+		return nil, nil, false
+	}
+	// Events ingested before IDs were normalized are stored as hex
+	args = append(args, handlers.EncodeContractID(id), hex.EncodeToString(id[:]))
+	return append(conditions, fmt.Sprintf("contract_id IN ($%d, $%d)", len(args)-1, len(args))), args, true
+}
+
+// listContractEvents writes a page of the events matching conditions and
+// the filters of the request
+func (ic *IngesterController) listContractEvents(c *gin.Context, conditions []string, args []interface{}) {
+	page, ok := cursorPage(c, "ledger", "transaction_index", "event_index")
+	if !ok {
+		return
+	}
+	if decoder := c.Query("decoder"); decoder != "" {
+		args = append(args, decoder)
+		conditions = append(conditions, fmt.Sprintf("decoder = $%d", len(args)))
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		if eventType != "contract" && eventType != "system" && eventType != "diagnostic" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "event_type must be contract, system or diagnostic"})
+			return
+		}
+		args = append(args, eventType)
+		conditions = append(conditions, fmt.Sprintf("event_type = $%d", len(args)))
+	}
+	for _, param := range []struct{ name, column string }{
+		{"successful", "in_successful_tx"},
+		{"in_successful_contract_call", "in_successful_contract_call"},
+	} {
+		flag, ok := boolParam(c, param.name)
+		if !ok {
+			return
+		}
+		if flag == nil {
+			continue
+		}
+		args = append(args, *flag)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", param.column, len(args)))
+	}
+	if conditions, args, ok = topicFilter(c, conditions, args); !ok {
+		return
+	}
+	if conditions, args, ok = ledgerRange(c, "ledger", conditions, args); !ok {
+		return
+	}
+	if conditions, args, ok = timeRange(c, "closed_at", conditions, args); !ok {
+		return
+	}
+	conditions, args = page.Condition(conditions, args)
+	orderBy, args := page.OrderBy(args)
+	rows, err := ic.db.Query(`SELECT `+handlers.ContractEventColumns+` FROM contract_events`+whereClause(conditions)+orderBy, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch contract events"})
 		return
 	}
 	defer rows.Close()
 
-	var events []models.ContractEvent
-	for rows.Next() {
-		var event models.ContractEvent
-		var topicsJSON, dataJSON []byte
-		if err := rows.Scan(&event.ID, &event.ContractID, &event.Ledger,
-			&event.TransactionHash, &event.EventType, &topicsJSON, &dataJSON, &event.InSuccessfulTx); err == nil {
-			if err := json.Unmarshal(topicsJSON, &event.Topics); err != nil {
-				// skip this row if topics cannot be decoded
-				continue
-			}
-			event.Data = dataJSON
-			events = append(events, event)
-		}
-	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": events})
+	events, keys := handlers.ScanContractEvents(rows)
+	events, info := pageOf(page, events, keys)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": events, "pagination": info})
 }
 
 func (ic *IngesterController) GetStats(c *gin.Context) {
@@ -253,6 +514,9 @@ func (ic *IngesterController) GetStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch stats"})
 		return
 	}
+	if ic.hub != nil {
+		stats.ConnectedClients = ic.hub.ClientCount()
+	}
 	stats.LastUpdateTime = time.Now()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
 }
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// cursorPage parses the limit, order and cursor query parameters of a list
+// ordered by the key columns, writing a 400 response when they are invalid.
+// An offset is still honored without a cursor but flagged as deprecated.
+func cursorPage(c *gin.Context, columns ...string) (handlers.Page, bool) {
+	page := handlers.Page{Columns: columns, Order: c.DefaultQuery("order", handlers.OrderDesc), Limit: defaultPageLimit}
+	if raw, ok := c.GetQuery("offset"); ok {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid offset"})
+			return page, false
+		}
+		if c.Query("cursor") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "offset and cursor cannot be combined"})
+			return page, false
+		}
+		page.Offset = offset
+		c.Header("Deprecation", "true")
+		c.Header("Warning", `299 - "offset is deprecated, page with cursor"`)
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "limit must be between 1 and 1000"})
+			return page, false
+		}
+		page.Limit = limit
+	}
+	if page.Order != handlers.OrderAsc && page.Order != handlers.OrderDesc {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "order must be asc or desc"})
+		return page, false
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := handlers.ParseCursor(raw, len(columns))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cursor"})
+			return page, false
+		}
+		page.Cursor = &cursor
+	}
+	return page, true
+}
+
+// pageOf puts the rows of a page scanned in reverse back in order and
+// returns them with the page's cursors
+func pageOf[T any](page handlers.Page, rows []T, keys [][]int64) ([]T, models.PageInfo) {
+	if page.Reversed() {
+		for l, r := 0, len(rows)-1; l < r; l, r = l+1, r-1 {
+			rows[l], rows[r] = rows[r], rows[l]
+			keys[l], keys[r] = keys[r], keys[l]
+		}
+	}
+	return rows, page.Info(keys)
+}
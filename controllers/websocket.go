@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// StreamWebSocket upgrades to a WebSocket and streams ingested ledgers,
+// transactions and contract events. The initial subscription is taken from
+// the type, contract_id, topic and source_account query parameters; each may
+// be repeated or comma separated.
+func (ic *IngesterController) StreamWebSocket(c *gin.Context) {
+	if ic.hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "WebSocket streaming is disabled"})
+		return
+	}
+	filter := handlers.SubscriptionFilter{
+		Types:          queryList(c, "type"),
+		ContractIDs:    queryList(c, "contract_id"),
+		Topics:         queryList(c, "topic"),
+		SourceAccounts: queryList(c, "source_account"),
+	}
+	// The upgrader writes its own error response when the handshake fails
+	_ = ic.hub.ServeWS(c.Writer, c.Request, filter)
+}
+
+// queryList collects a query parameter given either repeatedly or comma separated
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(key) {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
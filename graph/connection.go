@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// connectionArgs are the Relay arguments of a connection: first and after
+// page forward from a cursor, last and before page back from one. Order is
+// ASC or DESC in chain order.
+type connectionArgs struct {
+	First  *int32
+	After  *string
+	Last   *int32
+	Before *string
+	Order  string
+}
+
+// page returns the page scan of the arguments over a list keyed by columns.
+// The page fetches one row more than asked so the connection knows whether
+// there are more.
+func (a connectionArgs) page(columns ...string) (handlers.Page, error) {
+	page := handlers.Page{Columns: columns, Order: strings.ToLower(a.Order), Limit: defaultPageSize}
+	if page.Order != handlers.OrderAsc && page.Order != handlers.OrderDesc {
+		return page, fmt.Errorf("invalid order %q", a.Order)
+	}
+	if a.First != nil && a.Last != nil {
+		return page, errors.New("first and last cannot be combined")
+	}
+	if a.After != nil && a.Before != nil {
+		return page, errors.New("after and before cannot be combined")
+	}
+	if (a.First != nil && a.Before != nil) || (a.Last != nil && a.After != nil) {
+		return page, errors.New("first pages after a cursor and last before one")
+	}
+	if size := a.size(); size != nil {
+		if *size < 1 || *size > maxPageSize {
+			return page, fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+		}
+		page.Limit = int(*size)
+	}
+	for _, raw := range []*string{a.After, a.Before} {
+		if raw == nil {
+			continue
+		}
+		cursor, err := handlers.ParseCursor(*raw, len(columns))
+		if err != nil {
+			return page, fmt.Errorf("invalid cursor %q", *raw)
+		}
+		cursor.Before = raw == a.Before
+		page.Cursor = &cursor
+	}
+	// The last rows without a cursor are the first ones in reverse
+	if a.backward() && page.Cursor == nil {
+		if page.Order == handlers.OrderAsc {
+			page.Order = handlers.OrderDesc
+		} else {
+			page.Order = handlers.OrderAsc
+		}
+	}
+	page.Limit++
+	return page, nil
+}
+
+func (a connectionArgs) size() *int32 {
+	if a.Last != nil {
+		return a.Last
+	}
+	return a.First
+}
+
+// backward reports whether the arguments page back, scanning rows against
+// the order
+func (a connectionArgs) backward() bool {
+	return a.Last != nil || a.Before != nil
+}
+
+// connection is a Relay connection of nodes resolved by R
+type connection[R any] struct {
+	edges []*edge[R]
+	info  *pageInfo
+}
+
+type edge[R any] struct {
+	cursor string
+	node   R
+}
+
+func (e *edge[R]) Cursor() string { return e.cursor }
+func (e *edge[R]) Node() R        { return e.node }
+
+func (c *connection[R]) Edges() []*edge[R]   { return c.edges }
+func (c *connection[R]) PageInfo() *pageInfo { return c.info }
+
+func (c *connection[R]) Nodes() []R {
+	nodes := make([]R, len(c.edges))
+	for idx, e := range c.edges {
+		nodes[idx] = e.node
+	}
+	return nodes
+}
+
+type pageInfo struct {
+	hasNext, hasPrev       bool
+	startCursor, endCursor *string
+}
+
+func (p *pageInfo) HasNextPage() bool     { return p.hasNext }
+func (p *pageInfo) HasPreviousPage() bool { return p.hasPrev }
+func (p *pageInfo) StartCursor() *string  { return p.startCursor }
+func (p *pageInfo) EndCursor() *string    { return p.endCursor }
+
+// newConnection builds the connection of the rows of a page scan with their
+// keys, in scan order, wrapping each row with resolve. The extra row of the
+// scan only tells there is another page and is dropped.
+func newConnection[T, R any](args connectionArgs, page handlers.Page, rows []T, keys [][]int64, resolve func(T) R) *connection[R] {
+	more := len(rows) == page.Limit
+	if more {
+		rows, keys = rows[:len(rows)-1], keys[:len(keys)-1]
+	}
+	c := &connection[R]{edges: make([]*edge[R], len(rows)), info: &pageInfo{}}
+	for idx, row := range rows {
+		pos := idx
+		// Backward scans run against the order and are flipped
+		if args.backward() {
+			pos = len(rows) - 1 - idx
+		}
+		c.edges[pos] = &edge[R]{cursor: handlers.Cursor{Key: keys[idx]}.String(), node: resolve(row)}
+	}
+	if args.backward() {
+		c.info.hasPrev, c.info.hasNext = more, args.Before != nil
+	} else {
+		c.info.hasNext, c.info.hasPrev = more, args.After != nil
+	}
+	if len(c.edges) > 0 {
+		c.info.startCursor, c.info.endCursor = &c.edges[0].cursor, &c.edges[len(c.edges)-1].cursor
+	}
+	return c
+}
@@ -0,0 +1,283 @@
+package graph
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/lib/pq"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+// maxTopics is the number of topics a Soroban event can have
+const maxTopics = 4
+
+var memoTypes = map[string]bool{"none": true, "text": true, "id": true, "hash": true, "return": true}
+
+// query collects the conditions of a list query with their arguments
+type query struct {
+	conditions []string
+	args       []interface{}
+}
+
+// where adds a condition on value, formatted with the number of its placeholder
+func (q *query) where(format string, value interface{}) {
+	q.args = append(q.args, value)
+	q.conditions = append(q.conditions, fmt.Sprintf(format, len(q.args)))
+}
+
+// clause joins the conditions into a WHERE clause, empty without conditions
+func clause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// bounds adds the inclusive ledger bounds of a filter on ledgerColumn and
+// its time bounds on closed_at
+func (q *query) bounds(ledgerColumn string, startLedger, endLedger *int32, startTime, endTime *graphql.Time) error {
+	for _, bound := range []struct {
+		name string
+		v    *int32
+	}{{"startLedger", startLedger}, {"endLedger", endLedger}} {
+		if bound.v != nil && *bound.v < 1 {
+			return fmt.Errorf("%s must be a ledger sequence", bound.name)
+		}
+	}
+	if startLedger != nil && endLedger != nil && *startLedger > *endLedger {
+		return errors.New("startLedger must not be after endLedger")
+	}
+	if startTime != nil && endTime != nil && startTime.After(endTime.Time) {
+		return errors.New("startTime must not be after endTime")
+	}
+	if startLedger != nil {
+		q.where(ledgerColumn+" >= $%d", int64(*startLedger))
+	}
+	if endLedger != nil {
+		q.where(ledgerColumn+" <= $%d", int64(*endLedger))
+	}
+	if startTime != nil {
+		q.where("closed_at >= $%d", startTime.UTC())
+	}
+	if endTime != nil {
+		q.where("closed_at <= $%d", endTime.UTC())
+	}
+	return nil
+}
+
+// account parses a G... or M... account argument into its G... address
+func account(name, raw string) (string, error) {
+	id, err := handlers.NormalizeAccountID(raw)
+	if err != nil {
+		return "", fmt.Errorf("%s must be a G... or M... account", name)
+	}
+	return id, nil
+}
+
+type ledgerFilter struct {
+	StartLedger *int32
+	EndLedger   *int32
+	StartTime   *graphql.Time
+	EndTime     *graphql.Time
+}
+
+func (f *ledgerFilter) apply(q *query) error {
+	if f == nil {
+		return nil
+	}
+	return q.bounds("sequence", f.StartLedger, f.EndLedger, f.StartTime, f.EndTime)
+}
+
+type transactionFilter struct {
+	StartLedger   *int32
+	EndLedger     *int32
+	StartTime     *graphql.Time
+	EndTime       *graphql.Time
+	SourceAccount *string
+	Successful    *bool
+	MemoType      *string
+	Memo          *string
+}
+
+func (f *transactionFilter) apply(q *query) error {
+	if f == nil {
+		return nil
+	}
+	if err := q.bounds("ledger", f.StartLedger, f.EndLedger, f.StartTime, f.EndTime); err != nil {
+		return err
+	}
+	if f.SourceAccount != nil {
+		source, err := account("sourceAccount", *f.SourceAccount)
+		if err != nil {
+			return err
+		}
+		q.where("source_account = $%d", source)
+	}
+	if f.Successful != nil {
+		q.where("successful = $%d", *f.Successful)
+	}
+	if f.MemoType != nil {
+		if !memoTypes[*f.MemoType] {
+			return errors.New("memoType must be none, text, id, hash or return")
+		}
+		if *f.MemoType == "none" {
+			q.conditions = append(q.conditions, "COALESCE(memo_type, '') = ''")
+		} else {
+			q.where("memo_type = $%d", *f.MemoType)
+		}
+	}
+	if f.Memo != nil {
+		q.where("memo_value = $%d", *f.Memo)
+	}
+	return nil
+}
+
+type operationFilter struct {
+	StartLedger   *int32
+	EndLedger     *int32
+	StartTime     *graphql.Time
+	EndTime       *graphql.Time
+	Types         *[]string
+	SourceAccount *string
+	Successful    *bool
+	ContractID    *string
+	Function      *string
+}
+
+func (f *operationFilter) apply(q *query) error {
+	if f == nil {
+		return nil
+	}
+	if err := q.bounds("ledger", f.StartLedger, f.EndLedger, f.StartTime, f.EndTime); err != nil {
+		return err
+	}
+	if f.Types != nil {
+		for _, opType := range *f.Types {
+			if !handlers.KnownOperationType(opType) {
+				return fmt.Errorf("unknown operation type %q", opType)
+			}
+		}
+		q.where("type = ANY($%d)", pq.Array(*f.Types))
+	}
+	// Calls are matched on the expressions of idx_operations_invocation_order
+	if f.ContractID != nil || f.Function != nil {
+		if f.ContractID != nil {
+			id, err := handlers.NormalizeContractID(*f.ContractID)
+			if err != nil {
+				return errors.New("invalid contractId")
+			}
+			q.where("details->>'contract_id' = $%d", id)
+		}
+		if f.Function != nil {
+			q.where("details->>'fn' = $%d", *f.Function)
+		}
+		q.conditions = append(q.conditions, "type = 'invoke_host_function'")
+	}
+	if f.SourceAccount != nil {
+		source, err := account("sourceAccount", *f.SourceAccount)
+		if err != nil {
+			return err
+		}
+		effectiveSource(q, source)
+	}
+	if f.Successful != nil {
+		q.where("transaction_id IN (SELECT id FROM transactions WHERE successful = $%d)", *f.Successful)
+	}
+	return nil
+}
+
+// effectiveSource adds the condition selecting the operations account is
+// the source of; operations without their own source account take the
+// transaction's
+func effectiveSource(q *query, account string) {
+	q.where(`(source_account = $%[1]d OR (COALESCE(source_account, '') = ''
+		AND transaction_id IN (SELECT id FROM transactions WHERE source_account = $%[1]d)))`, account)
+}
+
+type contractEventFilter struct {
+	StartLedger              *int32
+	EndLedger                *int32
+	StartTime                *graphql.Time
+	EndTime                  *graphql.Time
+	ContractID               *string
+	Type                     *string
+	Topics                   *[]*string
+	Decoder                  *string
+	Successful               *bool
+	InSuccessfulContractCall *bool
+}
+
+func (f *contractEventFilter) apply(q *query) error {
+	if f == nil {
+		return nil
+	}
+	if err := q.bounds("ledger", f.StartLedger, f.EndLedger, f.StartTime, f.EndTime); err != nil {
+		return err
+	}
+	if f.ContractID != nil {
+		id, err := handlers.ParseContractID(*f.ContractID)
+		if err != nil {
+			return errors.New("invalid contractId")
+		}
+		// Events ingested before IDs were normalized are stored as hex
+		q.args = append(q.args, handlers.EncodeContractID(id), hex.EncodeToString(id[:]))
+		q.conditions = append(q.conditions, fmt.Sprintf("contract_id IN ($%d, $%d)", len(q.args)-1, len(q.args)))
+	}
+	if f.Type != nil {
+		if *f.Type != "contract" && *f.Type != "system" && *f.Type != "diagnostic" {
+			return errors.New("type must be contract, system or diagnostic")
+		}
+		q.where("event_type = $%d", *f.Type)
+	}
+	if f.Topics != nil {
+		if len(*f.Topics) > maxTopics {
+			return errors.New("events have at most 4 topics")
+		}
+		for position, topic := range *f.Topics {
+			if topic != nil {
+				q.where(fmt.Sprintf("topics->>%d = $%%d", position), *topic)
+			}
+		}
+	}
+	if f.Decoder != nil {
+		q.where("decoder = $%d", *f.Decoder)
+	}
+	if f.Successful != nil {
+		q.where("in_successful_tx = $%d", *f.Successful)
+	}
+	if f.InSuccessfulContractCall != nil {
+		q.where("in_successful_contract_call = $%d", *f.InSuccessfulContractCall)
+	}
+	return nil
+}
+
+type attestationFilter struct {
+	ContractID *string
+	SchemaUID  *string
+	Attester   *string
+	Subject    *string
+	Revoked    *bool
+}
+
+// query returns the attestation query of the filter; the handlers validate
+// its values
+func (f *attestationFilter) query() handlers.AttestationQuery {
+	var q handlers.AttestationQuery
+	if f == nil {
+		return q
+	}
+	for _, field := range []struct {
+		to   *string
+		from *string
+	}{{&q.ContractID, f.ContractID}, {&q.SchemaUID, f.SchemaUID}, {&q.Attester, f.Attester}, {&q.Subject, f.Subject}} {
+		if field.from != nil {
+			*field.to = *field.from
+		}
+	}
+	q.Revoked = f.Revoked
+	return q
+}
@@ -0,0 +1,275 @@
+// Package graph serves a GraphQL API over the ingested ledgers,
+// transactions, operations, contract events, accounts and attestations.
+//
+// Lists are Relay connections paged by the same keyset cursors as the REST
+// API. Relations between rows are loaded through per-request loaders that
+// batch the keys of a list into one query per relation, so resolving a
+// page of transactions with their ledgers, operations and events runs a
+// fixed number of queries rather than one per row. Connections nested in a
+// list, such as the transactions of every ledger of a page, still run one
+// query per parent.
+package graph
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// maxDepth bounds the nesting of queries, which relations make unbounded
+const maxDepth = 12
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// NewSchema parses the GraphQL schema resolved against db. hub feeds the
+// subscriptions, which fail while it is nil because WebSocket streaming is
+// disabled.
+func NewSchema(db *sql.DB, hub *handlers.WebSocketHub) (*graphql.Schema, error) {
+	return graphql.ParseSchema(schemaSDL, &resolver{db: db, hub: hub},
+		graphql.UseStringDescriptions(), graphql.MaxDepth(maxDepth))
+}
+
+// resolver is the root resolver of queries and subscriptions. The resolvers
+// of subscription events carry the loaders of their event in scope.
+type resolver struct {
+	db    *sql.DB
+	hub   *handlers.WebSocketHub
+	scope *loaders
+}
+
+type ledgersArgs struct {
+	connectionArgs
+	Filter *ledgerFilter
+}
+
+type transactionsArgs struct {
+	connectionArgs
+	Filter *transactionFilter
+}
+
+type operationsArgs struct {
+	connectionArgs
+	Filter *operationFilter
+}
+
+type contractEventsArgs struct {
+	connectionArgs
+	Filter *contractEventFilter
+}
+
+func (r *resolver) loaders(ctx context.Context) *loaders {
+	if r.scope != nil {
+		return r.scope
+	}
+	return loadersOf(ctx, r.db)
+}
+
+func (r *resolver) Ledger(ctx context.Context, args struct{ Sequence int32 }) (*ledgerResolver, error) {
+	if args.Sequence < 1 {
+		return nil, nil
+	}
+	return r.loadLedger(ctx, uint32(args.Sequence))
+}
+
+func (r *resolver) Ledgers(ctx context.Context, args ledgersArgs) (*connection[*ledgerResolver], error) {
+	page, err := args.page("sequence")
+	if err != nil {
+		return nil, err
+	}
+	var q query
+	if err := args.Filter.apply(&q); err != nil {
+		return nil, err
+	}
+	ledgers, keys, err := scanPage(ctx, r.db, `SELECT `+handlers.LedgerColumns+` FROM ledgers`, q, page, scanLedgers)
+	if err != nil {
+		return nil, errors.New("failed to fetch ledgers")
+	}
+	return newConnection(args.connectionArgs, page, ledgers, keys, r.ledger), nil
+}
+
+func (r *resolver) Transaction(ctx context.Context, args struct{ Hash string }) (*transactionResolver, error) {
+	return r.loadTransaction(ctx, args.Hash)
+}
+
+func (r *resolver) Transactions(ctx context.Context, args transactionsArgs) (*connection[*transactionResolver], error) {
+	return r.transactions(ctx, args.connectionArgs, args.Filter, query{})
+}
+
+func (r *resolver) Operations(ctx context.Context, args operationsArgs) (*connection[*operationResolver], error) {
+	return r.operations(ctx, args.connectionArgs, args.Filter, query{})
+}
+
+func (r *resolver) ContractEvents(ctx context.Context, args contractEventsArgs) (*connection[*contractEventResolver], error) {
+	page, err := args.page("ledger", "transaction_index", "event_index")
+	if err != nil {
+		return nil, err
+	}
+	var q query
+	if err := args.Filter.apply(&q); err != nil {
+		return nil, err
+	}
+	events, keys, err := scanPage(ctx, r.db, `SELECT `+handlers.ContractEventColumns+` FROM contract_events`, q, page, handlers.ScanContractEvents)
+	if err != nil {
+		return nil, errors.New("failed to fetch contract events")
+	}
+	r.loaders(ctx).primeEvents(events)
+	return newConnection(args.connectionArgs, page, events, keys, r.contractEvent), nil
+}
+
+func (r *resolver) Account(args struct{ ID string }) (*accountResolver, error) {
+	id, err := handlers.NormalizeAccountID(args.ID)
+	if err != nil {
+		return nil, handlers.ErrInvalidAccountID
+	}
+	return &accountResolver{r: r, id: id}, nil
+}
+
+func (r *resolver) Attestation(ctx context.Context, args struct {
+	UID        string
+	ContractID *string
+}) (*attestationResolver, error) {
+	var contractID string
+	if args.ContractID != nil {
+		contractID = *args.ContractID
+	}
+	attestation, err := handlers.GetAttestation(ctx, r.db, args.UID, contractID)
+	if errors.Is(err, handlers.ErrAttestationNotFound) {
+		return nil, nil
+	}
+	if errors.Is(err, handlers.ErrInvalidUID) || errors.Is(err, handlers.ErrInvalidContractID) || errors.Is(err, handlers.ErrAmbiguousUID) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("failed to fetch attestation")
+	}
+	return &attestationResolver{r: r, attestation: attestation}, nil
+}
+
+func (r *resolver) Attestations(ctx context.Context, args struct {
+	Filter        *attestationFilter
+	Limit, Offset int32
+}) ([]*attestationResolver, error) {
+	return r.attestations(ctx, args.Filter, args.Limit, args.Offset)
+}
+
+// loadLedger loads a ledger by sequence, nil when it has not been ingested
+func (r *resolver) loadLedger(ctx context.Context, sequence uint32) (*ledgerResolver, error) {
+	ledger, found, err := r.loaders(ctx).ledgers.Load(ctx, sequence)
+	if err != nil || !found {
+		return nil, err
+	}
+	return r.ledger(ledger), nil
+}
+
+// loadTransaction loads a transaction by hash, nil when it has not been
+// ingested
+func (r *resolver) loadTransaction(ctx context.Context, hash string) (*transactionResolver, error) {
+	tx, found, err := r.loaders(ctx).transactionsByHash.Load(ctx, hash)
+	if err != nil || !found {
+		return nil, err
+	}
+	return r.transaction(tx), nil
+}
+
+// transactions pages through the transactions matching q and filter
+func (r *resolver) transactions(ctx context.Context, args connectionArgs, filter *transactionFilter, q query) (*connection[*transactionResolver], error) {
+	page, err := args.page("ledger", "index")
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.apply(&q); err != nil {
+		return nil, err
+	}
+	transactions, keys, err := scanPage(ctx, r.db, `SELECT `+handlers.TransactionColumns+` FROM transactions`, q, page, scanTransactions)
+	if err != nil {
+		return nil, errors.New("failed to fetch transactions")
+	}
+	r.loaders(ctx).primeTransactions(transactions)
+	return newConnection(args, page, transactions, keys, r.transaction), nil
+}
+
+// operations pages through the operations matching q and filter
+func (r *resolver) operations(ctx context.Context, args connectionArgs, filter *operationFilter, q query) (*connection[*operationResolver], error) {
+	page, err := args.page("ledger", "transaction_index", "index")
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.apply(&q); err != nil {
+		return nil, err
+	}
+	operations, keys, err := scanPage(ctx, r.db, `SELECT `+handlers.OperationColumns+` FROM operations`, q, page, handlers.ScanOperations)
+	if err != nil {
+		return nil, errors.New("failed to fetch operations")
+	}
+	r.loaders(ctx).primeOperations(operations)
+	return newConnection(args, page, operations, keys, r.operation), nil
+}
+
+// attestations lists the attestations matching filter, newest first
+func (r *resolver) attestations(ctx context.Context, filter *attestationFilter, limit, offset int32) ([]*attestationResolver, error) {
+	if limit < 1 || limit > maxPageSize {
+		return nil, errors.New("limit must be between 1 and 1000")
+	}
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	q := filter.query()
+	q.Limit, q.Offset = int(limit), int(offset)
+	attestations, err := handlers.ListAttestations(ctx, r.db, q)
+	if errors.Is(err, handlers.ErrInvalidContractID) || errors.Is(err, handlers.ErrInvalidUID) || errors.Is(err, handlers.ErrInvalidAddress) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("failed to fetch attestations")
+	}
+	l := r.loaders(ctx)
+	for _, attestation := range attestations {
+		if attestation.Ledger != nil {
+			l.ledgers.Prime(*attestation.Ledger)
+		}
+		if attestation.TransactionHash != "" {
+			l.transactionsByHash.Prime(attestation.TransactionHash)
+		}
+	}
+	return resolveAll(attestations, func(a models.Attestation) *attestationResolver {
+		return &attestationResolver{r: r, attestation: a}
+	}), nil
+}
+
+// scanPage runs the page scan of a connection over the rows selected by
+// selectFrom that match q, reading them with scan
+func scanPage[T any](ctx context.Context, db *sql.DB, selectFrom string, q query, page handlers.Page,
+	scan func(*sql.Rows) ([]T, [][]int64)) ([]T, [][]int64, error) {
+	conditions, args := page.Condition(q.conditions, q.args)
+	orderBy, args := page.OrderBy(args)
+	rows, err := db.QueryContext(ctx, selectFrom+clause(conditions)+orderBy, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	items, keys := scan(rows)
+	return items, keys, rows.Err()
+}
+
+func (r *resolver) ledger(ledger models.LedgerInfo) *ledgerResolver {
+	return &ledgerResolver{r: r, ledger: ledger}
+}
+
+func (r *resolver) transaction(tx models.Transaction) *transactionResolver {
+	return &transactionResolver{r: r, tx: tx}
+}
+
+func (r *resolver) operation(op models.Operation) *operationResolver {
+	return &operationResolver{r: r, op: op}
+}
+
+func (r *resolver) contractEvent(event models.ContractEvent) *contractEventResolver {
+	return &contractEventResolver{r: r, event: event}
+}
@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+var (
+	transactionColumns = []string{"id", "hash", "ledger", "index", "source_account", "fee_paid",
+		"operation_count", "created_at", "memo_type", "memo_value", "successful", "closed_at"}
+	ledgerColumns = []string{"sequence", "hash", "previous_hash", "transaction_count", "operation_count",
+		"closed_at", "total_coins", "fee_pool", "base_fee", "base_reserve", "max_tx_set_size", "protocol_version"}
+	operationColumns = []string{"id", "transaction_id", "ledger", "transaction_index", "index", "type",
+		"source_account", "details", "closed_at"}
+)
+
+const testAccount = "GAAZI4TCR3TY5OJHCTJC2A4QSY6CJWJH5IAJTGKIN2ER7LBNVKOCCWN7"
+
+func intPtr(v int32) *int32   { return &v }
+func strPtr(v string) *string { return &v }
+
+func TestSchemaParses(t *testing.T) {
+	_, err := NewSchema(nil, nil)
+	require.NoError(t, err)
+}
+
+func TestTransactionsConnectionBatchesRelations(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	closedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	txs := sqlmock.NewRows(transactionColumns)
+	for idx, tx := range []struct {
+		id, hash string
+		ledger   int64
+	}{{"t3", "h3", 11}, {"t2", "h2", 10}, {"t1", "h1", 10}} {
+		txs.AddRow(tx.id, tx.hash, tx.ledger, int64(3-idx), testAccount, int64(100), int32(1), closedAt, nil, nil, true, closedAt)
+	}
+	mock.ExpectQuery(`FROM transactions ORDER BY ledger DESC, index DESC LIMIT \$1`).WithArgs(3).WillReturnRows(txs)
+	mock.ExpectQuery(`FROM ledgers WHERE sequence = ANY\(\$1\)`).WillReturnRows(sqlmock.NewRows(ledgerColumns).
+		AddRow(int64(10), "l10", "l9", 2, 2, closedAt, int64(5), int64(1), 100, 5000000, 1000, 22).
+		AddRow(int64(11), "l11", "l10", 1, 1, closedAt, int64(5), int64(1), 100, 5000000, 1000, 22))
+	mock.ExpectQuery(`FROM operations\s+WHERE transaction_id = ANY\(\$1\)`).WillReturnRows(sqlmock.NewRows(operationColumns).
+		AddRow("o3", "t3", int64(11), int64(3), int64(0), "payment", nil, []byte(`{"amount":"1"}`), closedAt).
+		AddRow("o2", "t2", int64(10), int64(2), int64(0), "invoke_host_function", nil, []byte(`{}`), closedAt))
+
+	schema, err := NewSchema(mockDB, nil)
+	require.NoError(t, err)
+	response := schema.Exec(withLoaders(context.Background(), mockDB), `{
+		transactions(first: 2) {
+			edges { cursor node { hash feePaid ledger { sequence hash } operations { type details } } }
+			pageInfo { hasNextPage hasPreviousPage endCursor }
+		}
+	}`, "", nil)
+	require.Empty(t, response.Errors)
+
+	var data struct {
+		Transactions struct {
+			Edges []struct {
+				Cursor string
+				Node   struct {
+					Hash    string
+					FeePaid string
+					Ledger  struct {
+						Sequence int32
+						Hash     string
+					}
+					Operations []struct {
+						Type    string
+						Details json.RawMessage
+					}
+				}
+			}
+			PageInfo struct {
+				HasNextPage, HasPreviousPage bool
+				EndCursor                    string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(response.Data, &data))
+	edges := data.Transactions.Edges
+	require.Len(t, edges, 2)
+	assert.Equal(t, "h3", edges[0].Node.Hash)
+	assert.Equal(t, "100", edges[0].Node.FeePaid)
+	assert.Equal(t, "l11", edges[0].Node.Ledger.Hash)
+	assert.Equal(t, "payment", edges[0].Node.Operations[0].Type)
+	assert.JSONEq(t, `{"amount":"1"}`, string(edges[0].Node.Operations[0].Details))
+	assert.Equal(t, "l10", edges[1].Node.Ledger.Hash)
+	assert.Len(t, edges[1].Node.Operations, 1)
+	assert.Equal(t, handlers.Cursor{Key: []int64{10, 2}}.String(), edges[1].Cursor)
+	assert.True(t, data.Transactions.PageInfo.HasNextPage)
+	assert.False(t, data.Transactions.PageInfo.HasPreviousPage)
+	assert.Equal(t, edges[1].Cursor, data.Transactions.PageInfo.EndCursor)
+	// One query per relation, not per transaction
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnectionArgsPage(t *testing.T) {
+	cursor := handlers.Cursor{Key: []int64{10, 2}}.String()
+
+	page, err := connectionArgs{First: intPtr(5), After: &cursor, Order: "ASC"}.page("ledger", "index")
+	require.NoError(t, err)
+	assert.Equal(t, handlers.OrderAsc, page.Order)
+	assert.Equal(t, 6, page.Limit)
+	assert.False(t, page.Reversed())
+
+	// The last rows without a cursor are scanned from the other end
+	page, err = connectionArgs{Last: intPtr(5), Order: "DESC"}.page("ledger", "index")
+	require.NoError(t, err)
+	assert.Equal(t, handlers.OrderAsc, page.Order)
+	assert.Nil(t, page.Cursor)
+
+	page, err = connectionArgs{Last: intPtr(5), Before: &cursor, Order: "DESC"}.page("ledger", "index")
+	require.NoError(t, err)
+	assert.Equal(t, handlers.OrderDesc, page.Order)
+	assert.True(t, page.Reversed())
+
+	for _, args := range []connectionArgs{
+		{First: intPtr(1), Last: intPtr(1), Order: "DESC"},
+		{After: &cursor, Before: &cursor, Order: "DESC"},
+		{First: intPtr(1), Before: &cursor, Order: "DESC"},
+		{First: intPtr(0), Order: "DESC"},
+		{First: intPtr(1001), Order: "DESC"},
+		{After: strPtr("nope"), Order: "DESC"},
+		{Order: "sideways"},
+	} {
+		_, err := args.page("ledger", "index")
+		assert.Error(t, err, "%+v", args)
+	}
+}
+
+func TestNewConnectionBackward(t *testing.T) {
+	args := connectionArgs{Last: intPtr(2), Order: "DESC"}
+	page, err := args.page("sequence")
+	require.NoError(t, err)
+	// Scanned ascending from the oldest ledger, with one extra row
+	c := newConnection(args, page, []int{1, 2, 3}, [][]int64{{1}, {2}, {3}}, func(v int) int { return v })
+	assert.Equal(t, []int{2, 1}, c.Nodes())
+	assert.True(t, c.PageInfo().HasPreviousPage())
+	assert.False(t, c.PageInfo().HasNextPage())
+	assert.Equal(t, handlers.Cursor{Key: []int64{2}}.String(), *c.PageInfo().StartCursor())
+}
+
+func TestFilters(t *testing.T) {
+	var q query
+	require.NoError(t, (&transactionFilter{StartLedger: intPtr(5), MemoType: strPtr("none"), Memo: strPtr("hi")}).apply(&q))
+	assert.Equal(t, []string{"ledger >= $1", "COALESCE(memo_type, '') = ''", "memo_value = $2"}, q.conditions)
+	assert.Equal(t, []interface{}{int64(5), "hi"}, q.args)
+
+	q = query{}
+	first := "transfer"
+	require.NoError(t, (&contractEventFilter{Topics: &[]*string{nil, &first}}).apply(&q))
+	assert.Equal(t, []string{"topics->>1 = $1"}, q.conditions)
+
+	assert.Error(t, (&transactionFilter{StartLedger: intPtr(9), EndLedger: intPtr(2)}).apply(&query{}))
+	assert.Error(t, (&transactionFilter{SourceAccount: strPtr("nope")}).apply(&query{}))
+	assert.Error(t, (&operationFilter{Types: &[]string{"teleport"}}).apply(&query{}))
+	assert.Error(t, (&contractEventFilter{Type: strPtr("other")}).apply(&query{}))
+}
+
+func TestSubscriptionsNeedStreaming(t *testing.T) {
+	schema, err := NewSchema(nil, nil)
+	require.NoError(t, err)
+	responses, err := schema.Subscribe(context.Background(), `subscription { ledgerClosed { sequence } }`, "", nil)
+	require.NoError(t, err)
+	var errs []string
+	for response := range responses {
+		for _, e := range response.(*graphql.Response).Errors {
+			errs = append(errs, e.Message)
+		}
+	}
+	assert.Contains(t, errs, ErrStreamingDisabled.Error())
+}
+
+func TestForward(t *testing.T) {
+	messages := make(chan interface{}, 3)
+	messages <- map[string]interface{}{"type": "transaction", "data": models.Transaction{Hash: "ignored"}}
+	messages <- map[string]interface{}{"type": "ledger", "data": models.LedgerInfo{Sequence: 7}}
+	close(messages)
+
+	out := forward(context.Background(), &resolver{}, messages, (*resolver).ledger)
+	ledger := <-out
+	require.NotNil(t, ledger)
+	assert.Equal(t, int32(7), ledger.Sequence())
+	assert.NotNil(t, ledger.r.scope)
+	_, open := <-out
+	assert.False(t, open)
+}
+
+func TestLoadersFailOnBadRows(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	closedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery(`FROM ledgers WHERE sequence = ANY\(\$1\)`).WillReturnRows(sqlmock.NewRows(ledgerColumns).
+		AddRow(int64(10), "l10", "l9", 2, 2, closedAt, int64(5), int64(1), 100, 5000000, 1000, 22).
+		AddRow("eleven", "l11", "l10", 1, 1, closedAt, int64(5), int64(1), 100, 5000000, 1000, 22))
+
+	l := newLoaders(mockDB)
+	l.ledgers.Prime(10, 11)
+	// The batch fails rather than reporting ledger 11 as missing
+	_, _, err = l.ledgers.Load(context.Background(), 10)
+	assert.EqualError(t, err, "failed to read ledgers")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,267 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+// Protocol is the WebSocket subprotocol subscriptions are served with
+const Protocol = "graphql-transport-ws"
+
+// Messages of the graphql-transport-ws protocol
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes of the graphql-transport-ws protocol
+const (
+	closeBadRequest         = 4400
+	closeUnauthorized       = 4401
+	closeInitTimeout        = 4408
+	closeSubscriberExists   = 4409
+	closeTooManyInitRequest = 4429
+)
+
+// initTimeout is how long a WebSocket client has to send connection_init
+const initTimeout = 10 * time.Second
+
+// Handler serves the schema over HTTP: queries as a JSON POST body or as
+// GET query parameters, and subscriptions over WebSocket
+type Handler struct {
+	db     *sql.DB
+	schema *graphql.Schema
+}
+
+// NewHandler returns the handler of the schema resolved against db, with
+// subscriptions fed by hub. The schema is embedded, so it only panics when
+// the schema and its resolvers disagree.
+func NewHandler(db *sql.DB, hub *handlers.WebSocketHub) *Handler {
+	schema, err := NewSchema(db, hub)
+	if err != nil {
+		panic(err)
+	}
+	return &Handler{db: db, schema: schema}
+}
+
+// request is a GraphQL request, also the payload of subscribe messages
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if raw := r.URL.Query().Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				http.Error(w, "variables must be a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "body must be a JSON GraphQL request", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+	response := h.schema.Exec(withLoaders(r.Context(), h.db), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// message is a message of the graphql-transport-ws protocol
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// session is a WebSocket connection speaking graphql-transport-ws. Each
+// subscribe message runs an operation until it completes, the client
+// completes it or the connection closes.
+type session struct {
+	h    *Handler
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu           sync.Mutex
+	acknowledged bool
+	operations   map[string]context.CancelFunc
+}
+
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{Protocol},
+		// Origins are enforced by the CORS middleware for the REST API; the API is read-only
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader writes its own error response
+		return
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != Protocol {
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseProtocolError, "subprotocol "+Protocol+" is required"), time.Now().Add(time.Second))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	s := &session{h: h, conn: conn, operations: map[string]context.CancelFunc{}}
+	s.run(ctx)
+}
+
+// run reads messages until the connection fails or the session closes it
+func (s *session) run(ctx context.Context) {
+	initTimer := time.AfterFunc(initTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.acknowledged {
+			s.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	for {
+		var msg message
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*websocket.CloseError); !ok && ctx.Err() == nil {
+				s.close(closeBadRequest, "Invalid message")
+			}
+			return
+		}
+		switch msg.Type {
+		case msgConnectionInit:
+			s.mu.Lock()
+			already := s.acknowledged
+			s.acknowledged = true
+			s.mu.Unlock()
+			if already {
+				s.close(closeTooManyInitRequest, "Too many initialisation requests")
+				return
+			}
+			s.write(message{Type: msgConnectionAck})
+		case msgPing:
+			s.write(message{Type: msgPong})
+		case msgPong:
+		case msgSubscribe:
+			if !s.subscribe(ctx, msg) {
+				return
+			}
+		case msgComplete:
+			s.finish(msg.ID)
+		default:
+			s.close(closeBadRequest, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// subscribe starts the operation of a subscribe message, reporting false
+// when the session had to be closed instead
+func (s *session) subscribe(ctx context.Context, msg message) bool {
+	var req request
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil || req.Query == "" {
+		s.close(closeBadRequest, "Invalid subscribe message")
+		return false
+	}
+	s.mu.Lock()
+	if !s.acknowledged {
+		s.mu.Unlock()
+		s.close(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, exists := s.operations[msg.ID]; exists {
+		s.mu.Unlock()
+		s.close(closeSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	opCtx, stop := context.WithCancel(withLoaders(ctx, s.h.db))
+	s.operations[msg.ID] = stop
+	s.mu.Unlock()
+
+	responses, err := s.h.schema.Subscribe(opCtx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		s.finish(msg.ID)
+		payload, _ := json.Marshal([]map[string]string{{"message": err.Error()}})
+		s.write(message{ID: msg.ID, Type: msgError, Payload: payload})
+		return true
+	}
+	go func() {
+		for response := range responses {
+			payload, err := json.Marshal(response)
+			if err != nil {
+				continue
+			}
+			s.write(message{ID: msg.ID, Type: msgNext, Payload: payload})
+		}
+		// Operations the client completed are not completed back
+		if s.finish(msg.ID) {
+			s.write(message{ID: msg.ID, Type: msgComplete})
+		}
+	}()
+	return true
+}
+
+// finish forgets a running operation, reporting whether it was still running
+func (s *session) finish(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stop, ok := s.operations[id]
+	if ok {
+		stop()
+		delete(s.operations, id)
+	}
+	return ok
+}
+
+func (s *session) write(msg message) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_ = s.conn.WriteJSON(msg)
+}
+
+// close closes the connection with a protocol close code, which ends the
+// read loop of run
+func (s *session) close(code int, reason string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	_ = s.conn.Close()
+}
@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerHTTP(t *testing.T) {
+	server := httptest.NewServer(NewHandler(nil, nil))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"query":"query($s: Int!) { ledger(sequence: $s) { hash } }","variables":{"s":0}}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]interface{}{"ledger": nil}, body["data"])
+
+	resp, err = http.Get(server.URL + "?query=" + url.QueryEscape("{ __typename }"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]interface{}{"__typename": "Query"}, body["data"])
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandlerWebSocket(t *testing.T) {
+	server := httptest.NewServer(NewHandler(nil, nil))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{Protocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func() message {
+		var msg message
+		require.NoError(t, conn.ReadJSON(&msg))
+		return msg
+	}
+	require.NoError(t, conn.WriteJSON(message{Type: msgConnectionInit}))
+	assert.Equal(t, msgConnectionAck, read().Type)
+	require.NoError(t, conn.WriteJSON(message{Type: msgPing}))
+	assert.Equal(t, msgPong, read().Type)
+
+	// Without a hub the subscription reports the error and completes
+	payload, _ := json.Marshal(request{Query: "subscription { ledgerClosed { sequence } }"})
+	require.NoError(t, conn.WriteJSON(message{ID: "1", Type: msgSubscribe, Payload: payload}))
+	next := read()
+	assert.Equal(t, message{ID: "1", Type: msgNext}, message{ID: next.ID, Type: next.Type})
+	assert.Contains(t, string(next.Payload), ErrStreamingDisabled.Error())
+	assert.Equal(t, message{ID: "1", Type: msgComplete}, read())
+
+	// A second connection_init closes the connection
+	require.NoError(t, conn.WriteJSON(message{Type: msgConnectionInit}))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, closeTooManyInitRequest, closeErr.Code)
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"sync"
+)
+
+// loader batches and caches the loads of one request by key, the way
+// dataloader does. Resolvers that produce a list prime the loaders of its
+// rows' relations with their keys, so the first Load of any of them fetches
+// them all in one query and the others wait for that fetch instead of
+// querying per row.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	batches map[K]*batch[K, V]
+}
+
+// batch is a fetch of several keys; done is closed once values and err are set
+type batch[K comparable, V any] struct {
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+// newLoader returns a loader fetching keys with fetch, which returns the
+// values found keyed by key
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, queued: map[K]bool{}, batches: map[K]*batch[K, V]{}}
+}
+
+// Prime queues keys to be fetched with the next load
+func (l *loader[K, V]) Prime(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if _, loaded := l.batches[key]; !loaded && !l.queued[key] {
+			l.queued[key] = true
+			l.pending = append(l.pending, key)
+		}
+	}
+}
+
+// Load returns the value of key, fetching it with all queued keys unless it
+// was fetched before. found is false for keys fetch returned no value for.
+func (l *loader[K, V]) Load(ctx context.Context, key K) (value V, found bool, err error) {
+	l.mu.Lock()
+	b, ok := l.batches[key]
+	if !ok {
+		keys := l.pending
+		if !l.queued[key] {
+			keys = append(keys, key)
+		}
+		l.pending, l.queued = nil, map[K]bool{}
+		b = &batch[K, V]{done: make(chan struct{})}
+		for _, k := range keys {
+			l.batches[k] = b
+		}
+		l.mu.Unlock()
+		b.values, b.err = l.fetch(ctx, keys)
+		close(b.done)
+	} else {
+		l.mu.Unlock()
+	}
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return value, false, ctx.Err()
+	}
+	if b.err != nil {
+		return value, false, b.err
+	}
+	value, found = b.values[key]
+	return value, found, nil
+}
@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoaderBatchesPrimedKeys(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	l := newLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		values := map[int]string{}
+		for _, key := range keys {
+			if key != 3 {
+				values[key] = string(rune('a' + key))
+			}
+		}
+		return values, nil
+	})
+
+	l.Prime(0, 1, 2, 3, 1)
+	var wg sync.WaitGroup
+	for key := 0; key < 4; key++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			value, found, err := l.Load(context.Background(), key)
+			require.NoError(t, err)
+			assert.Equal(t, key != 3, found)
+			if found {
+				assert.Equal(t, string(rune('a'+key)), value)
+			}
+		}(key)
+	}
+	wg.Wait()
+	assert.Equal(t, [][]int{{0, 1, 2, 3}}, batches)
+
+	// Loaded keys are cached and new ones fetched on their own
+	_, _, err := l.Load(context.Background(), 1)
+	require.NoError(t, err)
+	_, found, err := l.Load(context.Background(), 5)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, [][]int{{0, 1, 2, 3}, {5}}, batches)
+}
+
+func TestLoaderError(t *testing.T) {
+	l := newLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		return nil, errors.New("boom")
+	})
+	l.Prime("a", "b")
+	_, _, err := l.Load(context.Background(), "b")
+	assert.EqualError(t, err, "boom")
+	_, _, err = l.Load(context.Background(), "a")
+	assert.EqualError(t, err, "boom")
+}
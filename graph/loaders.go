@@ -0,0 +1,201 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// loaders are the loaders of one request. Operations and events are loaded
+// by transaction, in chain order.
+type loaders struct {
+	ledgers            *loader[uint32, models.LedgerInfo]
+	transactionsByID   *loader[string, models.Transaction]
+	transactionsByHash *loader[string, models.Transaction]
+	accounts           *loader[string, models.Account]
+	operations         *loader[string, []models.Operation]     // by transaction ID
+	events             *loader[string, []models.ContractEvent] // by transaction hash
+}
+
+type loadersKey struct{}
+
+// withLoaders returns ctx carrying fresh loaders for one request
+func withLoaders(ctx context.Context, db *sql.DB) context.Context {
+	return context.WithValue(ctx, loadersKey{}, newLoaders(db))
+}
+
+// loadersOf returns the loaders of the request of ctx, or fresh ones when
+// the schema is run outside a request
+func loadersOf(ctx context.Context, db *sql.DB) *loaders {
+	if l, ok := ctx.Value(loadersKey{}).(*loaders); ok {
+		return l
+	}
+	return newLoaders(db)
+}
+
+func newLoaders(db *sql.DB) *loaders {
+	l := &loaders{}
+	l.ledgers = newLoader(func(ctx context.Context, sequences []uint32) (map[uint32]models.LedgerInfo, error) {
+		keys := make([]int64, len(sequences))
+		for idx, sequence := range sequences {
+			keys[idx] = int64(sequence)
+		}
+		rows, err := db.QueryContext(ctx, `SELECT `+handlers.LedgerColumns+` FROM ledgers WHERE sequence = ANY($1)`, pq.Array(keys))
+		if err != nil {
+			return nil, errors.New("failed to fetch ledgers")
+		}
+		defer rows.Close()
+		ledgers, err := scanAll(rows, func(r *sql.Rows) (models.LedgerInfo, error) { return handlers.ScanLedger(r) })
+		if err != nil {
+			return nil, errors.New("failed to read ledgers")
+		}
+		byKey := make(map[uint32]models.LedgerInfo, len(ledgers))
+		for _, ledger := range ledgers {
+			byKey[ledger.Sequence] = ledger
+		}
+		return byKey, rows.Err()
+	})
+	l.transactionsByID = newLoader(l.fetchTransactions(db, "id", func(tx models.Transaction) string { return tx.ID }))
+	l.transactionsByHash = newLoader(l.fetchTransactions(db, "hash", func(tx models.Transaction) string { return tx.Hash }))
+	l.accounts = newLoader(func(ctx context.Context, ids []string) (map[string]models.Account, error) {
+		accounts, err := handlers.GetAccounts(ctx, db, ids)
+		if err != nil {
+			return nil, errors.New("failed to fetch accounts")
+		}
+		return accounts, nil
+	})
+	l.operations = newLoader(func(ctx context.Context, txIDs []string) (map[string][]models.Operation, error) {
+		rows, err := db.QueryContext(ctx, `SELECT `+handlers.OperationColumns+` FROM operations
+			WHERE transaction_id = ANY($1) ORDER BY ledger, transaction_index, index`, pq.Array(txIDs))
+		if err != nil {
+			return nil, errors.New("failed to fetch operations")
+		}
+		defer rows.Close()
+		operations, err := scanAll(rows, func(r *sql.Rows) (models.Operation, error) { return handlers.ScanOperation(r) })
+		if err != nil {
+			return nil, errors.New("failed to read operations")
+		}
+		l.primeOperations(operations)
+		byTx := map[string][]models.Operation{}
+		for _, op := range operations {
+			byTx[op.TransactionID] = append(byTx[op.TransactionID], op)
+		}
+		return byTx, rows.Err()
+	})
+	l.events = newLoader(func(ctx context.Context, hashes []string) (map[string][]models.ContractEvent, error) {
+		rows, err := db.QueryContext(ctx, `SELECT `+handlers.ContractEventColumns+` FROM contract_events
+			WHERE transaction_hash = ANY($1) ORDER BY ledger, transaction_index, event_index`, pq.Array(hashes))
+		if err != nil {
+			return nil, errors.New("failed to fetch contract events")
+		}
+		defer rows.Close()
+		events, err := scanAll(rows, func(r *sql.Rows) (models.ContractEvent, error) { return handlers.ScanContractEvent(r) })
+		if err != nil {
+			return nil, errors.New("failed to read contract events")
+		}
+		l.primeEvents(events)
+		byTx := map[string][]models.ContractEvent{}
+		for _, event := range events {
+			byTx[event.TransactionHash] = append(byTx[event.TransactionHash], event)
+		}
+		return byTx, rows.Err()
+	})
+	return l
+}
+
+// fetchTransactions fetches transactions by column, keyed by key
+func (l *loaders) fetchTransactions(db *sql.DB, column string, key func(models.Transaction) string) func(context.Context, []string) (map[string]models.Transaction, error) {
+	return func(ctx context.Context, keys []string) (map[string]models.Transaction, error) {
+		rows, err := db.QueryContext(ctx, `SELECT `+handlers.TransactionColumns+` FROM transactions WHERE `+column+` = ANY($1)`, pq.Array(keys))
+		if err != nil {
+			return nil, errors.New("failed to fetch transactions")
+		}
+		defer rows.Close()
+		transactions, err := scanAll(rows, func(r *sql.Rows) (models.Transaction, error) { return handlers.ScanTransaction(r) })
+		if err != nil {
+			return nil, errors.New("failed to read transactions")
+		}
+		l.primeTransactions(transactions)
+		byKey := make(map[string]models.Transaction, len(transactions))
+		for _, tx := range transactions {
+			byKey[key(tx)] = tx
+		}
+		return byKey, rows.Err()
+	}
+}
+
+// primeTransactions queues the relations of transactions to be loaded together
+func (l *loaders) primeTransactions(transactions []models.Transaction) {
+	for _, tx := range transactions {
+		l.ledgers.Prime(tx.Ledger)
+		l.accounts.Prime(tx.SourceAccount)
+		l.operations.Prime(tx.ID)
+		l.events.Prime(tx.Hash)
+	}
+}
+
+// primeOperations queues the relations of operations to be loaded together
+func (l *loaders) primeOperations(operations []models.Operation) {
+	for _, op := range operations {
+		l.ledgers.Prime(op.Ledger)
+		l.transactionsByID.Prime(op.TransactionID)
+		if op.SourceAccount != "" {
+			l.accounts.Prime(op.SourceAccount)
+		}
+	}
+}
+
+// primeEvents queues the relations of events to be loaded together
+func (l *loaders) primeEvents(events []models.ContractEvent) {
+	for _, event := range events {
+		l.ledgers.Prime(event.Ledger)
+		l.transactionsByHash.Prime(event.TransactionHash)
+	}
+}
+
+// scanAll reads every row with scan, failing on the first row that does not
+// scan so a batch is not returned with rows silently missing
+func scanAll[T any](rows *sql.Rows, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	var values []T
+	for rows.Next() {
+		value, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// scanLedgers reads rows of LedgerColumns with their page keys, skipping
+// rows that fail to scan
+func scanLedgers(rows *sql.Rows) ([]models.LedgerInfo, [][]int64) {
+	var ledgers []models.LedgerInfo
+	var keys [][]int64
+	for rows.Next() {
+		if ledger, err := handlers.ScanLedger(rows); err == nil {
+			ledgers = append(ledgers, ledger)
+			keys = append(keys, []int64{int64(ledger.Sequence)})
+		}
+	}
+	return ledgers, keys
+}
+
+// scanTransactions reads rows of TransactionColumns with their page keys,
+// skipping rows that fail to scan
+func scanTransactions(rows *sql.Rows) ([]models.Transaction, [][]int64) {
+	var transactions []models.Transaction
+	var keys [][]int64
+	for rows.Next() {
+		if tx, err := handlers.ScanTransaction(rows); err == nil {
+			transactions = append(transactions, tx)
+			keys = append(keys, []int64{int64(tx.Ledger), int64(tx.Index)})
+		}
+	}
+	return transactions, keys
+}
@@ -0,0 +1,353 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+type ledgerResolver struct {
+	r      *resolver
+	ledger models.LedgerInfo
+}
+
+func (l *ledgerResolver) Sequence() int32         { return int32(l.ledger.Sequence) }
+func (l *ledgerResolver) Hash() string            { return l.ledger.Hash }
+func (l *ledgerResolver) PreviousHash() string    { return l.ledger.PreviousHash }
+func (l *ledgerResolver) TransactionCount() int32 { return int32(l.ledger.TransactionCount) }
+func (l *ledgerResolver) OperationCount() int32   { return int32(l.ledger.OperationCount) }
+func (l *ledgerResolver) ClosedAt() graphql.Time  { return graphql.Time{Time: l.ledger.ClosedAt} }
+func (l *ledgerResolver) TotalCoins() BigInt      { return BigInt(l.ledger.TotalCoins) }
+func (l *ledgerResolver) FeePool() BigInt         { return BigInt(l.ledger.FeePool) }
+func (l *ledgerResolver) BaseFee() int32          { return int32(l.ledger.BaseFee) }
+func (l *ledgerResolver) BaseReserve() int32      { return int32(l.ledger.BaseReserve) }
+func (l *ledgerResolver) MaxTxSetSize() int32     { return int32(l.ledger.MaxTxSetSize) }
+func (l *ledgerResolver) ProtocolVersion() int32  { return int32(l.ledger.ProtocolVersion) }
+
+// Transactions pages through the transactions of the ledger with one query
+// per ledger
+func (l *ledgerResolver) Transactions(ctx context.Context, args transactionsArgs) (*connection[*transactionResolver], error) {
+	return l.r.transactions(ctx, args.connectionArgs, args.Filter,
+		query{conditions: []string{"ledger = $1"}, args: []interface{}{int64(l.ledger.Sequence)}})
+}
+
+type transactionResolver struct {
+	r  *resolver
+	tx models.Transaction
+}
+
+func (t *transactionResolver) ID() graphql.ID         { return graphql.ID(t.tx.ID) }
+func (t *transactionResolver) Hash() string           { return t.tx.Hash }
+func (t *transactionResolver) LedgerSequence() int32  { return int32(t.tx.Ledger) }
+func (t *transactionResolver) Index() int32           { return int32(t.tx.Index) }
+func (t *transactionResolver) SourceAccount() string  { return t.tx.SourceAccount }
+func (t *transactionResolver) FeePaid() BigInt        { return BigInt(t.tx.FeePaid) }
+func (t *transactionResolver) OperationCount() int32  { return t.tx.OperationCount }
+func (t *transactionResolver) MemoType() *string      { return optional(t.tx.MemoType) }
+func (t *transactionResolver) Memo() *string          { return optional(t.tx.MemoValue) }
+func (t *transactionResolver) Successful() bool       { return t.tx.Successful }
+func (t *transactionResolver) ClosedAt() graphql.Time { return graphql.Time{Time: t.tx.ClosedAt} }
+
+func (t *transactionResolver) Source() *accountResolver {
+	return &accountResolver{r: t.r, id: t.tx.SourceAccount}
+}
+
+func (t *transactionResolver) Ledger(ctx context.Context) (*ledgerResolver, error) {
+	return t.r.loadLedger(ctx, t.tx.Ledger)
+}
+
+func (t *transactionResolver) Operations(ctx context.Context) ([]*operationResolver, error) {
+	operations, _, err := t.r.loaders(ctx).operations.Load(ctx, t.tx.ID)
+	if err != nil {
+		return nil, err
+	}
+	return resolveAll(operations, t.r.operation), nil
+}
+
+func (t *transactionResolver) Events(ctx context.Context) ([]*contractEventResolver, error) {
+	events, _, err := t.r.loaders(ctx).events.Load(ctx, t.tx.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return resolveAll(events, t.r.contractEvent), nil
+}
+
+type operationResolver struct {
+	r  *resolver
+	op models.Operation
+}
+
+func (o *operationResolver) ID() graphql.ID          { return graphql.ID(o.op.ID) }
+func (o *operationResolver) TransactionIndex() int32 { return int32(o.op.TransactionIndex) }
+func (o *operationResolver) Index() int32            { return int32(o.op.Index) }
+func (o *operationResolver) Type() string            { return o.op.Type }
+func (o *operationResolver) SourceAccount() *string  { return optional(o.op.SourceAccount) }
+func (o *operationResolver) Details() JSON           { return JSON(o.op.Details) }
+func (o *operationResolver) LedgerSequence() int32   { return int32(o.op.Ledger) }
+func (o *operationResolver) ClosedAt() graphql.Time  { return graphql.Time{Time: o.op.ClosedAt} }
+
+func (o *operationResolver) Ledger(ctx context.Context) (*ledgerResolver, error) {
+	return o.r.loadLedger(ctx, o.op.Ledger)
+}
+
+func (o *operationResolver) Transaction(ctx context.Context) (*transactionResolver, error) {
+	tx, found, err := o.r.loaders(ctx).transactionsByID.Load(ctx, o.op.TransactionID)
+	if err != nil || !found {
+		return nil, err
+	}
+	return o.r.transaction(tx), nil
+}
+
+// Source is the operation's own source account or else the transaction's
+func (o *operationResolver) Source(ctx context.Context) (*accountResolver, error) {
+	if o.op.SourceAccount != "" {
+		return &accountResolver{r: o.r, id: o.op.SourceAccount}, nil
+	}
+	tx, err := o.Transaction(ctx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	return tx.Source(), nil
+}
+
+func (o *operationResolver) Events(ctx context.Context) ([]*contractEventResolver, error) {
+	tx, err := o.Transaction(ctx)
+	if err != nil || tx == nil {
+		return []*contractEventResolver{}, err
+	}
+	events, _, err := o.r.loaders(ctx).events.Load(ctx, tx.tx.Hash)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := []*contractEventResolver{}
+	for _, event := range events {
+		if event.OperationIndex != nil && *event.OperationIndex == o.op.Index {
+			resolvers = append(resolvers, o.r.contractEvent(event))
+		}
+	}
+	return resolvers, nil
+}
+
+type contractEventResolver struct {
+	r     *resolver
+	event models.ContractEvent
+}
+
+func (e *contractEventResolver) ID() graphql.ID                { return graphql.ID(e.event.ID) }
+func (e *contractEventResolver) ContractID() string            { return e.event.ContractID }
+func (e *contractEventResolver) Type() string                  { return e.event.EventType }
+func (e *contractEventResolver) Data() *JSON                   { return jsonValue(e.event.Data) }
+func (e *contractEventResolver) Decoder() *string              { return optional(e.event.Decoder) }
+func (e *contractEventResolver) Decoded() *JSON                { return jsonValue(e.event.Decoded) }
+func (e *contractEventResolver) InSuccessfulTransaction() bool { return e.event.InSuccessfulTx }
+func (e *contractEventResolver) InSuccessfulContractCall() bool {
+	return e.event.InSuccessfulContractCall
+}
+func (e *contractEventResolver) TransactionIndex() int32 { return int32(e.event.TransactionIndex) }
+func (e *contractEventResolver) EventIndex() int32       { return int32(e.event.EventIndex) }
+func (e *contractEventResolver) LedgerSequence() int32   { return int32(e.event.Ledger) }
+func (e *contractEventResolver) TransactionHash() string { return e.event.TransactionHash }
+func (e *contractEventResolver) ClosedAt() graphql.Time  { return graphql.Time{Time: e.event.ClosedAt} }
+
+func (e *contractEventResolver) Topics() []string {
+	if e.event.Topics == nil {
+		return []string{}
+	}
+	return e.event.Topics
+}
+
+func (e *contractEventResolver) OperationIndex() *int32 {
+	if e.event.OperationIndex == nil {
+		return nil
+	}
+	idx := int32(*e.event.OperationIndex)
+	return &idx
+}
+
+func (e *contractEventResolver) Ledger(ctx context.Context) (*ledgerResolver, error) {
+	return e.r.loadLedger(ctx, e.event.Ledger)
+}
+
+func (e *contractEventResolver) Transaction(ctx context.Context) (*transactionResolver, error) {
+	return e.r.loadTransaction(ctx, e.event.TransactionHash)
+}
+
+func (e *contractEventResolver) Operation(ctx context.Context) (*operationResolver, error) {
+	if e.event.OperationIndex == nil {
+		return nil, nil
+	}
+	tx, err := e.Transaction(ctx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	operations, _, err := e.r.loaders(ctx).operations.Load(ctx, tx.tx.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range operations {
+		if op.Index == *e.event.OperationIndex {
+			return e.r.operation(op), nil
+		}
+	}
+	return nil, nil
+}
+
+// accountResolver is an account by address. Its ledger entry is loaded
+// only when state is asked for.
+type accountResolver struct {
+	r  *resolver
+	id string
+}
+
+func (a *accountResolver) ID() string { return a.id }
+
+func (a *accountResolver) State(ctx context.Context) (*accountStateResolver, error) {
+	account, found, err := a.r.loaders(ctx).accounts.Load(ctx, a.id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &accountStateResolver{account}, nil
+}
+
+// Transactions pages through the transactions the account is the source of
+// or has operations in, with one query per account
+func (a *accountResolver) Transactions(ctx context.Context, args transactionsArgs) (*connection[*transactionResolver], error) {
+	return a.r.transactions(ctx, args.connectionArgs, args.Filter, query{
+		conditions: []string{"(source_account = $1 OR id IN (SELECT transaction_id FROM operations WHERE source_account = $1))"},
+		args:       []interface{}{a.id},
+	})
+}
+
+// Operations pages through the operations the account is the effective
+// source of, with one query per account
+func (a *accountResolver) Operations(ctx context.Context, args operationsArgs) (*connection[*operationResolver], error) {
+	var q query
+	effectiveSource(&q, a.id)
+	return a.r.operations(ctx, args.connectionArgs, args.Filter, q)
+}
+
+func (a *accountResolver) Attestations(ctx context.Context, args struct{ Limit, Offset int32 }) ([]*attestationResolver, error) {
+	return a.r.attestations(ctx, &attestationFilter{Subject: &a.id}, args.Limit, args.Offset)
+}
+
+type accountStateResolver struct {
+	account models.Account
+}
+
+func (s *accountStateResolver) Sequence() BigInt          { return BigInt(s.account.Sequence) }
+func (s *accountStateResolver) Balance() BigInt           { return BigInt(s.account.Balance) }
+func (s *accountStateResolver) BuyingLiabilities() BigInt { return BigInt(s.account.BuyingLiabilities) }
+func (s *accountStateResolver) SellingLiabilities() BigInt {
+	return BigInt(s.account.SellingLiabilities)
+}
+func (s *accountStateResolver) NumSubentries() int32      { return int32(s.account.NumSubentries) }
+func (s *accountStateResolver) NumSponsoring() int32      { return int32(s.account.NumSponsoring) }
+func (s *accountStateResolver) NumSponsored() int32       { return int32(s.account.NumSponsored) }
+func (s *accountStateResolver) Flags() int32              { return int32(s.account.Flags) }
+func (s *accountStateResolver) HomeDomain() *string       { return optional(s.account.HomeDomain) }
+func (s *accountStateResolver) MasterWeight() int32       { return int32(s.account.MasterWeight) }
+func (s *accountStateResolver) LastModifiedLedger() int32 { return int32(s.account.LastModifiedLedger) }
+
+func (s *accountStateResolver) Thresholds() *thresholdsResolver {
+	return &thresholdsResolver{s.account.Thresholds}
+}
+
+func (s *accountStateResolver) Signers() []*signerResolver {
+	signers := make([]*signerResolver, len(s.account.Signers))
+	for idx, signer := range s.account.Signers {
+		signers[idx] = &signerResolver{signer}
+	}
+	return signers
+}
+
+func (s *accountStateResolver) UpdatedAt() *graphql.Time {
+	if s.account.UpdatedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *s.account.UpdatedAt}
+}
+
+type thresholdsResolver struct {
+	thresholds models.AccountThresholds
+}
+
+func (t *thresholdsResolver) Low() int32    { return int32(t.thresholds.Low) }
+func (t *thresholdsResolver) Medium() int32 { return int32(t.thresholds.Medium) }
+func (t *thresholdsResolver) High() int32   { return int32(t.thresholds.High) }
+
+type signerResolver struct {
+	signer models.AccountSigner
+}
+
+func (s *signerResolver) Key() string   { return s.signer.Key }
+func (s *signerResolver) Weight() int32 { return int32(s.signer.Weight) }
+
+type attestationResolver struct {
+	r           *resolver
+	attestation models.Attestation
+}
+
+func (a *attestationResolver) ContractID() string       { return a.attestation.ContractID }
+func (a *attestationResolver) UID() string              { return a.attestation.UID }
+func (a *attestationResolver) SchemaUID() *string       { return optional(a.attestation.SchemaUID) }
+func (a *attestationResolver) Attester() *string        { return optional(a.attestation.Attester) }
+func (a *attestationResolver) Subject() *string         { return optional(a.attestation.Subject) }
+func (a *attestationResolver) Value() *JSON             { return jsonValue(a.attestation.Value) }
+func (a *attestationResolver) ExpiresAt() *graphql.Time { return optionalTime(a.attestation.ExpiresAt) }
+func (a *attestationResolver) Status() string           { return a.attestation.Status }
+func (a *attestationResolver) Revoked() bool            { return a.attestation.Revoked }
+func (a *attestationResolver) RevokedAt() *graphql.Time { return optionalTime(a.attestation.RevokedAt) }
+func (a *attestationResolver) RevocationTransactionHash() *string {
+	return optional(a.attestation.RevocationTx)
+}
+func (a *attestationResolver) EventID() *string        { return optional(a.attestation.EventID) }
+func (a *attestationResolver) ClosedAt() *graphql.Time { return optionalTime(a.attestation.ClosedAt) }
+
+func (a *attestationResolver) RevokedLedger() *int32 {
+	if a.attestation.RevokedLedger == nil {
+		return nil
+	}
+	sequence := int32(*a.attestation.RevokedLedger)
+	return &sequence
+}
+
+func (a *attestationResolver) Ledger(ctx context.Context) (*ledgerResolver, error) {
+	if a.attestation.Ledger == nil {
+		return nil, nil
+	}
+	return a.r.loadLedger(ctx, *a.attestation.Ledger)
+}
+
+func (a *attestationResolver) Transaction(ctx context.Context) (*transactionResolver, error) {
+	if a.attestation.TransactionHash == "" {
+		return nil, nil
+	}
+	return a.r.loadTransaction(ctx, a.attestation.TransactionHash)
+}
+
+// optional returns s as a nullable string, null when empty
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func optionalTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+// resolveAll wraps every row with resolve, returning an empty list for none
+func resolveAll[T, R any](rows []T, resolve func(T) R) []R {
+	resolvers := make([]R, len(rows))
+	for idx, row := range rows {
+		resolvers[idx] = resolve(row)
+	}
+	return resolvers
+}
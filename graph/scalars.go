@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// BigInt is a 64-bit integer, served as a decimal string so JavaScript
+// clients do not lose precision
+type BigInt int64
+
+func (BigInt) ImplementsGraphQLType(name string) bool { return name == "BigInt" }
+
+func (b *BigInt) UnmarshalGraphQL(input interface{}) error {
+	switch v := input.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BigInt %q", v)
+		}
+		*b = BigInt(n)
+	case int32:
+		*b = BigInt(v)
+	default:
+		return fmt.Errorf("wrong type for BigInt: %T", input)
+	}
+	return nil
+}
+
+func (b BigInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(b), 10))
+}
+
+// JSON is a JSON value passed through as stored, such as operation details
+// or event data in the readable scval form
+type JSON json.RawMessage
+
+func (JSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	*j = raw
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// jsonValue returns raw as a nullable JSON value
+func jsonValue(raw []byte) *JSON {
+	if len(raw) == 0 {
+		return nil
+	}
+	j := JSON(raw)
+	return &j
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/daccred/sorobangraph.attest.so/handlers"
+)
+
+// ErrStreamingDisabled is returned for subscriptions while the ingester runs
+// without WebSocket streaming
+var ErrStreamingDisabled = errors.New("subscriptions need WebSocket streaming, set ENABLE_WEBSOCKET=true")
+
+func (r *resolver) LedgerClosed(ctx context.Context) (<-chan *ledgerResolver, error) {
+	messages, err := r.subscribe(ctx, handlers.SubscriptionFilter{Types: []string{"ledger"}})
+	if err != nil {
+		return nil, err
+	}
+	return forward(ctx, r, messages, (*resolver).ledger), nil
+}
+
+func (r *resolver) TransactionIngested(ctx context.Context, args struct{ SourceAccounts *[]string }) (<-chan *transactionResolver, error) {
+	filter := handlers.SubscriptionFilter{Types: []string{"transaction"}}
+	if args.SourceAccounts != nil {
+		for _, raw := range *args.SourceAccounts {
+			source, err := account("sourceAccounts", raw)
+			if err != nil {
+				return nil, err
+			}
+			filter.SourceAccounts = append(filter.SourceAccounts, source)
+		}
+	}
+	messages, err := r.subscribe(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return forward(ctx, r, messages, (*resolver).transaction), nil
+}
+
+func (r *resolver) ContractEventEmitted(ctx context.Context, args struct {
+	ContractIds *[]string
+	Topics      *[]string
+}) (<-chan *contractEventResolver, error) {
+	filter := handlers.SubscriptionFilter{Types: []string{"contract_event"}}
+	if args.ContractIds != nil {
+		for _, raw := range *args.ContractIds {
+			id, err := handlers.NormalizeContractID(raw)
+			if err != nil {
+				return nil, errors.New("invalid contractIds")
+			}
+			filter.ContractIDs = append(filter.ContractIDs, id)
+		}
+	}
+	if args.Topics != nil {
+		filter.Topics = *args.Topics
+	}
+	messages, err := r.subscribe(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return forward(ctx, r, messages, (*resolver).contractEvent), nil
+}
+
+// subscribe registers with the hub for the broadcast messages matching
+// filter until ctx is done
+func (r *resolver) subscribe(ctx context.Context, filter handlers.SubscriptionFilter) (<-chan interface{}, error) {
+	if r.hub == nil {
+		return nil, ErrStreamingDisabled
+	}
+	messages, cancel := r.hub.Subscribe(filter)
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return messages, nil
+}
+
+// forward resolves the data of broadcast messages of type T until the hub
+// closes messages, which it does once ctx is done or when the subscriber
+// falls behind. Each message is resolved with loaders of its own, so the
+// relations of an event are batched without caching rows across events.
+func forward[T any, R any](ctx context.Context, r *resolver, messages <-chan interface{}, resolve func(*resolver, T) R) <-chan R {
+	out := make(chan R)
+	go func() {
+		defer close(out)
+		for message := range messages {
+			msg, _ := message.(map[string]interface{})
+			data, ok := msg["data"].(T)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- resolve(&resolver{db: r.db, hub: r.hub, scope: newLoaders(r.db)}, data):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
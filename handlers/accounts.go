@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+var (
+	// ErrInvalidAccountID is returned for account IDs that are not G... or M... strkeys
+	ErrInvalidAccountID = errors.New("invalid account ID")
+	// ErrAccountNotFound is returned for accounts that are not stored
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// NormalizeAccountID validates a G... or M... address and returns the G...
+// address of the underlying account
+func NormalizeAccountID(id string) (string, error) {
+	version, err := strkey.Version(id)
+	if err != nil || (version != strkey.VersionByteAccountID && version != strkey.VersionByteMuxedAccount) {
+		return "", ErrInvalidAccountID
+	}
+	if _, err := strkey.Decode(version, id); err != nil {
+		return "", ErrInvalidAccountID
+	}
+	return baseAccount(id), nil
+}
+
+// accountFromEntry converts an account ledger entry
+func accountFromEntry(entry xdr.LedgerEntry) models.Account {
+	account := entry.Data.MustAccount()
+	liabilities := account.Liabilities()
+	signers := make([]models.AccountSigner, 0, len(account.Signers))
+	for _, signer := range account.Signers {
+		signers = append(signers, models.AccountSigner{Key: signer.Key.Address(), Weight: uint32(signer.Weight)})
+	}
+	return models.Account{
+		AccountID:          account.AccountId.Address(),
+		Sequence:           int64(account.SeqNum),
+		Balance:            int64(account.Balance),
+		BuyingLiabilities:  int64(liabilities.Buying),
+		SellingLiabilities: int64(liabilities.Selling),
+		NumSubentries:      uint32(account.NumSubEntries),
+		NumSponsoring:      uint32(account.NumSponsoring()),
+		NumSponsored:       uint32(account.NumSponsored()),
+		Thresholds: models.AccountThresholds{
+			Low:    account.ThresholdLow(),
+			Medium: account.ThresholdMedium(),
+			High:   account.ThresholdHigh(),
+		},
+		Flags:              uint32(account.Flags),
+		HomeDomain:         string(account.HomeDomain),
+		MasterWeight:       account.MasterKeyWeight(),
+		Signers:            signers,
+		LastModifiedLedger: uint32(entry.LastModifiedLedgerSeq),
+	}
+}
+
+// transactionAccounts lists the source accounts of a transaction and its
+// operations as G... addresses
+func transactionAccounts(tx ingest.LedgerTransaction) []string {
+	accounts := []string{tx.Envelope.SourceAccount().ToAccountId().Address()}
+	for _, op := range tx.Envelope.Operations() {
+		if op.SourceAccount != nil {
+			accounts = append(accounts, op.SourceAccount.ToAccountId().Address())
+		}
+	}
+	return accounts
+}
+
+// processAccountChange applies a created, updated or merged account to
+// accounts and account_history. Accounts that are not tracked are only
+// updated when they are already stored, so once an account is seen in a
+// kept transaction its state stays current.
+func (i *Ingester) processAccountChange(dbTx *sql.Tx, ledgerSeq uint32, change ingest.Change, track bool) error {
+	if change.Post == nil {
+		if change.Pre == nil {
+			return nil
+		}
+		accountID := change.Pre.Data.MustAccount().AccountId.Address()
+		// A re-ingested old ledger must not remove an account that was
+		// recreated since
+		res, err := dbTx.Exec(`DELETE FROM accounts WHERE account_id = $1 AND last_modified_ledger < $2`, accountID, ledgerSeq)
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 && !track {
+			if stored, err := accountStored(dbTx, accountID); err != nil || !stored {
+				return err
+			}
+		}
+		if _, err := dbTx.Exec(`
+			INSERT INTO account_history (account_id, ledger, deleted) VALUES ($1, $2, true)
+			ON CONFLICT (account_id, ledger) DO UPDATE SET deleted = true`, accountID, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to record account removal: %w", err)
+		}
+		return nil
+	}
+
+	account := accountFromEntry(*change.Post)
+	thresholdsJSON, _ := json.Marshal(account.Thresholds)
+	signersJSON, _ := json.Marshal(account.Signers)
+	args := []interface{}{account.AccountID, account.Sequence, account.Balance,
+		account.BuyingLiabilities, account.SellingLiabilities, account.NumSubentries,
+		account.NumSponsoring, account.NumSponsored, account.LastModifiedLedger,
+		thresholdsJSON, account.Flags, account.HomeDomain, account.MasterWeight, signersJSON}
+
+	var res sql.Result
+	var err error
+	if track {
+		res, err = dbTx.Exec(`
+			INSERT INTO accounts (account_id, sequence, balance, buying_liabilities, selling_liabilities,
+				num_subentries, num_sponsoring, num_sponsored, last_modified_ledger,
+				thresholds, flags, home_domain, master_weight, signers)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			ON CONFLICT (account_id) DO UPDATE SET
+				sequence = EXCLUDED.sequence, balance = EXCLUDED.balance,
+				buying_liabilities = EXCLUDED.buying_liabilities, selling_liabilities = EXCLUDED.selling_liabilities,
+				num_subentries = EXCLUDED.num_subentries, num_sponsoring = EXCLUDED.num_sponsoring,
+				num_sponsored = EXCLUDED.num_sponsored, last_modified_ledger = EXCLUDED.last_modified_ledger,
+				thresholds = EXCLUDED.thresholds, flags = EXCLUDED.flags, home_domain = EXCLUDED.home_domain,
+				master_weight = EXCLUDED.master_weight, signers = EXCLUDED.signers
+			WHERE accounts.last_modified_ledger <= EXCLUDED.last_modified_ledger`, args...)
+	} else {
+		res, err = dbTx.Exec(`
+			UPDATE accounts SET sequence = $2, balance = $3, buying_liabilities = $4, selling_liabilities = $5,
+				num_subentries = $6, num_sponsoring = $7, num_sponsored = $8, last_modified_ledger = $9,
+				thresholds = $10, flags = $11, home_domain = $12, master_weight = $13, signers = $14
+			WHERE account_id = $1 AND last_modified_ledger <= $9`, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store account: %w", err)
+	}
+	// Current state only moves forward: ledgers older than the stored state,
+	// as re-ingested by backfills and repairs, only add to the history
+	if n, err := res.RowsAffected(); err == nil && n == 0 && !track {
+		if stored, err := accountStored(dbTx, account.AccountID); err != nil || !stored {
+			return err // not tracked
+		}
+	}
+
+	if _, err := dbTx.Exec(`
+		INSERT INTO account_history (account_id, ledger, sequence, balance, buying_liabilities, selling_liabilities,
+			num_subentries, num_sponsoring, num_sponsored, last_modified_ledger,
+			thresholds, flags, home_domain, master_weight, signers)
+		VALUES ($1, $15, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (account_id, ledger) DO UPDATE SET
+			sequence = EXCLUDED.sequence, balance = EXCLUDED.balance,
+			buying_liabilities = EXCLUDED.buying_liabilities, selling_liabilities = EXCLUDED.selling_liabilities,
+			num_subentries = EXCLUDED.num_subentries, num_sponsoring = EXCLUDED.num_sponsoring,
+			num_sponsored = EXCLUDED.num_sponsored, last_modified_ledger = EXCLUDED.last_modified_ledger,
+			thresholds = EXCLUDED.thresholds, flags = EXCLUDED.flags, home_domain = EXCLUDED.home_domain,
+			master_weight = EXCLUDED.master_weight, signers = EXCLUDED.signers, deleted = false`,
+		append(args, ledgerSeq)...); err != nil {
+		return fmt.Errorf("failed to record account history: %w", err)
+	}
+	return nil
+}
+
+// accountStored reports whether an account has a current state stored
+func accountStored(dbTx *sql.Tx, accountID string) (bool, error) {
+	var stored bool
+	if err := dbTx.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE account_id = $1)`, accountID).Scan(&stored); err != nil {
+		return false, fmt.Errorf("failed to look up account: %w", err)
+	}
+	return stored, nil
+}
+
+const accountColumns = `account_id, sequence, balance, buying_liabilities, selling_liabilities,
+	num_subentries, num_sponsoring, num_sponsored, last_modified_ledger,
+	thresholds, flags, home_domain, master_weight, signers`
+
+// GetAccount returns the latest stored state of an account
+func GetAccount(ctx context.Context, db *sql.DB, accountID string) (models.Account, error) {
+	id, err := NormalizeAccountID(accountID)
+	if err != nil {
+		return models.Account{}, err
+	}
+	var updatedAt sql.NullTime
+	var account models.Account
+	row := db.QueryRowContext(ctx, `SELECT `+accountColumns+`, updated_at FROM accounts WHERE account_id = $1`, id)
+	if err := scanAccount(row, &account, &updatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return account, ErrAccountNotFound
+		}
+		return account, err
+	}
+	if updatedAt.Valid {
+		account.UpdatedAt = &updatedAt.Time
+	}
+	return account, nil
+}
+
+// GetAccounts returns the latest stored states of the accounts with the
+// given G... IDs, keyed by ID. Accounts that are not stored are left out.
+func GetAccounts(ctx context.Context, db *sql.DB, accountIDs []string) (map[string]models.Account, error) {
+	accounts := make(map[string]models.Account, len(accountIDs))
+	rows, err := db.QueryContext(ctx, `SELECT `+accountColumns+`, updated_at FROM accounts WHERE account_id = ANY($1)`,
+		pq.Array(accountIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var updatedAt sql.NullTime
+		var account models.Account
+		if err := scanAccount(rows, &account, &updatedAt); err != nil {
+			return nil, err
+		}
+		if updatedAt.Valid {
+			account.UpdatedAt = &updatedAt.Time
+		}
+		accounts[account.AccountID] = account
+	}
+	return accounts, rows.Err()
+}
+
+// AccountHistory lists the recorded states of an account, newest first
+func AccountHistory(ctx context.Context, db *sql.DB, accountID string, limit, offset int) ([]models.AccountHistoryEntry, error) {
+	id, err := NormalizeAccountID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT ledger, deleted, `+accountColumns+`
+		FROM account_history WHERE account_id = $1
+		ORDER BY ledger DESC
+		LIMIT $2 OFFSET $3`, id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := []models.AccountHistoryEntry{}
+	for rows.Next() {
+		var entry models.AccountHistoryEntry
+		// Columns other than the key are NULL for removed accounts
+		var n [10]sql.NullInt64
+		var thresholds, signers []byte
+		var homeDomain sql.NullString
+		if err := rows.Scan(&entry.Ledger, &entry.Deleted, &entry.AccountID,
+			&n[0], &n[1], &n[2], &n[3], &n[4], &n[5], &n[6], &n[7],
+			&thresholds, &n[8], &homeDomain, &n[9], &signers); err != nil {
+			return nil, err
+		}
+		entry.Sequence = n[0].Int64
+		entry.Balance = n[1].Int64
+		entry.BuyingLiabilities = n[2].Int64
+		entry.SellingLiabilities = n[3].Int64
+		entry.NumSubentries = uint32(n[4].Int64)
+		entry.NumSponsoring = uint32(n[5].Int64)
+		entry.NumSponsored = uint32(n[6].Int64)
+		entry.LastModifiedLedger = uint32(n[7].Int64)
+		entry.Flags = uint32(n[8].Int64)
+		entry.HomeDomain = homeDomain.String
+		entry.MasterWeight = uint8(n[9].Int64)
+		if err := decodeAccountJSON(thresholds, signers, &entry.Account); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+func scanAccount(row rowScanner, account *models.Account, updatedAt *sql.NullTime) error {
+	var thresholds, signers []byte
+	var homeDomain sql.NullString
+	var masterWeight, flags sql.NullInt64
+	if err := row.Scan(&account.AccountID, &account.Sequence, &account.Balance,
+		&account.BuyingLiabilities, &account.SellingLiabilities, &account.NumSubentries,
+		&account.NumSponsoring, &account.NumSponsored, &account.LastModifiedLedger,
+		&thresholds, &flags, &homeDomain, &masterWeight, &signers, updatedAt); err != nil {
+		return err
+	}
+	account.Flags = uint32(flags.Int64)
+	account.HomeDomain = homeDomain.String
+	account.MasterWeight = uint8(masterWeight.Int64)
+	return decodeAccountJSON(thresholds, signers, account)
+}
+
+// decodeAccountJSON fills the JSONB columns of an account row
+func decodeAccountJSON(thresholds, signers []byte, account *models.Account) error {
+	if len(thresholds) > 0 {
+		if err := json.Unmarshal(thresholds, &account.Thresholds); err != nil {
+			return err
+		}
+	}
+	account.Signers = []models.AccountSigner{}
+	if len(signers) > 0 {
+		if err := json.Unmarshal(signers, &account.Signers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
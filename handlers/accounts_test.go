@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccount = "GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H"
+
+func accountEntry(address string, balance int64, lastModified uint32) *xdr.LedgerEntry {
+	return &xdr.LedgerEntry{
+		LastModifiedLedgerSeq: xdr.Uint32(lastModified),
+		Data: xdr.LedgerEntryData{
+			Type: xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{
+				AccountId:  xdr.MustAddress(address),
+				Balance:    xdr.Int64(balance),
+				SeqNum:     xdr.SequenceNumber(12),
+				Flags:      2,
+				HomeDomain: "attest.so",
+				Signers: []xdr.Signer{{
+					Key:    xdr.SignerKey{Type: xdr.SignerKeyTypeSignerKeyTypeEd25519, Ed25519: xdr.MustAddress(address).Ed25519},
+					Weight: 5,
+				}},
+			},
+		},
+	}
+}
+
+func TestProcessAccountChange(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	entry := accountEntry(testAccount, 1000, 40)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO accounts").
+		WithArgs(testAccount, int64(12), int64(1000), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), uint32(40), sqlmock.AnyArg(), uint32(2), "attest.so", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO account_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	// Untracked accounts are only updated when already stored
+	mock.ExpectExec("UPDATE accounts SET").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(testAccount).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("UPDATE accounts SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO account_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	// Merged accounts are removed and the removal recorded
+	mock.ExpectExec("DELETE FROM accounts").WithArgs(testAccount, uint32(43)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO account_history \\(account_id, ledger, deleted\\)").
+		WithArgs(testAccount, uint32(43)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processAccountChange(dbTx, 40, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Post: entry}, true))
+	require.NoError(t, ingester.processAccountChange(dbTx, 41, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Post: entry}, false))
+	require.NoError(t, ingester.processAccountChange(dbTx, 42, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Post: entry}, false))
+	require.NoError(t, ingester.processAccountChange(dbTx, 43, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Pre: entry}, false))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessAccountChangeOldLedger(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	entry := accountEntry(testAccount, 1000, 40)
+	exists := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"exists"}).AddRow(true) }
+
+	// The stored state is newer: nothing is overwritten or deleted, but the
+	// history of the old ledger is still recorded
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO accounts .* WHERE accounts.last_modified_ledger <= EXCLUDED.last_modified_ledger").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO account_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE accounts SET .* AND last_modified_ledger <= \\$9").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(testAccount).WillReturnRows(exists())
+	mock.ExpectExec("INSERT INTO account_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM accounts WHERE account_id = \\$1 AND last_modified_ledger < \\$2").
+		WithArgs(testAccount, uint32(41)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(testAccount).WillReturnRows(exists())
+	mock.ExpectExec("INSERT INTO account_history \\(account_id, ledger, deleted\\)").
+		WithArgs(testAccount, uint32(41)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processAccountChange(dbTx, 40, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Post: entry}, true))
+	require.NoError(t, ingester.processAccountChange(dbTx, 40, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Post: entry}, false))
+	require.NoError(t, ingester.processAccountChange(dbTx, 41, ingest.Change{Type: xdr.LedgerEntryTypeAccount, Pre: entry}, false))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAccount(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	columns := []string{"account_id", "sequence", "balance", "buying_liabilities", "selling_liabilities",
+		"num_subentries", "num_sponsoring", "num_sponsored", "last_modified_ledger",
+		"thresholds", "flags", "home_domain", "master_weight", "signers", "updated_at"}
+	mock.ExpectQuery("FROM accounts WHERE account_id = \\$1").WithArgs(testAccount).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(testAccount, 12, 1000, 0, 0, 1, 0, 0, 40,
+			[]byte(`{"low":1,"medium":2,"high":3}`), 2, "attest.so", 1, []byte(`[{"key":"GABC","weight":5}]`), time.Now()))
+
+	account, err := GetAccount(context.Background(), mockDB, testAccount)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), account.Balance)
+	assert.Equal(t, uint8(3), account.Thresholds.High)
+	assert.Equal(t, "attest.so", account.HomeDomain)
+	require.Len(t, account.Signers, 1)
+	assert.Equal(t, uint32(5), account.Signers[0].Weight)
+
+	mock.ExpectQuery("FROM accounts WHERE account_id = \\$1").WithArgs(testAccount).
+		WillReturnRows(sqlmock.NewRows(columns))
+	_, err = GetAccount(context.Background(), mockDB, testAccount)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	_, err = GetAccount(context.Background(), mockDB, EncodeContractID(xdr.ContractId{1}))
+	assert.ErrorIs(t, err, ErrInvalidAccountID)
+
+	mock.ExpectQuery("FROM accounts WHERE account_id = ANY").WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(testAccount, 12, 1000, 0, 0, 1, 0, 0, 40,
+			[]byte(`{"low":1,"medium":2,"high":3}`), 2, nil, 1, nil, nil))
+	accounts, err := GetAccounts(context.Background(), mockDB, []string{testAccount, testIssuer})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, int64(1000), accounts[testAccount].Balance)
+	assert.Nil(t, accounts[testAccount].UpdatedAt)
+
+	// History rows of removed accounts have NULL state
+	mock.ExpectQuery("FROM account_history WHERE account_id = \\$1").WithArgs(testAccount, 10, 0).
+		WillReturnRows(sqlmock.NewRows(append([]string{"ledger", "deleted"}, columns[:14]...)).
+			AddRow(43, true, testAccount, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil).
+			AddRow(40, false, testAccount, 12, 1000, 0, 0, 1, 0, 0, 40, []byte(`{"low":1,"medium":2,"high":3}`), 2, "attest.so", 1, []byte(`[]`)))
+	history, err := AccountHistory(context.Background(), mockDB, testAccount, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.True(t, history[0].Deleted)
+	assert.Equal(t, int64(1000), history[1].Balance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Asset types as stored in assets.asset_type and trustlines.asset_type
+const (
+	AssetTypeNative           = "native"
+	AssetTypeCreditAlphanum4  = "credit_alphanum4"
+	AssetTypeCreditAlphanum12 = "credit_alphanum12"
+)
+
+// ErrInvalidAsset is returned for asset identifiers that are neither
+// "native" nor CODE:ISSUER
+var ErrInvalidAsset = errors.New("invalid asset")
+
+// assetModel splits an asset into its type, code and issuer
+func assetModel(asset xdr.Asset) models.Asset {
+	switch asset.Type {
+	case xdr.AssetTypeAssetTypeCreditAlphanum4:
+		return models.Asset{AssetType: AssetTypeCreditAlphanum4, AssetCode: asset.GetCode(), AssetIssuer: asset.GetIssuer()}
+	case xdr.AssetTypeAssetTypeCreditAlphanum12:
+		return models.Asset{AssetType: AssetTypeCreditAlphanum12, AssetCode: asset.GetCode(), AssetIssuer: asset.GetIssuer()}
+	}
+	return models.Asset{AssetType: AssetTypeNative}
+}
+
+// ParseAsset parses "native" or a CODE:ISSUER asset identifier
+func ParseAsset(id string) (models.Asset, error) {
+	if id == "native" {
+		return models.Asset{AssetType: AssetTypeNative}, nil
+	}
+	code, issuer, ok := strings.Cut(id, ":")
+	if !ok || code == "" || len(code) > 12 {
+		return models.Asset{}, ErrInvalidAsset
+	}
+	for _, r := range code {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return models.Asset{}, ErrInvalidAsset
+		}
+	}
+	if _, err := strkey.Decode(strkey.VersionByteAccountID, issuer); err != nil {
+		return models.Asset{}, ErrInvalidAsset
+	}
+	assetType := AssetTypeCreditAlphanum4
+	if len(code) > 4 {
+		assetType = AssetTypeCreditAlphanum12
+	}
+	return models.Asset{AssetType: assetType, AssetCode: code, AssetIssuer: issuer}, nil
+}
+
+// storeAsset records an asset, keeping the earliest ledger it was seen in and
+// its Stellar Asset Contract address once known
+func (i *Ingester) storeAsset(dbTx *sql.Tx, asset xdr.Asset, ledgerSeq uint32, contractID string) error {
+	a := assetModel(asset)
+	if _, err := dbTx.Exec(`
+		INSERT INTO assets (asset_type, asset_code, asset_issuer, contract_id, first_seen_ledger)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (asset_type, asset_code, asset_issuer) DO UPDATE SET
+			contract_id = COALESCE(EXCLUDED.contract_id, assets.contract_id),
+			first_seen_ledger = LEAST(assets.first_seen_ledger, EXCLUDED.first_seen_ledger)`,
+		a.AssetType, a.AssetCode, a.AssetIssuer, contractID, ledgerSeq); err != nil {
+		return fmt.Errorf("failed to store asset: %w", err)
+	}
+	return nil
+}
+
+// discoverAssets records the assets used by an operation of a successful
+// transaction: trusted, paid and traded assets, and assets whose Stellar
+// Asset Contract it deploys
+func (i *Ingester) discoverAssets(dbTx *sql.Tx, ledgerSeq uint32, op xdr.Operation, tx ingest.LedgerTransaction) error {
+	if !tx.Result.Successful() {
+		return nil
+	}
+	for _, asset := range operationAssets(op) {
+		if asset.Type == xdr.AssetTypeAssetTypeNative {
+			continue
+		}
+		if err := i.storeAsset(dbTx, asset, ledgerSeq, ""); err != nil {
+			return err
+		}
+	}
+	if op.Body.Type != xdr.OperationTypeInvokeHostFunction {
+		return nil
+	}
+	var preimage xdr.ContractIdPreimage
+	switch hostFn := op.Body.MustInvokeHostFunctionOp().HostFunction; hostFn.Type {
+	case xdr.HostFunctionTypeHostFunctionTypeCreateContract:
+		preimage = hostFn.MustCreateContract().ContractIdPreimage
+	case xdr.HostFunctionTypeHostFunctionTypeCreateContractV2:
+		preimage = hostFn.MustCreateContractV2().ContractIdPreimage
+	default:
+		return nil
+	}
+	if preimage.Type != xdr.ContractIdPreimageTypeContractIdPreimageFromAsset || preimage.FromAsset == nil {
+		return nil
+	}
+	contractHash, err := preimage.FromAsset.ContractID(i.networkPassphrase)
+	if err != nil {
+		return fmt.Errorf("failed to derive asset contract ID: %w", err)
+	}
+	return i.storeAsset(dbTx, *preimage.FromAsset, ledgerSeq, EncodeContractID(contractHash))
+}
+
+// processTrustlineChange applies a created, updated or removed trustline to
+// trustlines. Like accounts, untracked trustlines are only updated when
+// already stored. Liquidity pool share trustlines are skipped.
+func (i *Ingester) processTrustlineChange(dbTx *sql.Tx, ledgerSeq uint32, change ingest.Change, track bool) error {
+	entry := change.Post
+	if entry == nil {
+		entry = change.Pre
+	}
+	if entry == nil {
+		return nil
+	}
+	line := entry.Data.MustTrustLine()
+	if line.Asset.Type == xdr.AssetTypeAssetTypePoolShare {
+		return nil
+	}
+	accountID := line.AccountId.Address()
+	asset := assetModel(line.Asset.ToAsset())
+
+	// Like accounts, current state only moves forward so re-ingesting an old
+	// ledger neither rolls a trustline back nor removes a recreated one
+	if change.Post == nil {
+		if _, err := dbTx.Exec(`
+			DELETE FROM trustlines
+			WHERE account_id = $1 AND asset_code = $2 AND asset_issuer = $3 AND last_modified_ledger < $4`,
+			accountID, asset.AssetCode, asset.AssetIssuer, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to delete trustline: %w", err)
+		}
+		return nil
+	}
+
+	liabilities := line.Liabilities()
+	args := []interface{}{accountID, asset.AssetType, asset.AssetCode, asset.AssetIssuer,
+		int64(line.Balance), int64(line.Limit), int64(liabilities.Buying), int64(liabilities.Selling),
+		uint32(line.Flags), uint32(entry.LastModifiedLedgerSeq)}
+	var err error
+	if track {
+		_, err = dbTx.Exec(`
+			INSERT INTO trustlines (account_id, asset_type, asset_code, asset_issuer, balance, trust_limit,
+				buying_liabilities, selling_liabilities, flags, last_modified_ledger)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (account_id, asset_code, asset_issuer) DO UPDATE SET
+				balance = EXCLUDED.balance, trust_limit = EXCLUDED.trust_limit,
+				buying_liabilities = EXCLUDED.buying_liabilities, selling_liabilities = EXCLUDED.selling_liabilities,
+				flags = EXCLUDED.flags, last_modified_ledger = EXCLUDED.last_modified_ledger
+			WHERE trustlines.last_modified_ledger <= EXCLUDED.last_modified_ledger`, args...)
+	} else {
+		_, err = dbTx.Exec(`
+			UPDATE trustlines SET balance = $5, trust_limit = $6, buying_liabilities = $7,
+				selling_liabilities = $8, flags = $9, last_modified_ledger = $10
+			WHERE account_id = $1 AND asset_type = $2 AND asset_code = $3 AND asset_issuer = $4
+				AND last_modified_ledger <= $10`, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store trustline: %w", err)
+	}
+	return nil
+}
+
+const balanceColumns = `account_id, asset_type, asset_code, asset_issuer, balance, trust_limit,
+	buying_liabilities, selling_liabilities, flags, last_modified_ledger`
+
+// nativeBalanceColumns selects balanceColumns from the accounts table
+const nativeBalanceColumns = `account_id, 'native' AS asset_type, '' AS asset_code, '' AS asset_issuer, balance,
+	0 AS trust_limit, buying_liabilities, selling_liabilities, 0 AS flags, last_modified_ledger`
+
+// AccountBalances lists an account's native balance followed by its
+// trustlines
+func AccountBalances(ctx context.Context, db *sql.DB, accountID string) ([]models.Balance, error) {
+	id, err := NormalizeAccountID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+balanceColumns+` FROM (
+			SELECT `+nativeBalanceColumns+`, 0 AS position FROM accounts WHERE account_id = $1
+			UNION ALL
+			SELECT `+balanceColumns+`, 1 FROM trustlines WHERE account_id = $1
+		) b
+		ORDER BY position, asset_code, asset_issuer`, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanBalances(rows)
+}
+
+// AssetHolders lists the accounts holding an asset, largest balance first
+func AssetHolders(ctx context.Context, db *sql.DB, assetID string, limit, offset int) ([]models.Balance, error) {
+	asset, err := ParseAsset(assetID)
+	if err != nil {
+		return nil, err
+	}
+	var rows *sql.Rows
+	if asset.AssetType == AssetTypeNative {
+		rows, err = db.QueryContext(ctx, `
+			SELECT `+nativeBalanceColumns+`
+			FROM accounts ORDER BY balance DESC, account_id
+			LIMIT $1 OFFSET $2`, limit, offset)
+	} else {
+		rows, err = db.QueryContext(ctx, `
+			SELECT `+balanceColumns+` FROM trustlines
+			WHERE asset_code = $1 AND asset_issuer = $2
+			ORDER BY balance DESC, account_id
+			LIMIT $3 OFFSET $4`, asset.AssetCode, asset.AssetIssuer, limit, offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanBalances(rows)
+}
+
+func scanBalances(rows *sql.Rows) ([]models.Balance, error) {
+	defer rows.Close()
+	balances := []models.Balance{}
+	for rows.Next() {
+		var b models.Balance
+		if err := rows.Scan(&b.AccountID, &b.AssetType, &b.AssetCode, &b.AssetIssuer, &b.Balance, &b.Limit,
+			&b.BuyingLiabilities, &b.SellingLiabilities, &b.Flags, &b.LastModifiedLedger); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// ListAssets lists discovered assets, optionally only those with a code
+func ListAssets(ctx context.Context, db *sql.DB, code string, limit, offset int) ([]models.Asset, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT asset_type, COALESCE(asset_code, ''), COALESCE(asset_issuer, ''),
+		       COALESCE(contract_id, ''), COALESCE(first_seen_ledger, 0)
+		FROM assets
+		WHERE $1 = '' OR asset_code = $1
+		ORDER BY asset_code, asset_issuer
+		LIMIT $2 OFFSET $3`, code, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assets := []models.Asset{}
+	for rows.Next() {
+		var a models.Asset
+		if err := rows.Scan(&a.AssetType, &a.AssetCode, &a.AssetIssuer, &a.ContractID, &a.FirstSeenLedger); err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
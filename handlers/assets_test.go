@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+const testIssuer = "GAHK7EEG2WWHVKDNT4CEQFZGKF2LGDSW2IVM4S5DP42RBW3K6BTODB4A"
+
+func TestParseAsset(t *testing.T) {
+	tests := []struct {
+		input string
+		want  models.Asset
+		valid bool
+	}{
+		{"native", models.Asset{AssetType: AssetTypeNative}, true},
+		{"USDC:" + testIssuer, models.Asset{AssetType: AssetTypeCreditAlphanum4, AssetCode: "USDC", AssetIssuer: testIssuer}, true},
+		{"ATTEST:" + testIssuer, models.Asset{AssetType: AssetTypeCreditAlphanum12, AssetCode: "ATTEST", AssetIssuer: testIssuer}, true},
+		{"USDC", models.Asset{}, false},
+		{"US-DC:" + testIssuer, models.Asset{}, false},
+		{"TOOLONGASSETCODE:" + testIssuer, models.Asset{}, false},
+		{"USDC:" + EncodeContractID(xdr.ContractId{1}), models.Asset{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			asset, err := ParseAsset(tt.input)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidAsset)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, asset)
+		})
+	}
+}
+
+func TestDiscoverAssets(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, networkPassphrase: "Test SDF Network ; September 2015", logger: logrus.NewEntry(logrus.New())}
+	usdc := creditAsset("USDC", testIssuer)
+	changeTrust := xdr.Operation{Body: xdr.OperationBody{
+		Type:          xdr.OperationTypeChangeTrust,
+		ChangeTrustOp: &xdr.ChangeTrustOp{Line: xdr.ChangeTrustAsset{Type: usdc.Type, AlphaNum4: usdc.AlphaNum4}},
+	}}
+	deploySAC := xdr.Operation{Body: xdr.OperationBody{
+		Type: xdr.OperationTypeInvokeHostFunction,
+		InvokeHostFunctionOp: &xdr.InvokeHostFunctionOp{HostFunction: xdr.HostFunction{
+			Type: xdr.HostFunctionTypeHostFunctionTypeCreateContract,
+			CreateContract: &xdr.CreateContractArgs{ContractIdPreimage: xdr.ContractIdPreimage{
+				Type:      xdr.ContractIdPreimageTypeContractIdPreimageFromAsset,
+				FromAsset: &usdc,
+			}},
+		}},
+	}}
+	contractHash, err := usdc.ContractID(ingester.networkPassphrase)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO assets").
+		WithArgs(AssetTypeCreditAlphanum4, "USDC", testIssuer, "", uint32(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO assets").
+		WithArgs(AssetTypeCreditAlphanum4, "USDC", testIssuer, EncodeContractID(contractHash), uint32(11)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.discoverAssets(dbTx, 10, changeTrust, ingest.LedgerTransaction{}))
+	require.NoError(t, ingester.discoverAssets(dbTx, 11, deploySAC, ingest.LedgerTransaction{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessTrustlineChange(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	usdc := creditAsset("USDC", testIssuer)
+	trustline := func(assetType xdr.AssetType) *xdr.LedgerEntry {
+		return &xdr.LedgerEntry{
+			LastModifiedLedgerSeq: 20,
+			Data: xdr.LedgerEntryData{
+				Type: xdr.LedgerEntryTypeTrustline,
+				TrustLine: &xdr.TrustLineEntry{
+					AccountId: xdr.MustAddress(testAccount),
+					Asset:     xdr.TrustLineAsset{Type: assetType, AlphaNum4: usdc.AlphaNum4},
+					Balance:   500,
+					Limit:     1000,
+					Flags:     1,
+				},
+			},
+		}
+	}
+	entry := trustline(xdr.AssetTypeAssetTypeCreditAlphanum4)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO trustlines .* WHERE trustlines.last_modified_ledger <= EXCLUDED.last_modified_ledger").
+		WithArgs(testAccount, AssetTypeCreditAlphanum4, "USDC", testIssuer, int64(500), int64(1000),
+			int64(0), int64(0), uint32(1), uint32(20)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE trustlines SET .* AND last_modified_ledger <= \\$10").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM trustlines\\s+WHERE .* AND last_modified_ledger < \\$4").
+		WithArgs(testAccount, "USDC", testIssuer, uint32(22)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processTrustlineChange(dbTx, 20, ingest.Change{Type: xdr.LedgerEntryTypeTrustline, Post: entry}, true))
+	require.NoError(t, ingester.processTrustlineChange(dbTx, 21, ingest.Change{Type: xdr.LedgerEntryTypeTrustline, Post: entry}, false))
+	require.NoError(t, ingester.processTrustlineChange(dbTx, 22, ingest.Change{Type: xdr.LedgerEntryTypeTrustline, Pre: entry}, false))
+	// Liquidity pool shares are not balances of an asset
+	pool := trustline(xdr.AssetTypeAssetTypePoolShare)
+	require.NoError(t, ingester.processTrustlineChange(dbTx, 22, ingest.Change{Type: xdr.LedgerEntryTypeTrustline, Post: pool}, true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAssetHolders(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	columns := []string{"account_id", "asset_type", "asset_code", "asset_issuer", "balance", "trust_limit",
+		"buying_liabilities", "selling_liabilities", "flags", "last_modified_ledger"}
+	mock.ExpectQuery("FROM trustlines\\s+WHERE asset_code = \\$1 AND asset_issuer = \\$2").
+		WithArgs("USDC", testIssuer, 50, 0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(testAccount, AssetTypeCreditAlphanum4, "USDC", testIssuer, 500, 1000, 0, 0, 1, 20))
+	holders, err := AssetHolders(context.Background(), mockDB, "USDC:"+testIssuer, 50, 0)
+	require.NoError(t, err)
+	require.Len(t, holders, 1)
+	assert.Equal(t, int64(500), holders[0].Balance)
+
+	mock.ExpectQuery("FROM accounts ORDER BY balance DESC").WithArgs(50, 0).
+		WillReturnRows(sqlmock.NewRows(columns))
+	holders, err = AssetHolders(context.Background(), mockDB, "native", 50, 0)
+	require.NoError(t, err)
+	assert.Empty(t, holders)
+
+	_, err = AssetHolders(context.Background(), mockDB, "USDC", 50, 0)
+	assert.ErrorIs(t, err, ErrInvalidAsset)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
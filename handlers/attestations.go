@@ -0,0 +1,603 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+var (
+	// ErrInvalidUID is returned for schema and attestation UIDs that are not
+	// 32 hex-encoded bytes
+	ErrInvalidUID = errors.New("invalid UID")
+	// ErrInvalidAddress is returned for addresses that are not G... or C... strkeys
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrSchemaNotFound is returned for schemas that are not stored
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrAttestationNotFound is returned for attestations that are not stored
+	ErrAttestationNotFound = errors.New("attestation not found")
+	// ErrAmbiguousUID is returned for a UID used by several contracts when
+	// no contract is given
+	ErrAmbiguousUID = errors.New("UID is used by several contracts")
+)
+
+// Attestation statuses, derived from revocation and expiry
+const (
+	AttestationActive  = "active"
+	AttestationExpired = "expired"
+	AttestationRevoked = "revoked"
+)
+
+// Attestation contract events, as the event of their decoded form
+const (
+	schemaRegistered   = "schema_registered"
+	attestationCreated = "attestation_created"
+	attestationRevoked = "attestation_revoked"
+)
+
+// attestationTopics are the leading topics of the events attestation
+// contracts emit, compared case-insensitively
+var attestationTopics = []struct {
+	topics []string
+	kind   string
+}{
+	{[]string{"schema", "register"}, schemaRegistered},
+	{[]string{"schema_registered"}, schemaRegistered},
+	{[]string{"attest", "create"}, attestationCreated},
+	{[]string{"attestation_created"}, attestationCreated},
+	{[]string{"attest", "revoke"}, attestationRevoked},
+	{[]string{"attestation_revoked"}, attestationRevoked},
+}
+
+// attestationEvent holds the values of an attestation contract event: the
+// fields of the structs in its data by name, and its other values in order,
+// after the topics that identified it
+type attestationEvent struct {
+	kind       string
+	named      map[string]xdr.ScVal
+	positional []xdr.ScVal
+}
+
+// parseAttestationEvent recognizes an attestation contract event by its
+// topics. Data may be a struct or a tuple of structs and plain values.
+func parseAttestationEvent(event xdr.ContractEvent) (attestationEvent, bool) {
+	if event.Type != xdr.ContractEventTypeContract || event.Body.V0 == nil {
+		return attestationEvent{}, false
+	}
+	topics := event.Body.V0.Topics
+	for _, known := range attestationTopics {
+		if !topicsMatch(topics, known.topics) {
+			continue
+		}
+		e := attestationEvent{kind: known.kind, named: map[string]xdr.ScVal{}}
+		values := append([]xdr.ScVal{}, topics[len(known.topics):]...)
+		data := event.Body.V0.Data
+		if vec, ok := data.GetVec(); ok && vec != nil {
+			values = append(values, *vec...)
+		} else {
+			values = append(values, data)
+		}
+		for _, value := range values {
+			if m, ok := value.GetMap(); ok && m != nil {
+				for _, entry := range *m {
+					e.named[strings.ToLower(scval.String(entry.Key))] = entry.Val
+				}
+				continue
+			}
+			e.positional = append(e.positional, value)
+		}
+		return e, true
+	}
+	return attestationEvent{}, false
+}
+
+func topicsMatch(topics []xdr.ScVal, expected []string) bool {
+	if len(topics) < len(expected) {
+		return false
+	}
+	for idx, name := range expected {
+		sym, ok := topics[idx].GetSym()
+		if !ok || !strings.EqualFold(string(sym), name) {
+			return false
+		}
+	}
+	return true
+}
+
+// field returns the first named field present that is not void
+func (e attestationEvent) field(names ...string) (xdr.ScVal, bool) {
+	for _, name := range names {
+		if val, ok := e.named[name]; ok && val.Type != xdr.ScValTypeScvVoid {
+			return val, true
+		}
+	}
+	return xdr.ScVal{}, false
+}
+
+// uid returns a named 32-byte value, or else the nth one among the
+// positional values
+func (e attestationEvent) uid(n int, names ...string) string {
+	if val, ok := e.field(names...); ok {
+		if uid, ok := scBytes32(val); ok {
+			return uid
+		}
+	}
+	return nthPositional(e.positional, n, scBytes32)
+}
+
+// address returns a named address, or else the nth one among the positional
+// values; a negative n disables the fallback
+func (e attestationEvent) address(n int, names ...string) string {
+	if val, ok := e.field(names...); ok {
+		if addr, ok := scAddress(val); ok {
+			return addr
+		}
+	}
+	return nthPositional(e.positional, n, scAddress)
+}
+
+// nthPositional returns the nth value that convert accepts
+func nthPositional(values []xdr.ScVal, n int, convert func(xdr.ScVal) (string, bool)) string {
+	if n < 0 {
+		return ""
+	}
+	for _, val := range values {
+		if s, ok := convert(val); ok {
+			if n == 0 {
+				return s
+			}
+			n--
+		}
+	}
+	return ""
+}
+
+func scBytes32(val xdr.ScVal) (string, bool) {
+	b, ok := val.GetBytes()
+	if !ok || len(b) != 32 {
+		return "", false
+	}
+	return hex.EncodeToString(b), true
+}
+
+func scAddress(val xdr.ScVal) (string, bool) {
+	addr, ok := val.GetAddress()
+	if !ok {
+		return "", false
+	}
+	s, err := scval.AddressString(addr)
+	return s, err == nil
+}
+
+// unixTime converts a named u64 or timepoint in seconds, nil when absent or zero
+func (e attestationEvent) unixTime(names ...string) *time.Time {
+	val, ok := e.field(names...)
+	if !ok {
+		return nil
+	}
+	var secs uint64
+	switch val.Type {
+	case xdr.ScValTypeScvU64:
+		secs = uint64(val.MustU64())
+	case xdr.ScValTypeScvTimepoint:
+		secs = uint64(val.MustTimepoint())
+	default:
+		return nil
+	}
+	if secs == 0 {
+		return nil
+	}
+	t := time.Unix(int64(secs), 0).UTC()
+	return &t
+}
+
+// AttestationEvent is the decoded form of an attestation contract event.
+// Schema fields are only set for schema registrations.
+type AttestationEvent struct {
+	Event      string      `json:"event"`
+	UID        string      `json:"uid"`
+	SchemaUID  string      `json:"schema_uid,omitempty"`
+	Attester   string      `json:"attester,omitempty"`
+	Subject    string      `json:"subject,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time  `json:"revoked_at,omitempty"`
+	Definition string      `json:"definition,omitempty"`
+	Authority  string      `json:"authority,omitempty"`
+	Resolver   string      `json:"resolver,omitempty"`
+	Revocable  *bool       `json:"revocable,omitempty"`
+}
+
+// attestationDecoder decodes schema registrations, attestations and
+// revocations, and projects them into schemas and attestations
+type attestationDecoder struct{}
+
+func (attestationDecoder) Name() string { return "attestations" }
+
+// Decode recognizes an attestation contract event by its topics. Events
+// without a UID are not recognized.
+func (attestationDecoder) Decode(event xdr.ContractEvent) (interface{}, bool) {
+	e, ok := parseAttestationEvent(event)
+	if !ok {
+		return nil, false
+	}
+	decoded := AttestationEvent{Event: e.kind}
+	switch e.kind {
+	case schemaRegistered:
+		decoded.UID = e.uid(0, "uid", "schema_uid")
+		if val, ok := e.field("definition", "schema"); ok {
+			decoded.Definition = scval.String(val)
+		}
+		decoded.Authority = e.address(0, "authority", "registrar")
+		decoded.Resolver = e.address(-1, "resolver")
+		if val, ok := e.field("revocable"); ok {
+			revocable, _ := val.GetB()
+			decoded.Revocable = &revocable
+		}
+	case attestationCreated:
+		decoded.UID = e.uid(0, "uid", "attestation_uid")
+		decoded.SchemaUID = e.uid(1, "schema_uid")
+		decoded.Attester = e.address(0, "attester")
+		decoded.Subject = e.address(1, "subject", "recipient")
+		if val, ok := e.field("value", "data"); ok {
+			decoded.Value = scval.ToNative(val)
+		}
+		decoded.ExpiresAt = e.unixTime("expiration_time", "expiration", "expires_at")
+	case attestationRevoked:
+		decoded.UID = e.uid(0, "uid", "attestation_uid")
+		decoded.RevokedAt = e.unixTime("revocation_time", "revoked_at")
+	}
+	if decoded.UID == "" {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// Project stores a schema registration, attestation or revocation in
+// schemas or attestations
+func (attestationDecoder) Project(dbTx *sql.Tx, event DecodedEvent) error {
+	decoded, ok := event.Value.(AttestationEvent)
+	if !ok {
+		return fmt.Errorf("unexpected decoded value %T", event.Value)
+	}
+	switch decoded.Event {
+	case schemaRegistered:
+		revocable := true
+		if decoded.Revocable != nil {
+			revocable = *decoded.Revocable
+		}
+		if _, err := dbTx.Exec(`
+			INSERT INTO schemas (contract_id, uid, definition, authority, resolver, revocable,
+				ledger, transaction_hash, event_id, closed_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10)
+			ON CONFLICT (contract_id, uid) DO UPDATE SET
+				definition = EXCLUDED.definition, authority = EXCLUDED.authority, resolver = EXCLUDED.resolver,
+				revocable = EXCLUDED.revocable, ledger = EXCLUDED.ledger, transaction_hash = EXCLUDED.transaction_hash,
+				event_id = EXCLUDED.event_id, closed_at = EXCLUDED.closed_at`,
+			event.ContractID, decoded.UID, decoded.Definition, decoded.Authority, decoded.Resolver, revocable,
+			event.Ledger, event.TransactionHash, event.ID, event.ClosedAt); err != nil {
+			return fmt.Errorf("failed to store schema: %w", err)
+		}
+
+	case attestationCreated:
+		var value []byte
+		if decoded.Value != nil {
+			value, _ = json.Marshal(decoded.Value)
+		}
+		// A revocation stored first is kept
+		if _, err := dbTx.Exec(`
+			INSERT INTO attestations (contract_id, uid, schema_uid, attester, subject, value, expires_at,
+				ledger, transaction_hash, event_id, closed_at)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (contract_id, uid) DO UPDATE SET
+				schema_uid = EXCLUDED.schema_uid, attester = EXCLUDED.attester, subject = EXCLUDED.subject,
+				value = EXCLUDED.value, expires_at = EXCLUDED.expires_at, ledger = EXCLUDED.ledger,
+				transaction_hash = EXCLUDED.transaction_hash, event_id = EXCLUDED.event_id, closed_at = EXCLUDED.closed_at`,
+			event.ContractID, decoded.UID, decoded.SchemaUID, decoded.Attester, decoded.Subject, nullJSON(value), decoded.ExpiresAt,
+			event.Ledger, event.TransactionHash, event.ID, event.ClosedAt); err != nil {
+			return fmt.Errorf("failed to store attestation: %w", err)
+		}
+
+	case attestationRevoked:
+		revokedAt := event.ClosedAt
+		if decoded.RevokedAt != nil {
+			revokedAt = *decoded.RevokedAt
+		}
+		if _, err := dbTx.Exec(`
+			INSERT INTO attestations (contract_id, uid, revoked, revoked_at, revoked_ledger, revocation_tx_hash)
+			VALUES ($1, $2, true, $3, $4, $5)
+			ON CONFLICT (contract_id, uid) DO UPDATE SET
+				revoked = true, revoked_at = EXCLUDED.revoked_at, revoked_ledger = EXCLUDED.revoked_ledger,
+				revocation_tx_hash = EXCLUDED.revocation_tx_hash`,
+			event.ContractID, decoded.UID, revokedAt, event.Ledger, event.TransactionHash); err != nil {
+			return fmt.Errorf("failed to store revocation: %w", err)
+		}
+	}
+	return nil
+}
+
+// AttestationQuery selects attestations; empty fields match any value
+type AttestationQuery struct {
+	ContractID string
+	SchemaUID  string
+	Attester   string
+	Subject    string
+	Revoked    *bool
+	Limit      int
+	Offset     int
+}
+
+// normalizeUID validates a hex UID and returns it in lower case
+func normalizeUID(uid string) (string, error) {
+	uid = strings.ToLower(strings.TrimPrefix(uid, "0x"))
+	if raw, err := hex.DecodeString(uid); err != nil || len(raw) != 32 {
+		return "", ErrInvalidUID
+	}
+	return uid, nil
+}
+
+// normalizeAddress validates a G..., M... or C... address and returns its
+// canonical strkey
+func normalizeAddress(address string) (string, error) {
+	if strings.HasPrefix(address, "C") {
+		if id, err := NormalizeContractID(address); err == nil {
+			return id, nil
+		}
+		return "", ErrInvalidAddress
+	}
+	id, err := NormalizeAccountID(address)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+	return id, nil
+}
+
+const attestationColumns = `contract_id, uid, COALESCE(schema_uid, ''), COALESCE(attester, ''), COALESCE(subject, ''),
+	value, expires_at, revoked, revoked_at, revoked_ledger, COALESCE(revocation_tx_hash, ''),
+	ledger, COALESCE(transaction_hash, ''), COALESCE(event_id, ''), closed_at`
+
+// ListAttestations lists attestations matching q, newest first
+func ListAttestations(ctx context.Context, db *sql.DB, q AttestationQuery) ([]models.Attestation, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(column, value string) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if q.ContractID != "" {
+		id, err := NormalizeContractID(q.ContractID)
+		if err != nil {
+			return nil, err
+		}
+		add("contract_id", id)
+	}
+	if q.SchemaUID != "" {
+		uid, err := normalizeUID(q.SchemaUID)
+		if err != nil {
+			return nil, err
+		}
+		add("schema_uid", uid)
+	}
+	for _, filter := range []struct{ column, value string }{{"attester", q.Attester}, {"subject", q.Subject}} {
+		if filter.value == "" {
+			continue
+		}
+		address, err := normalizeAddress(filter.value)
+		if err != nil {
+			return nil, err
+		}
+		add(filter.column, address)
+	}
+	if q.Revoked != nil {
+		args = append(args, *q.Revoked)
+		conditions = append(conditions, fmt.Sprintf("revoked = $%d", len(args)))
+	}
+	query := `SELECT ` + attestationColumns + ` FROM attestations`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, q.Limit, q.Offset)
+	query += fmt.Sprintf(" ORDER BY ledger DESC NULLS LAST, uid LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attestations := []models.Attestation{}
+	for rows.Next() {
+		a, err := scanAttestation(rows)
+		if err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, a)
+	}
+	return attestations, rows.Err()
+}
+
+// GetAttestation returns an attestation by UID, of the given contract when
+// contractID is set. UIDs are only unique within a contract, so without one
+// a UID used by several contracts is ErrAmbiguousUID.
+func GetAttestation(ctx context.Context, db *sql.DB, uid, contractID string) (models.Attestation, error) {
+	uid, contractID, err := normalizeUIDLookup(uid, contractID)
+	if err != nil {
+		return models.Attestation{}, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+attestationColumns+` FROM attestations
+		WHERE uid = $1 AND ($2 = '' OR contract_id = $2)
+		ORDER BY contract_id LIMIT 2`, uid, contractID)
+	if err != nil {
+		return models.Attestation{}, err
+	}
+	defer rows.Close()
+	var found []models.Attestation
+	for rows.Next() {
+		a, err := scanAttestation(rows)
+		if err != nil {
+			return a, err
+		}
+		found = append(found, a)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Attestation{}, err
+	}
+	switch len(found) {
+	case 0:
+		return models.Attestation{}, ErrAttestationNotFound
+	case 1:
+		return found[0], nil
+	default:
+		return models.Attestation{}, ErrAmbiguousUID
+	}
+}
+
+// normalizeUIDLookup normalizes the UID and optional contract ID of a lookup
+// by UID
+func normalizeUIDLookup(uid, contractID string) (string, string, error) {
+	uid, err := normalizeUID(uid)
+	if err != nil {
+		return "", "", err
+	}
+	if contractID != "" {
+		if contractID, err = NormalizeContractID(contractID); err != nil {
+			return "", "", err
+		}
+	}
+	return uid, contractID, nil
+}
+
+func scanAttestation(row rowScanner) (models.Attestation, error) {
+	var a models.Attestation
+	var value []byte
+	var expiresAt, revokedAt, closedAt sql.NullTime
+	var revokedLedger, ledger sql.NullInt64
+	if err := row.Scan(&a.ContractID, &a.UID, &a.SchemaUID, &a.Attester, &a.Subject,
+		&value, &expiresAt, &a.Revoked, &revokedAt, &revokedLedger, &a.RevocationTx,
+		&ledger, &a.TransactionHash, &a.EventID, &closedAt); err != nil {
+		return a, err
+	}
+	if len(value) > 0 {
+		a.Value = value
+	}
+	if expiresAt.Valid {
+		a.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		a.RevokedAt = &revokedAt.Time
+	}
+	if revokedLedger.Valid {
+		l := uint32(revokedLedger.Int64)
+		a.RevokedLedger = &l
+	}
+	if ledger.Valid {
+		l := uint32(ledger.Int64)
+		a.Ledger = &l
+	}
+	if closedAt.Valid {
+		a.ClosedAt = &closedAt.Time
+	}
+	a.Status = attestationStatus(a, time.Now())
+	return a, nil
+}
+
+func attestationStatus(a models.Attestation, now time.Time) string {
+	switch {
+	case a.Revoked:
+		return AttestationRevoked
+	case a.ExpiresAt != nil && !a.ExpiresAt.After(now):
+		return AttestationExpired
+	}
+	return AttestationActive
+}
+
+const schemaColumns = `contract_id, uid, COALESCE(definition, ''), COALESCE(authority, ''), COALESCE(resolver, ''),
+	revocable, ledger, transaction_hash, event_id, closed_at`
+
+// ListSchemas lists registered schemas, newest first, optionally only those
+// of a contract or authority
+func ListSchemas(ctx context.Context, db *sql.DB, contractID, authority string, limit, offset int) ([]models.Schema, error) {
+	var err error
+	if contractID != "" {
+		if contractID, err = NormalizeContractID(contractID); err != nil {
+			return nil, err
+		}
+	}
+	if authority != "" {
+		if authority, err = normalizeAddress(authority); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+schemaColumns+` FROM schemas
+		WHERE ($1 = '' OR contract_id = $1) AND ($2 = '' OR authority = $2)
+		ORDER BY ledger DESC, uid
+		LIMIT $3 OFFSET $4`, contractID, authority, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schemas := []models.Schema{}
+	for rows.Next() {
+		s, err := scanSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, rows.Err()
+}
+
+// GetSchema returns a schema by UID, of the given contract when contractID
+// is set; like attestations, a UID used by several contracts without one is
+// ErrAmbiguousUID
+func GetSchema(ctx context.Context, db *sql.DB, uid, contractID string) (models.Schema, error) {
+	uid, contractID, err := normalizeUIDLookup(uid, contractID)
+	if err != nil {
+		return models.Schema{}, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+schemaColumns+` FROM schemas
+		WHERE uid = $1 AND ($2 = '' OR contract_id = $2)
+		ORDER BY contract_id LIMIT 2`, uid, contractID)
+	if err != nil {
+		return models.Schema{}, err
+	}
+	defer rows.Close()
+	var found []models.Schema
+	for rows.Next() {
+		s, err := scanSchema(rows)
+		if err != nil {
+			return s, err
+		}
+		found = append(found, s)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Schema{}, err
+	}
+	switch len(found) {
+	case 0:
+		return models.Schema{}, ErrSchemaNotFound
+	case 1:
+		return found[0], nil
+	default:
+		return models.Schema{}, ErrAmbiguousUID
+	}
+}
+
+func scanSchema(row rowScanner) (models.Schema, error) {
+	var s models.Schema
+	err := row.Scan(&s.ContractID, &s.UID, &s.Definition, &s.Authority, &s.Resolver,
+		&s.Revocable, &s.Ledger, &s.TransactionHash, &s.EventID, &s.ClosedAt)
+	return s, err
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scBytes(b byte) xdr.ScVal {
+	raw := make(xdr.ScBytes, 32)
+	raw[0] = b
+	return xdr.ScVal{Type: xdr.ScValTypeScvBytes, Bytes: &raw}
+}
+
+func scAccount(address string) xdr.ScVal {
+	account := xdr.MustAddress(address)
+	return xdr.ScVal{Type: xdr.ScValTypeScvAddress, Address: &xdr.ScAddress{
+		Type:      xdr.ScAddressTypeScAddressTypeAccount,
+		AccountId: &account,
+	}}
+}
+
+func scU64(n uint64) xdr.ScVal {
+	u := xdr.Uint64(n)
+	return xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &u}
+}
+
+func scVec(values ...xdr.ScVal) xdr.ScVal {
+	vec := xdr.ScVec(values)
+	ptr := &vec
+	return xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &ptr}
+}
+
+func scStruct(fields ...interface{}) xdr.ScVal {
+	var m xdr.ScMap
+	for idx := 0; idx < len(fields); idx += 2 {
+		m = append(m, xdr.ScMapEntry{Key: symbol(fields[idx].(string)), Val: fields[idx+1].(xdr.ScVal)})
+	}
+	ptr := &m
+	return xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &ptr}
+}
+
+func attestationContractEvent(data xdr.ScVal, topics ...string) xdr.ContractEvent {
+	event := testEvent(xdr.ContractId{3}, xdr.ContractEventTypeContract, topics[0])
+	for _, topic := range topics[1:] {
+		event.Body.V0.Topics = append(event.Body.V0.Topics, symbol(topic))
+	}
+	event.Body.V0.Data = data
+	return event
+}
+
+func TestParseAttestationEvent(t *testing.T) {
+	uid := hex.EncodeToString(append([]byte{7}, make([]byte, 31)...))
+	schemaUID := hex.EncodeToString(append([]byte{9}, make([]byte, 31)...))
+
+	named := attestationContractEvent(scStruct(
+		"uid", scBytes(7), "schema_uid", scBytes(9), "attester", scAccount(testAccount),
+		"recipient", scAccount(testIssuer), "expiration_time", scU64(0)), "ATTEST", "create")
+	e, ok := parseAttestationEvent(named)
+	require.True(t, ok)
+	assert.Equal(t, attestationCreated, e.kind)
+	assert.Equal(t, uid, e.uid(0, "uid", "attestation_uid"))
+	assert.Equal(t, schemaUID, e.uid(1, "schema_uid"))
+	assert.Equal(t, testAccount, e.address(0, "attester"))
+	assert.Equal(t, testIssuer, e.address(1, "subject", "recipient"))
+	assert.Nil(t, e.unixTime("expiration_time"))
+
+	// A tuple falls back to the order of the values
+	tuple := attestationContractEvent(scVec(scBytes(7), scBytes(9), scAccount(testAccount), scAccount(testIssuer)), "attestation_created")
+	e, ok = parseAttestationEvent(tuple)
+	require.True(t, ok)
+	assert.Equal(t, uid, e.uid(0, "uid", "attestation_uid"))
+	assert.Equal(t, schemaUID, e.uid(1, "schema_uid"))
+	assert.Equal(t, testAccount, e.address(0, "attester"))
+	assert.Equal(t, testIssuer, e.address(1, "subject", "recipient"))
+	assert.Empty(t, e.address(-1, "resolver"))
+
+	_, ok = parseAttestationEvent(attestationContractEvent(scBytes(7), "transfer"))
+	assert.False(t, ok)
+	diagnostic := attestationContractEvent(scBytes(7), "attest", "revoke")
+	diagnostic.Type = xdr.ContractEventTypeDiagnostic
+	_, ok = parseAttestationEvent(diagnostic)
+	assert.False(t, ok)
+}
+
+func TestProjectAttestationEvents(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	decoders := DefaultDecoders()
+	contractID := EncodeContractID(xdr.ContractId{3})
+	// Any contract can emit attestation topics, so only registered ones are decoded
+	_, _, ok := decoders.decode(contractID, attestationContractEvent(scBytes(7), "attest", "revoke"))
+	assert.False(t, ok)
+	decoder, ok := decoders.Decoder("attestations")
+	require.True(t, ok)
+	require.NoError(t, decoders.RegisterContract(contractID, decoder))
+	uid := hex.EncodeToString(append([]byte{7}, make([]byte, 31)...))
+	schemaUID := hex.EncodeToString(append([]byte{9}, make([]byte, 31)...))
+	closedAt := time.Unix(1700000000, 0).UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO schemas").
+		WithArgs(contractID, schemaUID, "name:string", testAccount, "", false, uint32(30), "abc", "e1", closedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO attestations \\(contract_id, uid, schema_uid").
+		WithArgs(contractID, uid, schemaUID, testAccount, testIssuer, []byte(`"GA"`), nil, uint32(30), "abc", "e2", closedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO attestations \\(contract_id, uid, revoked").
+		WithArgs(contractID, uid, closedAt, uint32(30), "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	store := func(id string, event xdr.ContractEvent) {
+		decoder, value, ok := decoders.decode(contractID, event)
+		require.True(t, ok)
+		assert.Equal(t, "attestations", decoder.Name())
+		require.NoError(t, project(dbTx, decoder, DecodedEvent{
+			ID: id, ContractID: contractID, Ledger: 30, TransactionHash: "abc", ClosedAt: closedAt, Event: event, Value: value,
+		}))
+	}
+	store("e1", attestationContractEvent(scStruct("uid", scBytes(9), "definition", symbol("name:string"),
+		"authority", scAccount(testAccount), "revocable", xdr.ScVal{Type: xdr.ScValTypeScvBool, B: new(bool)}), "schema", "register"))
+	store("e2", attestationContractEvent(scStruct("uid", scBytes(7), "schema_uid", scBytes(9),
+		"attester", scAccount(testAccount), "subject", scAccount(testIssuer), "value", symbol("GA")), "attest", "create"))
+	store("e3", attestationContractEvent(scBytes(7), "attest", "revoke"))
+
+	// Events without a UID are not recognized
+	_, _, ok = decoders.decode(contractID, attestationContractEvent(scAccount(testAccount), "attest", "create"))
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAttestations(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	uid := hex.EncodeToString(append([]byte{7}, make([]byte, 31)...))
+	expired := time.Now().Add(-time.Hour)
+	columns := []string{"contract_id", "uid", "schema_uid", "attester", "subject", "value", "expires_at", "revoked",
+		"revoked_at", "revoked_ledger", "revocation_tx_hash", "ledger", "transaction_hash", "event_id", "closed_at"}
+	revoked := false
+	mock.ExpectQuery("FROM attestations WHERE subject = \\$1 AND revoked = \\$2 ORDER BY").
+		WithArgs(testIssuer, false, 10, 0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("C", uid, "", testAccount, testIssuer, nil, expired, false, nil, nil, "", 30, "abc", "e2", time.Now()))
+	attestations, err := ListAttestations(context.Background(), mockDB, AttestationQuery{Subject: testIssuer, Revoked: &revoked, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, attestations, 1)
+	assert.Equal(t, AttestationExpired, attestations[0].Status)
+	assert.Nil(t, attestations[0].Value)
+
+	_, err = ListAttestations(context.Background(), mockDB, AttestationQuery{Subject: "nope"})
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+	_, err = ListAttestations(context.Background(), mockDB, AttestationQuery{SchemaUID: "abcd"})
+	assert.ErrorIs(t, err, ErrInvalidUID)
+	_, err = GetAttestation(context.Background(), mockDB, "0x"+uid[:10], "")
+	assert.ErrorIs(t, err, ErrInvalidUID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAttestation(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	uid := hex.EncodeToString(append([]byte{7}, make([]byte, 31)...))
+	contract := EncodeContractID(xdr.ContractId{3})
+	columns := []string{"contract_id", "uid", "schema_uid", "attester", "subject", "value", "expires_at", "revoked",
+		"revoked_at", "revoked_ledger", "revocation_tx_hash", "ledger", "transaction_hash", "event_id", "closed_at"}
+	row := func(rows *sqlmock.Rows, contractID string) *sqlmock.Rows {
+		return rows.AddRow(contractID, uid, "", testAccount, testIssuer, nil, nil, false, nil, nil, "", 30, "abc", "e2", time.Now())
+	}
+
+	mock.ExpectQuery("FROM attestations\\s+WHERE uid = \\$1 AND \\(\\$2 = '' OR contract_id = \\$2\\)").
+		WithArgs(uid, contract).
+		WillReturnRows(row(sqlmock.NewRows(columns), contract))
+	hash := xdr.ContractId{3}
+	a, err := GetAttestation(context.Background(), mockDB, "0x"+uid, hex.EncodeToString(hash[:]))
+	require.NoError(t, err)
+	assert.Equal(t, contract, a.ContractID)
+
+	// Without a contract, a UID used by several is not resolved to either
+	mock.ExpectQuery("FROM attestations").WithArgs(uid, "").
+		WillReturnRows(row(row(sqlmock.NewRows(columns), contract), EncodeContractID(xdr.ContractId{4})))
+	_, err = GetAttestation(context.Background(), mockDB, uid, "")
+	assert.ErrorIs(t, err, ErrAmbiguousUID)
+
+	mock.ExpectQuery("FROM attestations").WithArgs(uid, "").WillReturnRows(sqlmock.NewRows(columns))
+	_, err = GetAttestation(context.Background(), mockDB, uid, "")
+	assert.ErrorIs(t, err, ErrAttestationNotFound)
+
+	_, err = GetAttestation(context.Background(), mockDB, uid, "nope")
+	assert.ErrorIs(t, err, ErrInvalidContractID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
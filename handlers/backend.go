@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/log"
+)
+
+// Ledger backends selectable through Config.LedgerBackend
+const (
+	BackendCaptiveCore = "captive-core"
+	BackendRPC         = "rpc"
+	BackendDatastore   = "datastore"
+)
+
+// defaultRetryAttempts is the number of retries of a failed ledger backend
+// request when Config.RetryAttempts is 0
+const defaultRetryAttempts = 3
+
+// retryAttempts returns the retries every ledger backend makes of a failed
+// request, applying the default to an unset value
+func (cfg *Config) retryAttempts() int {
+	if cfg.RetryAttempts == 0 {
+		return defaultRetryAttempts
+	}
+	return cfg.RetryAttempts
+}
+
+// newLedgerBackend builds the configured ledger source. When no backend is
+// named it falls back to captive core if a binary is configured, then to RPC
+// if a server URL is set, then to a datastore if one is configured, and
+// otherwise returns nil so ingestion is skipped.
+func newLedgerBackend(cfg *Config) (backends.LedgerBackend, error) {
+	switch cfg.LedgerBackend {
+	case BackendCaptiveCore:
+		return newCaptiveCoreBackend(cfg)
+	case BackendRPC:
+		return newRPCBackend(cfg)
+	case BackendDatastore:
+		return newDatastoreBackend(cfg)
+	case "":
+		if cfg.CaptiveCoreBinaryPath != "" {
+			return newCaptiveCoreBackend(cfg)
+		}
+		if cfg.RPCServerURL != "" {
+			return newRPCBackend(cfg)
+		}
+		if cfg.Datastore.Type != "" {
+			return newDatastoreBackend(cfg)
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown ledger backend %q", cfg.LedgerBackend)
+	}
+}
+
+func newCaptiveCoreBackend(cfg *Config) (backends.LedgerBackend, error) {
+	if cfg.CaptiveCoreBinaryPath == "" {
+		return nil, fmt.Errorf("captive core backend requires a binary path")
+	}
+	params := backends.CaptiveCoreTomlParams{
+		NetworkPassphrase:                  cfg.NetworkPassphrase,
+		HistoryArchiveURLs:                 cfg.HistoryArchiveURLs,
+		Strict:                             false,
+		CoreBinaryPath:                     cfg.CaptiveCoreBinaryPath,
+		EnforceSorobanDiagnosticEvents:     true,
+		EnforceSorobanTransactionMetaExtV1: true,
+	}
+	var tomlCfg *backends.CaptiveCoreToml
+	var err error
+	if cfg.CaptiveCoreConfigPath != "" {
+		tomlCfg, err = backends.NewCaptiveCoreTomlFromFile(cfg.CaptiveCoreConfigPath, params)
+	} else {
+		tomlCfg, err = backends.NewCaptiveCoreToml(params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare captive core config: %w", err)
+	}
+	ccCfg := backends.CaptiveCoreConfig{
+		BinaryPath:         cfg.CaptiveCoreBinaryPath,
+		NetworkPassphrase:  cfg.NetworkPassphrase,
+		HistoryArchiveURLs: cfg.HistoryArchiveURLs,
+		Toml:               tomlCfg,
+		Log:                log.DefaultLogger,
+	}
+	captive, err := backends.NewCaptive(ccCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize captive core backend: %w", err)
+	}
+	return captive, nil
+}
+
+func newRPCBackend(cfg *Config) (backends.LedgerBackend, error) {
+	if cfg.RPCServerURL == "" {
+		return nil, fmt.Errorf("rpc backend requires a server URL")
+	}
+	return NewRPCLedgerBackend(RPCBackendConfig{
+		ServerURL:     cfg.RPCServerURL,
+		PageSize:      cfg.RPCPageSize,
+		PollInterval:  cfg.RPCPollInterval,
+		RetryAttempts: cfg.retryAttempts(),
+		RetryDelay:    cfg.RetryDelay,
+	}), nil
+}
+
+func newDatastoreBackend(cfg *Config) (backends.LedgerBackend, error) {
+	dsCfg := cfg.Datastore.withDefaults()
+	store, err := newDataStore(context.Background(), dsCfg, cfg.NetworkPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open datastore: %w", err)
+	}
+	backend, err := backends.NewBufferedStorageBackend(backends.BufferedStorageBackendConfig{
+		BufferSize: dsCfg.BufferSize,
+		NumWorkers: dsCfg.NumWorkers,
+		RetryLimit: uint32(cfg.retryAttempts()),
+		RetryWait:  cfg.RetryDelay,
+	}, store, dsCfg.schema())
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to initialize buffered storage backend: %w", err)
+	}
+	return backend, nil
+}
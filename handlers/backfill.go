@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Backfill chunk states stored in backfill_chunks.status
+const (
+	ChunkPending  = "pending"
+	ChunkRunning  = "running"
+	ChunkComplete = "complete"
+	ChunkFailed   = "failed"
+)
+
+// Owners of backfill_chunks rows, stored in backfill_chunks.source
+const (
+	chunkSourceBackfill = "backfill"
+	chunkSourceRepair   = "repair"
+)
+
+// defaultChunkSize is the number of ledgers per chunk when none is configured
+const defaultChunkSize = 10000
+
+// BackfillConfig holds the range and parallelism of a historical backfill
+type BackfillConfig struct {
+	StartLedger uint32
+	EndLedger   uint32
+	ChunkSize   uint32 // Ledgers per chunk
+	Workers     int    // Chunks processed concurrently, each with its own ledger backend
+}
+
+// BackfillChunk is one inclusive ledger range of a backfill
+type BackfillChunk struct {
+	Start      uint32
+	End        uint32
+	ContractID string // Only this contract's data is re-ingested when set
+	LastLedger uint32 // Last ledger committed for this chunk, 0 when none
+	Status     string
+	Replace    bool // Stored ledgers are deleted before they are written again
+}
+
+// Backfiller ingests a bounded ledger range in parallel chunks. Progress is
+// recorded per chunk in backfill_chunks so an interrupted run resumes where
+// each chunk stopped; the live ingester's ingestion_state is never touched.
+type Backfiller struct {
+	config     BackfillConfig
+	db         *sql.DB
+	ingester   *Ingester
+	logger     *logrus.Entry
+	newBackend func() (backends.LedgerBackend, error)
+	source     string
+}
+
+// NewBackfiller creates a backfiller reading ledgers from the backend in cfg
+func NewBackfiller(cfg *Config, bfCfg BackfillConfig, db *sql.DB, logger *logrus.Entry) (*Backfiller, error) {
+	if bfCfg.StartLedger == 0 || bfCfg.EndLedger < bfCfg.StartLedger {
+		return nil, fmt.Errorf("invalid backfill range %d-%d", bfCfg.StartLedger, bfCfg.EndLedger)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	// Events are decoded and projected as by the live ingester
+	decoders, err := newDecoders(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if bfCfg.ChunkSize == 0 {
+		bfCfg.ChunkSize = defaultChunkSize
+	}
+	if bfCfg.Workers <= 0 {
+		bfCfg.Workers = 1
+	}
+	return &Backfiller{
+		config: bfCfg,
+		db:     db,
+		ingester: &Ingester{
+			config:            cfg,
+			db:                db,
+			networkPassphrase: cfg.NetworkPassphrase,
+			logger:            logger,
+			stats:             &models.Stats{StartTime: time.Now()},
+			decoders:          decoders,
+		},
+		logger:     logger,
+		newBackend: func() (backends.LedgerBackend, error) { return newLedgerBackend(cfg) },
+		source:     chunkSourceBackfill,
+	}, nil
+}
+
+// Stats returns counters for the ledgers ingested by this backfill
+func (b *Backfiller) Stats() *models.Stats { return b.ingester.stats }
+
+// PlanChunks splits [start, end] into consecutive chunks of at most size ledgers
+func PlanChunks(start, end, size uint32) []BackfillChunk {
+	var chunks []BackfillChunk
+	if size == 0 || end < start {
+		return chunks
+	}
+	for from := start; from <= end; {
+		to := end
+		if end-from >= size {
+			to = from + size - 1
+		}
+		chunks = append(chunks, BackfillChunk{Start: from, End: to, Status: ChunkPending})
+		if to == end {
+			break
+		}
+		from = to + 1
+	}
+	return chunks
+}
+
+// Run registers the chunks of the configured range, then ingests every
+// unfinished one. Failed chunks are recorded and reported together once all
+// workers stop.
+func (b *Backfiller) Run(ctx context.Context) error {
+	if err := b.ingester.ReloadContractFilter(ctx); err != nil {
+		b.logger.Warnf("Using configured contract filter only: %v", err)
+	}
+	planned := PlanChunks(b.config.StartLedger, b.config.EndLedger, b.config.ChunkSize)
+	if err := b.registerChunks(planned); err != nil {
+		return err
+	}
+	// Failed chunks are retried on every run
+	pending, err := b.pendingChunks(ChunkComplete)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		b.logger.Info("Backfill range already complete")
+		return nil
+	}
+	b.logger.Infof("Backfilling %d chunks of ledgers %d-%d with %d workers",
+		len(pending), b.config.StartLedger, b.config.EndLedger, b.config.Workers)
+	return b.runChunks(ctx, pending)
+}
+
+// runChunks hands chunks to the configured number of workers and waits for
+// them to finish
+func (b *Backfiller) runChunks(ctx context.Context, pending []BackfillChunk) error {
+	jobs := make(chan BackfillChunk)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for w := 0; w < b.config.Workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			backend, err := b.newBackend()
+			if err == nil && backend == nil {
+				err = fmt.Errorf("no ledger backend configured")
+			}
+			if err != nil {
+				b.logger.Errorf("Worker %d could not create ledger backend: %v", worker, err)
+				// Drain so the remaining workers still get every chunk
+				for chunk := range jobs {
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%d-%d", chunk.Start, chunk.End))
+					mu.Unlock()
+					b.markChunk(chunk, ChunkFailed, err)
+				}
+				return
+			}
+			defer backend.Close()
+			for chunk := range jobs {
+				if err := b.runChunk(ctx, backend, chunk); err != nil {
+					b.logger.Errorf("Chunk %d-%d failed: %v", chunk.Start, chunk.End, err)
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%d-%d", chunk.Start, chunk.End))
+					mu.Unlock()
+					b.markChunk(chunk, ChunkFailed, err)
+				}
+			}
+		}(w)
+	}
+
+feed:
+	for _, chunk := range pending {
+		select {
+		case jobs <- chunk:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d backfill chunks failed: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// runChunk ingests a chunk from the ledger after its last recorded progress
+func (b *Backfiller) runChunk(ctx context.Context, backend backends.LedgerBackend, chunk BackfillChunk) error {
+	from := chunk.Start
+	if chunk.LastLedger >= chunk.Start {
+		from = chunk.LastLedger + 1
+	}
+	if from > chunk.End {
+		b.markChunk(chunk, ChunkComplete, nil)
+		return nil
+	}
+	b.markChunk(chunk, ChunkRunning, nil)
+	ingester := b.ingester
+	if chunk.ContractID != "" {
+		ingester = b.ingester.contractScope(chunk.ContractID)
+	}
+
+	if err := backend.PrepareRange(ctx, backends.BoundedRange(from, chunk.End)); err != nil {
+		return fmt.Errorf("failed to prepare range %d-%d: %w", from, chunk.End, err)
+	}
+	recordProgress := func(tx *sql.Tx, ledger uint32) error {
+		_, err := tx.Exec(`
+			UPDATE backfill_chunks SET last_ledger = $1
+			WHERE range_start = $2 AND range_end = $3 AND contract_id = $4 AND source = $5`,
+			ledger, chunk.Start, chunk.End, chunk.ContractID, b.source)
+		return err
+	}
+	for seq := from; seq <= chunk.End; seq++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lcm, err := backend.GetLedger(ctx, seq)
+		if err != nil {
+			return fmt.Errorf("failed to get ledger %d: %w", seq, err)
+		}
+		if err := ingester.ingestLedger(lcm, chunk.Replace, recordProgress); err != nil {
+			return fmt.Errorf("failed to process ledger %d: %w", seq, err)
+		}
+		b.ingester.incrementLedgersProcessed()
+	}
+	b.markChunk(chunk, ChunkComplete, nil)
+	b.logger.Infof("Chunk %d-%d complete", chunk.Start, chunk.End)
+	return nil
+}
+
+func (b *Backfiller) registerChunks(chunks []BackfillChunk) error {
+	for _, chunk := range chunks {
+		if _, err := b.db.Exec(`
+			INSERT INTO backfill_chunks (range_start, range_end, status, source)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (range_start, range_end, contract_id, source) DO NOTHING`, chunk.Start, chunk.End, ChunkPending, b.source); err != nil {
+			return fmt.Errorf("failed to register chunk %d-%d: %w", chunk.Start, chunk.End, err)
+		}
+	}
+	return nil
+}
+
+// pendingChunks loads this source's chunks inside the configured range
+// whose status is none of exclude
+func (b *Backfiller) pendingChunks(exclude ...string) ([]BackfillChunk, error) {
+	rows, err := b.db.Query(`
+		SELECT range_start, range_end, contract_id, COALESCE(last_ledger, 0), status, replace_ledgers
+		FROM backfill_chunks
+		WHERE source = $1 AND range_start >= $2 AND range_end <= $3 AND status <> ALL($4)
+		ORDER BY range_start`, b.source, b.config.StartLedger, b.config.EndLedger, pq.Array(exclude))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backfill chunks: %w", err)
+	}
+	defer rows.Close()
+	var chunks []BackfillChunk
+	for rows.Next() {
+		var chunk BackfillChunk
+		if err := rows.Scan(&chunk.Start, &chunk.End, &chunk.ContractID, &chunk.LastLedger, &chunk.Status, &chunk.Replace); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+func (b *Backfiller) markChunk(chunk BackfillChunk, status string, cause error) {
+	var errMsg interface{}
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	_, err := b.db.Exec(`
+		UPDATE backfill_chunks SET
+			status = $1,
+			error = $2,
+			started_at = CASE WHEN $1 = 'running' THEN COALESCE(started_at, NOW()) ELSE started_at END,
+			completed_at = CASE WHEN $1 = 'complete' THEN NOW() ELSE NULL END
+		WHERE range_start = $3 AND range_end = $4 AND contract_id = $5 AND source = $6`,
+		status, errMsg, chunk.Start, chunk.End, chunk.ContractID, b.source)
+	if err != nil {
+		b.logger.Errorf("Failed to mark chunk %d-%d %s: %v", chunk.Start, chunk.End, status, err)
+	}
+}
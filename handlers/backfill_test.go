@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+func TestPlanChunks(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end uint32
+		size       uint32
+		expected   [][2]uint32
+	}{
+		{"Exact multiple", 100, 399, 100, [][2]uint32{{100, 199}, {200, 299}, {300, 399}}},
+		{"Short last chunk", 100, 350, 100, [][2]uint32{{100, 199}, {200, 299}, {300, 350}}},
+		{"Single ledger", 5, 5, 100, [][2]uint32{{5, 5}}},
+		{"Range ends at max sequence", 4294967290, 4294967295, 4, [][2]uint32{{4294967290, 4294967293}, {4294967294, 4294967295}}},
+		{"Inverted range", 10, 5, 100, nil},
+		{"Zero chunk size", 1, 5, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := PlanChunks(tt.start, tt.end, tt.size)
+			var got [][2]uint32
+			for _, chunk := range chunks {
+				assert.Equal(t, ChunkPending, chunk.Status)
+				got = append(got, [2]uint32{chunk.Start, chunk.End})
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestNewBackfillerValidation(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+
+	_, err := NewBackfiller(&Config{}, BackfillConfig{StartLedger: 0, EndLedger: 10}, nil, logger)
+	assert.Error(t, err)
+	_, err = NewBackfiller(&Config{}, BackfillConfig{StartLedger: 20, EndLedger: 10}, nil, logger)
+	assert.Error(t, err)
+
+	b, err := NewBackfiller(&Config{}, BackfillConfig{StartLedger: 1, EndLedger: 10}, nil, logger)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(10000), b.config.ChunkSize)
+	assert.Equal(t, 1, b.config.Workers)
+
+	_, err = NewBackfiller(&Config{EventDecoders: map[string]string{EncodeContractID(xdr.ContractId{3}): "nope"}},
+		BackfillConfig{StartLedger: 1, EndLedger: 10}, nil, logger)
+	assert.ErrorIs(t, err, ErrUnknownDecoder)
+}
+
+func TestBackfillProjectsDecodedEvents(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	contractID := EncodeContractID(xdr.ContractId{3})
+	cfg := &Config{EventDecoders: map[string]string{contractID: "attestations"}}
+	b, err := NewBackfiller(cfg, BackfillConfig{StartLedger: 1, EndLedger: 10}, mockDB, logger)
+	require.NoError(t, err)
+
+	event := attestationContractEvent(scBytes(7), "attest", "revoke")
+	transaction := models.Transaction{Hash: "abc", Ledger: 5, Successful: true, ClosedAt: time.Unix(1700000000, 0).UTC()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contract_events").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO attestations \\(contract_id, uid, revoked").
+		WithArgs(contractID, sqlmock.AnyArg(), transaction.ClosedAt, uint32(5), "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, b.ingester.storeSorobanEvent(dbTx, transaction, sorobanEvent{event: event, inSuccessfulContractCall: true}, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackfillRecordsFailedChunks(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	b, err := NewBackfiller(&Config{}, BackfillConfig{StartLedger: 100, EndLedger: 149, ChunkSize: 25, Workers: 1}, mockDB, logger)
+	require.NoError(t, err)
+	b.newBackend = func() (backends.LedgerBackend, error) { return nil, errors.New("backend unavailable") }
+
+	mock.ExpectQuery("SELECT contract_id FROM contract_filters").WillReturnRows(sqlmock.NewRows([]string{"contract_id"}))
+	mock.ExpectExec("INSERT INTO backfill_chunks").WithArgs(uint32(100), uint32(124), ChunkPending, "backfill").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO backfill_chunks").WithArgs(uint32(125), uint32(149), ChunkPending, "backfill").WillReturnResult(sqlmock.NewResult(0, 0))
+	// The second chunk finished in an earlier run and is not returned
+	mock.ExpectQuery("SELECT range_start, range_end").
+		WithArgs("backfill", uint32(100), uint32(149), pq.Array([]string{ChunkComplete})).
+		WillReturnRows(sqlmock.NewRows([]string{"range_start", "range_end", "contract_id", "last_ledger", "status", "replace_ledgers"}).AddRow(100, 124, "", 110, ChunkRunning, false))
+	mock.ExpectExec("UPDATE backfill_chunks SET").
+		WithArgs(ChunkFailed, "backend unavailable", uint32(100), uint32(124), "", "backfill").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = b.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "100-124")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackfillSkipsCompletedRange(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	b, err := NewBackfiller(&Config{}, BackfillConfig{StartLedger: 1, EndLedger: 10, ChunkSize: 10}, mockDB, logger)
+	require.NoError(t, err)
+	b.newBackend = func() (backends.LedgerBackend, error) {
+		t.Fatal("no backend should be created for a completed range")
+		return nil, nil
+	}
+
+	mock.ExpectQuery("SELECT contract_id FROM contract_filters").WillReturnRows(sqlmock.NewRows([]string{"contract_id"}))
+	mock.ExpectExec("INSERT INTO backfill_chunks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT range_start, range_end").
+		WillReturnRows(sqlmock.NewRows([]string{"range_start", "range_end", "contract_id", "last_ledger", "status", "replace_ledgers"}))
+
+	assert.NoError(t, b.Run(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepairChunkReplacesLedgers(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	b, err := NewBackfiller(&Config{}, BackfillConfig{StartLedger: 101, EndLedger: 101}, mockDB, logger)
+	require.NoError(t, err)
+	backend, _ := newTestRPCBackend(t, 100, 110)
+	chunk := BackfillChunk{Start: 101, End: 101, Status: ChunkPending, Replace: true}
+
+	mock.ExpectExec("UPDATE backfill_chunks SET").WithArgs(ChunkRunning, nil, uint32(101), uint32(101), "", "backfill").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The stored ledger is deleted in the transaction that writes it again
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM ledgers WHERE sequence").WithArgs(uint32(101)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ledgers").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE backfill_chunks SET last_ledger").WithArgs(uint32(101), uint32(101), uint32(101), "", "backfill").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM ledger_failures").WithArgs(uint32(101)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec("UPDATE backfill_chunks SET").WithArgs(ChunkComplete, nil, uint32(101), uint32(101), "", "backfill").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, b.runChunk(context.Background(), backend, chunk))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/daccred/sorobangraph.attest.so/models"
 	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/strkey"
 	"github.com/stellar/go/xdr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -88,6 +89,11 @@ func TestScValConversion(t *testing.T) {
 		result = ingester.scValToJSON(intVal)
 		assert.Equal(t, xdr.Int32(42), result)
 
+		// 64-bit integers are decimal strings
+		i64Val := xdr.ScVal{Type: xdr.ScValTypeScvI64, I64: &[]xdr.Int64{-9007199254740993}[0]}
+		result = ingester.scValToJSON(i64Val)
+		assert.Equal(t, "-9007199254740993", result)
+
 		// Test string
 		strVal := xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &[]xdr.ScString{xdr.ScString("test")}[0]}
 		result = ingester.scValToJSON(strVal)
@@ -162,7 +168,7 @@ func TestExtractContractAddress(t *testing.T) {
 
 	t.Run("Contract address extraction", func(t *testing.T) {
 		// Create a contract ID
-		contractHash := xdr.Hash{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+		contractHash := xdr.ContractId{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
 		contractAddress := xdr.ScAddress{
 			Type:       xdr.ScAddressTypeScAddressTypeContract,
 			ContractId: &contractHash,
@@ -175,8 +181,11 @@ func TestExtractContractAddress(t *testing.T) {
 		}
 
 		result := ingester.extractContractAddress(invokeArgs)
-		expected := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
+		expected := strkey.MustEncode(strkey.VersionByteContract, contractHash[:])
 		assert.Equal(t, expected, result)
+		parsed, err := ParseContractID(result)
+		require.NoError(t, err)
+		assert.Equal(t, contractHash, parsed)
 	})
 
 	t.Run("Non-contract address returns empty", func(t *testing.T) {
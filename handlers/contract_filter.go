@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Sources reported in models.ContractFilter
+const (
+	FilterSourceConfig = "config"
+	FilterSourceAPI    = "api"
+)
+
+// filterReloadInterval is how often the contract filter is re-read so
+// changes made by other processes sharing the database are picked up
+const filterReloadInterval = 30 * time.Second
+
+var (
+	// ErrFilterContractNotFound is returned when removing a contract that was never added
+	ErrFilterContractNotFound = errors.New("contract is not in the filter")
+	// ErrFilterContractFixed is returned when removing a contract that comes from the configuration
+	ErrFilterContractFixed = errors.New("contract is configured statically")
+	// ErrInvalidLedgerRange is returned for a backfill start outside the ingested ledgers
+	ErrInvalidLedgerRange = errors.New("invalid ledger range")
+	// ErrFilterNotActive is returned when adding a contract while no filter
+	// is configured, which would narrow ingestion from everything to that contract
+	ErrFilterNotActive = errors.New("no filter is active, all data is being ingested")
+	// ErrLastFilterContract is returned when removing the only contract of a
+	// filter with nothing configured, which would widen ingestion to everything
+	ErrLastFilterContract = errors.New("contract is the last one in the filter")
+)
+
+// ContractFilters lists the contracts currently filtered for, configured
+// ones first
+func (i *Ingester) ContractFilters(ctx context.Context) ([]models.ContractFilter, error) {
+	filters := make([]models.ContractFilter, 0, len(i.config.FilterContracts))
+	for _, id := range i.config.FilterContracts {
+		filters = append(filters, models.ContractFilter{ContractID: canonicalContractID(id), Source: FilterSourceConfig})
+	}
+	rows, err := i.db.QueryContext(ctx, `
+		SELECT contract_id, label, created_at FROM contract_filters ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		filter := models.ContractFilter{Source: FilterSourceAPI}
+		var createdAt time.Time
+		if err := rows.Scan(&filter.ContractID, &filter.Label, &createdAt); err != nil {
+			return nil, err
+		}
+		filter.CreatedAt = &createdAt
+		filters = append(filters, filter)
+	}
+	return filters, rows.Err()
+}
+
+// AddFilterContract starts keeping data for a contract from the next ledger
+// on. With backfillFrom set, ledgers from backfillFrom up to the last
+// ingested one are scheduled for re-ingestion of the contract's events and
+// storage by the repair worker; the scheduled ranges are returned. Contracts
+// can only be added to an active filter, as adding the first one would stop
+// the ingestion of everything else.
+func (i *Ingester) AddFilterContract(ctx context.Context, contractID, label string, backfillFrom uint32) (models.ContractFilter, []models.LedgerGap, error) {
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return models.ContractFilter{}, nil, err
+	}
+	if _, filtering := i.activeFilter(); !filtering {
+		return models.ContractFilter{}, nil, ErrFilterNotActive
+	}
+
+	var ranges []models.LedgerGap
+	if backfillFrom > 0 {
+		if i.ledgerBackend == nil {
+			return models.ContractFilter{}, nil, ErrNoLedgerBackend
+		}
+		end := i.getCurrentLedger()
+		if end == 0 {
+			if end, err = i.loadLastLedger(); err != nil {
+				return models.ContractFilter{}, nil, fmt.Errorf("failed to load last ledger: %w", err)
+			}
+		}
+		if end == 0 || backfillFrom > end {
+			return models.ContractFilter{}, nil, fmt.Errorf("%w: backfill from %d, last ingested ledger is %d", ErrInvalidLedgerRange, backfillFrom, end)
+		}
+		for _, chunk := range PlanChunks(backfillFrom, end, defaultChunkSize) {
+			ranges = append(ranges, models.LedgerGap{Start: chunk.Start, End: chunk.End, Reason: GapContractBackfill, ContractID: id})
+		}
+	}
+
+	filter := models.ContractFilter{ContractID: id, Label: label, Source: FilterSourceAPI}
+	var createdAt time.Time
+	if err := i.db.QueryRowContext(ctx, `
+		INSERT INTO contract_filters (contract_id, label) VALUES ($1, $2)
+		ON CONFLICT (contract_id) DO UPDATE SET label = EXCLUDED.label
+		RETURNING created_at`, id, label).Scan(&createdAt); err != nil {
+		return models.ContractFilter{}, nil, fmt.Errorf("failed to add contract to filter: %w", err)
+	}
+	filter.CreatedAt = &createdAt
+
+	i.mu.Lock()
+	if !containsString(i.filterContracts, id) {
+		i.filterContracts = append(i.filterContracts, id)
+	}
+	i.mu.Unlock()
+	i.logger.Infof("Added contract %s to the ingestion filter", id)
+
+	if len(ranges) > 0 {
+		if err := i.ScheduleRepair(ctx, ranges); err != nil {
+			return filter, nil, fmt.Errorf("contract added but backfill could not be scheduled: %w", err)
+		}
+	}
+	return filter, ranges, nil
+}
+
+// RemoveFilterContract stops keeping data for a contract added through
+// AddFilterContract. Data already stored is left in place. The last contract
+// cannot be removed unless a filter is configured, as that would deactivate
+// the filter and start ingesting everything.
+func (i *Ingester) RemoveFilterContract(ctx context.Context, contractID string) error {
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return err
+	}
+	for _, configured := range i.config.FilterContracts {
+		if canonicalContractID(configured) == id {
+			return ErrFilterContractFixed
+		}
+	}
+	if i.isLastFilterContract(id) {
+		return ErrLastFilterContract
+	}
+	res, err := i.db.ExecContext(ctx, `DELETE FROM contract_filters WHERE contract_id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove contract from filter: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrFilterContractNotFound
+	}
+
+	i.mu.Lock()
+	kept := make([]string, 0, len(i.filterContracts))
+	for _, existing := range i.filterContracts {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+	i.filterContracts = kept
+	i.mu.Unlock()
+	i.logger.Infof("Removed contract %s from the ingestion filter", id)
+	return nil
+}
+
+// isLastFilterContract reports whether id is the only contract keeping the
+// filter active
+func (i *Ingester) isLastFilterContract(id string) bool {
+	if len(i.config.FilterContracts) > 0 || !i.config.Filter.IsEmpty() {
+		return false
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.filterContracts) == 1 && i.filterContracts[0] == id
+}
+
+// ReloadContractFilter replaces the runtime part of the filter with the
+// contents of the contract_filters table
+func (i *Ingester) ReloadContractFilter(ctx context.Context) error {
+	rows, err := i.db.QueryContext(ctx, `SELECT contract_id FROM contract_filters ORDER BY contract_id`)
+	if err != nil {
+		return fmt.Errorf("failed to load contract filter: %w", err)
+	}
+	defer rows.Close()
+	var contracts []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		contracts = append(contracts, canonicalContractID(id))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	i.filterContracts = contracts
+	i.mu.Unlock()
+	return nil
+}
+
+// runFilterReload keeps the runtime filter in sync with the database
+func (i *Ingester) runFilterReload(ctx context.Context) {
+	ticker := time.NewTicker(filterReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.ReloadContractFilter(ctx); err != nil {
+				i.logger.Errorf("Failed to reload contract filter: %v", err)
+			}
+		}
+	}
+}
+
+// contractScope returns an ingester that keeps only the data of one
+// contract, to backfill the history of a contract added to the filter
+// without re-ingesting that of the others
+func (i *Ingester) contractScope(contractID string) *Ingester {
+	cfg := *i.config
+	cfg.FilterContracts, cfg.Filter = nil, Filter{}
+	return &Ingester{
+		config:            &cfg,
+		db:                i.db,
+		networkPassphrase: i.networkPassphrase,
+		logger:            i.logger.WithField("contract_id", contractID),
+		stats:             &models.Stats{StartTime: time.Now()},
+		filterContracts:   []string{contractID},
+		decoders:          i.decoders,
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+func TestContractFilterHotReload(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	ingester := &Ingester{config: &Config{}, db: mockDB, logger: logger}
+	added := EncodeContractID(xdr.ContractId{1})
+	other := EncodeContractID(xdr.ContractId{2})
+
+	assert.True(t, ingester.isFilteredContract(other), "no filter includes everything")
+	// Adding a contract would narrow ingestion from everything to it
+	_, _, err = ingester.AddFilterContract(context.Background(), added, "attestations", 0)
+	assert.ErrorIs(t, err, ErrFilterNotActive)
+
+	configured := EncodeContractID(xdr.ContractId{9})
+	ingester.config.FilterContracts = []string{configured}
+	mock.ExpectQuery("INSERT INTO contract_filters").
+		WithArgs(added, "attestations").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	addedHash := xdr.ContractId{1}
+	filter, scheduled, err := ingester.AddFilterContract(context.Background(), hex.EncodeToString(addedHash[:]), "attestations", 0)
+	require.NoError(t, err)
+	assert.Equal(t, added, filter.ContractID)
+	assert.Equal(t, FilterSourceAPI, filter.Source)
+	assert.Empty(t, scheduled)
+
+	assert.True(t, ingester.isFilteredContract(added))
+	assert.False(t, ingester.isFilteredContract(other))
+
+	// Another process removed the contract and added a different one
+	mock.ExpectQuery("SELECT contract_id FROM contract_filters").
+		WillReturnRows(sqlmock.NewRows([]string{"contract_id"}).AddRow(other))
+	require.NoError(t, ingester.ReloadContractFilter(context.Background()))
+	assert.False(t, ingester.isFilteredContract(added))
+	assert.True(t, ingester.isFilteredContract(other))
+
+	// Without the configured contract, removing the last one would deactivate the filter
+	ingester.config.FilterContracts = nil
+	assert.ErrorIs(t, ingester.RemoveFilterContract(context.Background(), other), ErrLastFilterContract)
+	ingester.config.FilterContracts = []string{configured}
+
+	mock.ExpectExec("DELETE FROM contract_filters").WithArgs(other).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, ingester.RemoveFilterContract(context.Background(), other))
+	assert.False(t, ingester.isFilteredContract(other))
+	assert.True(t, ingester.isFilteredContract(configured))
+
+	mock.ExpectExec("DELETE FROM contract_filters").WithArgs(other).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, ingester.RemoveFilterContract(context.Background(), other), ErrFilterContractNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddFilterContractValidation(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	configured := EncodeContractID(xdr.ContractId{9})
+	ingester := &Ingester{config: &Config{FilterContracts: []string{configured}}, db: mockDB, logger: logger}
+	contract := EncodeContractID(xdr.ContractId{3})
+
+	_, _, err = ingester.AddFilterContract(context.Background(), "not-a-contract", "", 0)
+	assert.ErrorIs(t, err, ErrInvalidContractID)
+	_, _, err = ingester.AddFilterContract(context.Background(), contract, "", 100)
+	assert.ErrorIs(t, err, ErrNoLedgerBackend)
+	assert.ErrorIs(t, ingester.RemoveFilterContract(context.Background(), configured), ErrFilterContractFixed)
+
+	ingester.ledgerBackend = NewRPCLedgerBackend(RPCBackendConfig{ServerURL: "http://localhost:8000"})
+	ingester.repairSignal = make(chan struct{}, 1)
+	ingester.currentLedger = 50
+	_, _, err = ingester.AddFilterContract(context.Background(), contract, "", 100)
+	assert.ErrorIs(t, err, ErrInvalidLedgerRange)
+
+	mock.ExpectQuery("INSERT INTO contract_filters").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO backfill_chunks").
+		WithArgs(uint32(10), uint32(50), contract, ChunkPending, "repair", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, scheduled, err := ingester.AddFilterContract(context.Background(), contract, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.LedgerGap{{Start: 10, End: 50, Reason: GapContractBackfill, ContractID: contract}}, scheduled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	filtersRows := sqlmock.NewRows([]string{"contract_id", "label", "created_at"}).AddRow(contract, "", time.Now())
+	mock.ExpectQuery("SELECT contract_id, label, created_at FROM contract_filters").WillReturnRows(filtersRows)
+	filters, err := ingester.ContractFilters(context.Background())
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	assert.Equal(t, models.ContractFilter{ContractID: configured, Source: FilterSourceConfig}, filters[0])
+	assert.Equal(t, contract, filters[1].ContractID)
+}
+
+func TestContractScope(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	contract := EncodeContractID(xdr.ContractId{3})
+	other := EncodeContractID(xdr.ContractId{9})
+	ingester := &Ingester{
+		config:          &Config{FilterContracts: []string{other}, Filter: Filter{SourceAccounts: []string{testAccount}}},
+		logger:          logger,
+		filterContracts: []string{EncodeContractID(xdr.ContractId{4})},
+	}
+
+	scoped := ingester.contractScope(contract)
+	filter, filtering := scoped.activeFilter()
+	require.True(t, filtering)
+	assert.Equal(t, Filter{Contracts: []string{contract}}, filter)
+	assert.True(t, scoped.isFilteredContract(contract))
+	assert.False(t, scoped.isFilteredContract(other))
+	// The ingester it was scoped from keeps its filter
+	assert.Equal(t, []string{other}, ingester.config.FilterContracts)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+)
+
+// ErrInvalidContractID is returned for contract IDs that are neither a C...
+// strkey nor 32 hex-encoded bytes
+var ErrInvalidContractID = errors.New("invalid contract ID")
+
+// ParseContractID accepts a contract ID as a C... strkey or as the hex
+// encoding of its 32-byte hash
+func ParseContractID(id string) (xdr.ContractId, error) {
+	var contractID xdr.ContractId
+	id = strings.TrimSpace(id)
+	if raw, err := strkey.Decode(strkey.VersionByteContract, id); err == nil {
+		copy(contractID[:], raw)
+		return contractID, nil
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(id, "0x"))
+	if err != nil || len(raw) != len(contractID) {
+		return contractID, ErrInvalidContractID
+	}
+	copy(contractID[:], raw)
+	return contractID, nil
+}
+
+// EncodeContractID returns the canonical C... strkey of a contract hash, the
+// form stored in contract_events and returned by the API
+func EncodeContractID(id xdr.ContractId) string {
+	return strkey.MustEncode(strkey.VersionByteContract, id[:])
+}
+
+// NormalizeContractID converts a strkey or hex contract ID to its canonical strkey
+func NormalizeContractID(id string) (string, error) {
+	contractID, err := ParseContractID(id)
+	if err != nil {
+		return "", err
+	}
+	return EncodeContractID(contractID), nil
+}
+
+// canonicalContractID normalizes id when it is a valid contract ID and
+// otherwise returns it trimmed but unchanged, so arbitrary labels still
+// compare equal to themselves
+func canonicalContractID(id string) string {
+	if normalized, err := NormalizeContractID(id); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(id)
+}
+
+// canonicalContractIDs applies canonicalContractID to every entry
+func canonicalContractIDs(ids []string) []string {
+	if ids == nil {
+		return nil
+	}
+	out := make([]string, len(ids))
+	for idx, id := range ids {
+		out[idx] = canonicalContractID(id)
+	}
+	return out
+}
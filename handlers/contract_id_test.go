@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeContractID(t *testing.T) {
+	contractHash := xdr.ContractId{0xaa, 1, 2, 3}
+	hexID := hex.EncodeToString(contractHash[:])
+	strkeyID := EncodeContractID(contractHash)
+	require.True(t, strings.HasPrefix(strkeyID, "C"))
+
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"Strkey", strkeyID, true},
+		{"Lowercase hex", hexID, true},
+		{"Uppercase hex", strings.ToUpper(hexID), true},
+		{"Prefixed hex with whitespace", " 0x" + hexID + " ", true},
+		{"Short hex", hexID[:62], false},
+		{"Account strkey", strkey.MustEncode(strkey.VersionByteAccountID, contractHash[:]), false},
+		{"Empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := NormalizeContractID(tt.input)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidContractID)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, strkeyID, normalized)
+		})
+	}
+}
+
+func TestContractFilteringAcceptsStrkeyAndHex(t *testing.T) {
+	contractHash := xdr.ContractId{7, 7, 7}
+	hexID := hex.EncodeToString(contractHash[:])
+	strkeyID := EncodeContractID(contractHash)
+
+	logger := logrus.NewEntry(logrus.New())
+	byStrkey := &Ingester{config: &Config{FilterContracts: []string{strkeyID}}, logger: logger}
+	byHex := &Ingester{config: &Config{FilterContracts: []string{hexID}}, logger: logger}
+
+	for _, ingester := range []*Ingester{byStrkey, byHex} {
+		assert.True(t, ingester.isFilteredContract(strkeyID))
+		assert.True(t, ingester.isFilteredContract(hexID))
+		assert.False(t, ingester.isFilteredContract(EncodeContractID(xdr.ContractId{8})))
+	}
+
+	filter := SubscriptionFilter{ContractIDs: []string{hexID}}.normalized()
+	assert.True(t, filter.Matches(map[string]interface{}{
+		"type": "contract_event",
+		"data": models.ContractEvent{ContractID: strkeyID},
+	}))
+}
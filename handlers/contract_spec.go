@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/contractspec"
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Contract executables as stored in contracts.executable_type
+const (
+	ExecutableWasm         = "wasm"
+	ExecutableStellarAsset = "stellar_asset"
+)
+
+// ErrContractNotFound is returned for contracts whose instance has not been ingested
+var ErrContractNotFound = errors.New("contract not found")
+
+// contractSpec returns the spec of the WASM a contract runs, nil when the
+// contract, its WASM or the WASM's spec has not been ingested or the spec
+// does not parse, so calls fall back to positional arguments
+func (i *Ingester) contractSpec(dbTx *sql.Tx, contractID string) (*contractspec.Spec, error) {
+	var raw []byte
+	err := dbTx.QueryRow(`
+		SELECT cc.spec_xdr FROM contracts c
+		JOIN contract_code cc ON cc.wasm_hash = c.wasm_hash
+		WHERE c.contract_id = $1 AND cc.spec_xdr IS NOT NULL`, contractID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contract spec: %w", err)
+	}
+	spec, err := contractspec.Parse(raw)
+	if err != nil {
+		i.logger.Warnf("Failed to parse contract spec of %s: %v", contractID, err)
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// invocationDetails describes a contract call: the contract, the function
+// and its arguments, named and typed after the contract spec when it is
+// known and positional otherwise
+func (i *Ingester) invocationDetails(dbTx *sql.Tx, invoke xdr.InvokeContractArgs) (map[string]interface{}, error) {
+	contractID := i.extractContractAddress(invoke)
+	fn := string(invoke.FunctionName)
+	details := map[string]interface{}{"contract_id": contractID, "fn": fn}
+	var spec *contractspec.Spec
+	if contractID != "" {
+		var err error
+		if spec, err = i.contractSpec(dbTx, contractID); err != nil {
+			return nil, err
+		}
+	}
+	if spec != nil {
+		if args, ok := spec.Args(fn, invoke.Args); ok {
+			details["args"] = args
+			return details, nil
+		}
+	}
+	details["args"] = nativeArgs(invoke.Args)
+	return details, nil
+}
+
+// GetContract returns a contract's executable and, for WASM contracts, the
+// spec of its WASM when it was ingested
+func GetContract(ctx context.Context, db *sql.DB, contractID string) (models.Contract, error) {
+	var contract models.Contract
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return contract, err
+	}
+	var wasmHash sql.NullString
+	var spec []byte
+	err = db.QueryRowContext(ctx, `
+		SELECT c.contract_id, c.executable_type, c.wasm_hash, c.created_ledger, c.last_modified_ledger, cc.spec
+		FROM contracts c
+		LEFT JOIN contract_code cc ON cc.wasm_hash = c.wasm_hash
+		WHERE c.contract_id = $1`, id).Scan(
+		&contract.ContractID, &contract.ExecutableType, &wasmHash, &contract.CreatedLedger, &contract.LastModifiedLedger, &spec)
+	if err == sql.ErrNoRows {
+		return contract, ErrContractNotFound
+	}
+	if err != nil {
+		return contract, err
+	}
+	contract.WasmHash = wasmHash.String
+	if len(spec) > 0 {
+		contract.Spec = spec
+	}
+	return contract, nil
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessContractInstance(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	filtered := xdr.ContractId{1}
+	other := xdr.ContractId{2}
+	ingester := &Ingester{config: &Config{FilterContracts: []string{EncodeContractID(filtered)}}, logger: logrus.NewEntry(logrus.New())}
+	wasmHash := xdr.Hash{0xab}
+	instance := contractDataEntry(other, xdr.ScVal{Type: xdr.ScValTypeScvLedgerKeyContractInstance}, xdr.ScVal{
+		Type: xdr.ScValTypeScvContractInstance,
+		Instance: &xdr.ScContractInstance{Executable: xdr.ContractExecutable{
+			Type: xdr.ContractExecutableTypeContractExecutableWasm, WasmHash: &wasmHash,
+		}},
+	}, 40)
+
+	// Instances are recorded for contracts outside the filter too
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").
+		WithArgs(EncodeContractID(other), ExecutableWasm, wasmHash.HexString(), uint32(42), uint32(40)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processContractDataChange(dbTx, 42, ingest.Change{Type: xdr.LedgerEntryTypeContractData, Post: instance}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvocationDetails(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	contract := xdr.ContractId{1}
+	fn := xdr.ScSpecEntry{Kind: xdr.ScSpecEntryKindScSpecEntryFunctionV0, FunctionV0: &xdr.ScSpecFunctionV0{
+		Name: "attest",
+		Inputs: []xdr.ScSpecFunctionInputV0{
+			{Name: "subject", Type: xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeAddress}},
+			{Name: "value", Type: xdr.ScSpecTypeDef{Type: xdr.ScSpecTypeScSpecTypeString}},
+		},
+	}}
+	specXDR, err := fn.MarshalBinary()
+	require.NoError(t, err)
+	invoke := xdr.InvokeContractArgs{
+		ContractAddress: xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contract},
+		FunctionName:    "attest",
+		Args:            []xdr.ScVal{scAccount(testAccount), scString("verified")},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM contracts c").WithArgs(EncodeContractID(contract)).
+		WillReturnRows(sqlmock.NewRows([]string{"spec_xdr"}).AddRow(specXDR))
+	mock.ExpectQuery("FROM contracts c").WithArgs(EncodeContractID(contract)).
+		WillReturnRows(sqlmock.NewRows([]string{"spec_xdr"}))
+	mock.ExpectQuery("FROM contracts c").WithArgs(EncodeContractID(contract)).
+		WillReturnRows(sqlmock.NewRows([]string{"spec_xdr"}).AddRow([]byte{0xff}))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	details, err := ingester.invocationDetails(dbTx, invoke)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"contract_id": EncodeContractID(contract),
+		"fn":          "attest",
+		"args":        map[string]interface{}{"subject": testAccount, "value": "verified"},
+	}, details)
+
+	// Without a spec the arguments stay positional
+	details, err = ingester.invocationDetails(dbTx, invoke)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{testAccount, "verified"}, details["args"])
+
+	// Nor does a spec that does not parse fail the call
+	details, err = ingester.invocationDetails(dbTx, invoke)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{testAccount, "verified"}, details["args"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetContract(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	contractID := EncodeContractID(xdr.ContractId{1})
+	columns := []string{"contract_id", "executable_type", "wasm_hash", "created_ledger", "last_modified_ledger", "spec"}
+	mock.ExpectQuery("FROM contracts c").WithArgs(contractID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(contractID, ExecutableStellarAsset, nil, 10, 12, nil))
+	mock.ExpectQuery("FROM contracts c").WithArgs(contractID).WillReturnRows(sqlmock.NewRows(columns))
+
+	contract, err := GetContract(context.Background(), mockDB, contractID)
+	require.NoError(t, err)
+	assert.Equal(t, ExecutableStellarAsset, contract.ExecutableType)
+	assert.Empty(t, contract.WasmHash)
+	assert.Nil(t, contract.Spec)
+
+	_, err = GetContract(context.Background(), mockDB, contractID)
+	assert.ErrorIs(t, err, ErrContractNotFound)
+	_, err = GetContract(context.Background(), mockDB, "nope")
+	assert.ErrorIs(t, err, ErrInvalidContractID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
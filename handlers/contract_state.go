@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/contractspec"
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+// Contract data durabilities as stored in contract_data.durability
+const (
+	DurabilityPersistent = "persistent"
+	DurabilityTemporary  = "temporary"
+)
+
+var (
+	// ErrLedgerNotIngested is returned when reading state as of a ledger that is not in the ledgers table
+	ErrLedgerNotIngested = errors.New("ledger has not been ingested")
+	// ErrContractDataNotFound is returned when a storage entry does not exist at the requested ledger
+	ErrContractDataNotFound = errors.New("contract data entry not found")
+	// ErrContractCodeNotFound is returned for an unknown WASM hash
+	ErrContractCodeNotFound = errors.New("contract code not found")
+)
+
+// ContractStorageQuery selects the storage entries returned by ContractStorage
+type ContractStorageQuery struct {
+	Ledger     uint32 // Read state as of this ledger; 0 for the latest
+	Durability string // DurabilityPersistent or DurabilityTemporary; empty for both
+	Limit      int
+	Offset     int
+}
+
+// ledgerKeyHash returns the hex SHA-256 of the XDR ledger key of entry, the
+// identifier TTL entries use to refer to it
+func ledgerKeyHash(entry xdr.LedgerEntry) (string, error) {
+	key, err := entry.LedgerKey()
+	if err != nil {
+		return "", err
+	}
+	return keyHash(key)
+}
+
+// keyHash returns the hex SHA-256 of an XDR ledger key
+func keyHash(key xdr.LedgerKey) (string, error) {
+	raw, err := key.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func durabilityName(d xdr.ContractDataDurability) string {
+	if d == xdr.ContractDataDurabilityTemporary {
+		return DurabilityTemporary
+	}
+	return DurabilityPersistent
+}
+
+// encodeScVal returns the typed JSON and base64 XDR forms of val
+func encodeScVal(val xdr.ScVal) ([]byte, string, error) {
+	typed, err := scval.MarshalJSON(val)
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := xdr.MarshalBase64(val)
+	if err != nil {
+		return nil, "", err
+	}
+	return typed, raw, nil
+}
+
+// processContractDataChange records a created, updated or removed contract
+// storage entry in contract_data and contract_data_history. Entries of
+// contracts outside the contract filter are skipped.
+func (i *Ingester) processContractDataChange(dbTx *sql.Tx, ledgerSeq uint32, change ingest.Change) error {
+	entry := change.Post
+	if entry == nil {
+		entry = change.Pre
+	}
+	if entry == nil {
+		return nil
+	}
+	data := entry.Data.MustContractData()
+	contractID, err := scval.AddressString(data.Contract)
+	if err != nil {
+		return fmt.Errorf("failed to encode contract address: %w", err)
+	}
+	if change.Post != nil && data.Key.Type == xdr.ScValTypeScvLedgerKeyContractInstance {
+		if err := i.processContractInstance(dbTx, ledgerSeq, contractID, *change.Post); err != nil {
+			return err
+		}
+	}
+	if !i.isFilteredContract(contractID) {
+		return nil
+	}
+	keyHash, err := ledgerKeyHash(*entry)
+	if err != nil {
+		return fmt.Errorf("failed to hash ledger key: %w", err)
+	}
+	keyJSON, keyXDR, err := encodeScVal(data.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encode contract data key: %w", err)
+	}
+	durability := durabilityName(data.Durability)
+
+	// Current state only moves forward: ledgers older than the stored entry,
+	// as re-ingested by backfills and repairs, only add to the history
+	if change.Post == nil {
+		if _, err := dbTx.Exec(`DELETE FROM contract_data WHERE key_hash = $1 AND last_modified_ledger < $2`, keyHash, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to delete contract data: %w", err)
+		}
+		if _, err := dbTx.Exec(`
+			INSERT INTO contract_data_history (key_hash, ledger, contract_id, durability, key, key_xdr,
+				value, value_xdr, live_until_ledger, last_modified_ledger, deleted)
+			VALUES ($1, $2, $3, $4, $5, $6, NULL, NULL, NULL, $2, true)
+			ON CONFLICT (key_hash, ledger) DO UPDATE SET
+				value = NULL, value_xdr = NULL, live_until_ledger = NULL, deleted = true`,
+			keyHash, ledgerSeq, contractID, durability, keyJSON, keyXDR); err != nil {
+			return fmt.Errorf("failed to record contract data removal: %w", err)
+		}
+		return nil
+	}
+
+	valueJSON, valueXDR, err := encodeScVal(data.Val)
+	if err != nil {
+		return fmt.Errorf("failed to encode contract data value: %w", err)
+	}
+	lastModified := uint32(entry.LastModifiedLedgerSeq)
+	// The TTL lives in a separate entry, so an update keeps the known one
+	var liveUntil sql.NullInt64
+	err = dbTx.QueryRow(`
+		INSERT INTO contract_data (key_hash, contract_id, durability, key, key_xdr,
+			value, value_xdr, last_modified_ledger)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (key_hash) DO UPDATE SET
+			value = EXCLUDED.value, value_xdr = EXCLUDED.value_xdr,
+			last_modified_ledger = EXCLUDED.last_modified_ledger
+		WHERE contract_data.last_modified_ledger <= EXCLUDED.last_modified_ledger
+		RETURNING live_until_ledger`,
+		keyHash, contractID, durability, keyJSON, keyXDR, valueJSON, valueXDR, lastModified).Scan(&liveUntil)
+	// No row comes back when a newer version is stored
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to store contract data: %w", err)
+	}
+	if _, err := dbTx.Exec(`
+		INSERT INTO contract_data_history (key_hash, ledger, contract_id, durability, key, key_xdr,
+			value, value_xdr, live_until_ledger, last_modified_ledger, deleted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, false)
+		ON CONFLICT (key_hash, ledger) DO UPDATE SET
+			value = EXCLUDED.value, value_xdr = EXCLUDED.value_xdr,
+			last_modified_ledger = EXCLUDED.last_modified_ledger, deleted = false`,
+		keyHash, ledgerSeq, contractID, durability, keyJSON, keyXDR, valueJSON, valueXDR, liveUntil, lastModified); err != nil {
+		return fmt.Errorf("failed to record contract data history: %w", err)
+	}
+	return nil
+}
+
+// processContractCodeChange records uploaded WASM in contract_code
+func (i *Ingester) processContractCodeChange(dbTx *sql.Tx, ledgerSeq uint32, change ingest.Change) error {
+	if change.Post == nil {
+		if change.Pre == nil {
+			return nil
+		}
+		wasmHash := change.Pre.Data.MustContractCode().Hash.HexString()
+		if _, err := dbTx.Exec(`DELETE FROM contract_code WHERE wasm_hash = $1 AND last_modified_ledger < $2`, wasmHash, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to delete contract code: %w", err)
+		}
+		return nil
+	}
+	code := change.Post.Data.MustContractCode()
+	keyHash, err := ledgerKeyHash(*change.Post)
+	if err != nil {
+		return fmt.Errorf("failed to hash ledger key: %w", err)
+	}
+	var spec, specXDR interface{}
+	if raw, err := contractspec.Section(code.Code); err == nil {
+		if parsed, err := contractspec.Parse(raw); err != nil {
+			i.logger.Warnf("Failed to parse contract spec of WASM %s: %v", code.Hash.HexString(), err)
+		} else {
+			spec, _ = json.Marshal(parsed.Describe())
+			specXDR = raw
+		}
+	}
+	if _, err := dbTx.Exec(`
+		INSERT INTO contract_code (wasm_hash, key_hash, size, created_ledger, last_modified_ledger, spec, spec_xdr)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (wasm_hash) DO UPDATE SET last_modified_ledger = EXCLUDED.last_modified_ledger,
+			spec = EXCLUDED.spec, spec_xdr = EXCLUDED.spec_xdr
+		WHERE contract_code.last_modified_ledger <= EXCLUDED.last_modified_ledger`,
+		code.Hash.HexString(), keyHash, len(code.Code), ledgerSeq, uint32(change.Post.LastModifiedLedgerSeq),
+		spec, specXDR); err != nil {
+		return fmt.Errorf("failed to store contract code: %w", err)
+	}
+	return nil
+}
+
+// processContractInstance records the executable of a contract in
+// contracts. Instances are recorded for all contracts, filtered or not, so
+// invocations of any contract can be described with its spec.
+func (i *Ingester) processContractInstance(dbTx *sql.Tx, ledgerSeq uint32, contractID string, entry xdr.LedgerEntry) error {
+	val := entry.Data.MustContractData().Val
+	if val.Type != xdr.ScValTypeScvContractInstance {
+		return nil
+	}
+	executable := val.MustInstance().Executable
+	executableType, wasmHash := ExecutableStellarAsset, ""
+	if executable.Type == xdr.ContractExecutableTypeContractExecutableWasm && executable.WasmHash != nil {
+		executableType, wasmHash = ExecutableWasm, executable.WasmHash.HexString()
+	}
+	if _, err := dbTx.Exec(`
+		INSERT INTO contracts (contract_id, executable_type, wasm_hash, created_ledger, last_modified_ledger)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		ON CONFLICT (contract_id) DO UPDATE SET executable_type = EXCLUDED.executable_type,
+			wasm_hash = EXCLUDED.wasm_hash, last_modified_ledger = EXCLUDED.last_modified_ledger
+		WHERE contracts.last_modified_ledger <= EXCLUDED.last_modified_ledger`,
+		contractID, executableType, wasmHash, ledgerSeq, uint32(entry.LastModifiedLedgerSeq)); err != nil {
+		return fmt.Errorf("failed to store contract instance: %w", err)
+	}
+	return nil
+}
+
+// processTTLChange applies a TTL extension to the contract data or code entry
+// it belongs to. It runs after the ledger's other changes so entries created
+// in the same ledger exist; TTLs of entries that are not stored are ignored.
+func (i *Ingester) processTTLChange(dbTx *sql.Tx, ledgerSeq uint32, change ingest.Change) error {
+	if change.Post == nil {
+		return nil // removed together with its entry
+	}
+	ttl := change.Post.Data.MustTtl()
+	keyHash := ttl.KeyHash.HexString()
+	liveUntil := uint32(ttl.LiveUntilLedgerSeq)
+
+	res, err := dbTx.Exec(`UPDATE contract_data SET live_until_ledger = $2 WHERE key_hash = $1`, keyHash, liveUntil)
+	if err != nil {
+		return fmt.Errorf("failed to update contract data TTL: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		if _, err := dbTx.Exec(`
+			INSERT INTO contract_data_history (key_hash, ledger, contract_id, durability, key, key_xdr,
+				value, value_xdr, live_until_ledger, last_modified_ledger, deleted)
+			SELECT key_hash, $2, contract_id, durability, key, key_xdr,
+				value, value_xdr, live_until_ledger, last_modified_ledger, false
+			FROM contract_data WHERE key_hash = $1
+			ON CONFLICT (key_hash, ledger) DO UPDATE SET live_until_ledger = EXCLUDED.live_until_ledger`,
+			keyHash, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to record contract data TTL: %w", err)
+		}
+		return nil
+	}
+	if _, err := dbTx.Exec(`UPDATE contract_code SET live_until_ledger = $2 WHERE key_hash = $1`, keyHash, liveUntil); err != nil {
+		return fmt.Errorf("failed to update contract code TTL: %w", err)
+	}
+	return nil
+}
+
+// ContractStorage lists a contract's storage entries, either the latest
+// ones or those live as of q.Ledger. History starts at the first ledger
+// ingested, so state before it is incomplete.
+func ContractStorage(ctx context.Context, db *sql.DB, contractID string, q ContractStorageQuery) ([]models.ContractDataEntry, error) {
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return nil, err
+	}
+	if q.Ledger > 0 {
+		if err := requireIngestedLedger(ctx, db, q.Ledger); err != nil {
+			return nil, err
+		}
+	}
+	query, args := contractStorageQuery(id, q.Ledger, q.Durability, "")
+	query += fmt.Sprintf(" ORDER BY key_hash LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []models.ContractDataEntry{}
+	for rows.Next() {
+		entry, err := scanContractData(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ContractStorageEntry returns one storage entry by key hash, as of ledger
+// when it is non-zero
+func ContractStorageEntry(ctx context.Context, db *sql.DB, contractID, keyHash string, ledger uint32) (models.ContractDataEntry, error) {
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return models.ContractDataEntry{}, err
+	}
+	if ledger > 0 {
+		if err := requireIngestedLedger(ctx, db, ledger); err != nil {
+			return models.ContractDataEntry{}, err
+		}
+	}
+	query, args := contractStorageQuery(id, ledger, "", keyHash)
+	entry, err := scanContractData(db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return models.ContractDataEntry{}, ErrContractDataNotFound
+	}
+	return entry, err
+}
+
+// contractStorageQuery builds the selection of live entries of a contract,
+// from contract_data for the latest state and otherwise from the newest
+// version in contract_data_history at or before ledger
+func contractStorageQuery(contractID string, ledger uint32, durability, keyHash string) (string, []interface{}) {
+	args := []interface{}{contractID}
+	where := "contract_id = $1"
+	if durability != "" {
+		args = append(args, durability)
+		where += fmt.Sprintf(" AND durability = $%d", len(args))
+	}
+	if keyHash != "" {
+		args = append(args, keyHash)
+		where += fmt.Sprintf(" AND key_hash = $%d", len(args))
+	}
+	columns := `key_hash, contract_id, durability, key, key_xdr, value, value_xdr, live_until_ledger, last_modified_ledger`
+	if ledger == 0 {
+		return "SELECT " + columns + " FROM contract_data WHERE " + where, args
+	}
+	args = append(args, ledger)
+	return fmt.Sprintf(`
+		SELECT %s FROM (
+			SELECT DISTINCT ON (key_hash) *
+			FROM contract_data_history
+			WHERE %s AND ledger <= $%d
+			ORDER BY key_hash, ledger DESC
+		) latest
+		WHERE NOT deleted`, columns, where, len(args)), args
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanContractData(row rowScanner) (models.ContractDataEntry, error) {
+	var entry models.ContractDataEntry
+	var key, value []byte
+	var liveUntil sql.NullInt64
+	if err := row.Scan(&entry.KeyHash, &entry.ContractID, &entry.Durability, &key, &entry.KeyXDR,
+		&value, &entry.ValueXDR, &liveUntil, &entry.LastModifiedLedger); err != nil {
+		return entry, err
+	}
+	entry.Key = key
+	entry.Value = value
+	if liveUntil.Valid {
+		v := uint32(liveUntil.Int64)
+		entry.LiveUntilLedger = &v
+	}
+	return entry, nil
+}
+
+// GetContractCode returns an uploaded WASM by its hex hash
+func GetContractCode(ctx context.Context, db *sql.DB, wasmHash string) (models.ContractCode, error) {
+	var code models.ContractCode
+	var liveUntil sql.NullInt64
+	var spec []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT wasm_hash, size, created_ledger, last_modified_ledger, live_until_ledger, spec
+		FROM contract_code WHERE wasm_hash = $1`, wasmHash).Scan(
+		&code.WasmHash, &code.Size, &code.CreatedLedger, &code.LastModifiedLedger, &liveUntil, &spec)
+	if err == sql.ErrNoRows {
+		return code, ErrContractCodeNotFound
+	}
+	if err != nil {
+		return code, err
+	}
+	if liveUntil.Valid {
+		v := uint32(liveUntil.Int64)
+		code.LiveUntilLedger = &v
+	}
+	if len(spec) > 0 {
+		code.Spec = spec
+	}
+	return code, nil
+}
+
+// requireIngestedLedger returns ErrLedgerNotIngested unless ledger is stored
+func requireIngestedLedger(ctx context.Context, db *sql.DB, ledger uint32) error {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ledgers WHERE sequence = $1)`, ledger).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrLedgerNotIngested
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+func contractDataEntry(contract xdr.ContractId, key, val xdr.ScVal, lastModified uint32) *xdr.LedgerEntry {
+	return &xdr.LedgerEntry{
+		LastModifiedLedgerSeq: xdr.Uint32(lastModified),
+		Data: xdr.LedgerEntryData{
+			Type: xdr.LedgerEntryTypeContractData,
+			ContractData: &xdr.ContractDataEntry{
+				Contract:   xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contract},
+				Key:        key,
+				Durability: xdr.ContractDataDurabilityPersistent,
+				Val:        val,
+			},
+		},
+	}
+}
+
+func TestProcessContractDataChange(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	contract := xdr.ContractId{1}
+	other := xdr.ContractId{2}
+	ingester := &Ingester{config: &Config{FilterContracts: []string{EncodeContractID(contract)}}, logger: logger}
+	entry := contractDataEntry(contract, symbol("admin"), symbol("GA"), 90)
+	keyHash, err := ledgerKeyHash(*entry)
+	require.NoError(t, err)
+	keyJSON, err := scval.MarshalJSON(symbol("admin"))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO contract_data ").
+		WithArgs(keyHash, EncodeContractID(contract), DurabilityPersistent, keyJSON, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uint32(90)).
+		WillReturnRows(sqlmock.NewRows([]string{"live_until_ledger"}).AddRow(500))
+	mock.ExpectExec("INSERT INTO contract_data_history").
+		WithArgs(keyHash, uint32(100), EncodeContractID(contract), DurabilityPersistent, keyJSON,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uint32(90)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM contract_data WHERE key_hash = \\$1 AND last_modified_ledger < \\$2").
+		WithArgs(keyHash, uint32(101)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO contract_data_history").
+		WithArgs(keyHash, uint32(101), EncodeContractID(contract), DurabilityPersistent, keyJSON, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// A re-ingested old ledger leaves the newer stored entry and only adds history
+	mock.ExpectQuery("ON CONFLICT \\(key_hash\\) DO UPDATE SET(.|\n)*WHERE contract_data.last_modified_ledger <= EXCLUDED.last_modified_ledger").
+		WillReturnRows(sqlmock.NewRows([]string{"live_until_ledger"}))
+	mock.ExpectExec("INSERT INTO contract_data_history").
+		WithArgs(keyHash, uint32(95), EncodeContractID(contract), DurabilityPersistent, keyJSON,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uint32(90)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processContractDataChange(dbTx, 100, ingest.Change{Type: xdr.LedgerEntryTypeContractData, Post: entry}))
+	require.NoError(t, ingester.processContractDataChange(dbTx, 101, ingest.Change{Type: xdr.LedgerEntryTypeContractData, Pre: entry}))
+	require.NoError(t, ingester.processContractDataChange(dbTx, 95, ingest.Change{Type: xdr.LedgerEntryTypeContractData, Post: entry}))
+
+	// Contracts outside the filter are skipped
+	otherEntry := contractDataEntry(other, symbol("admin"), symbol("GB"), 90)
+	require.NoError(t, ingester.processContractDataChange(dbTx, 100, ingest.Change{Type: xdr.LedgerEntryTypeContractData, Post: otherEntry}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessContractCodeAndTTLChanges(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	wasmHash := xdr.Hash{0xab}
+	code := &xdr.LedgerEntry{
+		LastModifiedLedgerSeq: 70,
+		Data: xdr.LedgerEntryData{
+			Type:         xdr.LedgerEntryTypeContractCode,
+			ContractCode: &xdr.ContractCodeEntry{Hash: wasmHash, Code: make([]byte, 1234)},
+		},
+	}
+	codeKeyHash, err := ledgerKeyHash(*code)
+	require.NoError(t, err)
+	dataKeyHash := xdr.Hash{0xcd}
+	ttl := func(keyHash xdr.Hash, liveUntil uint32) ingest.Change {
+		return ingest.Change{Type: xdr.LedgerEntryTypeTtl, Post: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+			Type: xdr.LedgerEntryTypeTtl,
+			Ttl:  &xdr.TtlEntry{KeyHash: keyHash, LiveUntilLedgerSeq: xdr.Uint32(liveUntil)},
+		}}}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contract_code").
+		WithArgs(wasmHash.HexString(), codeKeyHash, 1234, uint32(70), uint32(70), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// A TTL for contract data extends it and records a new version
+	mock.ExpectExec("UPDATE contract_data SET live_until_ledger").
+		WithArgs(dataKeyHash.HexString(), uint32(9000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO contract_data_history(.|\n)*FROM contract_data WHERE key_hash").
+		WithArgs(dataKeyHash.HexString(), uint32(70)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Otherwise it belongs to contract code
+	mock.ExpectExec("UPDATE contract_data SET live_until_ledger").
+		WithArgs(codeKeyHash, uint32(8000)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE contract_code SET live_until_ledger").
+		WithArgs(codeKeyHash, uint32(8000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	require.NoError(t, ingester.processContractCodeChange(dbTx, 70, ingest.Change{Type: xdr.LedgerEntryTypeContractCode, Post: code}))
+	require.NoError(t, ingester.processTTLChange(dbTx, 70, ttl(dataKeyHash, 9000)))
+	raw, err := hex.DecodeString(codeKeyHash)
+	require.NoError(t, err)
+	var codeHash xdr.Hash
+	copy(codeHash[:], raw)
+	require.NoError(t, ingester.processTTLChange(dbTx, 70, ttl(codeHash, 8000)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestContractStorageAsOfLedger(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	contract := EncodeContractID(xdr.ContractId{3})
+	columns := []string{"key_hash", "contract_id", "durability", "key", "key_xdr", "value", "value_xdr", "live_until_ledger", "last_modified_ledger"}
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(uint32(120)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("DISTINCT ON \\(key_hash\\)(.|\n)*FROM contract_data_history(.|\n)*ledger <= \\$3(.|\n)*WHERE NOT deleted").
+		WithArgs(contract, DurabilityPersistent, uint32(120), 10, 0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("aa", contract, DurabilityPersistent, []byte(`{"type":"symbol","value":"admin"}`), "k", []byte(`{"type":"u32","value":1}`), "v", 300, 110))
+
+	entries, err := ContractStorage(context.Background(), mockDB, contract, ContractStorageQuery{Ledger: 120, Durability: DurabilityPersistent, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "aa", entries[0].KeyHash)
+	assert.JSONEq(t, `{"type":"u32","value":1}`, string(entries[0].Value))
+	require.NotNil(t, entries[0].LiveUntilLedger)
+	assert.Equal(t, uint32(300), *entries[0].LiveUntilLedger)
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(uint32(999)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	_, err = ContractStorage(context.Background(), mockDB, contract, ContractStorageQuery{Ledger: 999})
+	assert.ErrorIs(t, err, ErrLedgerNotIngested)
+
+	mock.ExpectQuery("SELECT (.|\n)* FROM contract_data WHERE contract_id = \\$1 AND key_hash = \\$2").
+		WithArgs(contract, "bb").
+		WillReturnRows(sqlmock.NewRows(columns))
+	_, err = ContractStorageEntry(context.Background(), mockDB, contract, "bb", 0)
+	assert.ErrorIs(t, err, ErrContractDataNotFound)
+
+	_, err = ContractStorage(context.Background(), mockDB, "nope", ContractStorageQuery{})
+	assert.ErrorIs(t, err, ErrInvalidContractID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
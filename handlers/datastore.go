@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/support/datastore"
+)
+
+// Datastore types accepted in DatastoreConfig.Type
+const (
+	DatastoreFilesystem = "filesystem"
+	DatastoreS3         = "S3"
+	DatastoreGCS        = "GCS"
+)
+
+// DatastoreConfig describes a ledger-meta data lake laid out the way galexie
+// exports it: batches of LedgerCloseMeta grouped into partitions
+type DatastoreConfig struct {
+	Type              string // DatastoreFilesystem, DatastoreS3 or DatastoreGCS
+	Path              string // Directory for filesystem, bucket/prefix for S3 and GCS
+	Region            string // S3 only
+	EndpointURL       string // S3-compatible endpoint; empty for AWS
+	LedgersPerFile    uint32
+	FilesPerPartition uint32
+	BufferSize        uint32 // Files prefetched ahead of the reader
+	NumWorkers        uint32 // Concurrent file downloads
+}
+
+func (c DatastoreConfig) withDefaults() DatastoreConfig {
+	if c.LedgersPerFile == 0 {
+		c.LedgersPerFile = 1
+	}
+	if c.FilesPerPartition == 0 {
+		c.FilesPerPartition = 64000
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = 100
+	}
+	if c.NumWorkers == 0 {
+		c.NumWorkers = 10
+	}
+	return c
+}
+
+func (c DatastoreConfig) schema() datastore.DataStoreSchema {
+	return datastore.DataStoreSchema{
+		LedgersPerFile:    c.LedgersPerFile,
+		FilesPerPartition: c.FilesPerPartition,
+	}
+}
+
+// newDataStore opens the configured data lake. Object stores go through the
+// stellar/go datastore package; local directories use FilesystemDataStore.
+func newDataStore(ctx context.Context, cfg DatastoreConfig, networkPassphrase string) (datastore.DataStore, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("datastore backend requires a path")
+	}
+	switch strings.ToLower(cfg.Type) {
+	case DatastoreFilesystem:
+		return NewFilesystemDataStore(cfg.Path)
+	case strings.ToLower(DatastoreS3):
+		params := map[string]string{"destination_bucket_path": cfg.Path}
+		if cfg.Region != "" {
+			params["region"] = cfg.Region
+		}
+		if cfg.EndpointURL != "" {
+			params["endpoint_url"] = cfg.EndpointURL
+		}
+		return datastore.NewDataStore(ctx, datastore.DataStoreConfig{
+			Type:              DatastoreS3,
+			Params:            params,
+			Schema:            cfg.schema(),
+			NetworkPassphrase: networkPassphrase,
+		})
+	case strings.ToLower(DatastoreGCS):
+		return datastore.NewDataStore(ctx, datastore.DataStoreConfig{
+			Type:              DatastoreGCS,
+			Params:            map[string]string{"destination_bucket_path": cfg.Path},
+			Schema:            cfg.schema(),
+			NetworkPassphrase: networkPassphrase,
+		})
+	default:
+		return nil, fmt.Errorf("unknown datastore type %q", cfg.Type)
+	}
+}
+
+// FilesystemDataStore is a datastore.DataStore rooted at a local directory,
+// used for fixture ledgers and data lakes synced to disk. File metadata is
+// not persisted.
+type FilesystemDataStore struct {
+	root string
+}
+
+// NewFilesystemDataStore opens the data lake directory at root
+func NewFilesystemDataStore(root string) (*FilesystemDataStore, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open datastore directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("datastore path %s is not a directory", root)
+	}
+	return &FilesystemDataStore{root: root}, nil
+}
+
+func (f *FilesystemDataStore) fullPath(path string) string {
+	return filepath.Join(f.root, filepath.FromSlash(path))
+}
+
+func (f *FilesystemDataStore) GetFileMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if _, err := os.Stat(f.fullPath(path)); err != nil {
+		return nil, err
+	}
+	return map[string]string{}, nil
+}
+
+func (f *FilesystemDataStore) GetFileLastModified(ctx context.Context, path string) (time.Time, error) {
+	info, err := os.Stat(f.fullPath(path))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (f *FilesystemDataStore) GetFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(f.fullPath(path))
+}
+
+func (f *FilesystemDataStore) PutFile(ctx context.Context, path string, in io.WriterTo, metaData map[string]string) error {
+	full := f.fullPath(path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial batch
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := in.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), full)
+}
+
+func (f *FilesystemDataStore) PutFileIfNotExists(ctx context.Context, path string, in io.WriterTo, metaData map[string]string) (bool, error) {
+	exists, err := f.Exists(ctx, path)
+	if err != nil || exists {
+		return false, err
+	}
+	if err := f.PutFile(ctx, path, in, metaData); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *FilesystemDataStore) Exists(ctx context.Context, path string) (bool, error) {
+	_, err := os.Stat(f.fullPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *FilesystemDataStore) Size(ctx context.Context, path string) (int64, error) {
+	info, err := os.Stat(f.fullPath(path))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// maxListFilePaths caps ListFilePaths as the object store datastores do
+const maxListFilePaths = 1000
+
+// ListFilePaths returns up to options.Limit file paths under options.Prefix
+// that sort after options.StartAfter, in lexical order
+func (f *FilesystemDataStore) ListFilePaths(ctx context.Context, options datastore.ListFileOptions) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, options.Prefix) && rel > options.StartAfter {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	limit := int(options.Limit)
+	if limit == 0 || limit > maxListFilePaths {
+		limit = maxListFilePaths
+	}
+	if len(paths) > limit {
+		paths = paths[:limit]
+	}
+	return paths, nil
+}
+
+func (f *FilesystemDataStore) Close() error { return nil }
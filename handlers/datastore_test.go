@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/compressxdr"
+	"github.com/stellar/go/support/datastore"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemDataStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFilesystemDataStore(root)
+	require.NoError(t, err)
+
+	path := "FFFFFFFF--0-63999/FFFFFF9B--100.xdr.zst"
+	exists, err := store.Exists(ctx, path)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, store.PutFile(ctx, path, bytes.NewBufferString("batch-100"), nil))
+	created, err := store.PutFileIfNotExists(ctx, path, bytes.NewBufferString("other"), nil)
+	require.NoError(t, err)
+	assert.False(t, created, "existing files are not overwritten")
+	created, err = store.PutFileIfNotExists(ctx, "FFFFFFFF--0-63999/FFFFFF9A--101.xdr.zst", bytes.NewBufferString("batch-101"), nil)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	reader, err := store.GetFile(ctx, path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "batch-100", string(content))
+
+	size, err := store.Size(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("batch-100")), size)
+
+	paths, err := store.ListFilePaths(ctx, datastore.ListFileOptions{Prefix: "FFFFFFFF--0-63999/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"FFFFFFFF--0-63999/FFFFFF9A--101.xdr.zst",
+		"FFFFFFFF--0-63999/FFFFFF9B--100.xdr.zst",
+	}, paths)
+
+	paths, err = store.ListFilePaths(ctx, datastore.ListFileOptions{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	paths, err = store.ListFilePaths(ctx, datastore.ListFileOptions{StartAfter: "FFFFFFFF--0-63999/FFFFFF9A--101.xdr.zst"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FFFFFFFF--0-63999/FFFFFF9B--100.xdr.zst"}, paths)
+
+	_, err = store.GetFile(ctx, "missing.xdr.zst")
+	assert.Error(t, err)
+}
+
+func TestDatastoreBackendReadsLedgers(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFilesystemDataStore(root)
+	require.NoError(t, err)
+
+	// A fixture data lake of two ledgers per file, as galexie writes them
+	cfg := DatastoreConfig{Type: DatastoreFilesystem, Path: root, LedgersPerFile: 2, FilesPerPartition: 10, BufferSize: 2, NumWorkers: 1}
+	schema := cfg.schema()
+	for start := uint32(100); start <= 102; start += 2 {
+		batch := xdr.LedgerCloseMetaBatch{StartSequence: xdr.Uint32(start), EndSequence: xdr.Uint32(start + 1)}
+		for seq := start; seq <= start+1; seq++ {
+			batch.LedgerCloseMetas = append(batch.LedgerCloseMetas, xdr.LedgerCloseMeta{
+				V: 0,
+				V0: &xdr.LedgerCloseMetaV0{
+					LedgerHeader: xdr.LedgerHeaderHistoryEntry{Header: xdr.LedgerHeader{LedgerSeq: xdr.Uint32(seq)}},
+				},
+			})
+		}
+		encoder := compressxdr.NewXDREncoder(compressxdr.DefaultCompressor, batch)
+		require.NoError(t, store.PutFile(ctx, schema.GetObjectKeyFromSequenceNumber(start), encoder, nil))
+	}
+
+	backend, err := newLedgerBackend(&Config{LedgerBackend: BackendDatastore, Datastore: cfg})
+	require.NoError(t, err)
+	defer backend.Close()
+	require.NoError(t, backend.PrepareRange(ctx, backends.BoundedRange(101, 103)))
+	for seq := uint32(101); seq <= 103; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		assert.Equal(t, seq, lcm.LedgerSequence())
+	}
+}
+
+func TestNewDataStore(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := newDataStore(ctx, DatastoreConfig{Type: DatastoreFilesystem}, "")
+	assert.Error(t, err, "path is required")
+
+	_, err = newDataStore(ctx, DatastoreConfig{Type: "ftp", Path: "bucket"}, "")
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "ledgers")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err = newDataStore(ctx, DatastoreConfig{Type: DatastoreFilesystem, Path: file}, "")
+	assert.Error(t, err, "path must be a directory")
+
+	store, err := newDataStore(ctx, DatastoreConfig{Type: "Filesystem", Path: t.TempDir()}, "")
+	require.NoError(t, err)
+	assert.IsType(t, &FilesystemDataStore{}, store)
+}
+
+func TestDatastoreConfigDefaults(t *testing.T) {
+	cfg := DatastoreConfig{}.withDefaults()
+	assert.Equal(t, uint32(1), cfg.LedgersPerFile)
+	assert.Equal(t, uint32(64000), cfg.FilesPerPartition)
+	assert.Equal(t, uint32(100), cfg.BufferSize)
+	assert.Equal(t, uint32(10), cfg.NumWorkers)
+
+	cfg = DatastoreConfig{LedgersPerFile: 64, NumWorkers: 2}.withDefaults()
+	assert.Equal(t, uint32(64), cfg.LedgersPerFile)
+	assert.Equal(t, uint32(2), cfg.NumWorkers)
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// ErrUnknownDecoder is returned for decoder names that are not registered
+var ErrUnknownDecoder = errors.New("unknown event decoder")
+
+// redecodeBatchSize is the number of events re-decoded per database transaction
+const redecodeBatchSize = 500
+
+// EventDecoder turns the contract events of a kind of contract into a
+// readable form, stored in contract_events.decoded
+type EventDecoder interface {
+	// Name identifies the decoder in contract_events.decoder and in the config
+	Name() string
+	// Decode returns the decoded form of an event, false for events it does
+	// not recognize
+	Decode(event xdr.ContractEvent) (interface{}, bool)
+}
+
+// EventProjector is implemented by decoders that also keep typed tables.
+// Project is only called for events of successful contract calls.
+type EventProjector interface {
+	Project(dbTx *sql.Tx, event DecodedEvent) error
+}
+
+// DecodedEvent is a decoded event with where it was emitted
+type DecodedEvent struct {
+	ID              string
+	ContractID      string
+	Ledger          uint32
+	TransactionHash string
+	ClosedAt        time.Time
+	Event           xdr.ContractEvent
+	Value           interface{} // As returned by Decode
+}
+
+// DecoderRegistry selects the decoder of a contract event: the decoders
+// registered for the emitting contract first, then those registered for the
+// symbol of its first topic. The first decoder that recognizes the event wins.
+type DecoderRegistry struct {
+	mu        sync.RWMutex
+	decoders  map[string]EventDecoder
+	contracts map[string][]EventDecoder
+	topics    map[string][]EventDecoder
+}
+
+func NewDecoderRegistry() *DecoderRegistry {
+	return &DecoderRegistry{
+		decoders:  map[string]EventDecoder{},
+		contracts: map[string][]EventDecoder{},
+		topics:    map[string][]EventDecoder{},
+	}
+}
+
+// DefaultDecoders returns a registry with the built-in decoders: SEP-41 token
+// events keyed by topic, and the attestations decoder. Since any contract
+// can emit attestation topics, the attestations decoder only applies to the
+// contracts registered for it.
+func DefaultDecoders() *DecoderRegistry {
+	r := NewDecoderRegistry()
+	for _, topic := range tokenEventTopics {
+		r.RegisterTopic(topic, tokenDecoder{})
+	}
+	r.Register(attestationDecoder{})
+	return r
+}
+
+// Register makes a decoder available by name, to be registered for
+// contracts, without applying it to any event
+func (r *DecoderRegistry) Register(decoder EventDecoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[decoder.Name()] = decoder
+}
+
+// RegisterTopic registers a decoder for events whose first topic is the
+// symbol topic, compared case-insensitively
+func (r *DecoderRegistry) RegisterTopic(topic string, decoder EventDecoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[decoder.Name()] = decoder
+	key := strings.ToLower(topic)
+	r.topics[key] = appendDecoder(r.topics[key], decoder)
+}
+
+// RegisterContract registers a decoder for all events of a contract, given
+// as a C... strkey or hex contract ID
+func (r *DecoderRegistry) RegisterContract(contractID string, decoder EventDecoder) error {
+	id, err := NormalizeContractID(contractID)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[decoder.Name()] = decoder
+	r.contracts[id] = appendDecoder(r.contracts[id], decoder)
+	return nil
+}
+
+func appendDecoder(decoders []EventDecoder, decoder EventDecoder) []EventDecoder {
+	for _, d := range decoders {
+		if d.Name() == decoder.Name() {
+			return decoders
+		}
+	}
+	return append(decoders, decoder)
+}
+
+// Decoder returns a registered decoder by name
+func (r *DecoderRegistry) Decoder(name string) (EventDecoder, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	decoder, ok := r.decoders[name]
+	return decoder, ok
+}
+
+// Decoders lists the registered decoders with the topics and contracts they
+// are registered for
+func (r *DecoderRegistry) Decoders() []models.EventDecoder {
+	if r == nil {
+		return []models.EventDecoder{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	byName := map[string]*models.EventDecoder{}
+	for name := range r.decoders {
+		byName[name] = &models.EventDecoder{Name: name, Topics: []string{}, Contracts: []string{}}
+	}
+	for topic, decoders := range r.topics {
+		for _, d := range decoders {
+			byName[d.Name()].Topics = append(byName[d.Name()].Topics, topic)
+		}
+	}
+	for contract, decoders := range r.contracts {
+		for _, d := range decoders {
+			byName[d.Name()].Contracts = append(byName[d.Name()].Contracts, contract)
+		}
+	}
+	list := make([]models.EventDecoder, 0, len(byName))
+	for _, d := range byName {
+		sort.Strings(d.Topics)
+		sort.Strings(d.Contracts)
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list
+}
+
+// decode decodes a contract event with the first registered decoder that
+// recognizes it. System and diagnostic events are not decoded.
+func (r *DecoderRegistry) decode(contractID string, event xdr.ContractEvent) (EventDecoder, interface{}, bool) {
+	for _, decoder := range r.candidates(contractID, event) {
+		if value, ok := decoder.Decode(event); ok {
+			return decoder, value, true
+		}
+	}
+	return nil, nil, false
+}
+
+// candidates lists the decoders registered for the contract or the first
+// topic of an event, in the order they are tried
+func (r *DecoderRegistry) candidates(contractID string, event xdr.ContractEvent) []EventDecoder {
+	if r == nil || event.Type != xdr.ContractEventTypeContract || event.Body.V0 == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	candidates := append([]EventDecoder{}, r.contracts[contractID]...)
+	if topics := event.Body.V0.Topics; len(topics) > 0 {
+		if sym, ok := topics[0].GetSym(); ok {
+			candidates = append(candidates, r.topics[strings.ToLower(string(sym))]...)
+		}
+	}
+	return candidates
+}
+
+// project stores a decoded event in the typed tables of its decoder, if any
+func project(dbTx *sql.Tx, decoder EventDecoder, event DecodedEvent) error {
+	projector, ok := decoder.(EventProjector)
+	if !ok {
+		return nil
+	}
+	if err := projector.Project(dbTx, event); err != nil {
+		return fmt.Errorf("failed to project %s event %s: %w", decoder.Name(), event.ID, err)
+	}
+	return nil
+}
+
+// nullJSON passes encoded JSON to a JSONB column, NULL when empty
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+// RedecodeQuery selects the stored events to decode again; empty fields
+// match any value
+type RedecodeQuery struct {
+	Decoder    string `json:"decoder"` // Only apply this decoder, leaving events it does not recognize as they are
+	ContractID string `json:"contract_id"`
+	From       uint32 `json:"from"`
+	To         uint32 `json:"to"`
+}
+
+// RedecodeEvents decodes stored contract events again from their XDR, for
+// instance after registering a decoder, and refreshes the typed tables of
+// the decoders that keep them. The XDR of events stored without it is first
+// restored from the result meta of their transactions; events whose
+// transaction has none are skipped.
+func (i *Ingester) RedecodeEvents(ctx context.Context, q RedecodeQuery) (models.RedecodeResult, error) {
+	var result models.RedecodeResult
+	var only EventDecoder
+	if q.Decoder != "" {
+		decoder, ok := i.decoders.Decoder(q.Decoder)
+		if !ok {
+			return result, ErrUnknownDecoder
+		}
+		only = decoder
+	}
+	if q.ContractID != "" {
+		id, err := NormalizeContractID(q.ContractID)
+		if err != nil {
+			return result, err
+		}
+		q.ContractID = id
+	}
+	if q.To > 0 && q.To < q.From {
+		return result, ErrInvalidLedgerRange
+	}
+
+	if err := i.restoreEventXDR(ctx, q); err != nil {
+		return result, err
+	}
+	skipped := i.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM contract_events
+		WHERE event_type = 'contract' AND event_xdr IS NULL
+			AND ($1 = '' OR contract_id = $1) AND ledger >= $2 AND ($3 = 0 OR ledger <= $3)`,
+		q.ContractID, q.From, q.To)
+	if err := skipped.Scan(&result.Skipped); err != nil {
+		return result, err
+	}
+
+	lastLedger, lastID := q.From, ""
+	for {
+		rows, err := i.db.QueryContext(ctx, `
+			SELECT id, contract_id, ledger, transaction_hash, in_successful_tx, in_successful_contract_call,
+				closed_at, event_xdr
+			FROM contract_events
+			WHERE event_type = 'contract' AND event_xdr IS NOT NULL
+				AND ($1 = '' OR contract_id = $1) AND ($2 = 0 OR ledger <= $2)
+				AND (ledger, id) > ($3, $4)
+			ORDER BY ledger, id
+			LIMIT $5`, q.ContractID, q.To, lastLedger, lastID, redecodeBatchSize)
+		if err != nil {
+			return result, err
+		}
+		type storedEvent struct {
+			DecodedEvent
+			project bool
+		}
+		var batch []storedEvent
+		for rows.Next() {
+			var e storedEvent
+			var successfulTx, successfulCall bool
+			var raw []byte
+			if err := rows.Scan(&e.ID, &e.ContractID, &e.Ledger, &e.TransactionHash, &successfulTx, &successfulCall,
+				&e.ClosedAt, &raw); err != nil {
+				rows.Close()
+				return result, err
+			}
+			if err := e.Event.UnmarshalBinary(raw); err != nil {
+				rows.Close()
+				return result, fmt.Errorf("failed to decode XDR of event %s: %w", e.ID, err)
+			}
+			e.project = successfulTx && successfulCall
+			batch = append(batch, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+		result.Processed += len(batch)
+
+		dbTx, err := i.db.BeginTx(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		for _, e := range batch {
+			var decoder EventDecoder
+			var ok bool
+			if only != nil {
+				// The decoder still only applies where it is registered
+				for _, candidate := range i.decoders.candidates(e.ContractID, e.Event) {
+					if candidate.Name() == only.Name() {
+						decoder = only
+						e.Value, ok = only.Decode(e.Event)
+					}
+				}
+				if !ok {
+					continue
+				}
+			} else {
+				decoder, e.Value, ok = i.decoders.decode(e.ContractID, e.Event)
+			}
+			var name sql.NullString
+			var decoded []byte
+			if ok {
+				name = sql.NullString{String: decoder.Name(), Valid: true}
+				decoded, _ = json.Marshal(e.Value)
+				result.Decoded++
+			}
+			if _, err := dbTx.Exec(`UPDATE contract_events SET decoder = $2, decoded = $3 WHERE id = $1`,
+				e.ID, name, nullJSON(decoded)); err != nil {
+				dbTx.Rollback()
+				return result, fmt.Errorf("failed to store decoded event: %w", err)
+			}
+			if ok && e.project {
+				if err := project(dbTx, decoder, e.DecodedEvent); err != nil {
+					dbTx.Rollback()
+					return result, err
+				}
+			}
+		}
+		if err := dbTx.Commit(); err != nil {
+			return result, err
+		}
+		last := batch[len(batch)-1]
+		lastLedger, lastID = last.Ledger, last.ID
+	}
+}
+
+// restoreEventXDR fills in the XDR of the contract events selected by q that
+// were stored without it, reading the events again from the result meta of
+// their transactions
+func (i *Ingester) restoreEventXDR(ctx context.Context, q RedecodeQuery) error {
+	lastLedger, lastIndex := uint32(0), uint32(0)
+	for {
+		rows, err := i.db.QueryContext(ctx, `
+			SELECT t.ledger, t.index, t.result_xdr, t.result_meta_xdr
+			FROM transactions t
+			WHERE (t.ledger, t.hash) IN (
+					SELECT ledger, transaction_hash FROM contract_events
+					WHERE event_type = 'contract' AND event_xdr IS NULL
+						AND ($1 = '' OR contract_id = $1) AND ledger >= $2 AND ($3 = 0 OR ledger <= $3))
+				AND t.result_xdr IS NOT NULL AND t.result_meta_xdr IS NOT NULL
+				AND (t.ledger, t.index) > ($4, $5)
+			ORDER BY t.ledger, t.index
+			LIMIT $6`, q.ContractID, q.From, q.To, lastLedger, lastIndex, redecodeBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to load transactions of events without XDR: %w", err)
+		}
+		type restored struct {
+			id  string
+			raw []byte
+		}
+		var batch []restored
+		count := 0
+		for rows.Next() {
+			var resultXDR, metaXDR []byte
+			tx := ingest.LedgerTransaction{}
+			if err := rows.Scan(&lastLedger, &lastIndex, &resultXDR, &metaXDR); err != nil {
+				rows.Close()
+				return err
+			}
+			count++
+			tx.Index = lastIndex
+			if tx.Result.UnmarshalBinary(resultXDR) != nil || tx.UnsafeMeta.UnmarshalBinary(metaXDR) != nil {
+				i.logger.Warnf("Cannot restore event XDR of transaction %d-%d: undecodable result or meta", lastLedger, lastIndex)
+				continue
+			}
+			for _, event := range transactionEvents(tx) {
+				if event.event.Type != xdr.ContractEventTypeContract {
+					continue
+				}
+				raw, err := event.event.MarshalBinary()
+				if err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to encode contract event: %w", err)
+				}
+				batch = append(batch, restored{eventID(lastLedger, lastIndex, event), raw})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if _, err := i.db.ExecContext(ctx, `UPDATE contract_events SET event_xdr = $2 WHERE id = $1 AND event_xdr IS NULL`, e.id, e.raw); err != nil {
+				return fmt.Errorf("failed to restore event XDR: %w", err)
+			}
+		}
+		if count < redecodeBatchSize {
+			return nil
+		}
+	}
+}
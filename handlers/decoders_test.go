@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scI128(n int64) xdr.ScVal {
+	parts := xdr.Int128Parts{Lo: xdr.Uint64(n)}
+	if n < 0 {
+		parts.Hi = -1
+	}
+	return xdr.ScVal{Type: xdr.ScValTypeScvI128, I128: &parts}
+}
+
+func scString(s string) xdr.ScVal {
+	str := xdr.ScString(s)
+	return xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &str}
+}
+
+func tokenEvent(data xdr.ScVal, topics ...xdr.ScVal) xdr.ContractEvent {
+	contract := xdr.ContractId{4}
+	return xdr.ContractEvent{
+		ContractId: &contract,
+		Type:       xdr.ContractEventTypeContract,
+		Body:       xdr.ContractEventBody{V: 0, V0: &xdr.ContractEventV0{Topics: topics, Data: data}},
+	}
+}
+
+func TestTokenDecoder(t *testing.T) {
+	asset := scString("USDC:" + testIssuer)
+	u32 := xdr.Uint32(900)
+	tests := []struct {
+		name  string
+		event xdr.ContractEvent
+		want  TokenEvent
+		ok    bool
+	}{
+		{"transfer", tokenEvent(scI128(100), symbol("transfer"), scAccount(testAccount), scAccount(testIssuer), asset),
+			TokenEvent{Event: "transfer", From: testAccount, To: testIssuer, Asset: "USDC:" + testIssuer, Amount: "100"}, true},
+		{"muxed transfer", tokenEvent(scStruct("amount", scI128(5), "to_muxed_id", scU64(7)),
+			symbol("transfer"), scAccount(testAccount), scAccount(testIssuer)),
+			TokenEvent{Event: "transfer", From: testAccount, To: testIssuer, Amount: "5", ToMuxedID: "7"}, true},
+		{"mint with admin", tokenEvent(scI128(3), symbol("mint"), scAccount(testIssuer), scAccount(testAccount), asset),
+			TokenEvent{Event: "mint", Admin: testIssuer, To: testAccount, Asset: "USDC:" + testIssuer, Amount: "3"}, true},
+		{"mint", tokenEvent(scI128(3), symbol("mint"), scAccount(testAccount)),
+			TokenEvent{Event: "mint", To: testAccount, Amount: "3"}, true},
+		{"burn", tokenEvent(scI128(2), symbol("burn"), scAccount(testAccount)),
+			TokenEvent{Event: "burn", From: testAccount, Amount: "2"}, true},
+		{"approve", tokenEvent(scVec(scI128(9), xdr.ScVal{Type: xdr.ScValTypeScvU32, U32: &u32}),
+			symbol("approve"), scAccount(testAccount), scAccount(testIssuer)),
+			TokenEvent{Event: "approve", From: testAccount, Spender: testIssuer, Amount: "9", LiveUntilLedger: 900}, true},
+		{"transfer without recipient", tokenEvent(scI128(1), symbol("transfer"), scAccount(testAccount)), TokenEvent{}, false},
+		{"non-numeric amount", tokenEvent(symbol("GA"), symbol("burn"), scAccount(testAccount)), TokenEvent{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, ok := tokenDecoder{}.Decode(tt.event)
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.want, decoded)
+			}
+		})
+	}
+}
+
+// constDecoder recognizes every event
+type constDecoder struct{ name string }
+
+func (d constDecoder) Name() string { return d.name }
+
+func (d constDecoder) Decode(event xdr.ContractEvent) (interface{}, bool) {
+	return map[string]string{"decoder": d.name}, true
+}
+
+func TestDecoderRegistry(t *testing.T) {
+	registry := DefaultDecoders()
+	contract := xdr.ContractId{4}
+	transfer := tokenEvent(scI128(100), symbol("transfer"), scAccount(testAccount), scAccount(testIssuer))
+
+	decoder, _, ok := registry.decode(EncodeContractID(contract), transfer)
+	require.True(t, ok)
+	assert.Equal(t, "sep41", decoder.Name())
+
+	// Decoders registered for a contract come before those of the topic
+	require.NoError(t, registry.RegisterContract(EncodeContractID(contract), constDecoder{"custom"}))
+	decoder, value, ok := registry.decode(EncodeContractID(contract), transfer)
+	require.True(t, ok)
+	assert.Equal(t, "custom", decoder.Name())
+	assert.Equal(t, map[string]string{"decoder": "custom"}, value)
+	decoder, _, ok = registry.decode(EncodeContractID(xdr.ContractId{5}), transfer)
+	require.True(t, ok)
+	assert.Equal(t, "sep41", decoder.Name())
+
+	// System and diagnostic events are not decoded
+	transfer.Type = xdr.ContractEventTypeDiagnostic
+	_, _, ok = registry.decode(EncodeContractID(contract), transfer)
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, registry.RegisterContract("nope", constDecoder{"custom"}), ErrInvalidContractID)
+	names := []string{}
+	for _, d := range registry.Decoders() {
+		names = append(names, d.Name)
+	}
+	assert.Equal(t, []string{"attestations", "custom", "sep41"}, names)
+}
+
+func TestRedecodeEvents(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, db: mockDB, decoders: DefaultDecoders(), logger: logrus.NewEntry(logrus.New())}
+	contractID := EncodeContractID(xdr.ContractId{4})
+	transfer, err := tokenEvent(scI128(100), symbol("transfer"), scAccount(testAccount), scAccount(testIssuer)).MarshalBinary()
+	require.NoError(t, err)
+	unknown, err := testEvent(xdr.ContractId{4}, xdr.ContractEventTypeContract, "ping").MarshalBinary()
+	require.NoError(t, err)
+	decoded, err := json.Marshal(TokenEvent{Event: "transfer", From: testAccount, To: testIssuer, Amount: "100"})
+	require.NoError(t, err)
+	closedAt := time.Unix(1700000000, 0).UTC()
+	columns := []string{"id", "contract_id", "ledger", "transaction_hash", "in_successful_tx", "in_successful_contract_call",
+		"closed_at", "event_xdr"}
+
+	// Events stored without XDR get it back from their transaction's meta
+	txResult, err := xdr.TransactionResultPair{Result: xdr.TransactionResult{
+		Result: xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxSuccess, Results: &[]xdr.OperationResult{}},
+	}}.MarshalBinary()
+	require.NoError(t, err)
+	restoredEvent := tokenEvent(scI128(5), symbol("transfer"), scAccount(testAccount), scAccount(testIssuer))
+	meta, err := xdr.TransactionMeta{V: 3, V3: &xdr.TransactionMetaV3{SorobanMeta: &xdr.SorobanTransactionMeta{
+		Events:      []xdr.ContractEvent{restoredEvent},
+		ReturnValue: xdr.ScVal{Type: xdr.ScValTypeScvVoid},
+	}}}.MarshalBinary()
+	require.NoError(t, err)
+	restoredXDR, err := restoredEvent.MarshalBinary()
+	require.NoError(t, err)
+	mock.ExpectQuery("FROM transactions t(.|\n)*event_xdr IS NULL").
+		WithArgs(contractID, uint32(10), uint32(0), uint32(0), uint32(0), redecodeBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"ledger", "index", "result_xdr", "result_meta_xdr"}).AddRow(12, 3, txResult, meta))
+	mock.ExpectExec("UPDATE contract_events SET event_xdr").
+		WithArgs(eventID(12, 3, sorobanEvent{}), restoredXDR).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM contract_events").
+		WithArgs(contractID, uint32(10), uint32(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("FROM contract_events").
+		WithArgs(contractID, uint32(0), uint32(10), "", redecodeBatchSize).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("e1", contractID, 10, "abc", true, true, closedAt, transfer).
+			AddRow("e2", contractID, 11, "abc", true, true, closedAt, unknown))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE contract_events SET decoder").WithArgs("e1", "sep41", decoded).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE contract_events SET decoder").WithArgs("e2", nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("FROM contract_events").
+		WithArgs(contractID, uint32(0), uint32(11), "e2", redecodeBatchSize).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	result, err := ingester.RedecodeEvents(context.Background(), RedecodeQuery{ContractID: contractID, From: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Processed)
+	assert.Equal(t, 1, result.Decoded)
+	assert.Equal(t, 3, result.Skipped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = ingester.RedecodeEvents(context.Background(), RedecodeQuery{Decoder: "nope"})
+	assert.ErrorIs(t, err, ErrUnknownDecoder)
+}
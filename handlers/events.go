@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/toid"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// sorobanEvent is an event of a transaction as read from its meta,
+// independent of the TransactionMeta version
+type sorobanEvent struct {
+	event xdr.ContractEvent
+	// operationIndex is the operation that emitted the event, or -1 for
+	// transaction-level events such as fees
+	operationIndex int
+	// eventIndex is the position of the event among those of its
+	// transaction, in the order they were emitted
+	eventIndex uint32
+	// inSuccessfulContractCall is false for events of calls that reverted
+	inSuccessfulContractCall bool
+	// diagnostic is set for events read from the diagnostic events
+	diagnostic bool
+}
+
+// transactionEvents extracts the events to store from TransactionMeta V3 or
+// V4, in the order they were emitted. Successful transactions contribute
+// their operation events, which in V4 include the classic asset movements of
+// CAP-67, their transaction-level fee events, and the diagnostic-only
+// events. Failed transactions have no operation events, so all their
+// diagnostic events are returned, including the contract events of the calls
+// that reverted.
+func transactionEvents(tx ingest.LedgerTransaction) []sorobanEvent {
+	successful := tx.Result.Successful()
+	var events []sorobanEvent
+	add := func(event xdr.ContractEvent, opIndex int, inSuccessfulCall, diagnostic bool) {
+		events = append(events, sorobanEvent{
+			event:                    event,
+			operationIndex:           opIndex,
+			eventIndex:               uint32(len(events)),
+			inSuccessfulContractCall: inSuccessfulCall,
+			diagnostic:               diagnostic,
+		})
+	}
+
+	var diagnostics []xdr.DiagnosticEvent
+	meta := tx.UnsafeMeta
+	switch {
+	case meta.V == 3 && meta.V3 != nil:
+		if meta.V3.SorobanMeta == nil {
+			return nil
+		}
+		if successful {
+			// Soroban transactions have a single operation
+			for _, event := range meta.V3.SorobanMeta.Events {
+				add(event, 0, true, false)
+			}
+		}
+		diagnostics = meta.V3.SorobanMeta.DiagnosticEvents
+	case meta.V == 4 && meta.V4 != nil:
+		// Fees are charged before the operations run and refunded after,
+		// whatever the result
+		for _, event := range meta.V4.Events {
+			if event.Stage == xdr.TransactionEventStageTransactionEventStageBeforeAllTxs {
+				add(event.Event, -1, true, false)
+			}
+		}
+		if successful {
+			for opIndex, op := range meta.V4.Operations {
+				for _, event := range op.Events {
+					add(event, opIndex, true, false)
+				}
+			}
+		}
+		for _, event := range meta.V4.Events {
+			if event.Stage != xdr.TransactionEventStageTransactionEventStageBeforeAllTxs {
+				add(event.Event, -1, true, false)
+			}
+		}
+		diagnostics = meta.V4.DiagnosticEvents
+	default:
+		return nil
+	}
+	for _, diagnostic := range diagnostics {
+		if successful && diagnostic.Event.Type != xdr.ContractEventTypeDiagnostic {
+			continue // already among the operation events
+		}
+		add(diagnostic.Event, 0, diagnostic.InSuccessfulContractCall, true)
+	}
+	return events
+}
+
+// operationEvents returns the contract and system events an operation emitted
+func operationEvents(events []sorobanEvent, opIndex int) []xdr.ContractEvent {
+	var opEvents []xdr.ContractEvent
+	for _, e := range events {
+		if e.operationIndex == opIndex && !e.diagnostic {
+			opEvents = append(opEvents, e.event)
+		}
+	}
+	return opEvents
+}
+
+// eventID builds the ID of an event in the Stellar RPC format: the TOID of
+// its ledger, transaction and operation followed by its index in the
+// transaction. Transaction-level events use operation 0.
+func eventID(ledger, txIndex uint32, event sorobanEvent) string {
+	opIndex := int32(0)
+	if event.operationIndex > 0 {
+		opIndex = int32(event.operationIndex)
+	}
+	return fmt.Sprintf("%019d-%010d", toid.New(int32(ledger), int32(txIndex), opIndex).ToInt64(), event.eventIndex)
+}
+
+// storeSorobanEvent stores a contract, system or diagnostic event of a
+// transaction, flagged with the result of the transaction and of the call
+// that emitted it, and adds its broadcast message to messages
+func (i *Ingester) storeSorobanEvent(dbTx *sql.Tx, transaction models.Transaction, stored sorobanEvent, messages *outbox) error {
+	event := stored.event
+	var contractID string
+	if event.ContractId != nil {
+		contractID = EncodeContractID(*event.ContractId)
+	}
+
+	eventType := "unknown"
+	switch event.Type {
+	case xdr.ContractEventTypeContract:
+		eventType = "contract"
+	case xdr.ContractEventTypeSystem:
+		eventType = "system"
+	case xdr.ContractEventTypeDiagnostic:
+		eventType = "diagnostic"
+	}
+	var topics []string
+	for _, topic := range event.Body.V0.Topics {
+		topics = append(topics, i.scValToString(topic))
+	}
+	data := i.scValToJSON(event.Body.V0.Data)
+	id := eventID(transaction.Ledger, transaction.Index, stored)
+	var opIndex *uint32
+	if stored.operationIndex >= 0 {
+		index := uint32(stored.operationIndex)
+		opIndex = &index
+	}
+	topicsJSON, _ := json.Marshal(topics)
+	dataJSON, _ := json.Marshal(data)
+	eventXDR, err := event.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode contract event: %w", err)
+	}
+	decoder, decodedValue, decoded := i.decoders.decode(contractID, event)
+	var decoderName sql.NullString
+	var decodedJSON []byte
+	if decoded {
+		decoderName = sql.NullString{String: decoder.Name(), Valid: true}
+		decodedJSON, _ = json.Marshal(decodedValue)
+	}
+	if _, err := dbTx.Exec(`
+		INSERT INTO contract_events (id, contract_id, ledger, transaction_hash,
+			event_type, topics, data, in_successful_tx, in_successful_contract_call,
+			transaction_index, operation_index, event_index, closed_at, event_xdr, decoder, decoded)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			event_xdr = EXCLUDED.event_xdr, decoder = EXCLUDED.decoder, decoded = EXCLUDED.decoded`,
+		id, contractID, transaction.Ledger, transaction.Hash, eventType, topicsJSON, dataJSON,
+		transaction.Successful, stored.inSuccessfulContractCall, transaction.Index, opIndex, stored.eventIndex,
+		transaction.ClosedAt, eventXDR, decoderName, nullJSON(decodedJSON)); err != nil {
+		return fmt.Errorf("failed to store contract event: %w", err)
+	}
+	if decoded && transaction.Successful && stored.inSuccessfulContractCall {
+		if err := project(dbTx, decoder, DecodedEvent{
+			ID: id, ContractID: contractID, Ledger: transaction.Ledger, TransactionHash: transaction.Hash,
+			ClosedAt: transaction.ClosedAt, Event: event, Value: decodedValue,
+		}); err != nil {
+			return err
+		}
+	}
+	i.incrementEventCount()
+	if messages != nil {
+		messages.add("contract_event", models.ContractEvent{
+			ID: id, ContractID: contractID, Ledger: transaction.Ledger, TransactionHash: transaction.Hash, EventType: eventType,
+			Topics: topics, Data: dataJSON, InSuccessfulTx: transaction.Successful, InSuccessfulContractCall: stored.inSuccessfulContractCall,
+			TransactionIndex: transaction.Index, OperationIndex: opIndex, EventIndex: stored.eventIndex, ClosedAt: transaction.ClosedAt,
+			Decoder: decoderName.String, Decoded: decodedJSON,
+		})
+	}
+	return nil
+}
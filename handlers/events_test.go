@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(contract xdr.ContractId, eventType xdr.ContractEventType, topic string) xdr.ContractEvent {
+	return xdr.ContractEvent{
+		ContractId: &contract,
+		Type:       eventType,
+		Body:       xdr.ContractEventBody{V: 0, V0: &xdr.ContractEventV0{Topics: []xdr.ScVal{symbol(topic)}, Data: symbol("GA")}},
+	}
+}
+
+func TestTransactionEvents(t *testing.T) {
+	sac := xdr.ContractId{1}
+	contract := xdr.ContractId{2}
+	failed := xdr.TransactionResultPair{Result: xdr.TransactionResult{
+		Result: xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxFailed},
+	}}
+
+	t.Run("V3", func(t *testing.T) {
+		tx := ingest.LedgerTransaction{UnsafeMeta: xdr.TransactionMeta{V: 3, V3: &xdr.TransactionMetaV3{
+			SorobanMeta: &xdr.SorobanTransactionMeta{
+				Events: []xdr.ContractEvent{testEvent(contract, xdr.ContractEventTypeContract, "attested")},
+				DiagnosticEvents: []xdr.DiagnosticEvent{
+					{InSuccessfulContractCall: true, Event: testEvent(contract, xdr.ContractEventTypeDiagnostic, "fn_call")},
+					{InSuccessfulContractCall: true, Event: testEvent(contract, xdr.ContractEventTypeContract, "attested")},
+				},
+			},
+		}}}
+		events := transactionEvents(tx)
+		require.Len(t, events, 2)
+		assert.Equal(t, sorobanEvent{event: testEvent(contract, xdr.ContractEventTypeContract, "attested"),
+			operationIndex: 0, eventIndex: 0, inSuccessfulContractCall: true}, events[0])
+		assert.True(t, events[1].diagnostic)
+		assert.Equal(t, uint32(1), events[1].eventIndex)
+		assert.Equal(t, xdr.ContractEventTypeDiagnostic, events[1].event.Type)
+	})
+
+	t.Run("V4", func(t *testing.T) {
+		meta := xdr.TransactionMeta{V: 4, V4: &xdr.TransactionMetaV4{
+			Operations: []xdr.OperationMetaV2{
+				{Events: []xdr.ContractEvent{testEvent(sac, xdr.ContractEventTypeContract, "transfer")}},
+				{},
+				{Events: []xdr.ContractEvent{
+					testEvent(sac, xdr.ContractEventTypeContract, "mint"),
+					testEvent(sac, xdr.ContractEventTypeContract, "burn"),
+				}},
+			},
+			Events: []xdr.TransactionEvent{
+				{Stage: xdr.TransactionEventStageTransactionEventStageAfterTx, Event: testEvent(sac, xdr.ContractEventTypeContract, "fee")},
+				{Stage: xdr.TransactionEventStageTransactionEventStageBeforeAllTxs, Event: testEvent(sac, xdr.ContractEventTypeContract, "fee")},
+			},
+			DiagnosticEvents: []xdr.DiagnosticEvent{
+				{InSuccessfulContractCall: false, Event: testEvent(contract, xdr.ContractEventTypeContract, "attested")},
+			},
+		}}
+
+		// The fee is charged first and refunded after the operations
+		events := transactionEvents(ingest.LedgerTransaction{UnsafeMeta: meta})
+		require.Len(t, events, 5)
+		var opIndexes []int
+		for idx, e := range events {
+			opIndexes = append(opIndexes, e.operationIndex)
+			assert.Equal(t, uint32(idx), e.eventIndex)
+		}
+		assert.Equal(t, []int{-1, 0, 2, 2, -1}, opIndexes)
+		assert.Len(t, operationEvents(events, 2), 2)
+		assert.Empty(t, operationEvents(events, 1))
+
+		// Failed transactions keep their fees and every diagnostic event
+		events = transactionEvents(ingest.LedgerTransaction{Result: failed, UnsafeMeta: meta})
+		require.Len(t, events, 3)
+		assert.Equal(t, -1, events[0].operationIndex)
+		assert.Equal(t, -1, events[1].operationIndex)
+		assert.True(t, events[2].diagnostic)
+		assert.False(t, events[2].inSuccessfulContractCall)
+		assert.Empty(t, operationEvents(events, 0))
+	})
+
+	t.Run("Classic meta", func(t *testing.T) {
+		assert.Empty(t, transactionEvents(ingest.LedgerTransaction{UnsafeMeta: xdr.TransactionMeta{V: 2, V2: &xdr.TransactionMetaV2{}}}))
+	})
+}
+
+func TestEventID(t *testing.T) {
+	// TOID of ledger 100, transaction 2, operation 1, then the event index
+	assert.Equal(t, "0000000429496737793-0000000003", eventID(100, 2, sorobanEvent{operationIndex: 1, eventIndex: 3}))
+	// Transaction-level events use operation 0
+	assert.Equal(t, "0000000429496737792-0000000000", eventID(100, 2, sorobanEvent{operationIndex: -1}))
+
+	// Events from the same contract with the same topics no longer collide
+	contract := xdr.ContractId{1}
+	tx := ingest.LedgerTransaction{UnsafeMeta: xdr.TransactionMeta{V: 3, V3: &xdr.TransactionMetaV3{
+		SorobanMeta: &xdr.SorobanTransactionMeta{Events: []xdr.ContractEvent{
+			testEvent(contract, xdr.ContractEventTypeContract, "attested"),
+			testEvent(contract, xdr.ContractEventTypeContract, "attested"),
+		}},
+	}}}
+	events := transactionEvents(tx)
+	require.Len(t, events, 2)
+	assert.NotEqual(t, eventID(100, 1, events[0]), eventID(100, 1, events[1]))
+}
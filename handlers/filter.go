@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+)
+
+// Filter selects which transactions, operations and contract events are
+// stored. Each list matches when any of its values is present; the lists
+// that are set, every And clause and at least one Or clause (when there are
+// any) must all match. An empty Filter matches everything.
+//
+// The same expression is applied to every record:
+//   - an operation is kept when it matches; contract events emitted by an
+//     invoke_host_function count towards its contracts and event topics
+//   - a transaction is kept when any of its operations is kept
+//   - a contract event is kept when it matches together with the
+//     transaction source and the operation that emitted it
+//   - contract storage is kept when the contract alone matches, so clauses
+//     that also need an account, function or topic keep none
+type Filter struct {
+	SourceAccounts []string `mapstructure:"source_accounts" json:"source_accounts,omitempty"` // Transaction or operation source, G... strkeys
+	OperationTypes []string `mapstructure:"operation_types" json:"operation_types,omitempty"` // e.g. "payment", "invoke_host_function"
+	Contracts      []string `mapstructure:"contracts" json:"contracts,omitempty"`             // Invoked or event-emitting contracts, strkey or hex
+	Functions      []string `mapstructure:"functions" json:"functions,omitempty"`             // Invoked contract function names
+	EventTopics    []string `mapstructure:"event_topics" json:"event_topics,omitempty"`       // First topic of contract events
+	AssetCodes     []string `mapstructure:"asset_codes" json:"asset_codes,omitempty"`         // Asset codes of classic operations, "native" for XLM
+	And            []Filter `mapstructure:"and" json:"and,omitempty"`
+	Or             []Filter `mapstructure:"or" json:"or,omitempty"`
+}
+
+// filterSubject holds the values of a record that a Filter is matched against
+type filterSubject struct {
+	sourceAccounts []string
+	operationTypes []string
+	contracts      []string
+	functions      []string
+	eventTopics    []string
+	assetCodes     []string
+}
+
+// operationTypeNames are the names used in operations.type and Filter.OperationTypes
+var operationTypeNames = map[xdr.OperationType]string{
+	xdr.OperationTypeCreateAccount:                 "create_account",
+	xdr.OperationTypePayment:                       "payment",
+	xdr.OperationTypePathPaymentStrictReceive:      "path_payment_strict_receive",
+	xdr.OperationTypeManageSellOffer:               "manage_sell_offer",
+	xdr.OperationTypeCreatePassiveSellOffer:        "create_passive_sell_offer",
+	xdr.OperationTypeSetOptions:                    "set_options",
+	xdr.OperationTypeChangeTrust:                   "change_trust",
+	xdr.OperationTypeAllowTrust:                    "allow_trust",
+	xdr.OperationTypeAccountMerge:                  "account_merge",
+	xdr.OperationTypeInflation:                     "inflation",
+	xdr.OperationTypeManageData:                    "manage_data",
+	xdr.OperationTypeBumpSequence:                  "bump_sequence",
+	xdr.OperationTypeManageBuyOffer:                "manage_buy_offer",
+	xdr.OperationTypePathPaymentStrictSend:         "path_payment_strict_send",
+	xdr.OperationTypeCreateClaimableBalance:        "create_claimable_balance",
+	xdr.OperationTypeClaimClaimableBalance:         "claim_claimable_balance",
+	xdr.OperationTypeBeginSponsoringFutureReserves: "begin_sponsoring_future_reserves",
+	xdr.OperationTypeEndSponsoringFutureReserves:   "end_sponsoring_future_reserves",
+	xdr.OperationTypeRevokeSponsorship:             "revoke_sponsorship",
+	xdr.OperationTypeClawback:                      "clawback",
+	xdr.OperationTypeClawbackClaimableBalance:      "clawback_claimable_balance",
+	xdr.OperationTypeSetTrustLineFlags:             "set_trust_line_flags",
+	xdr.OperationTypeLiquidityPoolDeposit:          "liquidity_pool_deposit",
+	xdr.OperationTypeLiquidityPoolWithdraw:         "liquidity_pool_withdraw",
+	xdr.OperationTypeInvokeHostFunction:            "invoke_host_function",
+	xdr.OperationTypeExtendFootprintTtl:            "extend_footprint_ttl",
+	xdr.OperationTypeRestoreFootprint:              "restore_footprint",
+}
+
+// operationTypeName returns the snake_case name of an operation type
+func operationTypeName(t xdr.OperationType) string {
+	if name, ok := operationTypeNames[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// IsEmpty reports whether the filter has no conditions and so matches everything
+func (f Filter) IsEmpty() bool {
+	return len(f.SourceAccounts) == 0 && len(f.OperationTypes) == 0 && len(f.Contracts) == 0 &&
+		len(f.Functions) == 0 && len(f.EventTopics) == 0 && len(f.AssetCodes) == 0 &&
+		len(f.And) == 0 && len(f.Or) == 0
+}
+
+// Validate checks that accounts, contracts and operation types are well formed
+func (f Filter) Validate() error {
+	for _, account := range f.SourceAccounts {
+		if version, err := strkey.Version(account); err != nil || (version != strkey.VersionByteAccountID && version != strkey.VersionByteMuxedAccount) {
+			return fmt.Errorf("invalid source account %q", account)
+		}
+	}
+	for _, contract := range f.Contracts {
+		if _, err := ParseContractID(contract); err != nil {
+			return fmt.Errorf("invalid contract %q: %w", contract, err)
+		}
+	}
+	for _, opType := range f.OperationTypes {
+		if !KnownOperationType(opType) {
+			return fmt.Errorf("unknown operation type %q", opType)
+		}
+	}
+	for _, clauses := range [][]Filter{f.And, f.Or} {
+		for _, clause := range clauses {
+			if err := clause.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// KnownOperationType reports whether name is an operation type of operations.type
+func KnownOperationType(name string) bool {
+	for _, known := range operationTypeNames {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matches evaluates the filter against one record
+func (f Filter) matches(s filterSubject) bool {
+	if !anyMatch(f.OperationTypes, s.operationTypes, strings.EqualFold) ||
+		!anyMatch(f.Functions, s.functions, stringsEqual) ||
+		!anyMatch(f.EventTopics, s.eventTopics, stringsEqual) ||
+		!anyMatch(f.AssetCodes, s.assetCodes, strings.EqualFold) ||
+		!anyMatch(f.SourceAccounts, s.sourceAccounts, sameAccount) ||
+		!anyMatch(f.Contracts, s.contracts, sameContract) {
+		return false
+	}
+	for _, clause := range f.And {
+		if !clause.matches(s) {
+			return false
+		}
+	}
+	if len(f.Or) == 0 {
+		return true
+	}
+	for _, clause := range f.Or {
+		if clause.matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyMatch reports whether want is unset or shares a value with have
+func anyMatch(want, have []string, equal func(a, b string) bool) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		for _, h := range have {
+			if equal(w, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringsEqual(a, b string) bool { return a == b }
+
+func sameContract(a, b string) bool { return canonicalContractID(a) == canonicalContractID(b) }
+
+// sameAccount compares accounts by their G... address so muxed M... filter
+// entries match their underlying account
+func sameAccount(a, b string) bool { return baseAccount(a) == baseAccount(b) }
+
+func baseAccount(address string) string {
+	if version, err := strkey.Version(address); err == nil && version == strkey.VersionByteMuxedAccount {
+		var muxed xdr.MuxedAccount
+		if err := muxed.SetAddress(address); err == nil {
+			return muxed.ToAccountId().Address()
+		}
+	}
+	return address
+}
+
+// operationSubject describes an operation for filtering. events are the
+// contract events it emitted, if any.
+func (i *Ingester) operationSubject(txSource string, op xdr.Operation, events []xdr.ContractEvent) filterSubject {
+	s := filterSubject{
+		sourceAccounts: []string{txSource},
+		operationTypes: []string{operationTypeName(op.Body.Type)},
+		assetCodes:     operationAssetCodes(op),
+	}
+	if op.SourceAccount != nil {
+		s.sourceAccounts = append(s.sourceAccounts, op.SourceAccount.ToAccountId().Address())
+	}
+	if op.Body.Type == xdr.OperationTypeInvokeHostFunction {
+		hostFn := op.Body.MustInvokeHostFunctionOp().HostFunction
+		if hostFn.Type == xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
+			invoke := hostFn.MustInvokeContract()
+			if contract := i.extractContractAddress(invoke); contract != "" {
+				s.contracts = append(s.contracts, contract)
+			}
+			s.functions = append(s.functions, string(invoke.FunctionName))
+		}
+	}
+	for _, event := range events {
+		if event.ContractId != nil {
+			s.contracts = append(s.contracts, EncodeContractID(*event.ContractId))
+		}
+		if topics := event.Body.V0.Topics; len(topics) > 0 {
+			s.eventTopics = append(s.eventTopics, i.scValToString(topics[0]))
+		}
+	}
+	return s
+}
+
+// eventSubject describes a contract event for filtering, in the context of
+// the transaction source and the operation that emitted it
+func (i *Ingester) eventSubject(txSource string, op *xdr.Operation, event xdr.ContractEvent) filterSubject {
+	s := filterSubject{sourceAccounts: []string{txSource}}
+	if op != nil {
+		opSubject := i.operationSubject(txSource, *op, nil)
+		s.sourceAccounts = opSubject.sourceAccounts
+		s.operationTypes = opSubject.operationTypes
+		s.functions = opSubject.functions
+	}
+	if event.ContractId != nil {
+		s.contracts = []string{EncodeContractID(*event.ContractId)}
+	}
+	if topics := event.Body.V0.Topics; len(topics) > 0 {
+		s.eventTopics = []string{i.scValToString(topics[0])}
+	}
+	return s
+}
+
+// operationAssets lists the assets a classic operation moves or trades
+func operationAssets(op xdr.Operation) []xdr.Asset {
+	switch op.Body.Type {
+	case xdr.OperationTypePayment:
+		return []xdr.Asset{op.Body.MustPaymentOp().Asset}
+	case xdr.OperationTypePathPaymentStrictReceive:
+		pp := op.Body.MustPathPaymentStrictReceiveOp()
+		return append([]xdr.Asset{pp.SendAsset, pp.DestAsset}, pp.Path...)
+	case xdr.OperationTypePathPaymentStrictSend:
+		pp := op.Body.MustPathPaymentStrictSendOp()
+		return append([]xdr.Asset{pp.SendAsset, pp.DestAsset}, pp.Path...)
+	case xdr.OperationTypeManageSellOffer:
+		offer := op.Body.MustManageSellOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeManageBuyOffer:
+		offer := op.Body.MustManageBuyOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeCreatePassiveSellOffer:
+		offer := op.Body.MustCreatePassiveSellOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeChangeTrust:
+		line := op.Body.MustChangeTrustOp().Line
+		if line.Type != xdr.AssetTypeAssetTypePoolShare {
+			return []xdr.Asset{line.ToAsset()}
+		}
+	}
+	return nil
+}
+
+// operationAssetCodes lists the asset codes of operationAssets; XLM is
+// reported as "native"
+func operationAssetCodes(op xdr.Operation) []string {
+	assets := operationAssets(op)
+	codes := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		if asset.Type == xdr.AssetTypeAssetTypeNative {
+			codes = append(codes, "native")
+		} else {
+			codes = append(codes, asset.GetCode())
+		}
+	}
+	return codes
+}
+
+// activeFilter combines the configured filter expression with the contract
+// list from the configuration and the contract_filters table; data matching
+// either is kept. ok is false when nothing is filtered.
+func (i *Ingester) activeFilter() (filter Filter, ok bool) {
+	var clauses []Filter
+	if contracts := i.filterContractList(); len(contracts) > 0 {
+		clauses = append(clauses, Filter{Contracts: contracts})
+	}
+	if !i.config.Filter.IsEmpty() {
+		clauses = append(clauses, i.config.Filter)
+	}
+	switch len(clauses) {
+	case 0:
+		return Filter{}, false
+	case 1:
+		return clauses[0], true
+	default:
+		return Filter{Or: clauses}, true
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func symbol(s string) xdr.ScVal {
+	sym := xdr.ScSymbol(s)
+	return xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &sym}
+}
+
+func creditAsset(code, issuer string) xdr.Asset {
+	var asset xdr.Asset
+	var alpha xdr.AlphaNum4
+	copy(alpha.AssetCode[:], code)
+	alpha.Issuer = xdr.MustAddress(issuer)
+	asset.Type = xdr.AssetTypeAssetTypeCreditAlphanum4
+	asset.AlphaNum4 = &alpha
+	return asset
+}
+
+func TestFilterMatches(t *testing.T) {
+	payment := filterSubject{
+		sourceAccounts: []string{"GA"},
+		operationTypes: []string{"payment"},
+		assetCodes:     []string{"USDC"},
+	}
+	invoke := filterSubject{
+		sourceAccounts: []string{"GB"},
+		operationTypes: []string{"invoke_host_function"},
+		functions:      []string{"attest"},
+		eventTopics:    []string{"attest"},
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		payment bool
+		invoke  bool
+	}{
+		{"Empty matches everything", Filter{}, true, true},
+		{"Any value in a list", Filter{OperationTypes: []string{"payment", "create_account"}}, true, false},
+		{"Lists are combined with AND", Filter{OperationTypes: []string{"payment"}, AssetCodes: []string{"EURC"}}, false, false},
+		{"Asset codes ignore case", Filter{AssetCodes: []string{"usdc"}}, true, false},
+		{"Function names are exact", Filter{Functions: []string{"Attest"}}, false, false},
+		{"And clauses", Filter{And: []Filter{{SourceAccounts: []string{"GB"}}, {EventTopics: []string{"attest"}}}}, false, true},
+		{"Or clauses", Filter{Or: []Filter{{AssetCodes: []string{"USDC"}}, {Functions: []string{"attest"}}}}, true, true},
+		{"Lists and Or together", Filter{SourceAccounts: []string{"GA"}, Or: []Filter{{Functions: []string{"attest"}}, {AssetCodes: []string{"USDC"}}}}, true, false},
+		{"Nested", Filter{Or: []Filter{{And: []Filter{{OperationTypes: []string{"invoke_host_function"}}, {Functions: []string{"revoke"}}}}}}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.payment, tt.filter.matches(payment))
+			assert.Equal(t, tt.invoke, tt.filter.matches(invoke))
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	account := xdr.MustAddress("GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H")
+	contract := EncodeContractID(xdr.ContractId{4})
+
+	assert.NoError(t, Filter{
+		SourceAccounts: []string{account.Address()},
+		OperationTypes: []string{"payment", "invoke_host_function"},
+		Contracts:      []string{contract},
+		Or:             []Filter{{Functions: []string{"attest"}}},
+	}.Validate())
+
+	assert.ErrorContains(t, Filter{SourceAccounts: []string{contract}}.Validate(), "invalid source account")
+	assert.ErrorIs(t, Filter{Contracts: []string{"nope"}}.Validate(), ErrInvalidContractID)
+	assert.ErrorContains(t, Filter{And: []Filter{{OperationTypes: []string{"invoke_contract"}}}}.Validate(), "unknown operation type")
+
+	_, err := NewIngester(&Config{Filter: Filter{OperationTypes: []string{"pay"}}}, nil, logrus.NewEntry(logrus.New()))
+	assert.ErrorContains(t, err, "invalid filter")
+}
+
+func TestFilterFromJSON(t *testing.T) {
+	var filter Filter
+	require.NoError(t, json.Unmarshal([]byte(`{"or":[{"operation_types":["payment"],"asset_codes":["native"]},{"functions":["attest"]}]}`), &filter))
+	assert.Equal(t, Filter{Or: []Filter{
+		{OperationTypes: []string{"payment"}, AssetCodes: []string{"native"}},
+		{Functions: []string{"attest"}},
+	}}, filter)
+}
+
+func TestOperationAndEventSubjects(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	ingester := &Ingester{config: &Config{}, logger: logger}
+	txSource := "GBRPYHIL2CI3FNQ4BXLFMNDLFJUNPU2HY3ZMFSHONUCEOASW7QC7OX2H"
+	issuer := "GAHK7EEG2WWHVKDNT4CEQFZGKF2LGDSW2IVM4S5DP42RBW3K6BTODB4A"
+
+	t.Run("Payment", func(t *testing.T) {
+		op := xdr.Operation{Body: xdr.OperationBody{
+			Type:      xdr.OperationTypePayment,
+			PaymentOp: &xdr.PaymentOp{Asset: creditAsset("USDC", issuer)},
+		}}
+		s := ingester.operationSubject(txSource, op, nil)
+		assert.Equal(t, []string{"payment"}, s.operationTypes)
+		assert.Equal(t, []string{"USDC"}, s.assetCodes)
+		assert.Equal(t, []string{txSource}, s.sourceAccounts)
+	})
+
+	t.Run("Path payment through native", func(t *testing.T) {
+		op := xdr.Operation{Body: xdr.OperationBody{
+			Type: xdr.OperationTypePathPaymentStrictSend,
+			PathPaymentStrictSendOp: &xdr.PathPaymentStrictSendOp{
+				SendAsset: creditAsset("USDC", issuer),
+				DestAsset: creditAsset("EURC", issuer),
+				Path:      []xdr.Asset{{Type: xdr.AssetTypeAssetTypeNative}},
+			},
+		}}
+		assert.Equal(t, []string{"USDC", "EURC", "native"}, operationAssetCodes(op))
+	})
+
+	t.Run("Invoke host function with events", func(t *testing.T) {
+		invoked := xdr.ContractId{1}
+		emitter := xdr.ContractId{2}
+		opSource := xdr.MustMuxedAddress(issuer)
+		op := xdr.Operation{
+			SourceAccount: &opSource,
+			Body: xdr.OperationBody{
+				Type: xdr.OperationTypeInvokeHostFunction,
+				InvokeHostFunctionOp: &xdr.InvokeHostFunctionOp{HostFunction: xdr.HostFunction{
+					Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract,
+					InvokeContract: &xdr.InvokeContractArgs{
+						ContractAddress: xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &invoked},
+						FunctionName:    "attest",
+					},
+				}},
+			},
+		}
+		event := xdr.ContractEvent{
+			ContractId: &emitter,
+			Type:       xdr.ContractEventTypeContract,
+			Body:       xdr.ContractEventBody{V: 0, V0: &xdr.ContractEventV0{Topics: []xdr.ScVal{symbol("transfer"), symbol("from")}}},
+		}
+
+		s := ingester.operationSubject(txSource, op, []xdr.ContractEvent{event})
+		assert.Equal(t, []string{txSource, issuer}, s.sourceAccounts)
+		assert.Equal(t, []string{EncodeContractID(invoked), EncodeContractID(emitter)}, s.contracts)
+		assert.Equal(t, []string{"attest"}, s.functions)
+		assert.Equal(t, []string{"transfer"}, s.eventTopics)
+
+		e := ingester.eventSubject(txSource, &op, event)
+		assert.Equal(t, []string{EncodeContractID(emitter)}, e.contracts)
+		assert.Equal(t, []string{"attest"}, e.functions)
+		assert.Equal(t, []string{"invoke_host_function"}, e.operationTypes)
+		assert.Equal(t, []string{"transfer"}, e.eventTopics)
+
+		// The operation is kept for the emitter, but only the emitter's events are
+		filter := Filter{Contracts: []string{EncodeContractID(emitter)}}
+		assert.True(t, filter.matches(s))
+		assert.True(t, filter.matches(e))
+		assert.False(t, Filter{Contracts: []string{EncodeContractID(invoked)}}.matches(e))
+
+		// Muxed filter entries match the underlying account
+		base := xdr.MustAddress(issuer)
+		muxed := xdr.MuxedAccount{
+			Type:     xdr.CryptoKeyTypeKeyTypeMuxedEd25519,
+			Med25519: &xdr.MuxedAccountMed25519{Id: 42, Ed25519: *base.Ed25519},
+		}
+		assert.True(t, Filter{SourceAccounts: []string{muxed.Address()}}.matches(e))
+	})
+}
+
+func TestActiveFilter(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	contract := EncodeContractID(xdr.ContractId{5})
+	expression := Filter{OperationTypes: []string{"payment"}}
+
+	ingester := &Ingester{config: &Config{}, logger: logger}
+	_, filtering := ingester.activeFilter()
+	assert.False(t, filtering)
+
+	ingester.config.Filter = expression
+	filter, filtering := ingester.activeFilter()
+	assert.True(t, filtering)
+	assert.Equal(t, expression, filter)
+
+	ingester.filterContracts = []string{contract}
+	filter, _ = ingester.activeFilter()
+	assert.Equal(t, Filter{Or: []Filter{{Contracts: []string{contract}}, expression}}, filter)
+	assert.True(t, filter.matches(filterSubject{operationTypes: []string{"payment"}}))
+	assert.True(t, filter.matches(filterSubject{operationTypes: []string{"invoke_host_function"}, contracts: []string{contract}}))
+	assert.False(t, filter.matches(filterSubject{operationTypes: []string{"invoke_host_function"}}))
+}
+
+func TestIsFilteredContractUsesExpression(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	contract := EncodeContractID(xdr.ContractId{5})
+	other := EncodeContractID(xdr.ContractId{6})
+
+	// Contracts named by the expression keep their storage
+	ingester := &Ingester{config: &Config{Filter: Filter{Or: []Filter{
+		{Contracts: []string{contract}},
+		{SourceAccounts: []string{testAccount}},
+	}}}, logger: logger}
+	assert.True(t, ingester.isFilteredContract(contract))
+	assert.False(t, ingester.isFilteredContract(other))
+	assert.False(t, ingester.isFilteredContract(""))
+
+	// Clauses that need more than the contract do not match it alone
+	ingester.config.Filter = Filter{Contracts: []string{contract}, Functions: []string{"attest"}}
+	assert.False(t, ingester.isFilteredContract(contract))
+}
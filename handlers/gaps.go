@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Reasons reported in models.LedgerGap
+const (
+	GapMissing          = "missing"
+	GapHashMismatch     = "hash_mismatch"
+	GapContractBackfill = "contract_backfill" // History of a contract added to the filter
+)
+
+// ErrNoLedgerBackend is returned when work needs a ledger backend but none is configured
+var ErrNoLedgerBackend = errors.New("no ledger backend configured")
+
+// repairPollInterval is how often the repair worker looks for chunks that
+// were scheduled before a restart
+const repairPollInterval = time.Minute
+
+// FindLedgerGaps scans the ledgers table between from and to (0 means no
+// upper bound) for missing sequences and for ledgers whose previous_hash
+// does not match the stored hash of the ledger before them. With explicit
+// bounds, missing ledgers at either end of the range are reported as well.
+func FindLedgerGaps(ctx context.Context, db *sql.DB, from, to uint32) ([]models.LedgerGap, error) {
+	upper := int64(to)
+	if to == 0 {
+		upper = math.MaxUint32
+	}
+	var gaps []models.LedgerGap
+
+	var minSeq, maxSeq sql.NullInt64
+	if err := db.QueryRowContext(ctx, `
+		SELECT MIN(sequence), MAX(sequence) FROM ledgers
+		WHERE sequence BETWEEN $1 AND $2`, from, upper).Scan(&minSeq, &maxSeq); err != nil {
+		return nil, fmt.Errorf("failed to read ledger bounds: %w", err)
+	}
+	if !minSeq.Valid {
+		if from > 0 && to > 0 {
+			gaps = append(gaps, models.LedgerGap{Start: from, End: to, Reason: GapMissing})
+		}
+		return gaps, nil
+	}
+	if from > 0 && uint32(minSeq.Int64) > from {
+		gaps = append(gaps, models.LedgerGap{Start: from, End: uint32(minSeq.Int64) - 1, Reason: GapMissing})
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT sequence + 1, next_sequence - 1 FROM (
+			SELECT sequence, LEAD(sequence) OVER (ORDER BY sequence) AS next_sequence
+			FROM ledgers WHERE sequence BETWEEN $1 AND $2
+		) s
+		WHERE next_sequence > sequence + 1
+		ORDER BY sequence`, from, upper)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for missing ledgers: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gap := models.LedgerGap{Reason: GapMissing}
+		if err := rows.Scan(&gap.Start, &gap.End); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, gap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if to > 0 && uint32(maxSeq.Int64) < to {
+		gaps = append(gaps, models.LedgerGap{Start: uint32(maxSeq.Int64) + 1, End: to, Reason: GapMissing})
+	}
+
+	// A broken link at N means either N-1 or N holds the wrong ledger, so
+	// both are re-ingested; consecutive breaks merge into one range
+	hashRows, err := db.QueryContext(ctx, `
+		SELECT l.sequence FROM ledgers l
+		JOIN ledgers p ON p.sequence = l.sequence - 1
+		WHERE l.sequence BETWEEN $1 AND $2 AND l.previous_hash <> p.hash
+		ORDER BY l.sequence`, from, upper)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan ledger hash chain: %w", err)
+	}
+	defer hashRows.Close()
+	var mismatch *models.LedgerGap
+	for hashRows.Next() {
+		var seq uint32
+		if err := hashRows.Scan(&seq); err != nil {
+			return nil, err
+		}
+		if mismatch != nil && seq-1 <= mismatch.End {
+			mismatch.End = seq
+			continue
+		}
+		if mismatch != nil {
+			gaps = append(gaps, *mismatch)
+		}
+		mismatch = &models.LedgerGap{Start: seq - 1, End: seq, Reason: GapHashMismatch}
+	}
+	if mismatch != nil {
+		gaps = append(gaps, *mismatch)
+	}
+	return gaps, hashRows.Err()
+}
+
+// ScheduleRepair queues the given ranges for re-ingestion by the repair
+// worker. Ledgers in hash_mismatch ranges are replaced: each is deleted,
+// together with everything that references it, in the transaction that
+// writes it again.
+func (i *Ingester) ScheduleRepair(ctx context.Context, gaps []models.LedgerGap) error {
+	if i.db == nil {
+		return errors.New("database not configured")
+	}
+	if i.ledgerBackend == nil {
+		return ErrNoLedgerBackend
+	}
+	for _, gap := range gaps {
+		if gap.Start == 0 || gap.End < gap.Start {
+			return fmt.Errorf("invalid repair range %d-%d", gap.Start, gap.End)
+		}
+	}
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, gap := range gaps {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO backfill_chunks (range_start, range_end, contract_id, status, source, replace_ledgers)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (range_start, range_end, contract_id, source) DO UPDATE SET
+				status = EXCLUDED.status,
+				replace_ledgers = EXCLUDED.replace_ledgers,
+				last_ledger = NULL,
+				error = NULL,
+				completed_at = NULL`, gap.Start, gap.End, gap.ContractID, ChunkPending, chunkSourceRepair,
+			gap.Reason == GapHashMismatch); err != nil {
+			return fmt.Errorf("failed to schedule repair of %d-%d: %w", gap.Start, gap.End, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit repair schedule: %w", err)
+	}
+
+	select {
+	case i.repairSignal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RepairChunks lists scheduled repairs, most recently updated first
+func (i *Ingester) RepairChunks(ctx context.Context) ([]models.RepairChunk, error) {
+	rows, err := i.db.QueryContext(ctx, `
+		SELECT range_start, range_end, contract_id, COALESCE(last_ledger, 0), status, COALESCE(error, ''), updated_at
+		FROM backfill_chunks WHERE source = $1
+		ORDER BY updated_at DESC LIMIT 100`, chunkSourceRepair)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chunks []models.RepairChunk
+	for rows.Next() {
+		var chunk models.RepairChunk
+		if err := rows.Scan(&chunk.Start, &chunk.End, &chunk.ContractID, &chunk.LastLedger, &chunk.Status, &chunk.Error, &chunk.UpdatedAt); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// LedgerFailures lists ledgers the live ingester failed to process that have
+// not since been ingested
+func (i *Ingester) LedgerFailures(ctx context.Context) ([]models.LedgerFailure, error) {
+	rows, err := i.db.QueryContext(ctx, `
+		SELECT sequence, attempts, error, skipped, first_failed_at, last_failed_at
+		FROM ledger_failures ORDER BY sequence LIMIT 100`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var failures []models.LedgerFailure
+	for rows.Next() {
+		var f models.LedgerFailure
+		if err := rows.Scan(&f.Sequence, &f.Attempts, &f.Error, &f.Skipped, &f.FirstFailedAt, &f.LastFailedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// runRepairs re-ingests scheduled repair chunks with a dedicated ledger
+// backend, leaving the live ingestion loop untouched. Failed chunks stay
+// failed until they are scheduled again.
+//
+// Repairs go through their own ingester without a WebSocket hub, so
+// re-ingested ledgers are not streamed to subscribers as new. With the
+// captive core backend each repair chunk runs a second stellar-core process
+// next to the live one, catching up the bounded range from the history
+// archives.
+func (i *Ingester) runRepairs(ctx context.Context) {
+	logger := i.logger.WithField("component", "repair")
+	repairer := &Backfiller{
+		config: BackfillConfig{StartLedger: 0, EndLedger: math.MaxUint32, Workers: 1},
+		db:     i.db,
+		ingester: &Ingester{
+			config:            i.config,
+			db:                i.db,
+			networkPassphrase: i.networkPassphrase,
+			logger:            logger,
+			stats:             &models.Stats{StartTime: time.Now()},
+			decoders:          i.decoders,
+		},
+		logger:     logger,
+		newBackend: func() (backends.LedgerBackend, error) { return newLedgerBackend(i.config) },
+		source:     chunkSourceRepair,
+	}
+	ticker := time.NewTicker(repairPollInterval)
+	defer ticker.Stop()
+	for {
+		pending, err := repairer.pendingChunks(ChunkComplete, ChunkFailed)
+		if err != nil {
+			i.logger.Errorf("Failed to load repair chunks: %v", err)
+		} else if len(pending) > 0 {
+			i.logger.Infof("Repairing %d ledger ranges", len(pending))
+			// Contracts added at runtime are matched as by the live ingester
+			if err := repairer.ingester.ReloadContractFilter(ctx); err != nil {
+				i.logger.Warnf("Repairing with the configured contract filter only: %v", err)
+			}
+			if err := repairer.runChunks(ctx, pending); err != nil {
+				i.logger.Errorf("Ledger repair incomplete: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.repairSignal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleLedgerFailure records a ledger the live loop failed to process and
+// reports whether it has failed SkipAfterAttempts times and should be
+// skipped, leaving a gap for repair
+func (i *Ingester) handleLedgerFailure(sequence uint32, cause error) bool {
+	i.mu.Lock()
+	if i.failingLedger != sequence {
+		i.failingLedger = sequence
+		i.failedAttempts = 0
+	}
+	i.failedAttempts++
+	attempts := i.failedAttempts
+	i.mu.Unlock()
+
+	skip := i.config.SkipAfterAttempts > 0 && attempts >= i.config.SkipAfterAttempts
+	if i.db != nil {
+		if _, err := i.db.Exec(`
+			INSERT INTO ledger_failures (sequence, attempts, error, skipped)
+			VALUES ($1, 1, $2, $3)
+			ON CONFLICT (sequence) DO UPDATE SET
+				attempts = ledger_failures.attempts + 1,
+				error = EXCLUDED.error,
+				skipped = EXCLUDED.skipped,
+				last_failed_at = NOW()`, sequence, cause.Error(), skip); err != nil {
+			i.logger.Errorf("Failed to record failure of ledger %d: %v", sequence, err)
+		}
+	}
+	return skip
+}
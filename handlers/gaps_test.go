@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+func TestFindLedgerGaps(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	mock.ExpectQuery("SELECT MIN\\(sequence\\), MAX\\(sequence\\) FROM ledgers").
+		WithArgs(uint32(100), int64(200)).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(105, 190))
+	mock.ExpectQuery("LEAD\\(sequence\\)").
+		WithArgs(uint32(100), int64(200)).
+		WillReturnRows(sqlmock.NewRows([]string{"start", "end"}).AddRow(120, 124).AddRow(150, 150))
+	mock.ExpectQuery("JOIN ledgers p").
+		WithArgs(uint32(100), int64(200)).
+		WillReturnRows(sqlmock.NewRows([]string{"sequence"}).AddRow(160).AddRow(161).AddRow(170))
+
+	gaps, err := FindLedgerGaps(context.Background(), mockDB, 100, 200)
+	require.NoError(t, err)
+	assert.Equal(t, []models.LedgerGap{
+		{Start: 100, End: 104, Reason: GapMissing},
+		{Start: 120, End: 124, Reason: GapMissing},
+		{Start: 150, End: 150, Reason: GapMissing},
+		{Start: 191, End: 200, Reason: GapMissing},
+		{Start: 159, End: 161, Reason: GapHashMismatch},
+		{Start: 169, End: 170, Reason: GapHashMismatch},
+	}, gaps)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindLedgerGapsEmptyTable(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	mock.ExpectQuery("SELECT MIN\\(sequence\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+	gaps, err := FindLedgerGaps(context.Background(), mockDB, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, gaps, "an unbounded scan of an empty table has nothing to report")
+
+	mock.ExpectQuery("SELECT MIN\\(sequence\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+	gaps, err = FindLedgerGaps(context.Background(), mockDB, 10, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []models.LedgerGap{{Start: 10, End: 20, Reason: GapMissing}}, gaps)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScheduleRepair(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	ingester := &Ingester{config: &Config{}, db: mockDB, logger: logger, repairSignal: make(chan struct{}, 1)}
+	gaps := []models.LedgerGap{{Start: 10, End: 12, Reason: GapMissing}, {Start: 19, End: 20, Reason: GapHashMismatch}}
+
+	assert.ErrorIs(t, ingester.ScheduleRepair(context.Background(), gaps), ErrNoLedgerBackend)
+
+	ingester.ledgerBackend = NewRPCLedgerBackend(RPCBackendConfig{ServerURL: "http://localhost:8000"})
+	assert.Error(t, ingester.ScheduleRepair(context.Background(), []models.LedgerGap{{Start: 5, End: 4}}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO backfill_chunks").
+		WithArgs(uint32(10), uint32(12), "", ChunkPending, "repair", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Mismatched ledgers stay stored until the repair rewrites them
+	mock.ExpectExec("INSERT INTO backfill_chunks").
+		WithArgs(uint32(19), uint32(20), "", ChunkPending, "repair", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, ingester.ScheduleRepair(context.Background(), gaps))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	select {
+	case <-ingester.repairSignal:
+	default:
+		t.Fatal("repair worker was not signalled")
+	}
+}
+
+func TestHandleLedgerFailure(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	logger := logrus.NewEntry(logrus.New())
+	ingester := &Ingester{config: &Config{SkipAfterAttempts: 3}, db: mockDB, logger: logger}
+	cause := errors.New("boom")
+
+	for attempt, skip := range []bool{false, false, true} {
+		mock.ExpectExec("INSERT INTO ledger_failures").
+			WithArgs(uint32(42), "boom", skip).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.Equal(t, skip, ingester.handleLedgerFailure(42, cause), "attempt %d", attempt+1)
+	}
+
+	// A different ledger starts counting again
+	mock.ExpectExec("INSERT INTO ledger_failures").
+		WithArgs(uint32(43), "boom", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.False(t, ingester.handleLedgerFailure(43, cause))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Without a skip threshold the ledger is retried forever
+	ingester = &Ingester{config: &Config{}, logger: logger}
+	for n := 0; n < 10; n++ {
+		assert.False(t, ingester.handleLedgerFailure(42, cause))
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/stellar/go/xdr"
 
 	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/daccred/sorobangraph.attest.so/scval"
 )
 
 // Ingester handles the data ingestion from Stellar
@@ -29,6 +30,11 @@ type Ingester struct {
 	stats             *models.Stats
 	currentLedger     uint32
 	logger            *logrus.Entry
+	repairSignal      chan struct{} // Wakes the repair worker after ScheduleRepair
+	failingLedger     uint32        // Ledger the live loop is currently retrying
+	failedAttempts    int
+	filterContracts   []string // Canonical contract IDs added at runtime, see ReloadContractFilter
+	decoders          *DecoderRegistry
 }
 
 // Config holds the ingestion configuration
@@ -42,20 +48,31 @@ type Config struct {
 	EnableWebSocket       bool
 	LogLevel              string
 	FilterContracts       []string // Contract addresses to filter for
+	Filter                Filter   // Expression of further data to keep, combined with FilterContracts by OR
+	WebSocket             WebSocketConfig
+	LedgerBackend         string // BackendCaptiveCore or BackendRPC; inferred from the other settings when empty
+	RPCServerURL          string
+	RPCPageSize           uint32
+	RPCPollInterval       time.Duration
+	RetryAttempts         int // Retries of a failed ledger backend request; 0 uses the default
+	RetryDelay            time.Duration
+	SkipAfterAttempts     int               // Failed attempts after which the live loop skips a ledger and schedules its repair; 0 never skips
+	Datastore             DatastoreConfig   // Used by BackendDatastore
+	EventDecoders         map[string]string // Contract ID to the name of the decoder of all its events
 }
 
-// WebSocket structures
-type WebSocketHub struct {
-	clients    map[*WebSocketClient]bool
-	broadcast  chan interface{}
-	register   chan *WebSocketClient
-	unregister chan *WebSocketClient
-	mu         sync.RWMutex
-}
-
-type WebSocketClient struct {
-	send chan interface{}
-	hub  *WebSocketHub
+// validate checks the settings shared by the ingester and the backfiller
+func (cfg *Config) validate() error {
+	if err := cfg.Filter.Validate(); err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	if cfg.RetryAttempts < 0 {
+		return fmt.Errorf("invalid retry attempts %d", cfg.RetryAttempts)
+	}
+	if cfg.SkipAfterAttempts < 0 {
+		return fmt.Errorf("invalid skip after attempts %d: use 0 to never skip a ledger", cfg.SkipAfterAttempts)
+	}
+	return nil
 }
 
 func NewIngester(cfg *Config, db *sql.DB, logger *logrus.Entry) (*Ingester, error) {
@@ -67,40 +84,19 @@ func NewIngester(cfg *Config, db *sql.DB, logger *logrus.Entry) (*Ingester, erro
 		}
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	decoders, err := newDecoders(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize a ledger backend when configured
-	var ledgerBackend backends.LedgerBackend
-	if cfg.CaptiveCoreBinaryPath != "" {
-		params := backends.CaptiveCoreTomlParams{
-			NetworkPassphrase:                  cfg.NetworkPassphrase,
-			HistoryArchiveURLs:                 cfg.HistoryArchiveURLs,
-			Strict:                             false,
-			UseDB:                              false,
-			CoreBinaryPath:                     cfg.CaptiveCoreBinaryPath,
-			EnforceSorobanDiagnosticEvents:     true,
-			EnforceSorobanTransactionMetaExtV1: true,
-		}
-		var tomlCfg *backends.CaptiveCoreToml
-		var err error
-		if cfg.CaptiveCoreConfigPath != "" {
-			tomlCfg, err = backends.NewCaptiveCoreTomlFromFile(cfg.CaptiveCoreConfigPath, params)
-		} else {
-			tomlCfg, err = backends.NewCaptiveCoreToml(params)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to prepare captive core config: %w", err)
-		}
-		ccCfg := backends.CaptiveCoreConfig{
-			BinaryPath:         cfg.CaptiveCoreBinaryPath,
-			NetworkPassphrase:  cfg.NetworkPassphrase,
-			HistoryArchiveURLs: cfg.HistoryArchiveURLs,
-			Toml:               tomlCfg,
-			Log:                log.DefaultLogger,
-		}
-		captive, err := backends.NewCaptive(ccCfg)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize captive core backend: %w", err)
-		}
-		ledgerBackend = captive
+	ledgerBackend, err := newLedgerBackend(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	ingester := &Ingester{
@@ -110,29 +106,58 @@ func NewIngester(cfg *Config, db *sql.DB, logger *logrus.Entry) (*Ingester, erro
 		networkPassphrase: cfg.NetworkPassphrase,
 		logger:            logger,
 		stats:             &models.Stats{StartTime: time.Now()},
+		repairSignal:      make(chan struct{}, 1),
+		decoders:          decoders,
 	}
 
 	// Log configured filter contracts if any
 	if len(cfg.FilterContracts) > 0 {
-		logger.Infof("Ingester configured to filter for contracts: %v", cfg.FilterContracts)
-	} else {
+		for _, id := range cfg.FilterContracts {
+			if _, err := ParseContractID(id); err != nil {
+				logger.Warnf("Filter contract %q is not a C... strkey or hex contract ID and will only match literally", id)
+			}
+		}
+		logger.Infof("Ingester configured to filter for contracts: %v", canonicalContractIDs(cfg.FilterContracts))
+	}
+	if !cfg.Filter.IsEmpty() {
+		logger.Infof("Ingester configured with filter expression: %+v", cfg.Filter)
+	}
+	if len(cfg.FilterContracts) == 0 && cfg.Filter.IsEmpty() {
 		logger.Info("No contract filtering configured - ingesting all data")
 	}
 
 	if cfg.EnableWebSocket {
-		ingester.wsHub = &WebSocketHub{
-			clients:    make(map[*WebSocketClient]bool),
-			broadcast:  make(chan interface{}, 256),
-			register:   make(chan *WebSocketClient),
-			unregister: make(chan *WebSocketClient),
-		}
+		ingester.wsHub = newWebSocketHub(cfg.WebSocket)
 	}
 
 	return ingester, nil
 }
 
+// newDecoders returns the built-in decoders with the decoders configured
+// for contracts in cfg.EventDecoders registered
+func newDecoders(cfg *Config) (*DecoderRegistry, error) {
+	decoders := DefaultDecoders()
+	for contractID, name := range cfg.EventDecoders {
+		decoder, ok := decoders.Decoder(name)
+		if !ok {
+			return nil, fmt.Errorf("contract %s: %w %q", contractID, ErrUnknownDecoder, name)
+		}
+		if err := decoders.RegisterContract(contractID, decoder); err != nil {
+			return nil, fmt.Errorf("contract %s: %w", contractID, err)
+		}
+	}
+	return decoders, nil
+}
+
 func (i *Ingester) Stats() *models.Stats { return i.stats }
 
+// Decoders returns the event decoder registry, to register further decoders
+// before ingestion starts
+func (i *Ingester) Decoders() *DecoderRegistry { return i.decoders }
+
+// WebSocketHub returns the broadcast hub, or nil when WebSocket streaming is disabled
+func (i *Ingester) WebSocketHub() *WebSocketHub { return i.wsHub }
+
 // Start begins the ingestion process using Stellar's ingest package
 func (i *Ingester) Start(ctx context.Context) error {
 	// Load last ingestion state
@@ -142,11 +167,30 @@ func (i *Ingester) Start(ctx context.Context) error {
 		i.logger.Infof("Resuming from ledger %d", startLedger)
 	}
 
-	if i.config.EnableWebSocket && i.wsHub != nil {
-		go i.wsHub.run()
-	}
 	go i.updateStats(ctx)
 
+	if i.db != nil {
+		if err := i.ReloadContractFilter(ctx); err != nil {
+			i.logger.Warnf("Using configured contract filter only: %v", err)
+		}
+		go i.runFilterReload(ctx)
+	}
+
+	// If no ledger backend is configured, skip ingestion gracefully
+	if i.ledgerBackend == nil {
+		i.logger.Warn("Ledger backend not configured; skipping ingestion")
+		return nil
+	}
+
+	// Without a configured start, follow the network tip
+	if startLedger == 0 {
+		latest, err := i.ledgerBackend.GetLatestLedgerSequence(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get latest ledger: %w", err)
+		}
+		startLedger = latest
+	}
+
 	var ledgerRange backends.Range
 	if i.config.EndLedger > 0 {
 		ledgerRange = backends.BoundedRange(startLedger, i.config.EndLedger)
@@ -156,16 +200,14 @@ func (i *Ingester) Start(ctx context.Context) error {
 
 	i.logger.Infof("Starting ingestion from ledger %d", startLedger)
 
-	// If no ledger backend is configured, skip ingestion gracefully
-	if i.ledgerBackend == nil {
-		i.logger.Warn("Ledger backend not configured; skipping ingestion")
-		return nil
-	}
-
 	if err := i.ledgerBackend.PrepareRange(ctx, ledgerRange); err != nil {
 		return fmt.Errorf("failed to prepare range: %w", err)
 	}
+	i.setCurrentLedger(startLedger - 1)
 	go i.processLedgers(ctx)
+	if i.db != nil {
+		go i.runRepairs(ctx)
+	}
 	return nil
 }
 
@@ -188,6 +230,16 @@ func (i *Ingester) processLedgers(ctx context.Context) {
 			}
 			if err := i.processLedger(lcm); err != nil {
 				i.logger.Errorf("Failed to process ledger %d: %v", lcm.LedgerSequence(), err)
+				if i.handleLedgerFailure(lcm.LedgerSequence(), err) {
+					i.logger.Warnf("Skipping ledger %d after %d failed attempts", lcm.LedgerSequence(), i.config.SkipAfterAttempts)
+					gap := models.LedgerGap{Start: lcm.LedgerSequence(), End: lcm.LedgerSequence(), Reason: GapMissing}
+					if err := i.ScheduleRepair(ctx, []models.LedgerGap{gap}); err != nil {
+						i.logger.Errorf("Failed to schedule repair of skipped ledger %d: %v", lcm.LedgerSequence(), err)
+					}
+					i.setCurrentLedger(lcm.LedgerSequence())
+				} else if i.config.RetryDelay > 0 {
+					time.Sleep(i.config.RetryDelay)
+				}
 				continue
 			}
 			i.setCurrentLedger(lcm.LedgerSequence())
@@ -198,6 +250,14 @@ func (i *Ingester) processLedgers(ctx context.Context) {
 }
 
 func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
+	return i.ingestLedger(ledgerCloseMeta, false, i.updateIngestionState)
+}
+
+// ingestLedger stores a ledger and its contents in one database transaction.
+// With replace, a ledger already stored at that sequence is deleted first,
+// together with everything that references it. recordProgress runs inside
+// the transaction so progress tracking commits atomically with the data.
+func (i *Ingester) ingestLedger(ledgerCloseMeta xdr.LedgerCloseMeta, replace bool, recordProgress func(tx *sql.Tx, ledger uint32) error) error {
 	ledgerSeq := ledgerCloseMeta.LedgerSequence()
 	ledgerHeader := ledgerCloseMeta.LedgerHeaderHistoryEntry()
 
@@ -232,7 +292,7 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 		PreviousHash:     fmt.Sprintf("%x", ledgerHeader.Header.PreviousLedgerHash),
 		TransactionCount: ledgerCloseMeta.CountTransactions(),
 		OperationCount:   operationCount,
-		ClosedAt:         time.Unix(int64(ledgerHeader.Header.ScpValue.CloseTime), 0),
+		ClosedAt:         time.Unix(int64(ledgerHeader.Header.ScpValue.CloseTime), 0).UTC(),
 		TotalCoins:       int64(ledgerHeader.Header.TotalCoins),
 		FeePool:          int64(ledgerHeader.Header.FeePool),
 		BaseFee:          uint32(ledgerHeader.Header.BaseFee),
@@ -240,6 +300,11 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 		MaxTxSetSize:     uint32(ledgerHeader.Header.MaxTxSetSize),
 		ProtocolVersion:  uint32(ledgerHeader.Header.LedgerVersion),
 	}
+	if replace {
+		if _, err := dbTx.Exec(`DELETE FROM ledgers WHERE sequence = $1`, ledgerSeq); err != nil {
+			return fmt.Errorf("failed to clear ledger: %w", err)
+		}
+	}
 	if err := i.storeLedger(dbTx, ledgerInfo); err != nil {
 		return fmt.Errorf("failed to store ledger: %w", err)
 	}
@@ -250,6 +315,12 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 	}
 	defer txReader.Close()
 
+	// Accounts involved in the transactions kept from this ledger
+	accounts := map[string]bool{}
+	var messages *outbox
+	if i.wsHub != nil {
+		messages = &outbox{}
+	}
 	for {
 		tx, err := txReader.Read()
 		if err == io.EOF {
@@ -258,11 +329,14 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 		if err != nil {
 			return fmt.Errorf("failed to read transaction: %w", err)
 		}
-		if err := i.processTransaction(dbTx, ledgerSeq, tx); err != nil {
+		if err := i.processTransaction(dbTx, ledgerInfo, tx, accounts, messages); err != nil {
 			i.logger.Errorf("Failed to process transaction in ledger %d: %v", ledgerSeq, err)
 		}
 	}
+	_, filtering := i.activeFilter()
 
+	// TTL changes are applied last, once the entries they extend are stored
+	var ttlChanges []ingest.Change
 	for {
 		change, err := changeReader.Read()
 		if err == io.EOF {
@@ -273,18 +347,48 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 		}
 		switch change.Type {
 		case xdr.LedgerEntryTypeAccount:
-			// TODO: handle account changes
+			entry := change.Post
+			if entry == nil {
+				entry = change.Pre
+			}
+			track := !filtering || accounts[entry.Data.MustAccount().AccountId.Address()]
+			if err := i.processAccountChange(dbTx, ledgerSeq, change, track); err != nil {
+				return err
+			}
+		case xdr.LedgerEntryTypeTrustline:
+			entry := change.Post
+			if entry == nil {
+				entry = change.Pre
+			}
+			track := !filtering || accounts[entry.Data.MustTrustLine().AccountId.Address()]
+			if err := i.processTrustlineChange(dbTx, ledgerSeq, change, track); err != nil {
+				return err
+			}
 		case xdr.LedgerEntryTypeData:
 			// TODO: handle data entries
 		case xdr.LedgerEntryTypeContractData:
-			// TODO: handle Soroban contract data
+			if err := i.processContractDataChange(dbTx, ledgerSeq, change); err != nil {
+				return err
+			}
 		case xdr.LedgerEntryTypeContractCode:
-			// TODO: handle Soroban contract code
+			if err := i.processContractCodeChange(dbTx, ledgerSeq, change); err != nil {
+				return err
+			}
+		case xdr.LedgerEntryTypeTtl:
+			ttlChanges = append(ttlChanges, change)
+		}
+	}
+	for _, change := range ttlChanges {
+		if err := i.processTTLChange(dbTx, ledgerSeq, change); err != nil {
+			return err
 		}
 	}
 
-	if err := i.updateIngestionState(dbTx, ledgerSeq); err != nil {
-		return fmt.Errorf("failed to update ingestion state: %w", err)
+	if err := recordProgress(dbTx, ledgerSeq); err != nil {
+		return fmt.Errorf("failed to record progress: %w", err)
+	}
+	if _, err := dbTx.Exec(`DELETE FROM ledger_failures WHERE sequence = $1`, ledgerSeq); err != nil {
+		return fmt.Errorf("failed to clear ledger failure: %w", err)
 	}
 	if err := dbTx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -292,37 +396,40 @@ func (i *Ingester) processLedger(ledgerCloseMeta xdr.LedgerCloseMeta) error {
 	// Prevent deferred rollback after successful commit
 	dbTx = nil
 
-	if i.wsHub != nil {
-		i.wsHub.broadcast <- map[string]interface{}{"type": "ledger", "data": ledgerInfo}
+	if messages != nil {
+		messages.add("ledger", ledgerInfo)
+		for _, message := range *messages {
+			i.wsHub.broadcast <- message
+		}
 	}
 	return nil
 }
 
-func (i *Ingester) processTransaction(dbTx *sql.Tx, ledgerSeq uint32, tx ingest.LedgerTransaction) error {
+// processTransaction stores a transaction with the operations and events the
+// filter keeps, and adds its accounts to accounts and its broadcast messages
+// to messages when it is kept
+func (i *Ingester) processTransaction(dbTx *sql.Tx, ledger models.LedgerInfo, tx ingest.LedgerTransaction, accounts map[string]bool, messages *outbox) error {
+	ledgerSeq := ledger.Sequence
 	txHash := tx.Result.TransactionHash.HexString()
 	envelope := tx.Envelope
 	sourceAccount := envelope.SourceAccount().ToAccountId().Address()
 	successful := tx.Result.Successful()
 
-	// Check if this transaction involves any of our filtered contracts
-	if len(i.config.FilterContracts) > 0 {
-		hasFilteredContract := false
-		for _, op := range envelope.Operations() {
-			if op.Body.Type == xdr.OperationTypeInvokeHostFunction {
-				invokeOp := op.Body.MustInvokeHostFunctionOp()
-				if invokeOp.HostFunction.Type == xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
-					contractAddress := i.extractContractAddress(invokeOp.HostFunction.MustInvokeContract())
-					if contractAddress != "" && i.isFilteredContract(contractAddress) {
-						hasFilteredContract = true
-						break
-					}
-				}
-			}
-		}
-		// Skip this transaction if it doesn't involve any of our filtered contracts
-		if !hasFilteredContract {
-			return nil
-		}
+	// Decide which operations to keep; the transaction is kept when any is
+	operations := envelope.Operations()
+	events := transactionEvents(tx)
+	filter, filtering := i.activeFilter()
+	keepOps := make([]bool, len(operations))
+	keepTx := !filtering
+	for idx, op := range operations {
+		keepOps[idx] = !filtering || filter.matches(i.operationSubject(sourceAccount, op, operationEvents(events, idx)))
+		keepTx = keepTx || keepOps[idx]
+	}
+	if !keepTx {
+		return nil
+	}
+	for _, account := range transactionAccounts(tx) {
+		accounts[account] = true
 	}
 
 	feePaid := int64(envelope.Fee())
@@ -352,7 +459,8 @@ func (i *Ingester) processTransaction(dbTx *sql.Tx, ledgerSeq uint32, tx ingest.
 		SourceAccount:  sourceAccount,
 		FeePaid:        feePaid,
 		OperationCount: int32(len(envelope.Operations())),
-		CreatedAt:      time.Now(), // Use current time as LedgerCloseTime is not directly available
+		CreatedAt:      time.Now(),
+		ClosedAt:       ledger.ClosedAt,
 		MemoType:       memoType,
 		MemoValue:      memoValue,
 		Successful:     successful,
@@ -365,174 +473,91 @@ func (i *Ingester) processTransaction(dbTx *sql.Tx, ledgerSeq uint32, tx ingest.
 	if _, err := dbTx.Exec(`
 		INSERT INTO transactions (id, hash, ledger, index, source_account, fee_paid,
 			operation_count, created_at, memo_type, memo_value, successful,
-			envelope_xdr, result_xdr, result_meta_xdr)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			envelope_xdr, result_xdr, result_meta_xdr, closed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		ON CONFLICT (id) DO NOTHING`,
 		transaction.ID, transaction.Hash, transaction.Ledger, transaction.Index,
 		transaction.SourceAccount, transaction.FeePaid, transaction.OperationCount,
 		transaction.CreatedAt, transaction.MemoType, transaction.MemoValue,
-		transaction.Successful, envelopeXDR, resultXDR, metaXDR); err != nil {
+		transaction.Successful, envelopeXDR, resultXDR, metaXDR, transaction.ClosedAt); err != nil {
 		return fmt.Errorf("failed to store transaction: %w", err)
 	}
 
-	operations := envelope.Operations()
 	for opIndex, op := range operations {
-		if err := i.processOperation(dbTx, transaction.ID, uint32(opIndex), op, tx); err != nil {
+		if !keepOps[opIndex] {
+			continue
+		}
+		if err := i.processOperation(dbTx, transaction, uint32(opIndex), op, tx); err != nil {
 			i.logger.Errorf("Failed to process operation %d in tx %s: %v", opIndex, txHash, err)
 		}
+		if err := i.discoverAssets(dbTx, ledgerSeq, op, tx); err != nil {
+			i.logger.Errorf("Failed to record assets of operation %d in tx %s: %v", opIndex, txHash, err)
+		}
 	}
 
-	if tx.UnsafeMeta.V == 3 && tx.UnsafeMeta.V3 != nil {
-		if err := i.processSorobanEvents(dbTx, tx); err != nil {
-			i.logger.Errorf("Failed to process Soroban events in tx %s: %v", txHash, err)
+	// Diagnostic events are a trace of the kept transaction; other events
+	// must match in the context of the operation that emitted them
+	for _, event := range events {
+		if filtering && event.event.Type != xdr.ContractEventTypeDiagnostic {
+			var op *xdr.Operation
+			if event.operationIndex >= 0 && event.operationIndex < len(operations) {
+				op = &operations[event.operationIndex]
+			}
+			if !filter.matches(i.eventSubject(sourceAccount, op, event.event)) {
+				continue
+			}
+		}
+		if err := i.storeSorobanEvent(dbTx, transaction, event, messages); err != nil {
+			i.logger.Errorf("Failed to store Soroban event in tx %s: %v", txHash, err)
 		}
 	}
 	i.incrementTransactionCount()
-	if i.wsHub != nil {
-		i.wsHub.broadcast <- map[string]interface{}{"type": "transaction", "data": transaction}
-	}
+	messages.add("transaction", transaction)
 	return nil
 }
 
-func (i *Ingester) processOperation(dbTx *sql.Tx, txID string, index uint32, op xdr.Operation, tx ingest.LedgerTransaction) error {
-	opID := fmt.Sprintf("%s-%d", txID, index)
+func (i *Ingester) processOperation(dbTx *sql.Tx, transaction models.Transaction, index uint32, op xdr.Operation, tx ingest.LedgerTransaction) error {
+	opID := fmt.Sprintf("%s-%d", transaction.ID, index)
 	var sourceAccount string
 	if op.SourceAccount != nil {
 		sourceAccount = op.SourceAccount.ToAccountId().Address()
 	}
 
-	// Check if this is an invoke_host_function operation for contract filtering
-	if op.Body.Type == xdr.OperationTypeInvokeHostFunction && len(i.config.FilterContracts) > 0 {
-		invokeOp := op.Body.MustInvokeHostFunctionOp()
-		if invokeOp.HostFunction.Type == xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
-			// Extract contract address from the invoke operation
-			contractAddress := i.extractContractAddress(invokeOp.HostFunction.MustInvokeContract())
-			if contractAddress != "" && !i.isFilteredContract(contractAddress) {
-				// Skip this operation if it's not for one of our filtered contracts
-				return nil
-			}
-		}
-	}
-
-	var opType string
-	var details map[string]interface{}
+	opType := operationTypeName(op.Body.Type)
+	details := map[string]interface{}{}
 	switch op.Body.Type {
 	case xdr.OperationTypeCreateAccount:
-		opType = "create_account"
 		createOp := op.Body.MustCreateAccountOp()
 		details = map[string]interface{}{"destination": createOp.Destination.Address(), "starting_balance": createOp.StartingBalance}
 	case xdr.OperationTypePayment:
-		opType = "payment"
 		paymentOp := op.Body.MustPaymentOp()
 		details = map[string]interface{}{"destination": paymentOp.Destination.ToAccountId().Address(), "amount": paymentOp.Amount}
 	case xdr.OperationTypeManageSellOffer:
-		opType = "manage_sell_offer"
 		offerOp := op.Body.MustManageSellOfferOp()
 		details = map[string]interface{}{"amount": offerOp.Amount}
 	case xdr.OperationTypeCreatePassiveSellOffer:
-		opType = "create_passive_sell_offer"
 		passiveOp := op.Body.MustCreatePassiveSellOfferOp()
 		details = map[string]interface{}{"amount": passiveOp.Amount}
-	case xdr.OperationTypeSetOptions:
-		opType = "set_options"
-		details = map[string]interface{}{}
-	case xdr.OperationTypeChangeTrust:
-		opType = "change_trust"
-		details = map[string]interface{}{}
-	case xdr.OperationTypeAllowTrust:
-		opType = "allow_trust"
-		details = map[string]interface{}{}
-	case xdr.OperationTypeAccountMerge:
-		opType = "account_merge"
-		details = map[string]interface{}{}
-	case xdr.OperationTypeManageData:
-		opType = "manage_data"
-		details = map[string]interface{}{}
 	case xdr.OperationTypeInvokeHostFunction:
-		opType = "invoke_host_function"
-		details = map[string]interface{}{"function_type": op.Body.MustInvokeHostFunctionOp().HostFunction.Type.String()}
+		var err error
+		if details, err = i.invokeHostFunctionDetails(dbTx, op.Body.MustInvokeHostFunctionOp(), tx); err != nil {
+			return err
+		}
 	case xdr.OperationTypeExtendFootprintTtl:
-		opType = "extend_footprint_ttl"
 		details = map[string]interface{}{"extend_to": op.Body.MustExtendFootprintTtlOp().ExtendTo}
-	case xdr.OperationTypeRestoreFootprint:
-		opType = "restore_footprint"
-		details = map[string]interface{}{}
-	default:
-		opType = op.Body.Type.String()
-		details = map[string]interface{}{}
 	}
 	detailsJSON, _ := json.Marshal(details)
 	if _, err := dbTx.Exec(`
-		INSERT INTO operations (id, transaction_id, index, type, source_account, details)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO NOTHING`, opID, txID, index, opType, sourceAccount, detailsJSON); err != nil {
+		INSERT INTO operations (id, transaction_id, index, type, source_account, details, closed_at, ledger, transaction_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO NOTHING`, opID, transaction.ID, index, opType, sourceAccount, detailsJSON, transaction.ClosedAt,
+		transaction.Ledger, transaction.Index); err != nil {
 		return fmt.Errorf("failed to store operation: %w", err)
 	}
 	i.incrementOperationCount(1)
 	return nil
 }
 
-func (i *Ingester) processSorobanEvents(dbTx *sql.Tx, tx ingest.LedgerTransaction) error {
-	if tx.UnsafeMeta.V != 3 || tx.UnsafeMeta.V3 == nil {
-		return nil
-	}
-	txHash := tx.Result.TransactionHash.HexString()
-	successful := tx.Result.Successful()
-	// Process Soroban events from meta if transaction was successful
-	if successful && tx.UnsafeMeta.V3.SorobanMeta != nil {
-		for _, event := range tx.UnsafeMeta.V3.SorobanMeta.Events {
-			// Get ledger from current ingester state
-			ledger := i.getCurrentLedger()
-			if err := i.storeSorobanEvent(dbTx, event, ledger, txHash, true); err != nil {
-				i.logger.Errorf("Failed to store Soroban event: %v", err)
-			}
-		}
-	}
-	return nil
-}
-
-func (i *Ingester) storeSorobanEvent(dbTx *sql.Tx, event xdr.ContractEvent, ledger uint32, txHash string, successful bool) error {
-	var contractID string
-	if event.ContractId != nil {
-		contractID = fmt.Sprintf("%x", *event.ContractId)
-	}
-
-	// Filter events by contract address if filter is configured
-	if len(i.config.FilterContracts) > 0 && contractID != "" {
-		if !i.isFilteredContract(contractID) {
-			// Skip this event if it's not for one of our filtered contracts
-			return nil
-		}
-	}
-
-	eventType := "unknown"
-	if event.Type == xdr.ContractEventTypeContract {
-		eventType = "contract"
-	} else if event.Type == xdr.ContractEventTypeSystem {
-		eventType = "system"
-	}
-	var topics []string
-	for _, topic := range event.Body.V0.Topics {
-		topics = append(topics, i.scValToString(topic))
-	}
-	data := i.scValToJSON(event.Body.V0.Data)
-	eventID := fmt.Sprintf("%s-%d-%s", txHash, len(topics), contractID)
-	topicsJSON, _ := json.Marshal(topics)
-	dataJSON, _ := json.Marshal(data)
-	if _, err := dbTx.Exec(`
-		INSERT INTO contract_events (id, contract_id, ledger, transaction_hash,
-			event_type, topics, data, in_successful_tx)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (id) DO NOTHING`, eventID, contractID, ledger, txHash, eventType, topicsJSON, dataJSON, successful); err != nil {
-		return fmt.Errorf("failed to store contract event: %w", err)
-	}
-	i.incrementEventCount()
-	if i.wsHub != nil {
-		i.wsHub.broadcast <- map[string]interface{}{"type": "contract_event", "data": models.ContractEvent{ID: eventID, ContractID: contractID, Ledger: ledger, TransactionHash: txHash, EventType: eventType, Topics: topics, Data: dataJSON, InSuccessfulTx: successful}}
-	}
-	return nil
-}
-
 // Helpers
 func (i *Ingester) getCurrentLedger() uint32 {
 	i.mu.RLock()
@@ -575,6 +600,9 @@ func (i *Ingester) updateStats(ctx context.Context) {
 		case <-ticker.C:
 			i.mu.Lock()
 			i.stats.LastUpdateTime = time.Now()
+			if i.wsHub != nil {
+				i.stats.ConnectedClients = i.wsHub.ClientCount()
+			}
 			i.mu.Unlock()
 		}
 	}
@@ -600,8 +628,7 @@ func (i *Ingester) scValToString(val xdr.ScVal) string {
 	case xdr.ScValTypeScvBytes:
 		return fmt.Sprintf("%x", val.MustBytes())
 	default:
-		data, _ := val.MarshalBinary()
-		return fmt.Sprintf("%x", data)
+		return scval.String(val)
 	}
 }
 
@@ -611,12 +638,8 @@ func (i *Ingester) scValToJSON(val xdr.ScVal) interface{} {
 		return val.MustB()
 	case xdr.ScValTypeScvI32:
 		return val.MustI32()
-	case xdr.ScValTypeScvI64:
-		return val.MustI64()
 	case xdr.ScValTypeScvU32:
 		return val.MustU32()
-	case xdr.ScValTypeScvU64:
-		return val.MustU64()
 	case xdr.ScValTypeScvSymbol:
 		return string(val.MustSym())
 	case xdr.ScValTypeScvString:
@@ -639,8 +662,7 @@ func (i *Ingester) scValToJSON(val xdr.ScVal) interface{} {
 		}
 		return result
 	default:
-		data, _ := val.MarshalBinary()
-		return fmt.Sprintf("%x", data)
+		return scval.ToNative(val)
 	}
 }
 
@@ -681,52 +703,33 @@ func (i *Ingester) loadLastLedger() (uint32, error) {
 	return lastLedger, err
 }
 
-func (h *WebSocketHub) run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mu.Unlock()
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					delete(h.clients, client)
-					close(client.send)
-				}
-			}
-			h.mu.RUnlock()
-		}
-	}
-}
-
-// Helper functions for contract filtering
+// Helper functions for contract filtering. Filter entries and addresses may
+// be strkeys or hex and are compared in canonical form.
+//
+// isFilteredContract reports whether the active filter keeps the records of
+// a contract on their own, such as its storage
 func (i *Ingester) isFilteredContract(contractAddress string) bool {
-	if len(i.config.FilterContracts) == 0 {
+	filter, filtering := i.activeFilter()
+	if !filtering {
 		return true // No filter means include all
 	}
-	for _, filterAddr := range i.config.FilterContracts {
-		if contractAddress == filterAddr {
-			return true
-		}
+	if contractAddress == "" {
+		return false
 	}
-	return false
+	return filter.matches(filterSubject{contracts: []string{contractAddress}})
+}
+
+// filterContractList returns the configured contracts followed by those
+// added at runtime
+func (i *Ingester) filterContractList() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append(append([]string{}, i.config.FilterContracts...), i.filterContracts...)
 }
 
 func (i *Ingester) extractContractAddress(invokeContract xdr.InvokeContractArgs) string {
 	if invokeContract.ContractAddress.Type == xdr.ScAddressTypeScAddressTypeContract {
-		contractHash := invokeContract.ContractAddress.MustContractId()
-		return fmt.Sprintf("%x", contractHash)
+		return EncodeContractID(invokeContract.ContractAddress.MustContractId())
 	}
 	return ""
 }
@@ -4,10 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
 )
 
 func TestContractFiltering(t *testing.T) {
@@ -105,6 +111,22 @@ func TestIngesterInitialization(t *testing.T) {
 			expectWebSocket: false,
 			expectError:     false,
 		},
+		{
+			name: "Negative retry attempts",
+			config: &Config{
+				NetworkPassphrase: "Test SDF Network ; September 2015",
+				RetryAttempts:     -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative skip after attempts",
+			config: &Config{
+				NetworkPassphrase: "Test SDF Network ; September 2015",
+				SkipAfterAttempts: -1,
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -272,3 +294,92 @@ func TestDatabaseStateManagement(t *testing.T) {
 	assert.NoError(t, err)
 	assert.GreaterOrEqual(t, lastLedger, uint32(0))
 }
+
+func TestProcessFailedTransactionEvents(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	invoked := xdr.ContractId{1}
+	other := xdr.ContractId{2}
+	ingester := &Ingester{
+		config: &Config{FilterContracts: []string{EncodeContractID(invoked)}},
+		stats:  &models.Stats{},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+	op := xdr.Operation{Body: xdr.OperationBody{
+		Type: xdr.OperationTypeInvokeHostFunction,
+		InvokeHostFunctionOp: &xdr.InvokeHostFunctionOp{HostFunction: xdr.HostFunction{
+			Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract,
+			InvokeContract: &xdr.InvokeContractArgs{
+				ContractAddress: xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &invoked},
+				FunctionName:    "attest",
+			},
+		}},
+	}}
+	event := func(contract *xdr.ContractId, eventType xdr.ContractEventType, topic string) xdr.ContractEvent {
+		return xdr.ContractEvent{
+			ContractId: contract,
+			Type:       eventType,
+			Body:       xdr.ContractEventBody{V: 0, V0: &xdr.ContractEventV0{Topics: []xdr.ScVal{symbol(topic)}, Data: symbol("GA")}},
+		}
+	}
+	source := xdr.MustMuxedAddress(testAccount)
+	tx := ingest.LedgerTransaction{
+		Index: 1,
+		Envelope: xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1:   &xdr.TransactionV1Envelope{Tx: xdr.Transaction{SourceAccount: source, Operations: []xdr.Operation{op}}},
+		},
+		Result: xdr.TransactionResultPair{Result: xdr.TransactionResult{
+			Result: xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxFailed, Results: &[]xdr.OperationResult{}},
+		}},
+		UnsafeMeta: xdr.TransactionMeta{V: 3, V3: &xdr.TransactionMetaV3{SorobanMeta: &xdr.SorobanTransactionMeta{
+			DiagnosticEvents: []xdr.DiagnosticEvent{
+				{InSuccessfulContractCall: false, Event: event(nil, xdr.ContractEventTypeDiagnostic, "fn_call")},
+				{InSuccessfulContractCall: false, Event: event(&invoked, xdr.ContractEventTypeContract, "attested")},
+				{InSuccessfulContractCall: false, Event: event(&other, xdr.ContractEventTypeContract, "transfer")},
+			},
+			ReturnValue: xdr.ScVal{Type: xdr.ScValTypeScvVoid},
+		}}},
+	}
+	txHash := tx.Result.TransactionHash.HexString()
+	closedAt := time.Unix(1700000000, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO transactions").
+		WithArgs(sqlmock.AnyArg(), txHash, uint32(50), uint32(1), testAccount, int64(0), int32(1), sqlmock.AnyArg(),
+			"", "", false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), closedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The invoked contract has no spec, so its arguments stay positional
+	mock.ExpectQuery("FROM contracts c").WithArgs(EncodeContractID(invoked)).
+		WillReturnRows(sqlmock.NewRows([]string{"spec_xdr"}))
+	mock.ExpectExec("INSERT INTO operations").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), uint32(0), "invoke_host_function", "", sqlmock.AnyArg(), closedAt, uint32(50), uint32(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Diagnostic events are kept with their transaction, failed contract
+	// events only when they match the filter
+	mock.ExpectExec("INSERT INTO contract_events").
+		WithArgs(eventID(50, 1, sorobanEvent{eventIndex: 0}), "", uint32(50), txHash, "diagnostic", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			false, false, uint32(1), uint32(0), uint32(0), closedAt, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO contract_events").
+		WithArgs(eventID(50, 1, sorobanEvent{eventIndex: 1}), EncodeContractID(invoked), uint32(50), txHash, "contract", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			false, false, uint32(1), uint32(0), uint32(1), closedAt, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	accounts := map[string]bool{}
+	messages := &outbox{}
+	require.NoError(t, ingester.processTransaction(dbTx, models.LedgerInfo{Sequence: 50, ClosedAt: closedAt}, tx, accounts, messages))
+	assert.True(t, accounts[testAccount])
+	// Messages wait for the ledger to be committed
+	var types []interface{}
+	for _, message := range *messages {
+		types = append(types, message.(map[string]interface{})["type"])
+	}
+	assert.Equal(t, []interface{}{"contract_event", "contract_event", "transaction"}, types)
+	assert.Equal(t, int64(2), ingester.stats.EventCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
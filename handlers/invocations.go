@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+var ledgerEntryTypeNames = map[xdr.LedgerEntryType]string{
+	xdr.LedgerEntryTypeAccount:          "account",
+	xdr.LedgerEntryTypeTrustline:        "trustline",
+	xdr.LedgerEntryTypeOffer:            "offer",
+	xdr.LedgerEntryTypeData:             "data",
+	xdr.LedgerEntryTypeClaimableBalance: "claimable_balance",
+	xdr.LedgerEntryTypeLiquidityPool:    "liquidity_pool",
+	xdr.LedgerEntryTypeContractData:     "contract_data",
+	xdr.LedgerEntryTypeContractCode:     "contract_code",
+	xdr.LedgerEntryTypeConfigSetting:    "config_setting",
+	xdr.LedgerEntryTypeTtl:              "ttl",
+}
+
+// invokeHostFunctionDetails describes an invoke_host_function operation: the
+// called contract, function and arguments, the authorizations it carries and
+// the footprint and resources its transaction declared
+func (i *Ingester) invokeHostFunctionDetails(dbTx *sql.Tx, op xdr.InvokeHostFunctionOp, tx ingest.LedgerTransaction) (map[string]interface{}, error) {
+	details := map[string]interface{}{"function_type": op.HostFunction.Type.String()}
+	if op.HostFunction.Type == xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
+		invocation, err := i.invocationDetails(dbTx, op.HostFunction.MustInvokeContract())
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range invocation {
+			details[key] = value
+		}
+	}
+
+	auth := make([]map[string]interface{}, len(op.Auth))
+	for idx, entry := range op.Auth {
+		auth[idx] = authorizationDetails(entry)
+	}
+	details["auth"] = auth
+
+	// Soroban transactions have a single operation, so the transaction's
+	// resources are the operation's
+	if data, ok := tx.GetSorobanData(); ok {
+		details["footprint"] = map[string]interface{}{
+			"read_only":  footprintKeys(data.Resources.Footprint.ReadOnly),
+			"read_write": footprintKeys(data.Resources.Footprint.ReadWrite),
+		}
+		details["resources"] = map[string]interface{}{
+			"instructions":    uint32(data.Resources.Instructions),
+			"disk_read_bytes": uint32(data.Resources.DiskReadBytes),
+			"write_bytes":     uint32(data.Resources.WriteBytes),
+			"resource_fee":    int64(data.ResourceFee),
+		}
+	}
+	return details, nil
+}
+
+// authorizationDetails describes who signed an authorization entry, the
+// transaction source or an address with its nonce, and the tree of calls it
+// authorizes
+func authorizationDetails(entry xdr.SorobanAuthorizationEntry) map[string]interface{} {
+	auth := map[string]interface{}{"credentials": "source_account"}
+	if entry.Credentials.Type == xdr.SorobanCredentialsTypeSorobanCredentialsAddress {
+		credentials := entry.Credentials.MustAddress()
+		address, _ := scval.AddressString(credentials.Address)
+		auth["credentials"] = "address"
+		auth["address"] = address
+		auth["nonce"] = int64(credentials.Nonce)
+		auth["signature_expiration_ledger"] = uint32(credentials.SignatureExpirationLedger)
+	}
+	auth["invocation"] = authorizedInvocation(entry.RootInvocation)
+	return auth
+}
+
+// authorizedInvocation describes an authorized call and its sub-calls.
+// Arguments are positional; only the top-level call is named after the spec.
+func authorizedInvocation(invocation xdr.SorobanAuthorizedInvocation) map[string]interface{} {
+	out := map[string]interface{}{}
+	fn := invocation.Function
+	switch fn.Type {
+	case xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeContractFn:
+		call := fn.MustContractFn()
+		contractID, _ := scval.AddressString(call.ContractAddress)
+		out["type"] = "contract_fn"
+		out["contract_id"] = contractID
+		out["fn"] = string(call.FunctionName)
+		out["args"] = nativeArgs(call.Args)
+	case xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeCreateContractHostFn:
+		out["type"] = "create_contract"
+		addExecutable(out, fn.MustCreateContractHostFn().Executable)
+	case xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeCreateContractV2HostFn:
+		create := fn.MustCreateContractV2HostFn()
+		out["type"] = "create_contract"
+		addExecutable(out, create.Executable)
+		out["args"] = nativeArgs(create.ConstructorArgs)
+	}
+	if len(invocation.SubInvocations) > 0 {
+		subs := make([]map[string]interface{}, len(invocation.SubInvocations))
+		for idx, sub := range invocation.SubInvocations {
+			subs[idx] = authorizedInvocation(sub)
+		}
+		out["sub_invocations"] = subs
+	}
+	return out
+}
+
+func addExecutable(out map[string]interface{}, executable xdr.ContractExecutable) {
+	if executable.Type == xdr.ContractExecutableTypeContractExecutableWasm && executable.WasmHash != nil {
+		out["executable_type"] = ExecutableWasm
+		out["wasm_hash"] = executable.WasmHash.HexString()
+		return
+	}
+	out["executable_type"] = ExecutableStellarAsset
+}
+
+// footprintKeys describes ledger keys by type and key_hash, the SHA-256 the
+// contract state tables use, with the contract and key of contract data
+func footprintKeys(keys []xdr.LedgerKey) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(keys))
+	for idx, key := range keys {
+		k := map[string]interface{}{"type": ledgerEntryTypeNames[key.Type]}
+		if hash, err := keyHash(key); err == nil {
+			k["key_hash"] = hash
+		}
+		switch key.Type {
+		case xdr.LedgerEntryTypeAccount:
+			k["account_id"] = key.MustAccount().AccountId.Address()
+		case xdr.LedgerEntryTypeContractData:
+			data := key.MustContractData()
+			contractID, _ := scval.AddressString(data.Contract)
+			k["contract_id"] = contractID
+			k["key"] = scval.ToNative(data.Key)
+			k["durability"] = durabilityName(data.Durability)
+		case xdr.LedgerEntryTypeContractCode:
+			k["wasm_hash"] = key.MustContractCode().Hash.HexString()
+		}
+		out[idx] = k
+	}
+	return out
+}
+
+func nativeArgs(args []xdr.ScVal) []interface{} {
+	out := make([]interface{}, len(args))
+	for idx, arg := range args {
+		out[idx] = scval.ToNative(arg)
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvokeHostFunctionDetails(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	ingester := &Ingester{config: &Config{}, logger: logrus.NewEntry(logrus.New())}
+	contract := xdr.ContractId{1}
+	token := xdr.ContractId{2}
+	contractAddress := xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contract}
+	tokenAddress := xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &token}
+	attest := xdr.InvokeContractArgs{ContractAddress: contractAddress, FunctionName: "attest", Args: []xdr.ScVal{scAccount(testAccount)}}
+	signer := xdr.MustAddress(testIssuer)
+	wasmHash := xdr.Hash{0xab}
+	op := xdr.InvokeHostFunctionOp{
+		HostFunction: xdr.HostFunction{Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract, InvokeContract: &attest},
+		Auth: []xdr.SorobanAuthorizationEntry{
+			{
+				Credentials: xdr.SorobanCredentials{Type: xdr.SorobanCredentialsTypeSorobanCredentialsSourceAccount},
+				RootInvocation: xdr.SorobanAuthorizedInvocation{
+					Function: xdr.SorobanAuthorizedFunction{
+						Type: xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeContractFn, ContractFn: &attest,
+					},
+					SubInvocations: []xdr.SorobanAuthorizedInvocation{{Function: xdr.SorobanAuthorizedFunction{
+						Type: xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeContractFn,
+						ContractFn: &xdr.InvokeContractArgs{ContractAddress: tokenAddress, FunctionName: "transfer",
+							Args: []xdr.ScVal{scAccount(testAccount), scI128(10)}},
+					}}},
+				},
+			},
+			{
+				Credentials: xdr.SorobanCredentials{Type: xdr.SorobanCredentialsTypeSorobanCredentialsAddress, Address: &xdr.SorobanAddressCredentials{
+					Address:                   xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeAccount, AccountId: &signer},
+					Nonce:                     42,
+					SignatureExpirationLedger: 1000,
+				}},
+				RootInvocation: xdr.SorobanAuthorizedInvocation{Function: xdr.SorobanAuthorizedFunction{
+					Type: xdr.SorobanAuthorizedFunctionTypeSorobanAuthorizedFunctionTypeCreateContractHostFn,
+					CreateContractHostFn: &xdr.CreateContractArgs{Executable: xdr.ContractExecutable{
+						Type: xdr.ContractExecutableTypeContractExecutableWasm, WasmHash: &wasmHash,
+					}},
+				}},
+			},
+		},
+	}
+	entry := contractDataEntry(contract, symbol("admin"), symbol("GA"), 90)
+	dataKey, err := entry.LedgerKey()
+	require.NoError(t, err)
+	dataKeyHash, err := ledgerKeyHash(*entry)
+	require.NoError(t, err)
+	codeKey := xdr.LedgerKey{Type: xdr.LedgerEntryTypeContractCode, ContractCode: &xdr.LedgerKeyContractCode{Hash: wasmHash}}
+	tx := ingest.LedgerTransaction{Envelope: xdr.TransactionEnvelope{
+		Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+		V1: &xdr.TransactionV1Envelope{Tx: xdr.Transaction{Ext: xdr.TransactionExt{V: 1, SorobanData: &xdr.SorobanTransactionData{
+			Resources: xdr.SorobanResources{
+				Footprint:     xdr.LedgerFootprint{ReadOnly: []xdr.LedgerKey{codeKey}, ReadWrite: []xdr.LedgerKey{dataKey}},
+				Instructions:  250000,
+				DiskReadBytes: 1200,
+				WriteBytes:    300,
+			},
+			ResourceFee: 85000,
+		}}}},
+	}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM contracts c").WithArgs(EncodeContractID(contract)).
+		WillReturnRows(sqlmock.NewRows([]string{"spec_xdr"}))
+
+	dbTx, err := mockDB.Begin()
+	require.NoError(t, err)
+	details, err := ingester.invokeHostFunctionDetails(dbTx, op, tx)
+	require.NoError(t, err)
+	assert.Equal(t, EncodeContractID(contract), details["contract_id"])
+	assert.Equal(t, "attest", details["fn"])
+	assert.Equal(t, []interface{}{testAccount}, details["args"])
+
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"credentials": "source_account",
+			"invocation": map[string]interface{}{
+				"type": "contract_fn", "contract_id": EncodeContractID(contract), "fn": "attest", "args": []interface{}{testAccount},
+				"sub_invocations": []map[string]interface{}{{
+					"type": "contract_fn", "contract_id": EncodeContractID(token), "fn": "transfer", "args": []interface{}{testAccount, "10"},
+				}},
+			},
+		},
+		{
+			"credentials": "address", "address": testIssuer, "nonce": int64(42), "signature_expiration_ledger": uint32(1000),
+			"invocation": map[string]interface{}{"type": "create_contract", "executable_type": ExecutableWasm, "wasm_hash": wasmHash.HexString()},
+		},
+	}, details["auth"])
+
+	codeKeyHash, err := keyHash(codeKey)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"read_only": []map[string]interface{}{{"type": "contract_code", "key_hash": codeKeyHash, "wasm_hash": wasmHash.HexString()}},
+		"read_write": []map[string]interface{}{{
+			"type": "contract_data", "key_hash": dataKeyHash, "contract_id": EncodeContractID(contract), "key": "admin", "durability": DurabilityPersistent,
+		}},
+	}, details["footprint"])
+	assert.Equal(t, map[string]interface{}{
+		"instructions": uint32(250000), "disk_read_bytes": uint32(1200), "write_bytes": uint32(300), "resource_fee": int64(85000),
+	}, details["resources"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
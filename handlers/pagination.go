@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Sort orders of paged lists
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the list
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a row in a list: the values of the list's order
+// key for the row, such as (ledger, transaction index, operation index).
+// Cursors are exchanged as opaque strings; those with Before select the rows
+// before the position rather than after it.
+type Cursor struct {
+	Key    []int64
+	Before bool
+}
+
+// String encodes the cursor for clients
+func (c Cursor) String() string {
+	parts := make([]string, 0, len(c.Key)+1)
+	if c.Before {
+		parts = append(parts, "p")
+	} else {
+		parts = append(parts, "n")
+	}
+	for _, v := range c.Key {
+		parts = append(parts, strconv.FormatInt(v, 10))
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ":")))
+}
+
+// ParseCursor decodes a cursor of a list keyed by size columns
+func ParseCursor(s string, size int) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != size+1 || (parts[0] != "n" && parts[0] != "p") {
+		return Cursor{}, ErrInvalidCursor
+	}
+	cursor := Cursor{Key: make([]int64, size), Before: parts[0] == "p"}
+	for idx, part := range parts[1:] {
+		if cursor.Key[idx], err = strconv.ParseInt(part, 10, 64); err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// Page selects up to Limit rows of a list ordered by its key columns in
+// Order, starting after Cursor or ending before it when one is set. Rows are
+// scanned from the cursor outwards, so pages before a cursor are read in
+// reverse and flipped by the caller. Offset skips rows of a first page for
+// clients that have not moved to cursors.
+type Page struct {
+	Columns []string
+	Order   string
+	Limit   int
+	Cursor  *Cursor
+	Offset  int
+}
+
+// Reversed reports whether rows are scanned against Order
+func (p Page) Reversed() bool {
+	return p.Cursor != nil && p.Cursor.Before
+}
+
+// Condition adds the keyset condition of the cursor, a row comparison on the
+// key columns, to conditions
+func (p Page) Condition(conditions []string, args []interface{}) ([]string, []interface{}) {
+	if p.Cursor == nil {
+		return conditions, args
+	}
+	op := ">"
+	if (p.Order == OrderDesc) != p.Reversed() {
+		op = "<"
+	}
+	placeholders := make([]string, len(p.Cursor.Key))
+	for idx, v := range p.Cursor.Key {
+		args = append(args, v)
+		placeholders[idx] = fmt.Sprintf("$%d", len(args))
+	}
+	return append(conditions, fmt.Sprintf("(%s) %s (%s)",
+		strings.Join(p.Columns, ", "), op, strings.Join(placeholders, ", "))), args
+}
+
+// OrderBy returns the ORDER BY and LIMIT clauses of the page scan, the
+// limit and any offset taking the next placeholders
+func (p Page) OrderBy(args []interface{}) (string, []interface{}) {
+	direction := "ASC"
+	if (p.Order == OrderDesc) != p.Reversed() {
+		direction = "DESC"
+	}
+	columns := make([]string, len(p.Columns))
+	for idx, column := range p.Columns {
+		columns[idx] = column + " " + direction
+	}
+	args = append(args, p.Limit)
+	clause := fmt.Sprintf(" ORDER BY %s LIMIT $%d", strings.Join(columns, ", "), len(args))
+	if p.Offset > 0 {
+		args = append(args, p.Offset)
+		clause += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	return clause, args
+}
+
+// Info returns the cursors around a page given the keys of its rows in
+// Order. Next continues after the last row and Prev goes back before the
+// first; the first page has no Prev. An empty page keeps the cursor it was
+// requested with, so clients can poll it for rows ingested later.
+func (p Page) Info(keys [][]int64) models.PageInfo {
+	info := models.PageInfo{Order: p.Order, Limit: p.Limit}
+	if len(keys) == 0 {
+		if p.Cursor != nil {
+			if p.Cursor.Before {
+				info.Prev = p.Cursor.String()
+			} else {
+				info.Next = p.Cursor.String()
+			}
+		}
+		return info
+	}
+	info.Next = Cursor{Key: keys[len(keys)-1]}.String()
+	if p.Cursor != nil {
+		info.Prev = Cursor{Key: keys[0], Before: true}.String()
+	}
+	return info
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{Key: []int64{120, 3, 7}, Before: true}
+	parsed, err := ParseCursor(cursor.String(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, cursor, parsed)
+
+	for _, raw := range []string{"", "not base64!", Cursor{Key: []int64{120, 3}}.String(), "eDoxOjI6Mw"} {
+		_, err := ParseCursor(raw, 3)
+		assert.ErrorIs(t, err, ErrInvalidCursor, raw)
+	}
+}
+
+func TestPage(t *testing.T) {
+	columns := []string{"ledger", "index"}
+	tests := []struct {
+		name       string
+		page       Page
+		conditions []string
+		orderBy    string
+	}{
+		{"first page", Page{Columns: columns, Order: OrderDesc, Limit: 10}, nil,
+			" ORDER BY ledger DESC, index DESC LIMIT $2"},
+		{"next descending", Page{Columns: columns, Order: OrderDesc, Limit: 10, Cursor: &Cursor{Key: []int64{5, 1}}},
+			[]string{"closed_at >= $1", "(ledger, index) < ($2, $3)"}, " ORDER BY ledger DESC, index DESC LIMIT $4"},
+		{"prev descending", Page{Columns: columns, Order: OrderDesc, Limit: 10, Cursor: &Cursor{Key: []int64{5, 1}, Before: true}},
+			[]string{"closed_at >= $1", "(ledger, index) > ($2, $3)"}, " ORDER BY ledger ASC, index ASC LIMIT $4"},
+		{"next ascending", Page{Columns: columns, Order: OrderAsc, Limit: 10, Cursor: &Cursor{Key: []int64{5, 1}}},
+			[]string{"closed_at >= $1", "(ledger, index) > ($2, $3)"}, " ORDER BY ledger ASC, index ASC LIMIT $4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, args := tt.page.Condition([]string{"closed_at >= $1"}, []interface{}{"t"})
+			if tt.page.Cursor == nil {
+				assert.Equal(t, []string{"closed_at >= $1"}, conditions)
+			} else {
+				assert.Equal(t, tt.conditions, conditions)
+			}
+			orderBy, args := tt.page.OrderBy(args)
+			assert.Equal(t, tt.orderBy, orderBy)
+			assert.Equal(t, 10, args[len(args)-1])
+		})
+	}
+
+	// Deprecated offsets take the placeholder after the limit
+	orderBy, args := Page{Columns: columns, Order: OrderDesc, Limit: 10, Offset: 20}.OrderBy(nil)
+	assert.Equal(t, " ORDER BY ledger DESC, index DESC LIMIT $1 OFFSET $2", orderBy)
+	assert.Equal(t, []interface{}{10, 20}, args)
+}
+
+func TestPageInfo(t *testing.T) {
+	keys := [][]int64{{9, 2}, {9, 1}}
+	first := Page{Order: OrderDesc, Limit: 2}
+	assert.Equal(t, models.PageInfo{Order: OrderDesc, Limit: 2, Next: Cursor{Key: []int64{9, 1}}.String()}, first.Info(keys))
+
+	cursor := Cursor{Key: []int64{9, 3}}
+	next := Page{Order: OrderDesc, Limit: 2, Cursor: &cursor}
+	assert.Equal(t, models.PageInfo{
+		Order: OrderDesc, Limit: 2,
+		Next: Cursor{Key: []int64{9, 1}}.String(),
+		Prev: Cursor{Key: []int64{9, 2}, Before: true}.String(),
+	}, next.Info(keys))
+
+	// An empty page keeps its cursor to poll
+	assert.Equal(t, models.PageInfo{Order: OrderDesc, Limit: 2, Next: cursor.String()}, next.Info(nil))
+	assert.Equal(t, models.PageInfo{Order: OrderDesc, Limit: 2}, first.Info(nil))
+}
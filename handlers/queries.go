@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+// Columns of the ledgers, transactions, operations and contract events read
+// by the APIs, in the order their scanners expect
+const (
+	LedgerColumns = `sequence, hash, previous_hash, transaction_count, operation_count,
+	closed_at, total_coins, fee_pool, base_fee, base_reserve, max_tx_set_size, protocol_version`
+
+	TransactionColumns = `id, hash, ledger, index, source_account, fee_paid,
+	operation_count, created_at, memo_type, memo_value, successful, COALESCE(closed_at, created_at)`
+
+	OperationColumns = `id, transaction_id, ledger, transaction_index, index, type, source_account, details,
+	COALESCE(closed_at, created_at)`
+
+	ContractEventColumns = `id, contract_id, ledger, transaction_hash, event_type,
+	topics, data, in_successful_tx, in_successful_contract_call,
+	COALESCE(transaction_index, 0), operation_index, COALESCE(event_index, 0),
+	COALESCE(closed_at, created_at), COALESCE(decoder, ''), decoded`
+)
+
+// ScanLedger reads a row of LedgerColumns
+func ScanLedger(row rowScanner) (models.LedgerInfo, error) {
+	var ledger models.LedgerInfo
+	err := row.Scan(&ledger.Sequence, &ledger.Hash, &ledger.PreviousHash, &ledger.TransactionCount,
+		&ledger.OperationCount, &ledger.ClosedAt, &ledger.TotalCoins, &ledger.FeePool,
+		&ledger.BaseFee, &ledger.BaseReserve, &ledger.MaxTxSetSize, &ledger.ProtocolVersion)
+	return ledger, err
+}
+
+// ScanTransaction reads a row of TransactionColumns
+func ScanTransaction(row rowScanner) (models.Transaction, error) {
+	var tx models.Transaction
+	var memoType, memoValue sql.NullString
+	if err := row.Scan(&tx.ID, &tx.Hash, &tx.Ledger, &tx.Index, &tx.SourceAccount, &tx.FeePaid,
+		&tx.OperationCount, &tx.CreatedAt, &memoType, &memoValue, &tx.Successful, &tx.ClosedAt); err != nil {
+		return tx, err
+	}
+	tx.MemoType = memoType.String
+	tx.MemoValue = memoValue.String
+	return tx, nil
+}
+
+// ScanOperation reads a row of OperationColumns
+func ScanOperation(row rowScanner) (models.Operation, error) {
+	var op models.Operation
+	var sourceAccount sql.NullString
+	if err := row.Scan(&op.ID, &op.TransactionID, &op.Ledger, &op.TransactionIndex, &op.Index,
+		&op.Type, &sourceAccount, &op.Details, &op.ClosedAt); err != nil {
+		return op, err
+	}
+	op.SourceAccount = sourceAccount.String
+	return op, nil
+}
+
+// ScanOperations reads rows of OperationColumns with their page keys,
+// skipping rows that fail to scan
+func ScanOperations(rows *sql.Rows) ([]models.Operation, [][]int64) {
+	var operations []models.Operation
+	var keys [][]int64
+	for rows.Next() {
+		if op, err := ScanOperation(rows); err == nil {
+			operations = append(operations, op)
+			keys = append(keys, []int64{int64(op.Ledger), int64(op.TransactionIndex), int64(op.Index)})
+		}
+	}
+	return operations, keys
+}
+
+// ScanContractEvent reads a row of ContractEventColumns, failing when its
+// topics do not decode
+func ScanContractEvent(row rowScanner) (models.ContractEvent, error) {
+	var event models.ContractEvent
+	var topicsJSON, dataJSON, decodedJSON []byte
+	if err := row.Scan(&event.ID, &event.ContractID, &event.Ledger,
+		&event.TransactionHash, &event.EventType, &topicsJSON, &dataJSON, &event.InSuccessfulTx,
+		&event.InSuccessfulContractCall, &event.TransactionIndex, &event.OperationIndex, &event.EventIndex,
+		&event.ClosedAt, &event.Decoder, &decodedJSON); err != nil {
+		return event, err
+	}
+	if err := json.Unmarshal(topicsJSON, &event.Topics); err != nil {
+		return event, err
+	}
+	if normalized, err := NormalizeContractID(event.ContractID); err == nil {
+		event.ContractID = normalized
+	}
+	event.Data = dataJSON
+	if len(decodedJSON) > 0 {
+		event.Decoded = decodedJSON
+	}
+	return event, nil
+}
+
+// ScanContractEvents reads rows of ContractEventColumns with their page
+// keys, skipping rows that fail to scan or decode
+func ScanContractEvents(rows *sql.Rows) ([]models.ContractEvent, [][]int64) {
+	var events []models.ContractEvent
+	var keys [][]int64
+	for rows.Next() {
+		if event, err := ScanContractEvent(rows); err == nil {
+			events = append(events, event)
+			keys = append(keys, []int64{int64(event.Ledger), int64(event.TransactionIndex), int64(event.EventIndex)})
+		}
+	}
+	return events, keys
+}
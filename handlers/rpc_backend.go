@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	defaultRPCPageSize     = 200
+	defaultRPCPollInterval = time.Second
+	defaultRPCRetryDelay   = time.Second
+)
+
+// RPCBackendConfig configures a ledger backend reading from Stellar RPC
+type RPCBackendConfig struct {
+	ServerURL     string
+	PageSize      uint32        // Ledgers requested per getLedgers call
+	PollInterval  time.Duration // Wait between polls once the backend reaches the network tip
+	RetryAttempts int           // Retries after a failed request; 0 uses the default
+	RetryDelay    time.Duration // Initial retry delay, doubled on every attempt
+	HTTPClient    *http.Client
+}
+
+// RPCLedgerBackend is a backends.LedgerBackend that pages LedgerCloseMeta out
+// of the Stellar RPC getLedgers method. Only ledgers inside the server's
+// retention window are available.
+type RPCLedgerBackend struct {
+	config RPCBackendConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	prepared  *backends.Range
+	buffer    map[uint32]xdr.LedgerCloseMeta
+	cursor    string // getLedgers cursor following the last fetched page
+	nextSeq   uint32 // first sequence not yet fetched when cursor is set
+	latestSeq uint32 // latest ledger the server reported
+	closed    bool
+}
+
+// NewRPCLedgerBackend creates a backend for the RPC server in cfg
+func NewRPCLedgerBackend(cfg RPCBackendConfig) *RPCLedgerBackend {
+	if cfg.PageSize == 0 {
+		cfg.PageSize = defaultRPCPageSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultRPCPollInterval
+	}
+	if cfg.RetryAttempts == 0 {
+		cfg.RetryAttempts = defaultRetryAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRPCRetryDelay
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &RPCLedgerBackend{
+		config: cfg,
+		client: client,
+		buffer: make(map[uint32]xdr.LedgerCloseMeta),
+	}
+}
+
+// JSON-RPC wire types
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message) }
+
+type rpcPagination struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  uint32 `json:"limit"`
+}
+
+type rpcGetLedgersParams struct {
+	StartLedger uint32        `json:"startLedger,omitempty"`
+	Pagination  rpcPagination `json:"pagination"`
+}
+
+type rpcLedgerInfo struct {
+	Hash        string `json:"hash"`
+	Sequence    uint32 `json:"sequence"`
+	MetadataXDR string `json:"metadataXdr"`
+}
+
+type rpcGetLedgersResult struct {
+	Ledgers      []rpcLedgerInfo `json:"ledgers"`
+	LatestLedger uint32          `json:"latestLedger"`
+	OldestLedger uint32          `json:"oldestLedger"`
+	Cursor       string          `json:"cursor"`
+}
+
+type rpcGetHealthResult struct {
+	Status       string `json:"status"`
+	LatestLedger uint32 `json:"latestLedger"`
+	OldestLedger uint32 `json:"oldestLedger"`
+}
+
+type rpcGetLatestLedgerResult struct {
+	Sequence uint32 `json:"sequence"`
+}
+
+func (b *RPCLedgerBackend) GetLatestLedgerSequence(ctx context.Context) (uint32, error) {
+	var result rpcGetLatestLedgerResult
+	if err := b.call(ctx, "getLatestLedger", nil, &result); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.latestSeq = result.Sequence
+	b.mu.Unlock()
+	return result.Sequence, nil
+}
+
+// PrepareRange checks that the start of the range is still retained by the
+// server and resets any buffered ledgers
+func (b *RPCLedgerBackend) PrepareRange(ctx context.Context, ledgerRange backends.Range) error {
+	var health rpcGetHealthResult
+	if err := b.call(ctx, "getHealth", nil, &health); err != nil {
+		return fmt.Errorf("rpc server not available: %w", err)
+	}
+	if ledgerRange.From() < health.OldestLedger {
+		return fmt.Errorf("ledger %d is older than the rpc retention window (oldest %d)", ledgerRange.From(), health.OldestLedger)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("rpc backend is closed")
+	}
+	b.prepared = &ledgerRange
+	b.buffer = make(map[uint32]xdr.LedgerCloseMeta)
+	b.cursor = ""
+	b.nextSeq = 0
+	b.latestSeq = health.LatestLedger
+	return nil
+}
+
+func (b *RPCLedgerBackend) IsPrepared(ctx context.Context, ledgerRange backends.Range) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.prepared == nil || b.closed {
+		return false, nil
+	}
+	if ledgerRange.From() < b.prepared.From() {
+		return false, nil
+	}
+	if !b.prepared.Bounded() {
+		return true, nil
+	}
+	return ledgerRange.Bounded() && ledgerRange.To() <= b.prepared.To(), nil
+}
+
+// GetLedger returns the requested ledger, fetching a page of ledgers when it
+// is not buffered. For ledgers past the network tip it polls until the
+// ledger closes or ctx is cancelled.
+func (b *RPCLedgerBackend) GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return xdr.LedgerCloseMeta{}, errors.New("rpc backend is closed")
+	}
+	if b.prepared == nil {
+		b.mu.Unlock()
+		return xdr.LedgerCloseMeta{}, errors.New("ledger range not prepared")
+	}
+	if sequence < b.prepared.From() || (b.prepared.Bounded() && sequence > b.prepared.To()) {
+		b.mu.Unlock()
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("ledger %d is outside the prepared range %d-%d", sequence, b.prepared.From(), b.prepared.To())
+	}
+	b.mu.Unlock()
+
+	for {
+		if lcm, ok := b.takeBuffered(sequence); ok {
+			return lcm, nil
+		}
+
+		b.mu.Lock()
+		latest := b.latestSeq
+		b.mu.Unlock()
+		if sequence > latest {
+			var err error
+			if latest, err = b.GetLatestLedgerSequence(ctx); err != nil {
+				return xdr.LedgerCloseMeta{}, err
+			}
+		}
+		if sequence > latest {
+			if err := sleepContext(ctx, b.config.PollInterval); err != nil {
+				return xdr.LedgerCloseMeta{}, err
+			}
+			continue
+		}
+
+		fetched, err := b.fetchPage(ctx, sequence)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+		if fetched == 0 {
+			if err := sleepContext(ctx, b.config.PollInterval); err != nil {
+				return xdr.LedgerCloseMeta{}, err
+			}
+		}
+	}
+}
+
+func (b *RPCLedgerBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.prepared = nil
+	b.buffer = make(map[uint32]xdr.LedgerCloseMeta)
+	return nil
+}
+
+// takeBuffered pops a buffered ledger and drops everything before it
+func (b *RPCLedgerBackend) takeBuffered(sequence uint32) (xdr.LedgerCloseMeta, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lcm, ok := b.buffer[sequence]
+	if !ok {
+		return xdr.LedgerCloseMeta{}, false
+	}
+	for seq := range b.buffer {
+		if seq <= sequence {
+			delete(b.buffer, seq)
+		}
+	}
+	return lcm, true
+}
+
+// fetchPage loads one getLedgers page starting at sequence into the buffer.
+// Sequential reads continue from the previous page's cursor.
+func (b *RPCLedgerBackend) fetchPage(ctx context.Context, sequence uint32) (int, error) {
+	b.mu.Lock()
+	params := rpcGetLedgersParams{Pagination: rpcPagination{Limit: b.config.PageSize}}
+	if b.cursor != "" && b.nextSeq == sequence {
+		params.Pagination.Cursor = b.cursor
+	} else {
+		params.StartLedger = sequence
+	}
+	b.mu.Unlock()
+
+	var result rpcGetLedgersResult
+	if err := b.call(ctx, "getLedgers", params, &result); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if result.LatestLedger > b.latestSeq {
+		b.latestSeq = result.LatestLedger
+	}
+	for _, info := range result.Ledgers {
+		var lcm xdr.LedgerCloseMeta
+		if err := xdr.SafeUnmarshalBase64(info.MetadataXDR, &lcm); err != nil {
+			return 0, fmt.Errorf("failed to decode ledger %d metadata: %w", info.Sequence, err)
+		}
+		b.buffer[info.Sequence] = lcm
+		b.nextSeq = info.Sequence + 1
+	}
+	if len(result.Ledgers) > 0 {
+		b.cursor = result.Cursor
+	}
+	return len(result.Ledgers), nil
+}
+
+// call performs a JSON-RPC request, retrying transport and server failures
+// with exponential backoff. JSON-RPC errors are returned immediately.
+func (b *RPCLedgerBackend) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	var err error
+	delay := b.config.RetryDelay
+	for attempt := 0; attempt <= b.config.RetryAttempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+				return sleepErr
+			}
+			delay *= 2
+		}
+		err = b.doCall(ctx, method, params, result)
+		var rpcErr *rpcError
+		if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", method, b.config.RetryAttempts+1, err)
+}
+
+func (b *RPCLedgerBackend) doCall(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.config.ServerURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", method, resp.StatusCode)
+	}
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRPCServer serves getHealth, getLatestLedger and getLedgers for ledgers
+// oldest..latest
+type fakeRPCServer struct {
+	t        *testing.T
+	mu       sync.Mutex
+	oldest   uint32
+	latest   uint32
+	failures int // Requests to fail with HTTP 503 before answering
+	calls    map[string]int
+	params   []rpcGetLedgersParams
+}
+
+func (f *fakeRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&req))
+	f.calls[req.Method]++
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "getHealth":
+		result = rpcGetHealthResult{Status: "healthy", OldestLedger: f.oldest, LatestLedger: f.latest}
+	case "getLatestLedger":
+		result = rpcGetLatestLedgerResult{Sequence: f.latest}
+	case "getLedgers":
+		var params rpcGetLedgersParams
+		require.NoError(f.t, json.Unmarshal(req.Params, &params))
+		f.params = append(f.params, params)
+		start := params.StartLedger
+		if params.Pagination.Cursor != "" {
+			var cursor uint32
+			require.NoError(f.t, json.Unmarshal([]byte(params.Pagination.Cursor), &cursor))
+			start = cursor + 1
+		}
+		page := rpcGetLedgersResult{LatestLedger: f.latest, OldestLedger: f.oldest}
+		for seq := start; seq <= f.latest && uint32(len(page.Ledgers)) < params.Pagination.Limit; seq++ {
+			lcm := xdr.LedgerCloseMeta{
+				V: 0,
+				V0: &xdr.LedgerCloseMetaV0{
+					LedgerHeader: xdr.LedgerHeaderHistoryEntry{Header: xdr.LedgerHeader{LedgerSeq: xdr.Uint32(seq)}},
+				},
+			}
+			encoded, err := xdr.MarshalBase64(lcm)
+			require.NoError(f.t, err)
+			page.Ledgers = append(page.Ledgers, rpcLedgerInfo{Sequence: seq, MetadataXDR: encoded})
+			cursorJSON, _ := json.Marshal(seq)
+			page.Cursor = string(cursorJSON)
+		}
+		result = page
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0", "id": 1,
+			"error": map[string]interface{}{"code": -32601, "message": "method not found"},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+func newTestRPCBackend(t *testing.T, oldest, latest uint32) (*RPCLedgerBackend, *fakeRPCServer) {
+	fake := &fakeRPCServer{t: t, oldest: oldest, latest: latest, calls: map[string]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	backend := NewRPCLedgerBackend(RPCBackendConfig{
+		ServerURL:     server.URL,
+		PageSize:      3,
+		PollInterval:  10 * time.Millisecond,
+		RetryAttempts: 2,
+		RetryDelay:    time.Millisecond,
+	})
+	return backend, fake
+}
+
+func TestRPCLedgerBackendPagesLedgers(t *testing.T) {
+	backend, fake := newTestRPCBackend(t, 100, 110)
+	ctx := context.Background()
+
+	require.NoError(t, backend.PrepareRange(ctx, backends.BoundedRange(102, 108)))
+
+	prepared, err := backend.IsPrepared(ctx, backends.BoundedRange(103, 108))
+	require.NoError(t, err)
+	assert.True(t, prepared)
+	prepared, err = backend.IsPrepared(ctx, backends.UnboundedRange(102))
+	require.NoError(t, err)
+	assert.False(t, prepared)
+
+	for seq := uint32(102); seq <= 108; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		assert.Equal(t, seq, lcm.LedgerSequence())
+	}
+
+	// Pages of three: 102-104 by start ledger, then 105-107 and 108-110 by cursor
+	require.Len(t, fake.params, 3)
+	assert.Equal(t, uint32(102), fake.params[0].StartLedger)
+	assert.NotEmpty(t, fake.params[1].Pagination.Cursor)
+	assert.NotEmpty(t, fake.params[2].Pagination.Cursor)
+
+	_, err = backend.GetLedger(ctx, 109)
+	assert.Error(t, err, "ledger outside the bounded range")
+}
+
+func TestRPCLedgerBackendRetentionWindow(t *testing.T) {
+	backend, _ := newTestRPCBackend(t, 100, 110)
+
+	err := backend.PrepareRange(context.Background(), backends.UnboundedRange(50))
+	assert.Error(t, err)
+
+	_, err = backend.GetLedger(context.Background(), 101)
+	assert.Error(t, err, "range was never prepared")
+}
+
+func TestRPCLedgerBackendRetries(t *testing.T) {
+	backend, fake := newTestRPCBackend(t, 100, 110)
+	fake.failures = 2
+
+	latest, err := backend.GetLatestLedgerSequence(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(110), latest)
+	assert.Equal(t, 3, fake.calls["getLatestLedger"])
+
+	fake.failures = 5
+	_, err = backend.GetLatestLedgerSequence(context.Background())
+	assert.Error(t, err)
+}
+
+func TestRPCLedgerBackendWaitsForTip(t *testing.T) {
+	backend, fake := newTestRPCBackend(t, 100, 110)
+	require.NoError(t, backend.PrepareRange(context.Background(), backends.UnboundedRange(110)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := backend.GetLedger(ctx, 111)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	fake.mu.Lock()
+	fake.latest = 111
+	fake.mu.Unlock()
+	lcm, err := backend.GetLedger(context.Background(), 111)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(111), lcm.LedgerSequence())
+}
+
+func TestNewLedgerBackend(t *testing.T) {
+	backend, err := newLedgerBackend(&Config{})
+	require.NoError(t, err)
+	assert.Nil(t, backend)
+
+	backend, err = newLedgerBackend(&Config{RPCServerURL: "http://localhost:8000"})
+	require.NoError(t, err)
+	assert.IsType(t, &RPCLedgerBackend{}, backend)
+	// Unset retries take the default
+	assert.Equal(t, defaultRetryAttempts, backend.(*RPCLedgerBackend).config.RetryAttempts)
+
+	backend, err = newLedgerBackend(&Config{RPCServerURL: "http://localhost:8000", RetryAttempts: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.(*RPCLedgerBackend).config.RetryAttempts)
+	// Every backend reads 0 as the default
+	assert.Equal(t, defaultRetryAttempts, (&Config{LedgerBackend: BackendDatastore}).retryAttempts())
+
+	_, err = newLedgerBackend(&Config{LedgerBackend: BackendRPC})
+	assert.Error(t, err)
+
+	_, err = newLedgerBackend(&Config{LedgerBackend: "horizon"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+// tokenEventTopics are the first topics of the SEP-41 token events decoded
+// by tokenDecoder
+var tokenEventTopics = []string{"transfer", "mint", "burn", "clawback", "approve"}
+
+// TokenEvent is the decoded form of a SEP-41 token event. Amounts are
+// decimal strings. Asset is the SEP-11 asset of Stellar Asset Contract events.
+type TokenEvent struct {
+	Event           string `json:"event"`
+	Admin           string `json:"admin,omitempty"`
+	From            string `json:"from,omitempty"`
+	To              string `json:"to,omitempty"`
+	Spender         string `json:"spender,omitempty"`
+	Asset           string `json:"asset,omitempty"`
+	Amount          string `json:"amount"`
+	ToMuxedID       string `json:"to_muxed_id,omitempty"`
+	LiveUntilLedger uint32 `json:"live_until_ledger,omitempty"`
+}
+
+// tokenDecoder decodes the transfer, mint, burn, clawback and approve events
+// of SEP-41 tokens, including Stellar Asset Contracts before and after
+// CAP-67 dropped the admin topic from mint and clawback
+type tokenDecoder struct{}
+
+func (tokenDecoder) Name() string { return "sep41" }
+
+func (tokenDecoder) Decode(event xdr.ContractEvent) (interface{}, bool) {
+	if event.Body.V0 == nil || len(event.Body.V0.Topics) == 0 {
+		return nil, false
+	}
+	topics := event.Body.V0.Topics
+	sym, ok := topics[0].GetSym()
+	if !ok {
+		return nil, false
+	}
+	decoded := TokenEvent{Event: string(sym)}
+	var addresses []string
+	for _, topic := range topics[1:] {
+		if addr, ok := scAddress(topic); ok {
+			addresses = append(addresses, addr)
+		} else if s, ok := topic.GetStr(); ok {
+			decoded.Asset = string(s)
+		} else {
+			return nil, false
+		}
+	}
+
+	data := event.Body.V0.Data
+	switch decoded.Event {
+	case "transfer":
+		if len(addresses) != 2 {
+			return nil, false
+		}
+		decoded.From, decoded.To = addresses[0], addresses[1]
+		// CAP-67 transfers to muxed accounts carry the amount in a map
+		if m, ok := data.GetMap(); ok && m != nil {
+			for _, entry := range *m {
+				switch scval.String(entry.Key) {
+				case "amount":
+					data = entry.Val
+				case "to_muxed_id":
+					decoded.ToMuxedID = scval.String(entry.Val)
+				}
+			}
+		}
+	case "mint":
+		switch len(addresses) {
+		case 1:
+			decoded.To = addresses[0]
+		case 2:
+			decoded.Admin, decoded.To = addresses[0], addresses[1]
+		default:
+			return nil, false
+		}
+	case "burn":
+		if len(addresses) != 1 {
+			return nil, false
+		}
+		decoded.From = addresses[0]
+	case "clawback":
+		switch len(addresses) {
+		case 1:
+			decoded.From = addresses[0]
+		case 2:
+			decoded.Admin, decoded.From = addresses[0], addresses[1]
+		default:
+			return nil, false
+		}
+	case "approve":
+		if len(addresses) != 2 {
+			return nil, false
+		}
+		decoded.From, decoded.Spender = addresses[0], addresses[1]
+		vec, ok := data.GetVec()
+		if !ok || vec == nil || len(*vec) != 2 {
+			return nil, false
+		}
+		liveUntil, ok := (*vec)[1].GetU32()
+		if !ok {
+			return nil, false
+		}
+		data, decoded.LiveUntilLedger = (*vec)[0], uint32(liveUntil)
+	default:
+		return nil, false
+	}
+
+	amount, ok := data.GetI128()
+	if !ok {
+		return nil, false
+	}
+	decoded.Amount = scval.I128String(amount)
+	return decoded, true
+}
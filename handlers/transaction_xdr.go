@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/stellar/go/xdr"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+// ErrTransactionNotFound is returned for transactions that are not stored
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// Stages of the ledger entry changes of a transaction's meta
+const (
+	ChangeStageBefore    = "before"
+	ChangeStageOperation = "operation"
+	ChangeStageAfter     = "after"
+)
+
+var ledgerEntryChangeTypeNames = map[xdr.LedgerEntryChangeType]string{
+	xdr.LedgerEntryChangeTypeLedgerEntryCreated:  "created",
+	xdr.LedgerEntryChangeTypeLedgerEntryUpdated:  "updated",
+	xdr.LedgerEntryChangeTypeLedgerEntryRemoved:  "removed",
+	xdr.LedgerEntryChangeTypeLedgerEntryState:    "state",
+	xdr.LedgerEntryChangeTypeLedgerEntryRestored: "restored",
+}
+
+// GetTransactionXDR returns the envelope, result and meta XDR stored for a
+// transaction
+func GetTransactionXDR(ctx context.Context, db *sql.DB, hash string) (models.TransactionXDR, error) {
+	raw := models.TransactionXDR{}
+	var envelope, result, meta []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT hash, envelope_xdr, result_xdr, result_meta_xdr
+		FROM transactions WHERE hash = $1`, hash).Scan(&raw.Hash, &envelope, &result, &meta)
+	if err == sql.ErrNoRows {
+		return raw, ErrTransactionNotFound
+	}
+	if err != nil {
+		return raw, err
+	}
+	raw.EnvelopeXDR = base64.StdEncoding.EncodeToString(envelope)
+	raw.ResultXDR = base64.StdEncoding.EncodeToString(result)
+	raw.ResultMetaXDR = base64.StdEncoding.EncodeToString(meta)
+	return raw, nil
+}
+
+// DecodeTransactionXDR decodes the XDR of a transaction to JSON values.
+// Struct fields are keyed in snake_case and only the set arm of a union is
+// kept; enums are named, 64-bit integers are decimal strings, fixed-size
+// byte arrays are hex and other bytes base64. Accounts and addresses are
+// strkeys and ScVals take the typed form of the scval package.
+func DecodeTransactionXDR(raw models.TransactionXDR) (models.DecodedTransactionXDR, error) {
+	decoded := models.DecodedTransactionXDR{Hash: raw.Hash}
+	var envelope xdr.TransactionEnvelope
+	if err := xdr.SafeUnmarshalBase64(raw.EnvelopeXDR, &envelope); err != nil {
+		return decoded, fmt.Errorf("decode envelope: %w", err)
+	}
+	var result xdr.TransactionResultPair
+	if err := xdr.SafeUnmarshalBase64(raw.ResultXDR, &result); err != nil {
+		return decoded, fmt.Errorf("decode result: %w", err)
+	}
+	var meta xdr.TransactionMeta
+	if err := xdr.SafeUnmarshalBase64(raw.ResultMetaXDR, &meta); err != nil {
+		return decoded, fmt.Errorf("decode meta: %w", err)
+	}
+	decoded.Envelope = xdrJSON(reflect.ValueOf(envelope))
+	decoded.Result = xdrJSON(reflect.ValueOf(result))
+	decoded.ResultMeta = xdrJSON(reflect.ValueOf(meta))
+	decoded.ResultCode = enumName(reflect.ValueOf(result.Result.Result.Code))
+	decoded.OperationResults = operationResults(result)
+	decoded.Changes = metaChanges(meta)
+	return decoded, nil
+}
+
+// operationResults returns the result codes of the operations of a
+// transaction, empty when it failed before they were applied
+func operationResults(result xdr.TransactionResultPair) []models.OperationResult {
+	opResults, _ := result.OperationResults()
+	results := make([]models.OperationResult, 0, len(opResults))
+	for idx, opResult := range opResults {
+		r := models.OperationResult{Index: idx, Code: enumName(reflect.ValueOf(opResult.Code))}
+		if opResult.Tr != nil {
+			r.Type = operationTypeName(opResult.Tr.Type)
+			// The result of the operation is the set arm after the type
+			tr := reflect.ValueOf(*opResult.Tr)
+			for f := 1; f < tr.NumField(); f++ {
+				if arm := tr.Field(f); arm.Kind() == reflect.Ptr && !arm.IsNil() {
+					if code := arm.Elem().FieldByName("Code"); code.IsValid() {
+						r.ResultCode = enumName(code)
+					}
+					break
+				}
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// metaChanges lists the ledger entry changes of a transaction's meta in the
+// order they were applied
+func metaChanges(meta xdr.TransactionMeta) []models.LedgerEntryChange {
+	var before, after xdr.LedgerEntryChanges
+	var operations []xdr.LedgerEntryChanges
+	addOperations := func(ops []xdr.OperationMeta) {
+		for _, op := range ops {
+			operations = append(operations, op.Changes)
+		}
+	}
+	switch {
+	case meta.V4 != nil:
+		before, after = meta.V4.TxChangesBefore, meta.V4.TxChangesAfter
+		for _, op := range meta.V4.Operations {
+			operations = append(operations, op.Changes)
+		}
+	case meta.V3 != nil:
+		before, after = meta.V3.TxChangesBefore, meta.V3.TxChangesAfter
+		addOperations(meta.V3.Operations)
+	case meta.V2 != nil:
+		before, after = meta.V2.TxChangesBefore, meta.V2.TxChangesAfter
+		addOperations(meta.V2.Operations)
+	case meta.V1 != nil:
+		before = meta.V1.TxChanges
+		addOperations(meta.V1.Operations)
+	case meta.Operations != nil:
+		addOperations(*meta.Operations)
+	}
+
+	changes := []models.LedgerEntryChange{}
+	changes = appendChanges(changes, ChangeStageBefore, nil, before)
+	for idx := range operations {
+		opIndex := idx
+		changes = appendChanges(changes, ChangeStageOperation, &opIndex, operations[idx])
+	}
+	return appendChanges(changes, ChangeStageAfter, nil, after)
+}
+
+func appendChanges(changes []models.LedgerEntryChange, stage string, operation *int, entries xdr.LedgerEntryChanges) []models.LedgerEntryChange {
+	for _, entry := range entries {
+		change := models.LedgerEntryChange{Stage: stage, Operation: operation, Type: ledgerEntryChangeTypeNames[entry.Type]}
+		var ledgerEntry *xdr.LedgerEntry
+		switch entry.Type {
+		case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+			ledgerEntry = entry.Created
+		case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+			ledgerEntry = entry.Updated
+		case xdr.LedgerEntryChangeTypeLedgerEntryState:
+			ledgerEntry = entry.State
+		case xdr.LedgerEntryChangeTypeLedgerEntryRestored:
+			ledgerEntry = entry.Restored
+		case xdr.LedgerEntryChangeTypeLedgerEntryRemoved:
+			if entry.Removed != nil {
+				change.EntryType = ledgerEntryTypeNames[entry.Removed.Type]
+				change.KeyHash, _ = keyHash(*entry.Removed)
+				change.Key = xdrJSON(reflect.ValueOf(*entry.Removed))
+			}
+		}
+		if ledgerEntry != nil {
+			change.EntryType = ledgerEntryTypeNames[ledgerEntry.Data.Type]
+			change.KeyHash, _ = ledgerKeyHash(*ledgerEntry)
+			change.Entry = xdrJSON(reflect.ValueOf(*ledgerEntry))
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// xdrJSON converts an XDR value to values encoding/json writes as described
+// on DecodeTransactionXDR
+func xdrJSON(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch x := v.Interface().(type) {
+	case xdr.ScVal:
+		if typed, err := scval.Encode(x); err == nil {
+			return typed
+		}
+		return scval.ToNative(x)
+	case xdr.ScAddress:
+		if address, err := scval.AddressString(x); err == nil {
+			return address
+		}
+	case xdr.AccountId:
+		if address, err := x.GetAddress(); err == nil {
+			return address
+		}
+	case xdr.MuxedAccount:
+		if address, err := x.GetAddress(); err == nil {
+			return address
+		}
+	case xdr.Asset:
+		return assetModel(x)
+	case fmt.Stringer:
+		if v.Kind() == reflect.Int32 {
+			return enumName(v)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return xdrJSON(v.Elem())
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+		for f := 0; f < v.NumField(); f++ {
+			field := v.Type().Field(f)
+			value := v.Field(f)
+			if !field.IsExported() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+				continue
+			}
+			fields[snakeCase(field.Name)] = xdrJSON(value)
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			if v.Kind() == reflect.Array {
+				return hex.EncodeToString(b)
+			}
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		items := make([]interface{}, v.Len())
+		for idx := range items {
+			items[idx] = xdrJSON(v.Index(idx))
+		}
+		return items
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	// 64-bit integers such as amounts and fees exceed what JSON numbers
+	// hold exactly, so they are decimal strings
+	case reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return v.Uint()
+	}
+	return nil
+}
+
+// enumName returns the snake_case name of an XDR enum value without its type
+// prefix, as in tx_success for TransactionResultCodeTxSuccess, or its number
+// when it has no name
+func enumName(v reflect.Value) string {
+	name := v.Interface().(fmt.Stringer).String()
+	if name == "" {
+		return strconv.FormatInt(v.Int(), 10)
+	}
+	return snakeCase(strings.TrimPrefix(name, v.Type().Name()))
+}
+
+// snakeCase converts a Go identifier such as SorobanData or TxV0 to
+// soroban_data or tx_v0
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for idx, r := range runes {
+		if unicode.IsUpper(r) {
+			if idx > 0 {
+				prev := runes[idx-1]
+				nextLower := idx+1 < len(runes) && unicode.IsLower(runes[idx+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
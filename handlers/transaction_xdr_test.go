@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/daccred/sorobangraph.attest.so/scval"
+)
+
+func TestGetTransactionXDR(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	columns := []string{"hash", "envelope_xdr", "result_xdr", "result_meta_xdr"}
+	mock.ExpectQuery("FROM transactions WHERE hash").WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", []byte{1, 2}, []byte{3}, []byte{}))
+	mock.ExpectQuery("FROM transactions WHERE hash").WithArgs("def").WillReturnRows(sqlmock.NewRows(columns))
+
+	raw, err := GetTransactionXDR(context.Background(), mockDB, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionXDR{Hash: "abc", EnvelopeXDR: "AQI=", ResultXDR: "Aw=="}, raw)
+
+	_, err = GetTransactionXDR(context.Background(), mockDB, "def")
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecodeTransactionXDR(t *testing.T) {
+	contract := xdr.ContractId{1}
+	args := []xdr.ScVal{scAccount(testAccount)}
+	envelope := xdr.TransactionEnvelope{
+		Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+		V1: &xdr.TransactionV1Envelope{
+			Tx: xdr.Transaction{
+				SourceAccount: xdr.MustMuxedAddress(testAccount),
+				Fee:           100,
+				Operations: []xdr.Operation{{Body: xdr.OperationBody{
+					Type: xdr.OperationTypeInvokeHostFunction,
+					InvokeHostFunctionOp: &xdr.InvokeHostFunctionOp{HostFunction: xdr.HostFunction{
+						Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract,
+						InvokeContract: &xdr.InvokeContractArgs{
+							ContractAddress: xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contract},
+							FunctionName:    "attest",
+							Args:            args,
+						},
+					}},
+				}}},
+			},
+			Signatures: []xdr.DecoratedSignature{{Hint: [4]byte{1, 2, 3, 4}, Signature: []byte("sig")}},
+		},
+	}
+	opResults := []xdr.OperationResult{{Code: xdr.OperationResultCodeOpInner, Tr: &xdr.OperationResultTr{
+		Type:                     xdr.OperationTypeInvokeHostFunction,
+		InvokeHostFunctionResult: &xdr.InvokeHostFunctionResult{Code: xdr.InvokeHostFunctionResultCodeInvokeHostFunctionSuccess, Success: &xdr.Hash{}},
+	}}}
+	result := xdr.TransactionResultPair{Result: xdr.TransactionResult{
+		FeeCharged: 90,
+		Result:     xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxSuccess, Results: &opResults},
+	}}
+	account := &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeAccount, Account: &xdr.AccountEntry{AccountId: xdr.MustAddress(testAccount), Balance: 1000},
+	}}
+	data := contractDataEntry(contract, symbol("admin"), symbol("GA"), 50)
+	dataKey, err := data.LedgerKey()
+	require.NoError(t, err)
+	meta := xdr.TransactionMeta{V: 3, V3: &xdr.TransactionMetaV3{
+		TxChangesBefore: xdr.LedgerEntryChanges{
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryState, State: account},
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated, Updated: account},
+		},
+		Operations: []xdr.OperationMeta{{Changes: xdr.LedgerEntryChanges{
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryCreated, Created: data},
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryRemoved, Removed: &dataKey},
+		}}},
+	}}
+
+	raw := models.TransactionXDR{Hash: "abc"}
+	raw.EnvelopeXDR, err = xdr.MarshalBase64(envelope)
+	require.NoError(t, err)
+	raw.ResultXDR, err = xdr.MarshalBase64(result)
+	require.NoError(t, err)
+	raw.ResultMetaXDR, err = xdr.MarshalBase64(meta)
+	require.NoError(t, err)
+
+	decoded, err := DecodeTransactionXDR(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", decoded.Hash)
+
+	v1 := decoded.Envelope.(map[string]interface{})["v1"].(map[string]interface{})
+	tx := v1["tx"].(map[string]interface{})
+	assert.Equal(t, testAccount, tx["source_account"])
+	assert.Equal(t, uint64(100), tx["fee"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"hint": "01020304", "signature": base64.StdEncoding.EncodeToString([]byte("sig"))}},
+		v1["signatures"])
+	invoke := tx["operations"].([]interface{})[0].(map[string]interface{})["body"].(map[string]interface{})["invoke_host_function_op"]
+	call := invoke.(map[string]interface{})["host_function"].(map[string]interface{})["invoke_contract"].(map[string]interface{})
+	assert.Equal(t, EncodeContractID(contract), call["contract_address"])
+	assert.Equal(t, "attest", call["function_name"])
+	arg, err := scval.Encode(args[0])
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{arg}, call["args"])
+	assert.Equal(t, "90", decoded.Result.(map[string]interface{})["result"].(map[string]interface{})["fee_charged"])
+
+	assert.Equal(t, "tx_success", decoded.ResultCode)
+	assert.Equal(t, []models.OperationResult{
+		{Index: 0, Type: "invoke_host_function", Code: "op_inner", ResultCode: "invoke_host_function_success"},
+	}, decoded.OperationResults)
+
+	accountHash, err := ledgerKeyHash(*account)
+	require.NoError(t, err)
+	dataHash, err := keyHash(dataKey)
+	require.NoError(t, err)
+	require.Len(t, decoded.Changes, 4)
+	zero := 0
+	for idx, want := range []models.LedgerEntryChange{
+		{Stage: ChangeStageBefore, Type: "state", EntryType: "account", KeyHash: accountHash},
+		{Stage: ChangeStageBefore, Type: "updated", EntryType: "account", KeyHash: accountHash},
+		{Stage: ChangeStageOperation, Operation: &zero, Type: "created", EntryType: "contract_data", KeyHash: dataHash},
+		{Stage: ChangeStageOperation, Operation: &zero, Type: "removed", EntryType: "contract_data", KeyHash: dataHash},
+	} {
+		got := decoded.Changes[idx]
+		assert.Equal(t, want.Stage, got.Stage)
+		assert.Equal(t, want.Operation, got.Operation)
+		assert.Equal(t, want.Type, got.Type)
+		assert.Equal(t, want.EntryType, got.EntryType)
+		assert.Equal(t, want.KeyHash, got.KeyHash)
+	}
+	entry := decoded.Changes[0].Entry.(map[string]interface{})["data"].(map[string]interface{})["account"].(map[string]interface{})
+	assert.Equal(t, testAccount, entry["account_id"])
+	assert.NotNil(t, decoded.Changes[3].Key)
+	assert.Nil(t, decoded.Changes[3].Entry)
+
+	_, err = DecodeTransactionXDR(models.TransactionXDR{EnvelopeXDR: "not base64!"})
+	assert.Error(t, err)
+}
+
+func TestDecodeTransactionXDRMetaV4(t *testing.T) {
+	contract := xdr.ContractId{2}
+	envelope := xdr.TransactionEnvelope{
+		Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+		V1:   &xdr.TransactionV1Envelope{Tx: xdr.Transaction{SourceAccount: xdr.MustMuxedAddress(testAccount), Fee: 100}},
+	}
+	result := xdr.TransactionResultPair{Result: xdr.TransactionResult{
+		Result: xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxSuccess, Results: &[]xdr.OperationResult{}},
+	}}
+	account := &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeAccount, Account: &xdr.AccountEntry{AccountId: xdr.MustAddress(testAccount), Balance: 1000},
+	}}
+	data := contractDataEntry(contract, symbol("admin"), symbol("GA"), 50)
+	meta := xdr.TransactionMeta{V: 4, V4: &xdr.TransactionMetaV4{
+		TxChangesBefore: xdr.LedgerEntryChanges{
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryState, State: account},
+		},
+		Operations: []xdr.OperationMetaV2{
+			{Changes: xdr.LedgerEntryChanges{{Type: xdr.LedgerEntryChangeTypeLedgerEntryRestored, Restored: data}}},
+			{Changes: xdr.LedgerEntryChanges{{Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated, Updated: data}}},
+		},
+		TxChangesAfter: xdr.LedgerEntryChanges{
+			{Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated, Updated: account},
+		},
+	}}
+
+	raw := models.TransactionXDR{Hash: "v4"}
+	var err error
+	raw.EnvelopeXDR, err = xdr.MarshalBase64(envelope)
+	require.NoError(t, err)
+	raw.ResultXDR, err = xdr.MarshalBase64(result)
+	require.NoError(t, err)
+	raw.ResultMetaXDR, err = xdr.MarshalBase64(meta)
+	require.NoError(t, err)
+
+	decoded, err := DecodeTransactionXDR(raw)
+	require.NoError(t, err)
+	assert.Contains(t, decoded.ResultMeta.(map[string]interface{}), "v4")
+
+	accountHash, err := ledgerKeyHash(*account)
+	require.NoError(t, err)
+	dataHash, err := ledgerKeyHash(*data)
+	require.NoError(t, err)
+	require.Len(t, decoded.Changes, 4)
+	zero, one := 0, 1
+	for idx, want := range []models.LedgerEntryChange{
+		{Stage: ChangeStageBefore, Type: "state", EntryType: "account", KeyHash: accountHash},
+		{Stage: ChangeStageOperation, Operation: &zero, Type: "restored", EntryType: "contract_data", KeyHash: dataHash},
+		{Stage: ChangeStageOperation, Operation: &one, Type: "updated", EntryType: "contract_data", KeyHash: dataHash},
+		{Stage: ChangeStageAfter, Type: "updated", EntryType: "account", KeyHash: accountHash},
+	} {
+		got := decoded.Changes[idx]
+		assert.Equal(t, want.Stage, got.Stage)
+		assert.Equal(t, want.Operation, got.Operation)
+		assert.Equal(t, want.Type, got.Type)
+		assert.Equal(t, want.EntryType, got.EntryType)
+		assert.Equal(t, want.KeyHash, got.KeyHash)
+	}
+	restored := decoded.Changes[1].Entry.(map[string]interface{})["data"].(map[string]interface{})["contract_data"].(map[string]interface{})
+	assert.Equal(t, EncodeContractID(contract), restored["contract"])
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"SorobanData":        "soroban_data",
+		"TxV0":               "tx_v0",
+		"V1":                 "v1",
+		"ContractIDPreimage": "contract_id_preimage",
+		"Ed25519":            "ed25519",
+		"TxFeeBumpInnerFail": "tx_fee_bump_inner_fail",
+	} {
+		assert.Equal(t, want, snakeCase(in), in)
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+)
+
+const (
+	defaultWSBufferSize = 1024
+	defaultWSWriteWait  = 10 * time.Second
+	defaultWSPongWait   = 60 * time.Second
+	maxWSMessageSize    = 4096
+)
+
+// WebSocketConfig holds the buffer and keepalive settings for streaming clients
+type WebSocketConfig struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	WriteWait       time.Duration // Time allowed to write a message to the client
+	PongWait        time.Duration // Time allowed to read the next pong from the client
+	PingPeriod      time.Duration // Ping interval, must be shorter than PongWait
+	AllowedOrigins  []string      // Browser origins allowed to connect, as in the CORS config; empty allows only the same host
+}
+
+// withDefaults fills unset values so a zero config is usable
+func (c WebSocketConfig) withDefaults() WebSocketConfig {
+	if c.ReadBufferSize <= 0 {
+		c.ReadBufferSize = defaultWSBufferSize
+	}
+	if c.WriteBufferSize <= 0 {
+		c.WriteBufferSize = defaultWSBufferSize
+	}
+	if c.WriteWait <= 0 {
+		c.WriteWait = defaultWSWriteWait
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = defaultWSPongWait
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		c.PingPeriod = c.PongWait * 9 / 10
+	}
+	return c
+}
+
+// checkOrigin accepts requests without an Origin header, sent by clients
+// other than browsers, and browsers on an allowed origin. CORS does not apply
+// to WebSocket upgrades, so the allow-list is enforced here.
+func (c WebSocketConfig) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(c.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return containsString(c.AllowedOrigins, origin)
+}
+
+// SubscriptionFilter narrows the messages delivered to a WebSocket client.
+// Empty fields match everything, and each field only applies to the message
+// types that carry it: contract IDs and topics to contract events, source
+// accounts to transactions.
+type SubscriptionFilter struct {
+	Types          []string `json:"types,omitempty"`
+	ContractIDs    []string `json:"contract_ids,omitempty"`
+	Topics         []string `json:"topics,omitempty"` // Positional prefix of event topics, "*" matches any value
+	SourceAccounts []string `json:"source_accounts,omitempty"`
+}
+
+// Matches reports whether a broadcast message passes the filter
+func (f SubscriptionFilter) Matches(message interface{}) bool {
+	msg, ok := message.(map[string]interface{})
+	if !ok {
+		return len(f.Types) == 0
+	}
+	msgType, _ := msg["type"].(string)
+	if len(f.Types) > 0 && !containsString(f.Types, msgType) {
+		return false
+	}
+	switch data := msg["data"].(type) {
+	case models.Transaction:
+		return len(f.SourceAccounts) == 0 || containsString(f.SourceAccounts, data.SourceAccount)
+	case models.ContractEvent:
+		if len(f.ContractIDs) > 0 && !containsString(f.ContractIDs, data.ContractID) {
+			return false
+		}
+		return matchesTopicPrefix(f.Topics, data.Topics)
+	}
+	return true
+}
+
+// normalized returns a copy of the filter with contract IDs in the canonical
+// strkey form used by broadcast events, so clients may subscribe with hex
+func (f SubscriptionFilter) normalized() SubscriptionFilter {
+	f.ContractIDs = canonicalContractIDs(f.ContractIDs)
+	return f
+}
+
+func matchesTopicPrefix(prefix, topics []string) bool {
+	if len(prefix) > len(topics) {
+		return false
+	}
+	for idx, want := range prefix {
+		if want != "*" && want != topics[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionRequest is the in-band message a client sends to change its filter
+type subscriptionRequest struct {
+	Action string             `json:"action"` // Only "subscribe" is supported; it replaces the current filter
+	Filter SubscriptionFilter `json:"filter"`
+}
+
+// outbox collects the broadcast messages of a ledger while it is ingested.
+// They are sent once the ledger is committed, so subscribers never see data
+// that was rolled back. A nil outbox discards messages.
+type outbox []interface{}
+
+func (o *outbox) add(messageType string, data interface{}) {
+	if o != nil {
+		*o = append(*o, map[string]interface{}{"type": messageType, "data": data})
+	}
+}
+
+// WebSocket structures
+type WebSocketHub struct {
+	clients    map[*WebSocketClient]bool
+	broadcast  chan interface{}
+	register   chan *WebSocketClient
+	unregister chan *WebSocketClient
+	mu         sync.RWMutex
+	config     WebSocketConfig
+}
+
+type WebSocketClient struct {
+	send   chan interface{}
+	hub    *WebSocketHub
+	conn   *websocket.Conn
+	mu     sync.RWMutex
+	filter SubscriptionFilter
+}
+
+// newWebSocketHub creates a hub and starts its run loop, so clients can
+// register as soon as it is returned
+func newWebSocketHub(cfg WebSocketConfig) *WebSocketHub {
+	hub := &WebSocketHub{
+		clients:    make(map[*WebSocketClient]bool),
+		broadcast:  make(chan interface{}, 256),
+		register:   make(chan *WebSocketClient),
+		unregister: make(chan *WebSocketClient),
+		config:     cfg.withDefaults(),
+	}
+	go hub.run()
+	return hub
+}
+
+func (h *WebSocketHub) run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.mu.Lock()
+			h.clients[client] = true
+			h.mu.Unlock()
+		case client := <-h.unregister:
+			h.mu.Lock()
+			if _, ok := h.clients[client]; ok {
+				delete(h.clients, client)
+				close(client.send)
+			}
+			h.mu.Unlock()
+		case message := <-h.broadcast:
+			h.mu.Lock()
+			for client := range h.clients {
+				if !client.accepts(message) {
+					continue
+				}
+				select {
+				case client.send <- message:
+				default:
+					delete(h.clients, client)
+					close(client.send)
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// ClientCount returns the number of connected clients
+func (h *WebSocketHub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// ServeWS upgrades the request to a WebSocket connection and streams every
+// broadcast message matching filter until the client disconnects. On failure
+// the upgrader has already replied to the client.
+func (h *WebSocketHub) ServeWS(w http.ResponseWriter, r *http.Request, filter SubscriptionFilter) error {
+	cfg := h.config.withDefaults()
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		CheckOrigin:     cfg.checkOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	client := &WebSocketClient{
+		send:   make(chan interface{}, 256),
+		hub:    h,
+		conn:   conn,
+		filter: filter.normalized(),
+	}
+	h.register <- client
+	go client.writePump(cfg)
+	go client.readPump(cfg)
+	return nil
+}
+
+// Subscribe registers an in-process subscriber, such as a GraphQL
+// subscription, for the broadcast messages matching filter. Messages arrive
+// on the returned channel, which is closed once cancel is called or when the
+// subscriber falls too far behind.
+func (h *WebSocketHub) Subscribe(filter SubscriptionFilter) (<-chan interface{}, func()) {
+	client := &WebSocketClient{
+		send:   make(chan interface{}, 256),
+		hub:    h,
+		filter: filter.normalized(),
+	}
+	h.register <- client
+	var once sync.Once
+	return client.send, func() {
+		once.Do(func() { h.unregister <- client })
+	}
+}
+
+func (c *WebSocketClient) accepts(message interface{}) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.filter.Matches(message)
+}
+
+func (c *WebSocketClient) setFilter(filter SubscriptionFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filter = filter.normalized()
+}
+
+// readPump handles pongs and subscription changes until the connection fails
+func (c *WebSocketClient) readPump(cfg WebSocketConfig) {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(maxWSMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req subscriptionRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue // ignore malformed control messages
+		}
+		if req.Action == "subscribe" {
+			c.setFilter(req.Filter)
+		}
+	}
+}
+
+// writePump delivers queued messages and keeps the connection alive with pings
+func (c *WebSocketClient) writePump(cfg WebSocketConfig) {
+	ticker := time.NewTicker(cfg.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case message, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
+			if !ok {
+				// The hub closed the channel
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
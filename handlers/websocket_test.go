@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daccred/sorobangraph.attest.so/models"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionFilterMatches(t *testing.T) {
+	ledgerMsg := map[string]interface{}{"type": "ledger", "data": models.LedgerInfo{Sequence: 10}}
+	txMsg := map[string]interface{}{"type": "transaction", "data": models.Transaction{SourceAccount: "GSOURCE"}}
+	eventMsg := map[string]interface{}{"type": "contract_event", "data": models.ContractEvent{
+		ContractID: "CCONTRACT",
+		Topics:     []string{"attest", "GSUBJECT", "schema1"},
+	}}
+
+	tests := []struct {
+		name     string
+		filter   SubscriptionFilter
+		message  interface{}
+		expected bool
+	}{
+		{"Empty filter matches ledgers", SubscriptionFilter{}, ledgerMsg, true},
+		{"Empty filter matches events", SubscriptionFilter{}, eventMsg, true},
+		{"Type filter excludes other types", SubscriptionFilter{Types: []string{"contract_event"}}, ledgerMsg, false},
+		{"Type filter includes listed type", SubscriptionFilter{Types: []string{"ledger", "transaction"}}, txMsg, true},
+		{"Source account match", SubscriptionFilter{SourceAccounts: []string{"GSOURCE"}}, txMsg, true},
+		{"Source account mismatch", SubscriptionFilter{SourceAccounts: []string{"GOTHER"}}, txMsg, false},
+		{"Source account ignored for events", SubscriptionFilter{SourceAccounts: []string{"GOTHER"}}, eventMsg, true},
+		{"Contract match", SubscriptionFilter{ContractIDs: []string{"CCONTRACT"}}, eventMsg, true},
+		{"Contract mismatch", SubscriptionFilter{ContractIDs: []string{"COTHER"}}, eventMsg, false},
+		{"Contract ignored for ledgers", SubscriptionFilter{ContractIDs: []string{"COTHER"}}, ledgerMsg, true},
+		{"Topic prefix match", SubscriptionFilter{Topics: []string{"attest"}}, eventMsg, true},
+		{"Topic prefix with wildcard", SubscriptionFilter{Topics: []string{"*", "GSUBJECT"}}, eventMsg, true},
+		{"Topic prefix mismatch", SubscriptionFilter{Topics: []string{"revoke"}}, eventMsg, false},
+		{"Topic prefix longer than topics", SubscriptionFilter{Topics: []string{"attest", "GSUBJECT", "schema1", "x"}}, eventMsg, false},
+		{"Unknown message shape with type filter", SubscriptionFilter{Types: []string{"ledger"}}, "raw", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.Matches(tt.message))
+		})
+	}
+}
+
+func TestWebSocketConfigDefaults(t *testing.T) {
+	cfg := WebSocketConfig{}.withDefaults()
+	assert.Equal(t, 1024, cfg.ReadBufferSize)
+	assert.Equal(t, 1024, cfg.WriteBufferSize)
+	assert.Equal(t, 10*time.Second, cfg.WriteWait)
+	assert.Equal(t, 60*time.Second, cfg.PongWait)
+	assert.Less(t, cfg.PingPeriod, cfg.PongWait)
+
+	// A ping period that would outlast the pong deadline is corrected
+	cfg = WebSocketConfig{PongWait: 10 * time.Second, PingPeriod: 20 * time.Second}.withDefaults()
+	assert.Equal(t, 9*time.Second, cfg.PingPeriod)
+}
+
+func TestServeWSStreamsFilteredMessages(t *testing.T) {
+	hub := newWebSocketHub(WebSocketConfig{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = hub.ServeWS(w, r, SubscriptionFilter{Types: []string{"contract_event"}})
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return hub.ClientCount() == 1 }, time.Second, 10*time.Millisecond)
+
+	hub.broadcast <- map[string]interface{}{"type": "ledger", "data": models.LedgerInfo{Sequence: 1}}
+	hub.broadcast <- map[string]interface{}{"type": "contract_event", "data": models.ContractEvent{ID: "evt-1"}}
+
+	var received map[string]interface{}
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	require.NoError(t, conn.ReadJSON(&received))
+	assert.Equal(t, "contract_event", received["type"])
+
+	// Switch the subscription in-band to ledgers only
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"action": "subscribe",
+		"filter": map[string]interface{}{"types": []string{"ledger"}},
+	}))
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		for client := range hub.clients {
+			if !client.accepts(map[string]interface{}{"type": "ledger"}) {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	hub.broadcast <- map[string]interface{}{"type": "contract_event", "data": models.ContractEvent{ID: "evt-2"}}
+	hub.broadcast <- map[string]interface{}{"type": "ledger", "data": models.LedgerInfo{Sequence: 2}}
+
+	received = nil
+	require.NoError(t, conn.ReadJSON(&received))
+	assert.Equal(t, "ledger", received["type"])
+
+	conn.Close()
+	require.Eventually(t, func() bool { return hub.ClientCount() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHubSubscribe(t *testing.T) {
+	hub := newWebSocketHub(WebSocketConfig{})
+
+	messages, cancel := hub.Subscribe(SubscriptionFilter{Types: []string{"ledger"}})
+	hub.broadcast <- map[string]interface{}{"type": "contract_event", "data": models.ContractEvent{ID: "evt-1"}}
+	hub.broadcast <- map[string]interface{}{"type": "ledger", "data": models.LedgerInfo{Sequence: 3}}
+
+	select {
+	case message := <-messages:
+		assert.Equal(t, models.LedgerInfo{Sequence: 3}, message.(map[string]interface{})["data"])
+	case <-time.After(time.Second):
+		t.Fatal("no message delivered")
+	}
+
+	cancel()
+	cancel()
+	_, open := <-messages
+	assert.False(t, open)
+	assert.Equal(t, 0, hub.ClientCount())
+}
+
+func TestServeWSChecksOrigin(t *testing.T) {
+	hub := newWebSocketHub(WebSocketConfig{AllowedOrigins: []string{"http://localhost:3000"}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = hub.ServeWS(w, r, SubscriptionFilter{})
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for origin, allowed := range map[string]bool{
+		"":                      true, // Not a browser
+		"http://localhost:3000": true,
+		"http://evil.example":   false,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if !allowed {
+			require.Error(t, err, origin)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			continue
+		}
+		require.NoError(t, err, origin)
+		conn.Close()
+	}
+
+	// Without an allow-list only the same host is accepted
+	cfg := WebSocketConfig{}
+	req := httptest.NewRequest(http.MethodGet, "http://indexer.example/api/v1/ws", nil)
+	req.Header.Set("Origin", "http://indexer.example")
+	assert.True(t, cfg.checkOrigin(req))
+	req.Header.Set("Origin", "http://localhost:3000")
+	assert.False(t, cfg.checkOrigin(req))
+}
@@ -5,7 +5,6 @@ import (
 	"flag"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -61,45 +60,11 @@ func main() {
 	}
 	defer dbConn.Close()
 
-	// Parse filter contracts from environment variable or config
-	filterContractsEnv := getEnv("FILTER_CONTRACTS", "")
-	var filterContracts []string
-	if filterContractsEnv != "" {
-		// Environment variable takes precedence
-		filterContracts = strings.Split(filterContractsEnv, ",")
-		for i := range filterContracts {
-			filterContracts[i] = strings.TrimSpace(filterContracts[i])
-		}
-	} else {
-		// Read from config file
-		filterContracts = cfg.GetStringSlice("stellar.filter_contracts")
-	}
-
-	// Determine network mode (mainnet vs testnet)
-	networkMode := getEnv("NETWORK_MODE", "testnet")
-	var defaultPassphrase, defaultArchiveURL string
-	
-	if networkMode == "mainnet" {
-		// Mainnet configuration
-		defaultPassphrase = "Public Global Stellar Network ; September 2015"
-		defaultArchiveURL = "https://history.stellar.org/prd/core-live/core_live_001"
-	} else {
-		// Testnet configuration (default)
-		defaultPassphrase = "Test SDF Network ; September 2015"
-		defaultArchiveURL = "https://history.stellar.org/prd/core-testnet/core_testnet_001"
-	}
-	
-	ingCfg := &handlers.Config{
-		NetworkPassphrase:     getEnv("NETWORK_PASSPHRASE", defaultPassphrase),
-		CaptiveCoreConfigPath: getEnv("CAPTIVE_CORE_CONFIG_PATH", cfg.GetString("captive_core.config_path")),
-		CaptiveCoreBinaryPath: getEnv("CAPTIVE_CORE_BINARY_PATH", cfg.GetString("captive_core.binary_path")),
-		HistoryArchiveURLs:    []string{getEnv("HISTORY_ARCHIVE_URLS", defaultArchiveURL)},
-		StartLedger:           uint32(getEnvInt("START_LEDGER", 0)),
-		EndLedger:             uint32(getEnvInt("END_LEDGER", 0)),
-		EnableWebSocket:       getEnv("ENABLE_WEBSOCKET", "true") == "true",
-		LogLevel:              getEnv("LOG_LEVEL", "info"),
-		FilterContracts:       filterContracts,
+	ingCfg, err := config.IngesterConfig(cfg)
+	if err != nil {
+		log.Fatalf("invalid ingestion configuration: %v", err)
 	}
+	ingCfg.WebSocket.AllowedOrigins = server.AllowedOrigins
 
 	logger := logrus.WithField("service", "ingester")
 	ing, err := handlers.NewIngester(ingCfg, dbConn, logger)
@@ -110,7 +75,7 @@ func main() {
 		log.Fatalf("failed to start ingester: %v", err)
 	}
 
-	ctl := controllers.NewIngesterController(dbConn, ing.Stats())
+	ctl := controllers.NewIngesterController(dbConn, ing)
 	r := server.NewRouter(ctl)
 
 	s := &server.Server{}
@@ -118,19 +83,3 @@ func main() {
 		log.Fatalf("server failed: %v", err)
 	}
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
-		}
-	}
-	return defaultValue
-}
@@ -0,0 +1,20 @@
+-- Backfill progress, one row per ledger range chunk (kept apart from ingestion_state)
+
+CREATE TABLE IF NOT EXISTS backfill_chunks (
+    range_start BIGINT NOT NULL,
+    range_end BIGINT NOT NULL,
+    last_ledger BIGINT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error TEXT,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (range_start, range_end),
+    CONSTRAINT valid_range CHECK (range_start <= range_end)
+);
+
+CREATE INDEX IF NOT EXISTS idx_backfill_chunks_status ON backfill_chunks(status);
+
+DROP TRIGGER IF EXISTS update_backfill_chunks_updated_at ON backfill_chunks;
+CREATE TRIGGER update_backfill_chunks_updated_at BEFORE UPDATE ON backfill_chunks
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,15 @@
+-- Gap repair: repair ranges share backfill_chunks, tagged by source
+
+ALTER TABLE backfill_chunks ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'backfill';
+
+CREATE INDEX IF NOT EXISTS idx_backfill_chunks_source_status ON backfill_chunks(source, status);
+
+-- Ledgers the live ingester failed to process
+CREATE TABLE IF NOT EXISTS ledger_failures (
+    sequence BIGINT PRIMARY KEY,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    error TEXT NOT NULL,
+    skipped BOOLEAN NOT NULL DEFAULT false,
+    first_failed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_failed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,13 @@
+-- Contracts added to the ingestion filter at runtime through the admin API,
+-- on top of those configured in stellar.filter_contracts / FILTER_CONTRACTS
+
+CREATE TABLE IF NOT EXISTS contract_filters (
+    contract_id VARCHAR(56) PRIMARY KEY,
+    label TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS update_contract_filters_updated_at ON contract_filters;
+CREATE TRIGGER update_contract_filters_updated_at BEFORE UPDATE ON contract_filters
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,58 @@
+-- Soroban contract storage and uploaded WASM, from ledger entry changes.
+-- Entries are identified by key_hash, the hex SHA-256 of their XDR ledger
+-- key, which is also how TTL entries refer to them.
+
+-- Current contract storage
+CREATE TABLE IF NOT EXISTS contract_data (
+    key_hash VARCHAR(64) PRIMARY KEY,
+    contract_id VARCHAR(56) NOT NULL,
+    durability VARCHAR(20) NOT NULL,
+    key JSONB NOT NULL,
+    key_xdr TEXT NOT NULL,
+    value JSONB NOT NULL,
+    value_xdr TEXT NOT NULL,
+    live_until_ledger BIGINT,
+    last_modified_ledger BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_contract_data_contract_id ON contract_data(contract_id);
+
+-- Every version of each storage entry, one row per ledger it changed in.
+-- Removed entries are recorded with deleted = true.
+CREATE TABLE IF NOT EXISTS contract_data_history (
+    key_hash VARCHAR(64) NOT NULL,
+    ledger BIGINT NOT NULL,
+    contract_id VARCHAR(56) NOT NULL,
+    durability VARCHAR(20) NOT NULL,
+    key JSONB NOT NULL,
+    key_xdr TEXT NOT NULL,
+    value JSONB,
+    value_xdr TEXT,
+    live_until_ledger BIGINT,
+    last_modified_ledger BIGINT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (key_hash, ledger),
+    FOREIGN KEY (ledger) REFERENCES ledgers(sequence) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_contract_data_history_contract_ledger ON contract_data_history(contract_id, ledger DESC);
+
+-- Uploaded contract WASM
+CREATE TABLE IF NOT EXISTS contract_code (
+    wasm_hash VARCHAR(64) PRIMARY KEY,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    size INTEGER NOT NULL,
+    created_ledger BIGINT NOT NULL,
+    last_modified_ledger BIGINT NOT NULL,
+    live_until_ledger BIGINT,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS update_contract_data_updated_at ON contract_data;
+CREATE TRIGGER update_contract_data_updated_at BEFORE UPDATE ON contract_data
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_contract_code_updated_at ON contract_code;
+CREATE TRIGGER update_contract_code_updated_at BEFORE UPDATE ON contract_code
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
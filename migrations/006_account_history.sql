@@ -0,0 +1,27 @@
+-- Account state from account ledger entry changes: signers for the accounts
+-- table and one row per ledger an account changed in
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS signers JSONB;
+
+CREATE TABLE IF NOT EXISTS account_history (
+    account_id VARCHAR(56) NOT NULL,
+    ledger BIGINT NOT NULL,
+    sequence BIGINT,
+    balance BIGINT,
+    buying_liabilities BIGINT,
+    selling_liabilities BIGINT,
+    num_subentries INTEGER,
+    num_sponsoring INTEGER,
+    num_sponsored INTEGER,
+    thresholds JSONB,
+    flags INTEGER,
+    home_domain VARCHAR(255),
+    master_weight INTEGER,
+    signers JSONB,
+    last_modified_ledger BIGINT,
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (account_id, ledger),
+    FOREIGN KEY (ledger) REFERENCES ledgers(sequence) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_history_account_ledger ON account_history(account_id, ledger DESC);
@@ -0,0 +1,29 @@
+-- Trustline balances and asset discovery. Native and credit assets are
+-- keyed by (asset_type, asset_code, asset_issuer) with empty strings for the
+-- native asset's code and issuer so the unique constraint applies to it.
+
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS contract_id VARCHAR(56);
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS first_seen_ledger BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_assets_contract_id ON assets(contract_id);
+
+CREATE TABLE IF NOT EXISTS trustlines (
+    account_id VARCHAR(56) NOT NULL,
+    asset_type VARCHAR(20) NOT NULL,
+    asset_code VARCHAR(12) NOT NULL,
+    asset_issuer VARCHAR(56) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0,
+    trust_limit BIGINT NOT NULL DEFAULT 0,
+    buying_liabilities BIGINT NOT NULL DEFAULT 0,
+    selling_liabilities BIGINT NOT NULL DEFAULT 0,
+    flags INTEGER NOT NULL DEFAULT 0,
+    last_modified_ledger BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, asset_code, asset_issuer)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trustlines_asset_balance ON trustlines(asset_code, asset_issuer, balance DESC);
+
+DROP TRIGGER IF EXISTS update_trustlines_updated_at ON trustlines;
+CREATE TRIGGER update_trustlines_updated_at BEFORE UPDATE ON trustlines
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,8 @@
+-- Diagnostic events and events of failed transactions: event_type is
+-- contract, system or diagnostic, in_successful_tx the real transaction
+-- result, and in_successful_contract_call whether the call that emitted the
+-- event succeeded
+
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS in_successful_contract_call BOOLEAN NOT NULL DEFAULT true;
+
+CREATE INDEX IF NOT EXISTS idx_contract_events_in_successful_tx ON contract_events(in_successful_tx);
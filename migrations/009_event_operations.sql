@@ -0,0 +1,4 @@
+-- The operation that emitted each event; NULL for transaction-level events
+-- such as the fee events of TransactionMeta V4
+
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS operation_index INTEGER;
@@ -0,0 +1,8 @@
+-- Position of each event in the chain: events are ordered by ledger,
+-- transaction_index, then event_index within the transaction. IDs of new
+-- events are Stellar RPC style TOIDs built from the same fields.
+
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS transaction_index INTEGER;
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS event_index INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_contract_events_order ON contract_events(ledger, transaction_index, event_index);
@@ -0,0 +1,20 @@
+-- Ledger close time on transactions, operations and events, so time ranges
+-- reflect when data was on chain rather than when it was ingested. Rows
+-- ingested before are filled from their ledger.
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+
+UPDATE transactions t SET closed_at = l.closed_at
+FROM ledgers l WHERE t.ledger = l.sequence AND t.closed_at IS NULL;
+
+UPDATE operations o SET closed_at = t.closed_at
+FROM transactions t WHERE o.transaction_id = t.id AND o.closed_at IS NULL;
+
+UPDATE contract_events e SET closed_at = l.closed_at
+FROM ledgers l WHERE e.ledger = l.sequence AND e.closed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_closed_at ON transactions(closed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_operations_closed_at ON operations(closed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_contract_events_closed_at ON contract_events(closed_at DESC);
@@ -0,0 +1,56 @@
+-- Schemas and attestations decoded from the events of attestation
+-- contracts. Rows are keyed by the emitting contract so events of unrelated
+-- contracts cannot overwrite each other. A revocation seen before its
+-- attestation, as when backfilling out of order, leaves a row with only the
+-- revocation filled in until the attestation is ingested.
+
+CREATE TABLE IF NOT EXISTS schemas (
+    contract_id VARCHAR(56) NOT NULL,
+    uid VARCHAR(64) NOT NULL,
+    definition TEXT,
+    authority VARCHAR(56),
+    resolver VARCHAR(56),
+    revocable BOOLEAN NOT NULL DEFAULT true,
+    ledger BIGINT NOT NULL,
+    transaction_hash VARCHAR(64) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    closed_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (contract_id, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_schemas_uid ON schemas(uid);
+CREATE INDEX IF NOT EXISTS idx_schemas_authority ON schemas(authority);
+
+CREATE TABLE IF NOT EXISTS attestations (
+    contract_id VARCHAR(56) NOT NULL,
+    uid VARCHAR(64) NOT NULL,
+    schema_uid VARCHAR(64),
+    attester VARCHAR(56),
+    subject VARCHAR(56),
+    value JSONB,
+    expires_at TIMESTAMP,
+    revoked BOOLEAN NOT NULL DEFAULT false,
+    revoked_at TIMESTAMP,
+    revoked_ledger BIGINT,
+    revocation_tx_hash VARCHAR(64),
+    ledger BIGINT,
+    transaction_hash VARCHAR(64),
+    event_id VARCHAR(255),
+    closed_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (contract_id, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attestations_uid ON attestations(uid);
+CREATE INDEX IF NOT EXISTS idx_attestations_subject ON attestations(subject);
+CREATE INDEX IF NOT EXISTS idx_attestations_attester ON attestations(attester);
+CREATE INDEX IF NOT EXISTS idx_attestations_schema_uid ON attestations(schema_uid);
+
+DROP TRIGGER IF EXISTS update_schemas_updated_at ON schemas;
+CREATE TRIGGER update_schemas_updated_at BEFORE UPDATE ON schemas
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_attestations_updated_at ON attestations;
+CREATE TRIGGER update_attestations_updated_at BEFORE UPDATE ON attestations
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
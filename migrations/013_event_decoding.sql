@@ -0,0 +1,11 @@
+-- Decoded contract events: event_xdr is the ContractEvent XDR, kept so
+-- events can be decoded again when a decoder is added; decoder names the
+-- decoder that recognized the event and decoded holds its output. Events
+-- stored before this migration have no XDR until their ledgers are
+-- re-ingested.
+
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS event_xdr BYTEA;
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS decoder VARCHAR(64);
+ALTER TABLE contract_events ADD COLUMN IF NOT EXISTS decoded JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_contract_events_decoder ON contract_events(decoder);
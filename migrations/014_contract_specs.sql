@@ -0,0 +1,23 @@
+-- Contract specs: the contractspecv0 section of uploaded WASM, raw in
+-- spec_xdr and in readable form in spec, and the executable each deployed
+-- contract runs, so invocations can be described with the spec of their
+-- contract. WASM uploaded before this migration has no spec until the
+-- ledger it was uploaded in is re-ingested.
+
+ALTER TABLE contract_code ADD COLUMN IF NOT EXISTS spec JSONB;
+ALTER TABLE contract_code ADD COLUMN IF NOT EXISTS spec_xdr BYTEA;
+
+CREATE TABLE IF NOT EXISTS contracts (
+    contract_id VARCHAR(56) PRIMARY KEY,
+    executable_type VARCHAR(16) NOT NULL,
+    wasm_hash VARCHAR(64),
+    created_ledger BIGINT NOT NULL,
+    last_modified_ledger BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_contracts_wasm_hash ON contracts(wasm_hash);
+
+DROP TRIGGER IF EXISTS update_contracts_updated_at ON contracts;
+CREATE TRIGGER update_contracts_updated_at BEFORE UPDATE ON contracts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
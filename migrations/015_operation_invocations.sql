@@ -0,0 +1,8 @@
+-- invoke_host_function operations keep the called contract and function in
+-- details->>'contract_id' and details->>'fn', next to their arguments,
+-- authorizations, footprint and resources. Index them for lookups of the
+-- calls to a function of a contract.
+
+CREATE INDEX IF NOT EXISTS idx_operations_invocation
+    ON operations ((details->>'contract_id'), (details->>'fn'), closed_at DESC)
+    WHERE type = 'invoke_host_function';
@@ -0,0 +1,25 @@
+-- Chain position of operations, so lists page by cursor over the order key
+-- of each table: ledgers by sequence, transactions by (ledger, index),
+-- operations by (ledger, transaction_index, index) and events by (ledger,
+-- transaction_index, event_index). Operations ingested before take the
+-- position of their transaction; events stored before their position was
+-- recorded take their transaction's index and their order by ID in it.
+
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS ledger BIGINT;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS transaction_index INTEGER;
+
+UPDATE operations o SET ledger = t.ledger, transaction_index = t.index
+FROM transactions t WHERE o.transaction_id = t.id AND o.ledger IS NULL;
+
+UPDATE contract_events e SET transaction_index = t.index
+FROM transactions t WHERE e.transaction_hash = t.hash AND e.transaction_index IS NULL;
+
+UPDATE contract_events e SET event_index = n.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY ledger, transaction_hash ORDER BY id) - 1 AS position
+    FROM contract_events WHERE event_index IS NULL
+) n
+WHERE e.id = n.id;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_order ON transactions(ledger, index);
+CREATE INDEX IF NOT EXISTS idx_operations_order ON operations(ledger, transaction_index, index);
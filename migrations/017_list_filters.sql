@@ -0,0 +1,6 @@
+-- Indexes for the filters of the list endpoints not covered by earlier
+-- ones: events by their first topic, the event name of most contracts, and
+-- transactions by memo.
+
+CREATE INDEX IF NOT EXISTS idx_contract_events_topic0 ON contract_events ((topics->>0));
+CREATE INDEX IF NOT EXISTS idx_transactions_memo_value ON transactions(memo_value) WHERE memo_value IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Contract backfills: repair chunks that re-ingest only the data of the
+-- contract added to the filter, keyed apart from full repairs of the same range
+
+ALTER TABLE backfill_chunks ADD COLUMN IF NOT EXISTS contract_id VARCHAR(56) NOT NULL DEFAULT '';
+
+ALTER TABLE backfill_chunks DROP CONSTRAINT IF EXISTS backfill_chunks_pkey;
+ALTER TABLE backfill_chunks ADD PRIMARY KEY (range_start, range_end, contract_id);
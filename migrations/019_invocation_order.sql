@@ -0,0 +1,9 @@
+-- Calls to a contract or one of its functions are listed by cursor over the
+-- operation order, not by closed_at. Index the call expressions with that
+-- order so a page reads only its rows, replacing idx_operations_invocation.
+
+CREATE INDEX IF NOT EXISTS idx_operations_invocation_order
+    ON operations ((details->>'contract_id'), (details->>'fn'), ledger, transaction_index, index)
+    WHERE type = 'invoke_host_function';
+
+DROP INDEX IF EXISTS idx_operations_invocation;
@@ -0,0 +1,5 @@
+-- Repairs of hash_mismatch ranges replace the stored ledgers. They are
+-- deleted in the transaction that writes each repaired ledger, not when the
+-- repair is scheduled, so a range is never left empty while it waits.
+
+ALTER TABLE backfill_chunks ADD COLUMN IF NOT EXISTS replace_ledgers BOOLEAN NOT NULL DEFAULT false;
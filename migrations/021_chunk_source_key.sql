@@ -0,0 +1,5 @@
+-- Backfill and repair chunks of the same range are tracked separately, so
+-- registering one never resets or hides the other
+
+ALTER TABLE backfill_chunks DROP CONSTRAINT IF EXISTS backfill_chunks_pkey;
+ALTER TABLE backfill_chunks ADD PRIMARY KEY (range_start, range_end, contract_id, source);
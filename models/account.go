@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Account is the state of a Stellar account. Amounts are in stroops.
+type Account struct {
+	AccountID          string            `json:"account_id"`
+	Sequence           int64             `json:"sequence"`
+	Balance            int64             `json:"balance"`
+	BuyingLiabilities  int64             `json:"buying_liabilities"`
+	SellingLiabilities int64             `json:"selling_liabilities"`
+	NumSubentries      uint32            `json:"num_subentries"`
+	NumSponsoring      uint32            `json:"num_sponsoring"`
+	NumSponsored       uint32            `json:"num_sponsored"`
+	Thresholds         AccountThresholds `json:"thresholds"`
+	Flags              uint32            `json:"flags"`
+	HomeDomain         string            `json:"home_domain,omitempty"`
+	MasterWeight       uint8             `json:"master_weight"`
+	Signers            []AccountSigner   `json:"signers"`
+	LastModifiedLedger uint32            `json:"last_modified_ledger"`
+	UpdatedAt          *time.Time        `json:"updated_at,omitempty"`
+}
+
+// AccountThresholds are the weights needed for low, medium and high
+// threshold operations
+type AccountThresholds struct {
+	Low    uint8 `json:"low"`
+	Medium uint8 `json:"medium"`
+	High   uint8 `json:"high"`
+}
+
+// AccountSigner is an additional signer of an account
+type AccountSigner struct {
+	Key    string `json:"key"`
+	Weight uint32 `json:"weight"`
+}
+
+// AccountHistoryEntry is an account's state after it changed in Ledger.
+// Deleted entries record the account being merged away.
+type AccountHistoryEntry struct {
+	Ledger  uint32 `json:"ledger"`
+	Deleted bool   `json:"deleted"`
+	Account
+}
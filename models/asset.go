@@ -0,0 +1,26 @@
+package models
+
+// Asset is a classic asset seen on the network. ContractID is the address of
+// its Stellar Asset Contract once deployed.
+type Asset struct {
+	AssetType       string `json:"asset_type"` // "native", "credit_alphanum4" or "credit_alphanum12"
+	AssetCode       string `json:"asset_code,omitempty"`
+	AssetIssuer     string `json:"asset_issuer,omitempty"`
+	ContractID      string `json:"contract_id,omitempty"`
+	FirstSeenLedger uint32 `json:"first_seen_ledger,omitempty"`
+}
+
+// Balance is an account's holding of one asset, in stroops. Limit and Flags
+// only apply to trustlines.
+type Balance struct {
+	AccountID          string `json:"account_id"`
+	AssetType          string `json:"asset_type"`
+	AssetCode          string `json:"asset_code,omitempty"`
+	AssetIssuer        string `json:"asset_issuer,omitempty"`
+	Balance            int64  `json:"balance"`
+	Limit              int64  `json:"limit,omitempty"`
+	BuyingLiabilities  int64  `json:"buying_liabilities"`
+	SellingLiabilities int64  `json:"selling_liabilities"`
+	Flags              uint32 `json:"flags"`
+	LastModifiedLedger uint32 `json:"last_modified_ledger"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Schema is an attestation schema registered with an attestation contract
+type Schema struct {
+	ContractID      string    `json:"contract_id"`
+	UID             string    `json:"uid"`
+	Definition      string    `json:"definition,omitempty"`
+	Authority       string    `json:"authority,omitempty"`
+	Resolver        string    `json:"resolver,omitempty"`
+	Revocable       bool      `json:"revocable"`
+	Ledger          uint32    `json:"ledger"`
+	TransactionHash string    `json:"transaction_hash"`
+	EventID         string    `json:"event_id"`
+	ClosedAt        time.Time `json:"closed_at"`
+}
+
+// Attestation is an attestation made through an attestation contract.
+// Value is the attested data in the readable scval form.
+type Attestation struct {
+	ContractID      string          `json:"contract_id"`
+	UID             string          `json:"uid"`
+	SchemaUID       string          `json:"schema_uid,omitempty"`
+	Attester        string          `json:"attester,omitempty"`
+	Subject         string          `json:"subject,omitempty"`
+	Value           json.RawMessage `json:"value,omitempty"`
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"`
+	Status          string          `json:"status"` // "active", "expired" or "revoked"
+	Revoked         bool            `json:"revoked"`
+	RevokedAt       *time.Time      `json:"revoked_at,omitempty"`
+	RevokedLedger   *uint32         `json:"revoked_ledger,omitempty"`
+	RevocationTx    string          `json:"revocation_transaction_hash,omitempty"`
+	Ledger          *uint32         `json:"ledger,omitempty"`
+	TransactionHash string          `json:"transaction_hash,omitempty"`
+	EventID         string          `json:"event_id,omitempty"`
+	ClosedAt        *time.Time      `json:"closed_at,omitempty"`
+}
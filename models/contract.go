@@ -0,0 +1,38 @@
+package models
+
+import "encoding/json"
+
+// ContractDataEntry is one entry of a contract's storage. Key and Value use
+// the typed ScVal JSON encoding of the scval package.
+type ContractDataEntry struct {
+	KeyHash            string          `json:"key_hash"`
+	ContractID         string          `json:"contract_id"`
+	Durability         string          `json:"durability"` // "persistent" or "temporary"
+	Key                json.RawMessage `json:"key"`
+	KeyXDR             string          `json:"key_xdr"`
+	Value              json.RawMessage `json:"value"`
+	ValueXDR           string          `json:"value_xdr"`
+	LiveUntilLedger    *uint32         `json:"live_until_ledger,omitempty"`
+	LastModifiedLedger uint32          `json:"last_modified_ledger"`
+}
+
+// ContractCode describes an uploaded contract WASM. Spec is the readable
+// form of its contractspecv0 section, see the contractspec package.
+type ContractCode struct {
+	WasmHash           string          `json:"wasm_hash"`
+	Size               int             `json:"size"`
+	CreatedLedger      uint32          `json:"created_ledger"`
+	LastModifiedLedger uint32          `json:"last_modified_ledger"`
+	LiveUntilLedger    *uint32         `json:"live_until_ledger,omitempty"`
+	Spec               json.RawMessage `json:"spec,omitempty"`
+}
+
+// Contract is a deployed contract with the executable it runs
+type Contract struct {
+	ContractID         string          `json:"contract_id"`
+	ExecutableType     string          `json:"executable_type"` // "wasm" or "stellar_asset"
+	WasmHash           string          `json:"wasm_hash,omitempty"`
+	CreatedLedger      uint32          `json:"created_ledger"`
+	LastModifiedLedger uint32          `json:"last_modified_ledger"`
+	Spec               json.RawMessage `json:"spec,omitempty"`
+}
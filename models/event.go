@@ -1,14 +1,40 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type ContractEvent struct {
-	ID              string          `json:"id"`
-	ContractID      string          `json:"contract_id"`
-	Ledger          uint32          `json:"ledger"`
-	TransactionHash string          `json:"transaction_hash"`
-	EventType       string          `json:"event_type"`
-	Topics          []string        `json:"topics"`
-	Data            json.RawMessage `json:"data"`
-	InSuccessfulTx  bool            `json:"in_successful_tx"`
+	ID                       string          `json:"id"`
+	ContractID               string          `json:"contract_id"`
+	Ledger                   uint32          `json:"ledger"`
+	TransactionHash          string          `json:"transaction_hash"`
+	EventType                string          `json:"event_type"`
+	Topics                   []string        `json:"topics"`
+	Data                     json.RawMessage `json:"data"`
+	InSuccessfulTx           bool            `json:"in_successful_tx"`
+	InSuccessfulContractCall bool            `json:"in_successful_contract_call"`
+	TransactionIndex         uint32          `json:"transaction_index"`
+	OperationIndex           *uint32         `json:"operation_index"`
+	EventIndex               uint32          `json:"event_index"`
+	ClosedAt                 time.Time       `json:"closed_at"`
+	Decoder                  string          `json:"decoder,omitempty"`
+	Decoded                  json.RawMessage `json:"decoded,omitempty"`
+}
+
+// EventDecoder describes a registered event decoder and what it is
+// registered for
+type EventDecoder struct {
+	Name      string   `json:"name"`
+	Topics    []string `json:"topics"`
+	Contracts []string `json:"contracts"`
+}
+
+// RedecodeResult counts the events a re-decoding run went through, decoded,
+// and skipped for lack of stored XDR
+type RedecodeResult struct {
+	Processed int `json:"processed"`
+	Decoded   int `json:"decoded"`
+	Skipped   int `json:"skipped"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ContractFilter is a contract the ingester keeps data for. Contracts from
+// the configuration have source "config" and cannot be removed at runtime.
+type ContractFilter struct {
+	ContractID string     `json:"contract_id"`
+	Label      string     `json:"label,omitempty"`
+	Source     string     `json:"source"` // "config" or "api"
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// LedgerGap is an inclusive range of ledgers that is missing from the
+// ledgers table or whose hash chain does not link up
+type LedgerGap struct {
+	Start      uint32 `json:"start"`
+	End        uint32 `json:"end"`
+	Reason     string `json:"reason"`                // "missing", "hash_mismatch" or "contract_backfill"
+	ContractID string `json:"contract_id,omitempty"` // Only this contract's data is re-ingested when set
+}
+
+// LedgerFailure records a ledger the live ingester could not process
+type LedgerFailure struct {
+	Sequence      uint32    `json:"sequence"`
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error"`
+	Skipped       bool      `json:"skipped"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+}
+
+// RepairChunk is a scheduled re-ingestion range and its progress
+type RepairChunk struct {
+	Start      uint32    `json:"start"`
+	End        uint32    `json:"end"`
+	ContractID string    `json:"contract_id,omitempty"`
+	LastLedger uint32    `json:"last_ledger"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
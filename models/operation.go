@@ -1,12 +1,18 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Operation struct {
-	ID            string          `json:"id"`
-	TransactionID string          `json:"transaction_id"`
-	Index         uint32          `json:"index"`
-	Type          string          `json:"type"`
-	SourceAccount string          `json:"source_account,omitempty"`
-	Details       json.RawMessage `json:"details"`
+	ID               string          `json:"id"`
+	TransactionID    string          `json:"transaction_id"`
+	Ledger           uint32          `json:"ledger"`
+	TransactionIndex uint32          `json:"transaction_index"`
+	Index            uint32          `json:"index"`
+	Type             string          `json:"type"`
+	SourceAccount    string          `json:"source_account,omitempty"`
+	Details          json.RawMessage `json:"details"`
+	ClosedAt         time.Time       `json:"closed_at"`
 }
@@ -0,0 +1,9 @@
+package models
+
+// PageInfo carries the cursors of the pages around a page of a list
+type PageInfo struct {
+	Order string `json:"order"`
+	Limit int    `json:"limit"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
@@ -5,16 +5,60 @@ import (
 )
 
 type Transaction struct {
-	ID             string      `json:"id"`
-	Hash           string      `json:"hash"`
-	Ledger         uint32      `json:"ledger"`
-	Index          uint32      `json:"index"`
-	SourceAccount  string      `json:"source_account"`
-	FeePaid        int64       `json:"fee_paid"`
-	OperationCount int32       `json:"operation_count"`
-	CreatedAt      time.Time   `json:"created_at"`
-	MemoType       string      `json:"memo_type,omitempty"`
-	MemoValue      string      `json:"memo_value,omitempty"`
-	Successful     bool        `json:"successful"`
-	Operations     []Operation `json:"operations,omitempty"`
+	ID             string          `json:"id"`
+	Hash           string          `json:"hash"`
+	Ledger         uint32          `json:"ledger"`
+	Index          uint32          `json:"index"`
+	SourceAccount  string          `json:"source_account"`
+	FeePaid        int64           `json:"fee_paid"`
+	OperationCount int32           `json:"operation_count"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ClosedAt       time.Time       `json:"closed_at"`
+	MemoType       string          `json:"memo_type,omitempty"`
+	MemoValue      string          `json:"memo_value,omitempty"`
+	Successful     bool            `json:"successful"`
+	Operations     []Operation     `json:"operations,omitempty"`
+	Events         []ContractEvent `json:"events,omitempty"`
+}
+
+// TransactionXDR is the XDR stored for a transaction, base64 encoded
+type TransactionXDR struct {
+	Hash          string `json:"hash"`
+	EnvelopeXDR   string `json:"envelope_xdr"`
+	ResultXDR     string `json:"result_xdr"`
+	ResultMetaXDR string `json:"result_meta_xdr"`
+}
+
+// DecodedTransactionXDR is the XDR of a transaction decoded to JSON, with the
+// result codes of its operations and the ledger entries it changed
+type DecodedTransactionXDR struct {
+	Hash             string              `json:"hash"`
+	Envelope         interface{}         `json:"envelope"`
+	Result           interface{}         `json:"result"`
+	ResultMeta       interface{}         `json:"result_meta"`
+	ResultCode       string              `json:"result_code"`
+	OperationResults []OperationResult   `json:"operation_results"`
+	Changes          []LedgerEntryChange `json:"changes"`
+}
+
+// OperationResult is the outcome of an operation: Code is the generic
+// operation code and ResultCode the code of the operation type's result
+type OperationResult struct {
+	Index      int    `json:"index"`
+	Type       string `json:"type,omitempty"`
+	Code       string `json:"code"`
+	ResultCode string `json:"result_code,omitempty"`
+}
+
+// LedgerEntryChange is a ledger entry change in a transaction's meta. Stage
+// is before or after for changes made around the operations, and operation
+// for those of the operation at Operation.
+type LedgerEntryChange struct {
+	Stage     string      `json:"stage"`
+	Operation *int        `json:"operation,omitempty"`
+	Type      string      `json:"type"`
+	EntryType string      `json:"entry_type"`
+	KeyHash   string      `json:"key_hash,omitempty"`
+	Entry     interface{} `json:"entry,omitempty"`
+	Key       interface{} `json:"key,omitempty"`
 }
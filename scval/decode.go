@@ -0,0 +1,345 @@
+package scval
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/stellar/go/xdr"
+)
+
+// Decode converts a typed JSON value back into the ScVal it was encoded from
+func Decode(v Value) (xdr.ScVal, error) {
+	val, err := decodeValue(v)
+	if err != nil {
+		if _, ok := err.(*Error); !ok {
+			err = &Error{Op: "decode", Type: v.Type, Err: err}
+		}
+		return xdr.ScVal{}, err
+	}
+	return val, nil
+}
+
+func decodeValue(v Value) (xdr.ScVal, error) {
+	switch v.Type {
+	case TypeBool:
+		var b bool
+		if err := unmarshalPayload(v, &b); err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvBool, B: &b}, nil
+	case TypeVoid:
+		return xdr.ScVal{Type: xdr.ScValTypeScvVoid}, nil
+	case TypeLedgerKeyContractInstance:
+		return xdr.ScVal{Type: xdr.ScValTypeScvLedgerKeyContractInstance}, nil
+	case TypeError:
+		e, err := decodeError(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvError, Error: &e}, nil
+	case TypeU32:
+		var n json.Number
+		if err := unmarshalPayload(v, &n); err != nil {
+			return xdr.ScVal{}, err
+		}
+		u, err := parseUint(n.String(), 32)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		u32 := xdr.Uint32(u)
+		return xdr.ScVal{Type: xdr.ScValTypeScvU32, U32: &u32}, nil
+	case TypeI32:
+		var n json.Number
+		if err := unmarshalPayload(v, &n); err != nil {
+			return xdr.ScVal{}, err
+		}
+		i, err := parseInt(n.String(), 32)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		i32 := xdr.Int32(i)
+		return xdr.ScVal{Type: xdr.ScValTypeScvI32, I32: &i32}, nil
+	case TypeU64, TypeTimepoint, TypeDuration:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		u, err := parseUint(s, 64)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		switch v.Type {
+		case TypeTimepoint:
+			tp := xdr.TimePoint(u)
+			return xdr.ScVal{Type: xdr.ScValTypeScvTimepoint, Timepoint: &tp}, nil
+		case TypeDuration:
+			d := xdr.Duration(u)
+			return xdr.ScVal{Type: xdr.ScValTypeScvDuration, Duration: &d}, nil
+		}
+		u64 := xdr.Uint64(u)
+		return xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &u64}, nil
+	case TypeI64, TypeLedgerKeyNonce:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		i, err := parseInt(s, 64)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		if v.Type == TypeLedgerKeyNonce {
+			return xdr.ScVal{Type: xdr.ScValTypeScvLedgerKeyNonce, NonceKey: &xdr.ScNonceKey{Nonce: xdr.Int64(i)}}, nil
+		}
+		i64 := xdr.Int64(i)
+		return xdr.ScVal{Type: xdr.ScValTypeScvI64, I64: &i64}, nil
+	case TypeU128:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		parts, err := ParseU128(s)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvU128, U128: &parts}, nil
+	case TypeI128:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		parts, err := ParseI128(s)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvI128, I128: &parts}, nil
+	case TypeU256:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		parts, err := ParseU256(s)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvU256, U256: &parts}, nil
+	case TypeI256:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		parts, err := ParseI256(s)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvI256, I256: &parts}, nil
+	case TypeBytes:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		raw, err := hex.DecodeString(s)
+		if err != nil {
+			return xdr.ScVal{}, ErrInvalidValue
+		}
+		b := xdr.ScBytes(raw)
+		return xdr.ScVal{Type: xdr.ScValTypeScvBytes, Bytes: &b}, nil
+	case TypeString:
+		var str xdr.ScString
+		if bytes.HasPrefix(bytes.TrimSpace(v.Value), []byte("{")) {
+			var h hexString
+			if err := unmarshalPayload(v, &h); err != nil {
+				return xdr.ScVal{}, err
+			}
+			raw, err := hex.DecodeString(h.Hex)
+			if err != nil {
+				return xdr.ScVal{}, ErrInvalidValue
+			}
+			str = xdr.ScString(raw)
+		} else {
+			s, err := decodeString(v)
+			if err != nil {
+				return xdr.ScVal{}, err
+			}
+			str = xdr.ScString(s)
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &str}, nil
+	case TypeSymbol:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		sym := xdr.ScSymbol(s)
+		return xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &sym}, nil
+	case TypeVec:
+		var items []Value
+		if err := unmarshalPayload(v, &items); err != nil {
+			return xdr.ScVal{}, err
+		}
+		var vec *xdr.ScVec
+		if items != nil {
+			decoded := make(xdr.ScVec, len(items))
+			for idx, item := range items {
+				val, err := Decode(item)
+				if err != nil {
+					return xdr.ScVal{}, err
+				}
+				decoded[idx] = val
+			}
+			vec = &decoded
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &vec}, nil
+	case TypeMap:
+		var entries []MapEntry
+		if err := unmarshalPayload(v, &entries); err != nil {
+			return xdr.ScVal{}, err
+		}
+		m, err := decodeMap(entries)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &m}, nil
+	case TypeAddress:
+		s, err := decodeString(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		addr, err := ParseAddress(s)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvAddress, Address: &addr}, nil
+	case TypeContractInstance:
+		inst, err := decodeInstance(v)
+		if err != nil {
+			return xdr.ScVal{}, err
+		}
+		return xdr.ScVal{Type: xdr.ScValTypeScvContractInstance, Instance: &inst}, nil
+	default:
+		return xdr.ScVal{}, ErrUnsupportedType
+	}
+}
+
+// decodeMap returns nil for a nil entry list so null round-trips
+func decodeMap(entries []MapEntry) (*xdr.ScMap, error) {
+	if entries == nil {
+		return nil, nil
+	}
+	m := make(xdr.ScMap, len(entries))
+	for idx, entry := range entries {
+		key, err := Decode(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := Decode(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		m[idx] = xdr.ScMapEntry{Key: key, Val: val}
+	}
+	return &m, nil
+}
+
+func decodeError(v Value) (xdr.ScError, error) {
+	var payload struct {
+		Type string          `json:"type"`
+		Code json.RawMessage `json:"code"`
+	}
+	if err := unmarshalPayload(v, &payload); err != nil {
+		return xdr.ScError{}, err
+	}
+	for errType, name := range errorTypeNames {
+		if name != payload.Type {
+			continue
+		}
+		if errType == xdr.ScErrorTypeSceContract {
+			var code uint32
+			if err := json.Unmarshal(payload.Code, &code); err != nil {
+				return xdr.ScError{}, ErrInvalidValue
+			}
+			contractCode := xdr.Uint32(code)
+			return xdr.ScError{Type: errType, ContractCode: &contractCode}, nil
+		}
+		var codeName string
+		if err := json.Unmarshal(payload.Code, &codeName); err != nil {
+			return xdr.ScError{}, ErrInvalidValue
+		}
+		for code, name := range errorCodeNames {
+			if name == codeName {
+				code := code
+				return xdr.ScError{Type: errType, Code: &code}, nil
+			}
+		}
+		return xdr.ScError{}, ErrInvalidValue
+	}
+	return xdr.ScError{}, ErrUnsupportedType
+}
+
+func decodeInstance(v Value) (xdr.ScContractInstance, error) {
+	var payload ContractInstance
+	if err := unmarshalPayload(v, &payload); err != nil {
+		return xdr.ScContractInstance{}, err
+	}
+	var inst xdr.ScContractInstance
+	switch payload.Executable.Type {
+	case "wasm":
+		raw, err := hex.DecodeString(payload.Executable.Hash)
+		if err != nil || len(raw) != len(xdr.Hash{}) {
+			return inst, ErrInvalidValue
+		}
+		var hash xdr.Hash
+		copy(hash[:], raw)
+		inst.Executable = xdr.ContractExecutable{Type: xdr.ContractExecutableTypeContractExecutableWasm, WasmHash: &hash}
+	case "stellar_asset":
+		inst.Executable = xdr.ContractExecutable{Type: xdr.ContractExecutableTypeContractExecutableStellarAsset}
+	default:
+		return inst, ErrUnsupportedType
+	}
+	storage, err := decodeMap(payload.Storage)
+	if err != nil {
+		return inst, err
+	}
+	inst.Storage = storage
+	return inst, nil
+}
+
+func unmarshalPayload(v Value, dst interface{}) error {
+	if len(v.Value) == 0 {
+		return ErrInvalidValue
+	}
+	dec := json.NewDecoder(bytes.NewReader(v.Value))
+	dec.UseNumber()
+	if err := dec.Decode(dst); err != nil {
+		return ErrInvalidValue
+	}
+	return nil
+}
+
+func decodeString(v Value) (string, error) {
+	var s string
+	err := unmarshalPayload(v, &s)
+	return s, err
+}
+
+func parseUint(s string, bits int) (uint64, error) {
+	u, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return 0, ErrOutOfRange
+		}
+		return 0, ErrInvalidValue
+	}
+	return u, nil
+}
+
+func parseInt(s string, bits int) (int64, error) {
+	i, err := strconv.ParseInt(s, 10, bits)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return 0, ErrOutOfRange
+		}
+		return 0, ErrInvalidValue
+	}
+	return i, nil
+}
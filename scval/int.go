@@ -0,0 +1,128 @@
+package scval
+
+import (
+	"math/big"
+
+	"github.com/stellar/go/xdr"
+)
+
+var (
+	two64  = new(big.Int).Lsh(big.NewInt(1), 64)
+	two128 = new(big.Int).Lsh(big.NewInt(1), 128)
+	two256 = new(big.Int).Lsh(big.NewInt(1), 256)
+)
+
+// U128String formats a u128 as a decimal string
+func U128String(parts xdr.UInt128Parts) string {
+	return joinWords(uint64(parts.Hi), uint64(parts.Lo)).String()
+}
+
+// I128String formats an i128 as a decimal string
+func I128String(parts xdr.Int128Parts) string {
+	n := joinWords(uint64(parts.Hi), uint64(parts.Lo))
+	if parts.Hi < 0 {
+		n.Sub(n, two128)
+	}
+	return n.String()
+}
+
+// U256String formats a u256 as a decimal string
+func U256String(parts xdr.UInt256Parts) string {
+	return joinWords(uint64(parts.HiHi), uint64(parts.HiLo), uint64(parts.LoHi), uint64(parts.LoLo)).String()
+}
+
+// I256String formats an i256 as a decimal string
+func I256String(parts xdr.Int256Parts) string {
+	n := joinWords(uint64(parts.HiHi), uint64(parts.HiLo), uint64(parts.LoHi), uint64(parts.LoLo))
+	if parts.HiHi < 0 {
+		n.Sub(n, two256)
+	}
+	return n.String()
+}
+
+// ParseU128 parses a decimal string into a u128
+func ParseU128(s string) (xdr.UInt128Parts, error) {
+	n, err := parseBig(s, false, 128)
+	if err != nil {
+		return xdr.UInt128Parts{}, err
+	}
+	w := splitWords(n, 2)
+	return xdr.UInt128Parts{Hi: xdr.Uint64(w[0]), Lo: xdr.Uint64(w[1])}, nil
+}
+
+// ParseI128 parses a decimal string into an i128
+func ParseI128(s string) (xdr.Int128Parts, error) {
+	n, err := parseBig(s, true, 128)
+	if err != nil {
+		return xdr.Int128Parts{}, err
+	}
+	w := splitWords(n, 2)
+	return xdr.Int128Parts{Hi: xdr.Int64(w[0]), Lo: xdr.Uint64(w[1])}, nil
+}
+
+// ParseU256 parses a decimal string into a u256
+func ParseU256(s string) (xdr.UInt256Parts, error) {
+	n, err := parseBig(s, false, 256)
+	if err != nil {
+		return xdr.UInt256Parts{}, err
+	}
+	w := splitWords(n, 4)
+	return xdr.UInt256Parts{HiHi: xdr.Uint64(w[0]), HiLo: xdr.Uint64(w[1]), LoHi: xdr.Uint64(w[2]), LoLo: xdr.Uint64(w[3])}, nil
+}
+
+// ParseI256 parses a decimal string into an i256
+func ParseI256(s string) (xdr.Int256Parts, error) {
+	n, err := parseBig(s, true, 256)
+	if err != nil {
+		return xdr.Int256Parts{}, err
+	}
+	w := splitWords(n, 4)
+	return xdr.Int256Parts{HiHi: xdr.Int64(w[0]), HiLo: xdr.Uint64(w[1]), LoHi: xdr.Uint64(w[2]), LoLo: xdr.Uint64(w[3])}, nil
+}
+
+// joinWords builds an unsigned integer from 64-bit words, most significant first
+func joinWords(words ...uint64) *big.Int {
+	n := new(big.Int)
+	for _, w := range words {
+		n.Lsh(n, 64)
+		n.Or(n, new(big.Int).SetUint64(w))
+	}
+	return n
+}
+
+// splitWords returns the two's complement of n as count 64-bit words, most
+// significant first. n must already be within range.
+func splitWords(n *big.Int, count int) []uint64 {
+	v := new(big.Int).Set(n)
+	if v.Sign() < 0 {
+		v.Add(v, new(big.Int).Lsh(big.NewInt(1), uint(64*count)))
+	}
+	words := make([]uint64, count)
+	mask := new(big.Int).Sub(two64, big.NewInt(1))
+	for idx := count - 1; idx >= 0; idx-- {
+		words[idx] = new(big.Int).And(v, mask).Uint64()
+		v.Rsh(v, 64)
+	}
+	return words
+}
+
+// parseBig parses a base 10 integer and checks it fits in bits, signed or not
+func parseBig(s string, signed bool, bits uint) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	var lo, hi *big.Int
+	if signed {
+		hi = new(big.Int).Lsh(big.NewInt(1), bits-1)
+		lo = new(big.Int).Neg(hi)
+		hi.Sub(hi, big.NewInt(1))
+	} else {
+		lo = new(big.Int)
+		hi = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	}
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, ErrOutOfRange
+	}
+	return n, nil
+}
@@ -0,0 +1,131 @@
+package scval
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/stellar/go/xdr"
+)
+
+// ToNative converts an ScVal to plain JSON-ready Go values without type
+// tags: 32-bit numbers stay numbers, 64-bit and wider integers become
+// decimal strings so JavaScript clients do not lose precision, bytes become hex, addresses become strkeys and maps become
+// objects keyed by String of each key. The result is meant for reading and
+// filtering; use Encode when the value must round-trip.
+func ToNative(val xdr.ScVal) interface{} {
+	switch val.Type {
+	case xdr.ScValTypeScvBool:
+		return val.MustB()
+	case xdr.ScValTypeScvVoid, xdr.ScValTypeScvLedgerKeyContractInstance:
+		return nil
+	case xdr.ScValTypeScvError:
+		if e, err := encodeError(val.MustError()); err == nil {
+			return e
+		}
+	case xdr.ScValTypeScvU32:
+		return uint32(val.MustU32())
+	case xdr.ScValTypeScvI32:
+		return int32(val.MustI32())
+	case xdr.ScValTypeScvU64:
+		return strconv.FormatUint(uint64(val.MustU64()), 10)
+	case xdr.ScValTypeScvI64:
+		return strconv.FormatInt(int64(val.MustI64()), 10)
+	case xdr.ScValTypeScvTimepoint:
+		return strconv.FormatUint(uint64(val.MustTimepoint()), 10)
+	case xdr.ScValTypeScvDuration:
+		return strconv.FormatUint(uint64(val.MustDuration()), 10)
+	case xdr.ScValTypeScvU128:
+		return U128String(val.MustU128())
+	case xdr.ScValTypeScvI128:
+		return I128String(val.MustI128())
+	case xdr.ScValTypeScvU256:
+		return U256String(val.MustU256())
+	case xdr.ScValTypeScvI256:
+		return I256String(val.MustI256())
+	case xdr.ScValTypeScvBytes:
+		return hex.EncodeToString(val.MustBytes())
+	case xdr.ScValTypeScvString:
+		return string(val.MustStr())
+	case xdr.ScValTypeScvSymbol:
+		return string(val.MustSym())
+	case xdr.ScValTypeScvVec:
+		vec := val.MustVec()
+		if vec == nil {
+			return nil
+		}
+		result := make([]interface{}, len(*vec))
+		for idx, item := range *vec {
+			result[idx] = ToNative(item)
+		}
+		return result
+	case xdr.ScValTypeScvMap:
+		m := val.MustMap()
+		if m == nil {
+			return nil
+		}
+		return nativeMap(*m)
+	case xdr.ScValTypeScvAddress:
+		if addr, err := AddressString(val.MustAddress()); err == nil {
+			return addr
+		}
+	case xdr.ScValTypeScvContractInstance:
+		inst := val.MustInstance()
+		result := map[string]interface{}{"storage": nil}
+		if inst.Executable.Type == xdr.ContractExecutableTypeContractExecutableWasm && inst.Executable.WasmHash != nil {
+			result["executable"] = ContractExecutable{Type: "wasm", Hash: hex.EncodeToString(inst.Executable.WasmHash[:])}
+		} else {
+			result["executable"] = ContractExecutable{Type: "stellar_asset"}
+		}
+		if inst.Storage != nil {
+			result["storage"] = nativeMap(*inst.Storage)
+		}
+		return result
+	case xdr.ScValTypeScvLedgerKeyNonce:
+		return int64(val.MustNonceKey().Nonce)
+	}
+	return rawXDR(val)
+}
+
+// String renders an ScVal as a single string, as stored for event topics.
+// Scalars use their natural text form; vecs, maps and other composites are
+// the JSON encoding of ToNative.
+func String(val xdr.ScVal) string {
+	switch val.Type {
+	case xdr.ScValTypeScvBool:
+		return strconv.FormatBool(val.MustB())
+	case xdr.ScValTypeScvVoid:
+		return TypeVoid
+	case xdr.ScValTypeScvLedgerKeyContractInstance:
+		return TypeLedgerKeyContractInstance
+	case xdr.ScValTypeScvError:
+		if e, err := encodeError(val.MustError()); err == nil {
+			return fmt.Sprintf("%s:%v", e.Type, e.Code)
+		}
+		return rawXDR(val)
+	case xdr.ScValTypeScvVec, xdr.ScValTypeScvMap, xdr.ScValTypeScvContractInstance:
+		data, err := json.Marshal(ToNative(val))
+		if err != nil {
+			return rawXDR(val)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(ToNative(val))
+	}
+}
+
+func nativeMap(m xdr.ScMap) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for _, entry := range m {
+		result[String(entry.Key)] = ToNative(entry.Val)
+	}
+	return result
+}
+
+// rawXDR is the fallback for values that cannot be rendered: the hex of
+// their XDR encoding
+func rawXDR(val xdr.ScVal) string {
+	data, _ := val.MarshalBinary()
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,373 @@
+// Package scval converts Soroban ScVal values to and from JSON.
+//
+// Encode produces a lossless, typed form that Decode turns back into the
+// identical ScVal, so values can be stored or served as JSON and still be
+// re-encoded to XDR. Every value is an object with the ScVal arm in "type"
+// and its payload in "value":
+//
+//	bool                          {"type":"bool","value":true}
+//	void                          {"type":"void"}
+//	u32, i32                      {"type":"u32","value":7}
+//	u64, i64, timepoint, duration {"type":"i64","value":"-42"}
+//	u128, i128, u256, i256        {"type":"i128","value":"170141183460469231731687303715884105727"}
+//	bytes                         {"type":"bytes","value":"deadbeef"}
+//	string                        {"type":"string","value":"hello"} or {"type":"string","value":{"hex":"ff00"}} when not UTF-8
+//	symbol                        {"type":"symbol","value":"transfer"}
+//	vec                           {"type":"vec","value":[<value>, ...]}
+//	map                           {"type":"map","value":[{"key":<value>,"value":<value>}, ...]}
+//	address                       {"type":"address","value":"GABC..."} (G account, C contract, M/B/L where supported)
+//	error                         {"type":"error","value":{"type":"contract","code":3}} or {"type":"error","value":{"type":"budget","code":"exceeded_limit"}}
+//	contract_instance             {"type":"contract_instance","value":{"executable":{"type":"wasm","hash":"<hex>"},"storage":[<map entry>, ...]}}
+//	ledger_key_contract_instance  {"type":"ledger_key_contract_instance"}
+//	ledger_key_nonce              {"type":"ledger_key_nonce","value":"12345"}
+//
+// 64-bit and wider integers are decimal strings so JavaScript clients do not
+// lose precision. A nil vec, map or instance storage has a null value.
+//
+// ToNative gives the compact, readable form stored in contract_events: plain
+// JSON values without type tags, which cannot be decoded back.
+package scval
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+)
+
+// Type names used in Value.Type
+const (
+	TypeBool                      = "bool"
+	TypeVoid                      = "void"
+	TypeError                     = "error"
+	TypeU32                       = "u32"
+	TypeI32                       = "i32"
+	TypeU64                       = "u64"
+	TypeI64                       = "i64"
+	TypeTimepoint                 = "timepoint"
+	TypeDuration                  = "duration"
+	TypeU128                      = "u128"
+	TypeI128                      = "i128"
+	TypeU256                      = "u256"
+	TypeI256                      = "i256"
+	TypeBytes                     = "bytes"
+	TypeString                    = "string"
+	TypeSymbol                    = "symbol"
+	TypeVec                       = "vec"
+	TypeMap                       = "map"
+	TypeAddress                   = "address"
+	TypeContractInstance          = "contract_instance"
+	TypeLedgerKeyContractInstance = "ledger_key_contract_instance"
+	TypeLedgerKeyNonce            = "ledger_key_nonce"
+)
+
+var (
+	// ErrUnsupportedType is returned for ScVal arms or type names this package does not know
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrInvalidValue is returned when a payload does not match its type
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrOutOfRange is returned when an integer does not fit its type
+	ErrOutOfRange = errors.New("integer out of range")
+)
+
+// Error reports which type failed to convert and why. It wraps one of the
+// Err* sentinels or an underlying parse error.
+type Error struct {
+	Op   string // "encode" or "decode"
+	Type string
+	Err  error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("scval: %s %s: %v", e.Op, e.Type, e.Err) }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Value is the typed JSON form of an ScVal
+type Value struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MapEntry is one entry of a map or of contract instance storage
+type MapEntry struct {
+	Key   Value `json:"key"`
+	Value Value `json:"value"`
+}
+
+// ContractExecutable identifies the code behind a contract instance
+type ContractExecutable struct {
+	Type string `json:"type"` // "wasm" or "stellar_asset"
+	Hash string `json:"hash,omitempty"`
+}
+
+// ContractInstance is the payload of a contract_instance value
+type ContractInstance struct {
+	Executable ContractExecutable `json:"executable"`
+	Storage    []MapEntry         `json:"storage"`
+}
+
+// ScError is the payload of an error value. Code is a number for contract
+// errors and a code name for host errors.
+type ScError struct {
+	Type string      `json:"type"`
+	Code interface{} `json:"code"`
+}
+
+type hexString struct {
+	Hex string `json:"hex"`
+}
+
+var errorTypeNames = map[xdr.ScErrorType]string{
+	xdr.ScErrorTypeSceContract: "contract",
+	xdr.ScErrorTypeSceWasmVm:   "wasm_vm",
+	xdr.ScErrorTypeSceContext:  "context",
+	xdr.ScErrorTypeSceStorage:  "storage",
+	xdr.ScErrorTypeSceObject:   "object",
+	xdr.ScErrorTypeSceCrypto:   "crypto",
+	xdr.ScErrorTypeSceEvents:   "events",
+	xdr.ScErrorTypeSceBudget:   "budget",
+	xdr.ScErrorTypeSceValue:    "value",
+	xdr.ScErrorTypeSceAuth:     "auth",
+}
+
+var errorCodeNames = map[xdr.ScErrorCode]string{
+	xdr.ScErrorCodeScecArithDomain:    "arith_domain",
+	xdr.ScErrorCodeScecIndexBounds:    "index_bounds",
+	xdr.ScErrorCodeScecInvalidInput:   "invalid_input",
+	xdr.ScErrorCodeScecMissingValue:   "missing_value",
+	xdr.ScErrorCodeScecExistingValue:  "existing_value",
+	xdr.ScErrorCodeScecExceededLimit:  "exceeded_limit",
+	xdr.ScErrorCodeScecInvalidAction:  "invalid_action",
+	xdr.ScErrorCodeScecInternalError:  "internal_error",
+	xdr.ScErrorCodeScecUnexpectedType: "unexpected_type",
+	xdr.ScErrorCodeScecUnexpectedSize: "unexpected_size",
+}
+
+// MarshalJSON encodes val in the typed JSON form
+func MarshalJSON(val xdr.ScVal) ([]byte, error) {
+	v, err := Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes typed JSON produced by MarshalJSON
+func UnmarshalJSON(data []byte) (xdr.ScVal, error) {
+	var v Value
+	if err := json.Unmarshal(data, &v); err != nil {
+		return xdr.ScVal{}, &Error{Op: "decode", Type: "value", Err: err}
+	}
+	return Decode(v)
+}
+
+// FromXDR decodes a base64 XDR ScVal into the typed JSON form
+func FromXDR(b64 string) (Value, error) {
+	var val xdr.ScVal
+	if err := xdr.SafeUnmarshalBase64(b64, &val); err != nil {
+		return Value{}, &Error{Op: "decode", Type: "xdr", Err: err}
+	}
+	return Encode(val)
+}
+
+// ToXDR converts a typed JSON value back to base64 XDR
+func ToXDR(v Value) (string, error) {
+	val, err := Decode(v)
+	if err != nil {
+		return "", err
+	}
+	return xdr.MarshalBase64(val)
+}
+
+// Encode converts an ScVal to its typed JSON form
+func Encode(val xdr.ScVal) (Value, error) {
+	typ, payload, err := encodePayload(val)
+	if err != nil {
+		return Value{}, err
+	}
+	v := Value{Type: typ}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return Value{}, &Error{Op: "encode", Type: typ, Err: err}
+		}
+		v.Value = raw
+	}
+	return v, nil
+}
+
+// encodePayload returns the type name and the Go value to marshal as its
+// payload; a nil payload omits "value"
+func encodePayload(val xdr.ScVal) (string, interface{}, error) {
+	switch val.Type {
+	case xdr.ScValTypeScvBool:
+		return TypeBool, val.MustB(), nil
+	case xdr.ScValTypeScvVoid:
+		return TypeVoid, nil, nil
+	case xdr.ScValTypeScvError:
+		e, err := encodeError(val.MustError())
+		return TypeError, e, err
+	case xdr.ScValTypeScvU32:
+		return TypeU32, uint32(val.MustU32()), nil
+	case xdr.ScValTypeScvI32:
+		return TypeI32, int32(val.MustI32()), nil
+	case xdr.ScValTypeScvU64:
+		return TypeU64, strconv.FormatUint(uint64(val.MustU64()), 10), nil
+	case xdr.ScValTypeScvI64:
+		return TypeI64, strconv.FormatInt(int64(val.MustI64()), 10), nil
+	case xdr.ScValTypeScvTimepoint:
+		return TypeTimepoint, strconv.FormatUint(uint64(val.MustTimepoint()), 10), nil
+	case xdr.ScValTypeScvDuration:
+		return TypeDuration, strconv.FormatUint(uint64(val.MustDuration()), 10), nil
+	case xdr.ScValTypeScvU128:
+		return TypeU128, U128String(val.MustU128()), nil
+	case xdr.ScValTypeScvI128:
+		return TypeI128, I128String(val.MustI128()), nil
+	case xdr.ScValTypeScvU256:
+		return TypeU256, U256String(val.MustU256()), nil
+	case xdr.ScValTypeScvI256:
+		return TypeI256, I256String(val.MustI256()), nil
+	case xdr.ScValTypeScvBytes:
+		return TypeBytes, hex.EncodeToString(val.MustBytes()), nil
+	case xdr.ScValTypeScvString:
+		s := string(val.MustStr())
+		if !utf8.ValidString(s) {
+			return TypeString, hexString{Hex: hex.EncodeToString([]byte(s))}, nil
+		}
+		return TypeString, s, nil
+	case xdr.ScValTypeScvSymbol:
+		return TypeSymbol, string(val.MustSym()), nil
+	case xdr.ScValTypeScvVec:
+		vec := val.MustVec()
+		if vec == nil {
+			return TypeVec, json.RawMessage("null"), nil
+		}
+		items := make([]Value, len(*vec))
+		for idx, item := range *vec {
+			v, err := Encode(item)
+			if err != nil {
+				return TypeVec, nil, err
+			}
+			items[idx] = v
+		}
+		return TypeVec, items, nil
+	case xdr.ScValTypeScvMap:
+		m := val.MustMap()
+		if m == nil {
+			return TypeMap, json.RawMessage("null"), nil
+		}
+		entries, err := encodeMap(*m)
+		return TypeMap, entries, err
+	case xdr.ScValTypeScvAddress:
+		addr, err := AddressString(val.MustAddress())
+		if err != nil {
+			return TypeAddress, nil, &Error{Op: "encode", Type: TypeAddress, Err: err}
+		}
+		return TypeAddress, addr, nil
+	case xdr.ScValTypeScvContractInstance:
+		inst, err := encodeInstance(val.MustInstance())
+		return TypeContractInstance, inst, err
+	case xdr.ScValTypeScvLedgerKeyContractInstance:
+		return TypeLedgerKeyContractInstance, nil, nil
+	case xdr.ScValTypeScvLedgerKeyNonce:
+		return TypeLedgerKeyNonce, strconv.FormatInt(int64(val.MustNonceKey().Nonce), 10), nil
+	default:
+		return "", nil, &Error{Op: "encode", Type: strconv.Itoa(int(val.Type)), Err: ErrUnsupportedType}
+	}
+}
+
+func encodeMap(m xdr.ScMap) ([]MapEntry, error) {
+	entries := make([]MapEntry, len(m))
+	for idx, entry := range m {
+		key, err := Encode(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := Encode(entry.Val)
+		if err != nil {
+			return nil, err
+		}
+		entries[idx] = MapEntry{Key: key, Value: value}
+	}
+	return entries, nil
+}
+
+func encodeError(e xdr.ScError) (ScError, error) {
+	name, ok := errorTypeNames[e.Type]
+	if !ok {
+		return ScError{}, &Error{Op: "encode", Type: TypeError, Err: ErrUnsupportedType}
+	}
+	if e.Type == xdr.ScErrorTypeSceContract {
+		return ScError{Type: name, Code: uint32(e.MustContractCode())}, nil
+	}
+	code, ok := errorCodeNames[e.MustCode()]
+	if !ok {
+		return ScError{}, &Error{Op: "encode", Type: TypeError, Err: ErrInvalidValue}
+	}
+	return ScError{Type: name, Code: code}, nil
+}
+
+func encodeInstance(inst xdr.ScContractInstance) (ContractInstance, error) {
+	var out ContractInstance
+	switch inst.Executable.Type {
+	case xdr.ContractExecutableTypeContractExecutableWasm:
+		out.Executable = ContractExecutable{Type: "wasm", Hash: hex.EncodeToString(inst.Executable.WasmHash[:])}
+	case xdr.ContractExecutableTypeContractExecutableStellarAsset:
+		out.Executable = ContractExecutable{Type: "stellar_asset"}
+	default:
+		return out, &Error{Op: "encode", Type: TypeContractInstance, Err: ErrUnsupportedType}
+	}
+	if inst.Storage != nil {
+		storage, err := encodeMap(*inst.Storage)
+		if err != nil {
+			return out, err
+		}
+		out.Storage = storage
+	}
+	return out, nil
+}
+
+// AddressString renders an ScAddress as a strkey
+func AddressString(addr xdr.ScAddress) (string, error) {
+	switch addr.Type {
+	case xdr.ScAddressTypeScAddressTypeAccount:
+		account := addr.MustAccountId()
+		return account.GetAddress()
+	case xdr.ScAddressTypeScAddressTypeContract:
+		id := addr.MustContractId()
+		return strkey.Encode(strkey.VersionByteContract, id[:])
+	default:
+		return addr.String()
+	}
+}
+
+// ParseAddress parses a G (account) or C (contract) strkey into an ScAddress
+func ParseAddress(address string) (xdr.ScAddress, error) {
+	version, err := strkey.Version(address)
+	if err != nil {
+		return xdr.ScAddress{}, err
+	}
+	switch version {
+	case strkey.VersionByteAccountID:
+		var account xdr.AccountId
+		if err := account.SetAddress(address); err != nil {
+			return xdr.ScAddress{}, err
+		}
+		return xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeAccount, AccountId: &account}, nil
+	case strkey.VersionByteContract:
+		raw, err := strkey.Decode(strkey.VersionByteContract, address)
+		if err != nil {
+			return xdr.ScAddress{}, err
+		}
+		var id xdr.ContractId
+		copy(id[:], raw)
+		return xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &id}, nil
+	default:
+		return xdr.ScAddress{}, ErrUnsupportedType
+	}
+}
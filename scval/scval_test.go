@@ -0,0 +1,212 @@
+package scval
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func u32(v uint32) *xdr.Uint32 { x := xdr.Uint32(v); return &x }
+
+func sym(s string) xdr.ScVal {
+	v := xdr.ScSymbol(s)
+	return xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &v}
+}
+
+func i128(hi int64, lo uint64) xdr.ScVal {
+	return xdr.ScVal{Type: xdr.ScValTypeScvI128, I128: &xdr.Int128Parts{Hi: xdr.Int64(hi), Lo: xdr.Uint64(lo)}}
+}
+
+func accountAddress(seed byte) xdr.ScVal {
+	var key xdr.Uint256
+	key[0] = seed
+	account := xdr.AccountId{Type: xdr.PublicKeyTypePublicKeyTypeEd25519, Ed25519: &key}
+	return xdr.ScVal{Type: xdr.ScValTypeScvAddress, Address: &xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeAccount, AccountId: &account}}
+}
+
+func contractAddress(seed byte) xdr.ScVal {
+	var id xdr.ContractId
+	id[31] = seed
+	return xdr.ScVal{Type: xdr.ScValTypeScvAddress, Address: &xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &id}}
+}
+
+func TestEncodeShape(t *testing.T) {
+	b := true
+	u64 := xdr.Uint64(18446744073709551615)
+	tp := xdr.TimePoint(1700000000)
+	str := xdr.ScString("hello")
+	bad := xdr.ScString("\xff\x00")
+	raw := xdr.ScBytes{0xde, 0xad}
+	budget := xdr.ScErrorCodeScecExceededLimit
+	nilVec := (*xdr.ScVec)(nil)
+	vec := &xdr.ScVec{sym("a"), i128(0, 1)}
+
+	tests := []struct {
+		name     string
+		val      xdr.ScVal
+		expected string
+	}{
+		{"bool", xdr.ScVal{Type: xdr.ScValTypeScvBool, B: &b}, `{"type":"bool","value":true}`},
+		{"void", xdr.ScVal{Type: xdr.ScValTypeScvVoid}, `{"type":"void"}`},
+		{"u32", xdr.ScVal{Type: xdr.ScValTypeScvU32, U32: u32(7)}, `{"type":"u32","value":7}`},
+		{"u64 max", xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &u64}, `{"type":"u64","value":"18446744073709551615"}`},
+		{"timepoint", xdr.ScVal{Type: xdr.ScValTypeScvTimepoint, Timepoint: &tp}, `{"type":"timepoint","value":"1700000000"}`},
+		{"i128 max", i128(9223372036854775807, 18446744073709551615), `{"type":"i128","value":"170141183460469231731687303715884105727"}`},
+		{"i128 min", i128(-9223372036854775808, 0), `{"type":"i128","value":"-170141183460469231731687303715884105728"}`},
+		{"i128 minus one", i128(-1, 18446744073709551615), `{"type":"i128","value":"-1"}`},
+		{"bytes", xdr.ScVal{Type: xdr.ScValTypeScvBytes, Bytes: &raw}, `{"type":"bytes","value":"dead"}`},
+		{"string", xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &str}, `{"type":"string","value":"hello"}`},
+		{"string not utf8", xdr.ScVal{Type: xdr.ScValTypeScvString, Str: &bad}, `{"type":"string","value":{"hex":"ff00"}}`},
+		{"nil vec", xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &nilVec}, `{"type":"vec","value":null}`},
+		{"vec", xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &vec}, `{"type":"vec","value":[{"type":"symbol","value":"a"},{"type":"i128","value":"1"}]}`},
+		{"contract error", xdr.ScVal{Type: xdr.ScValTypeScvError, Error: &xdr.ScError{Type: xdr.ScErrorTypeSceContract, ContractCode: u32(3)}}, `{"type":"error","value":{"type":"contract","code":3}}`},
+		{"host error", xdr.ScVal{Type: xdr.ScValTypeScvError, Error: &xdr.ScError{Type: xdr.ScErrorTypeSceBudget, Code: &budget}}, `{"type":"error","value":{"type":"budget","code":"exceeded_limit"}}`},
+		{"instance key", xdr.ScVal{Type: xdr.ScValTypeScvLedgerKeyContractInstance}, `{"type":"ledger_key_contract_instance"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalJSON(tt.val)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestAddressStrkeys(t *testing.T) {
+	v, err := Encode(accountAddress(1))
+	require.NoError(t, err)
+	var account string
+	require.NoError(t, json.Unmarshal(v.Value, &account))
+	assert.Equal(t, byte('G'), account[0])
+	version, err := strkey.Version(account)
+	require.NoError(t, err)
+	assert.Equal(t, strkey.VersionByteAccountID, version)
+
+	v, err = Encode(contractAddress(2))
+	require.NoError(t, err)
+	var contract string
+	require.NoError(t, json.Unmarshal(v.Value, &contract))
+	assert.Equal(t, byte('C'), contract[0])
+	assert.Equal(t, contract, ToNative(contractAddress(2)))
+	assert.Equal(t, contract, String(contractAddress(2)))
+}
+
+func TestRoundTrip(t *testing.T) {
+	i32 := xdr.Int32(-5)
+	i64 := xdr.Int64(-9223372036854775808)
+	d := xdr.Duration(60)
+	bad := xdr.ScString("\xc3\x28")
+	contractErr := xdr.ScError{Type: xdr.ScErrorTypeSceContract, ContractCode: u32(12)}
+	authCode := xdr.ScErrorCodeScecInvalidAction
+	hash := xdr.Hash{1, 2, 3}
+	storage := &xdr.ScMap{{Key: sym("admin"), Val: accountAddress(9)}}
+	inner := &xdr.ScVec{i128(-1, 0), contractAddress(4)}
+	m := &xdr.ScMap{
+		{Key: sym("amount"), Val: i128(0, 12345)},
+		{Key: sym("list"), Val: xdr.ScVal{Type: xdr.ScValTypeScvVec, Vec: &inner}},
+	}
+	emptyMap := (*xdr.ScMap)(nil)
+
+	vals := []xdr.ScVal{
+		{Type: xdr.ScValTypeScvI32, I32: &i32},
+		{Type: xdr.ScValTypeScvI64, I64: &i64},
+		{Type: xdr.ScValTypeScvDuration, Duration: &d},
+		{Type: xdr.ScValTypeScvString, Str: &bad},
+		{Type: xdr.ScValTypeScvU128, U128: &xdr.UInt128Parts{Hi: 18446744073709551615, Lo: 18446744073709551615}},
+		{Type: xdr.ScValTypeScvU256, U256: &xdr.UInt256Parts{HiHi: 1, LoLo: 2}},
+		{Type: xdr.ScValTypeScvI256, I256: &xdr.Int256Parts{HiHi: -1, HiLo: 18446744073709551615, LoHi: 18446744073709551615, LoLo: 18446744073709551614}},
+		{Type: xdr.ScValTypeScvI256, I256: &xdr.Int256Parts{HiHi: -9223372036854775808}},
+		{Type: xdr.ScValTypeScvError, Error: &contractErr},
+		{Type: xdr.ScValTypeScvError, Error: &xdr.ScError{Type: xdr.ScErrorTypeSceAuth, Code: &authCode}},
+		{Type: xdr.ScValTypeScvMap, Map: &m},
+		{Type: xdr.ScValTypeScvMap, Map: &emptyMap},
+		{Type: xdr.ScValTypeScvLedgerKeyNonce, NonceKey: &xdr.ScNonceKey{Nonce: -42}},
+		{Type: xdr.ScValTypeScvContractInstance, Instance: &xdr.ScContractInstance{
+			Executable: xdr.ContractExecutable{Type: xdr.ContractExecutableTypeContractExecutableWasm, WasmHash: &hash},
+			Storage:    storage,
+		}},
+		{Type: xdr.ScValTypeScvContractInstance, Instance: &xdr.ScContractInstance{
+			Executable: xdr.ContractExecutable{Type: xdr.ContractExecutableTypeContractExecutableStellarAsset},
+		}},
+		accountAddress(200),
+	}
+
+	for _, val := range vals {
+		data, err := MarshalJSON(val)
+		require.NoError(t, err)
+		decoded, err := UnmarshalJSON(data)
+		require.NoError(t, err, string(data))
+		assert.Equal(t, val, decoded, string(data))
+	}
+
+	b64, err := xdr.MarshalBase64(xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &m})
+	require.NoError(t, err)
+	v, err := FromXDR(b64)
+	require.NoError(t, err)
+	assert.Equal(t, TypeMap, v.Type)
+	back, err := ToXDR(v)
+	require.NoError(t, err)
+	assert.Equal(t, b64, back)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{"unknown type", `{"type":"float","value":1}`, ErrUnsupportedType},
+		{"u32 overflow", `{"type":"u32","value":4294967296}`, ErrOutOfRange},
+		{"i64 overflow", `{"type":"i64","value":"9223372036854775808"}`, ErrOutOfRange},
+		{"u128 negative", `{"type":"u128","value":"-1"}`, ErrOutOfRange},
+		{"i128 overflow", `{"type":"i128","value":"170141183460469231731687303715884105728"}`, ErrOutOfRange},
+		{"i256 not a number", `{"type":"i256","value":"12abc"}`, ErrInvalidValue},
+		{"u64 as number", `{"type":"u64","value":5}`, ErrInvalidValue},
+		{"bad hex", `{"type":"bytes","value":"zz"}`, ErrInvalidValue},
+		{"missing value", `{"type":"bool"}`, ErrInvalidValue},
+		{"nested failure", `{"type":"vec","value":[{"type":"u32","value":-1}]}`, ErrInvalidValue},
+		{"unknown error code", `{"type":"error","value":{"type":"budget","code":"nope"}}`, ErrInvalidValue},
+		{"muxed address", `{"type":"address","value":"MAAAAAAAAAAAAAB7BQ2L7E5NBWMXDUCMZSIPOBKRDSBYVLMXGSSKF6YNPIB7Y77ITLVL6"}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UnmarshalJSON([]byte(tt.input))
+			require.Error(t, err)
+			var scErr *Error
+			assert.True(t, errors.As(err, &scErr))
+			assert.Equal(t, "decode", scErr.Op)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToNativeAndString(t *testing.T) {
+	m := &xdr.ScMap{
+		{Key: sym("amount"), Val: i128(0, 1000)},
+		{Key: sym("to"), Val: contractAddress(1)},
+	}
+	val := xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &m}
+
+	native, ok := ToNative(val).(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "1000", native["amount"])
+	// 64-bit integers are strings too, beyond what a JSON number holds
+	u64 := xdr.Uint64(18446744073709551615)
+	assert.Equal(t, "18446744073709551615", ToNative(xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &u64}))
+	tp := xdr.TimePoint(1700000000)
+	assert.Equal(t, "1700000000", ToNative(xdr.ScVal{Type: xdr.ScValTypeScvTimepoint, Timepoint: &tp}))
+
+	assert.Equal(t, "-170141183460469231731687303715884105728", String(i128(-9223372036854775808, 0)))
+	assert.Equal(t, "void", String(xdr.ScVal{Type: xdr.ScValTypeScvVoid}))
+	assert.Equal(t, "contract:7", String(xdr.ScVal{Type: xdr.ScValTypeScvError, Error: &xdr.ScError{Type: xdr.ScErrorTypeSceContract, ContractCode: u32(7)}}))
+	assert.JSONEq(t, `{"amount":"1000","to":"`+native["to"].(string)+`"}`, String(val))
+}
@@ -8,13 +8,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// AllowedOrigins are the browser origins allowed by CORS and by the
+// WebSocket endpoints
+var AllowedOrigins = []string{"http://localhost:3000", "http://localhost:5173"}
+
 func NewRouter(ingesterController *controllers.IngesterController) *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(gin.Logger())
 
 	cfg := cors.DefaultConfig()
-	cfg.AllowOrigins = []string{"http://localhost:3000", "http://localhost:5173"}
+	cfg.AllowOrigins = AllowedOrigins
 	cfg.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	cfg.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
 	cfg.AllowCredentials = true
@@ -23,5 +27,9 @@ func NewRouter(ingesterController *controllers.IngesterController) *gin.Engine {
 
 	ingesterController.RegisterRoutes(r)
 
+	graphql := gin.WrapH(ingesterController.GraphQL())
+	r.GET("/graphql", graphql)
+	r.POST("/graphql", graphql)
+
 	return r
 }